@@ -0,0 +1,186 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+type IAdminApp interface {
+	ReprocessTags(ctx context.Context, unionUserID string) (*ReprocessResult, error)
+	NotionWritesEnabled(ctx context.Context) bool
+	SetNotionWrites(ctx context.Context, enabled bool) error
+	SetCapture(ctx context.Context, unionUserID, capture string) error
+	MemoQueue(ctx context.Context) (*MemoQueueSummary, error)
+}
+
+type ReprocessResult struct {
+	Total   int `json:"total"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+// MemoQueueSummary counts the memos not saved yet, of all accounts
+type MemoQueueSummary struct {
+	// queued, never tried
+	Pending int `json:"pending"`
+	// failed, left to the pending worker to retry
+	Retrying int `json:"retrying"`
+	// failed for good
+	Dead int `json:"dead"`
+	// error category => number of retrying and dead memos
+	Errors map[string]int `json:"errors"`
+}
+
+// MemoTagger resolves the tags a memo was tagged with besides those of its
+// content, e.g. the tag of its chat
+type MemoTagger interface {
+	MemoTags(ctx context.Context, bindInfo *entity.BindInfo, memo *entity.Memo) []string
+}
+
+type adminApp struct {
+	bindRepo  repository.BindInfoRepository
+	memoRepo  repository.MemoRepository
+	notionCli *notion.NotionClient
+	// nil if memos have the tags of their content only
+	tagger MemoTagger
+	// global kill-switch of notion writes
+	notionWrites *notionWriteSwitch
+}
+
+var _ IAdminApp = &adminApp{}
+
+func NewAdminApp(bind repository.BindInfoRepository, memo repository.MemoRepository,
+	flag repository.FlagRepository, tagger MemoTagger, opt Option) *adminApp {
+	return &adminApp{
+		bindRepo:     bind,
+		memoRepo:     memo,
+		notionCli:    notion.NewNotionClient(opt.Notion),
+		tagger:       tagger,
+		notionWrites: newNotionWriteSwitch(flag),
+	}
+}
+
+func (app *adminApp) NotionWritesEnabled(ctx context.Context) bool {
+	return app.notionWrites.Enabled(ctx)
+}
+
+// SetNotionWrites flips the global switch of notion writes. While it's off
+// memos are queued, and they are written by the pending worker once it's on.
+func (app *adminApp) SetNotionWrites(ctx context.Context, enabled bool) error {
+	return app.notionWrites.Set(ctx, enabled)
+}
+
+// SetCapture turns capture of the binding of unionUserID on, off or to
+// queue, the same as `/set capture` by the user.
+func (app *adminApp) SetCapture(ctx context.Context, unionUserID, capture string) error {
+	_, err := app.bindRepo.UpdateSettings(ctx, unionUserID, func(s *entity.BindSettings) error {
+		return ApplySetting(s, "capture", capture)
+	})
+	return err
+}
+
+// ReprocessTags rescans the stored memos of a user and patches the Tags
+// property of all the notion pages created for them, counted by page.
+func (app *adminApp) ReprocessTags(ctx context.Context, unionUserID string) (*ReprocessResult, error) {
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, unionUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entity.BindPlatformType(bindInfo.BindPlatform) != entity.BindPlatformTypeNotion {
+		return nil, fmt.Errorf("only notion binding has tags. platform=%d", bindInfo.BindPlatform)
+	}
+
+	var pageInfo entity.NotionPageInfo
+	if err := json.Unmarshal([]byte(bindInfo.PageInfo), &pageInfo); err != nil {
+		return nil, err
+	}
+
+	memos, err := app.memoRepo.ListMemos(ctx, unionUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var res ReprocessResult
+	for i := range memos {
+		memo := &memos[i]
+		pages := memo.Pages()
+		if len(pages) == 0 || entity.BindPlatformType(memo.BindPlatform) != entity.BindPlatformTypeNotion {
+			continue
+		}
+
+		var extra []string
+		if app.tagger != nil {
+			extra = app.tagger.MemoTags(ctx, bindInfo, memo)
+		}
+		for _, pageID := range pages {
+			res.Total++
+			if err := app.notionCli.UpdatePageTags(pageInfo.NotionSecretKey, pageID, memo.Content, extra); err != nil {
+				log.Errorf("failed to update tags of memo %d. page=%s, err=%v", memo.ID, pageID, err)
+				res.Failed++
+				continue
+			}
+			res.Updated++
+		}
+	}
+
+	return &res, nil
+}
+
+// MemoQueue summarizes the pending and failed memos by their errors
+func (app *adminApp) MemoQueue(ctx context.Context) (*MemoQueueSummary, error) {
+	counts, err := app.memoRepo.CountMemosByError(ctx, entity.MemoStatusPending, entity.MemoStatusProcessing, entity.MemoStatusFailed)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := MemoQueueSummary{Errors: make(map[string]int)}
+	for _, c := range counts {
+		switch {
+		case entity.MemoStatusType(c.Status) == entity.MemoStatusFailed:
+			summary.Dead += c.Count
+		case c.LastError == "":
+			summary.Pending += c.Count
+			continue
+		default:
+			summary.Retrying += c.Count
+		}
+		summary.Errors[errorCategory(c.LastError)] += c.Count
+	}
+
+	return &summary, nil
+}
+
+// the status code in the error of a notion api call, see notion.APIError
+var notionStatusRegexp = regexp.MustCompile(`code=(\d{3}), status=`)
+
+// errorCategory groups the last errors of memos: notion_<status code> for
+// notion api errors, timeout, network or other.
+func errorCategory(lastError string) string {
+	if m := notionStatusRegexp.FindStringSubmatch(lastError); m != nil {
+		if code, _ := strconv.Atoi(m[1]); code >= 500 {
+			return "notion_5xx"
+		}
+		return "notion_" + m[1]
+	}
+
+	lower := strings.ToLower(lastError)
+	switch {
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(lower, "dial tcp") || strings.Contains(lower, "connection refused") ||
+		strings.Contains(lower, "connection reset") || strings.Contains(lower, "no such host"):
+		return "network"
+	}
+	return "other"
+}
@@ -0,0 +1,159 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestReprocessTags(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPatch, "/pages/page_fail", http.StatusBadGateway, "{}")
+
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{
+		NotionTheme:     "gallery",
+		NotionSecretKey: "secret",
+		NotionPageID:    "db_xxx",
+	})
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	}
+
+	memoRepo := &fakeMemoRepo{}
+	memos := []entity.Memo{
+		{UnionUserID: "lark_xxx", PageID: "page_1", Content: "#科技 只是一条科技#美食 memo"},
+		{UnionUserID: "lark_xxx", PageID: "page_2", Content: "这是一条没有标签的memo"},
+		{UnionUserID: "lark_xxx", PageID: "page_fail", Content: "#科技 失败"},
+		// flat theme memo has no page
+		{UnionUserID: "lark_xxx", Content: "#科技 flat"},
+		{UnionUserID: "lark_yyy", PageID: "page_3", Content: "#科技 other user"},
+	}
+	for i := range memos {
+		memos[i].BindPlatform = uint8(entity.BindPlatformTypeNotion)
+		memoRepo.Create(context.TODO(), &memos[i])
+	}
+
+	app := NewAdminApp(newFakeBindInfoRepo(bind), memoRepo, nil, nil,
+		Option{Notion: notion.ClientOption{BaseURI: n.URL}})
+	res, err := app.ReprocessTags(context.TODO(), "lark_xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ReprocessResult{Total: 3, Updated: 2, Failed: 1}
+	if *res != expected {
+		t.Fatalf("expected: %+v, got: %+v", expected, *res)
+	}
+
+	patches := map[string]string{
+		"/pages/page_1":    `{"properties":{"Tags":{"type":"multi_select","multi_select":[{"name":"科技"},{"name":"美食"}]}}}`,
+		"/pages/page_2":    `{"properties":{"Tags":{"type":"multi_select","multi_select":[]}}}`,
+		"/pages/page_fail": `{"properties":{"Tags":{"type":"multi_select","multi_select":[{"name":"科技"}]}}}`,
+	}
+	reqs := n.Requests()
+	if len(reqs) != len(patches) {
+		t.Fatalf("expected %d requests, got %+v", len(patches), reqs)
+	}
+	for _, req := range reqs {
+		if req.Method != http.MethodPatch || patches[req.Path] != req.Body {
+			t.Fatalf("unexpected request %+v", req)
+		}
+	}
+}
+
+func TestReprocessTagsAllPages(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.ReplyMatching(http.MethodPost, "/pages", `"database_id":"db_ideas"`, http.StatusOK, `{"object": "page", "id": "page_ideas"}`)
+	n.ReplyMatching(http.MethodPost, "/pages", `"database_id":"db_projx"`, http.StatusOK, `{"object": "page", "id": "page_projx"}`)
+
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	for _, kv := range [][2]string{{"tag_route", "ideas db_ideas"}, {"tag_route", "projx db_projx"}, {"multi_route", "on"}, {"chat_tag", "on"}} {
+		if err := ApplySetting(&settings, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bind.SetSettings(&settings)
+	memoRepo := &fakeMemoRepo{}
+	opt := Option{Notion: notion.ClientOption{BaseURI: n.URL}}
+	larkApp := newTestLarkApp(memoRepo, opt, bind)
+	larkApp.handlers[entity.BindPlatformTypeNotion] = larkApp.handleNotionAppend
+	larkApp.messenger = &fakeLarkMessenger{chatNames: map[string]string{"oc_xxx": "产品讨论群"}}
+
+	if err := larkApp.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "#ideas #projx 新的交互方案")); err != nil {
+		t.Fatal(err)
+	}
+	if len(memoRepo.memos) != 1 || !reflect.DeepEqual(memoRepo.memos[0].Pages(), []string{"page_ideas", "page_projx"}) {
+		t.Fatalf("expected both pages kept, got %+v", memoRepo.memos)
+	}
+
+	app := NewAdminApp(larkApp.bindRepo, memoRepo, nil, larkApp, opt)
+	res, err := app.ReprocessTags(context.TODO(), "lark_xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (ReprocessResult{Total: 2, Updated: 2}); *res != expected {
+		t.Fatalf("expected: %+v, got: %+v", expected, *res)
+	}
+
+	// the chat tag is kept
+	tags := `{"properties":{"Tags":{"type":"multi_select","multi_select":[{"name":"ideas"},{"name":"projx"},{"name":"产品讨论群"}]}}}`
+	patched := make(map[string]string)
+	for _, req := range n.Requests() {
+		if req.Method == http.MethodPatch {
+			patched[req.Path] = req.Body
+		}
+	}
+	if len(patched) != 2 || patched["/pages/page_ideas"] != tags || patched["/pages/page_projx"] != tags {
+		t.Fatalf("expected both pages patched with %s, got %+v", tags, patched)
+	}
+}
+
+func TestReprocessTagsNotNotion(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeLarkDoc),
+	}
+
+	app := NewAdminApp(newFakeBindInfoRepo(bind), &fakeMemoRepo{}, nil, nil, Option{})
+	if _, err := app.ReprocessTags(context.TODO(), "lark_xxx"); err == nil {
+		t.Fatal("expected error for lark doc binding")
+	}
+}
+
+func TestMemoQueue(t *testing.T) {
+	pending, failed := uint8(entity.MemoStatusPending), uint8(entity.MemoStatusFailed)
+	memoRepo := &fakeMemoRepo{memos: []entity.Memo{
+		{UnionUserID: "lark_xxx", Status: pending},
+		{UnionUserID: "lark_xxx", Status: pending, LastError: "code=502, status=502 Bad Gateway, body="},
+		{UnionUserID: "lark_yyy", Status: pending, LastError: "code=503, status=503 Service Unavailable, body="},
+		{UnionUserID: "lark_yyy", Status: failed, LastError: "code=429, status=429 Too Many Requests, body="},
+		{UnionUserID: "lark_zzz", Status: failed, LastError: `Post "https://api.notion.com/v1/pages": context deadline exceeded`},
+		{UnionUserID: "lark_zzz", Status: failed, LastError: "invalid theme list"},
+		{UnionUserID: "lark_zzz", Status: uint8(entity.MemoStatusSaved)},
+	}}
+	app := NewAdminApp(newFakeBindInfoRepo(), memoRepo, nil, nil, Option{})
+
+	summary, err := app.MemoQueue(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MemoQueueSummary{
+		Pending:  1,
+		Retrying: 2,
+		Dead:     3,
+		Errors:   map[string]int{"notion_5xx": 2, "notion_429": 1, "timeout": 1, "other": 1},
+	}
+	if !reflect.DeepEqual(*summary, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, *summary)
+	}
+}
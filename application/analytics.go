@@ -0,0 +1,41 @@
+package application
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+// newMemoAnalytics builds the anonymized row of a memo. The content is kept
+// as a keyed hash only, so short memos can't be recovered by brute force
+// without the salt.
+func newMemoAnalytics(salt, content string, platform uint8, status entity.MemoStatusType) *entity.MemoAnalytics {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(content))
+
+	// tag set, deduplicated and ordered
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, tag := range utils.RetriveTags(content) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	data, _ := json.Marshal(tags)
+
+	return &entity.MemoAnalytics{
+		ContentHash:  hex.EncodeToString(mac.Sum(nil)),
+		Length:       utf8.RuneCountInString(content),
+		Tags:         string(data),
+		BindPlatform: platform,
+		Status:       uint8(status),
+	}
+}
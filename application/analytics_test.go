@@ -0,0 +1,49 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestMemoAnalytics(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	content := "#科技 technology #life change our life #科技"
+
+	analyticsRepo := &fakeAnalyticsRepo{}
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{MemoAnalytics: true, AnalyticsSalt: "salt"}, bind)
+	app.analyticsRepo = analyticsRepo
+	app.analytics = true
+	if _, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{}, newTestLarkEvent("xxx", content), content); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(analyticsRepo.rows) != 1 {
+		t.Fatalf("expected 1 analytics row, got %d", len(analyticsRepo.rows))
+	}
+	row := analyticsRepo.rows[0]
+	if row.Length != len([]rune(content)) || row.Tags != `["life","科技"]` ||
+		row.Status != uint8(entity.MemoStatusSaved) || len(row.ContentHash) != 64 {
+		t.Fatalf("unexpected analytics %+v", row)
+	}
+
+	data, _ := json.Marshal(&row)
+	for _, word := range strings.Fields("technology change our") {
+		if strings.Contains(string(data), word) {
+			t.Fatalf("analytics row contains raw content: %s", data)
+		}
+	}
+
+	// the hash depends on the salt
+	other := newMemoAnalytics("other", content, bind.BindPlatform, entity.MemoStatusSaved)
+	same := newMemoAnalytics("salt", content, bind.BindPlatform, entity.MemoStatusSaved)
+	if other.ContentHash == row.ContentHash || same.ContentHash != row.ContentHash {
+		t.Fatalf("unexpected content hash %s, %s", other.ContentHash, same.ContentHash)
+	}
+}
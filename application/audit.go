@@ -0,0 +1,55 @@
+package application
+
+import (
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/audit"
+)
+
+// AuditSink keeps the audit trail of captured memos apart from the logs
+// and the memo table, e.g. audit.FileSink.
+type AuditSink interface {
+	Append(r *audit.Record) error
+}
+
+var memoStatusNames = map[entity.MemoStatusType]string{
+	entity.MemoStatusSaved:      "saved",
+	entity.MemoStatusFailed:     "failed",
+	entity.MemoStatusPending:    "pending",
+	entity.MemoStatusProcessing: "processing",
+}
+
+// memoDestination is where memo went: the platform of the binding, and
+// the page created for it if any
+func memoDestination(memo *entity.Memo) string {
+	dest := "notion"
+	if entity.BindPlatformType(memo.BindPlatform) == entity.BindPlatformTypeLarkDoc {
+		dest = "larkdoc"
+	}
+	if memo.PageID != "" {
+		dest += ":" + memo.PageID
+	}
+	return dest
+}
+
+// auditMemo appends memo to the audit trail if there's a sink. Memos are
+// handled whether it's written or not.
+func (app *larkMessageHandleApp) auditMemo(memo *entity.Memo) {
+	if app.auditSink == nil {
+		return
+	}
+
+	record := &audit.Record{
+		Time:        app.clock.Now(),
+		UnionUserID: memo.UnionUserID,
+		Platform:    "lark",
+		MessageID:   memo.MessageID,
+		ContentHash: audit.ContentHash(memo.Content),
+		Destination: memoDestination(memo),
+		Status:      memoStatusNames[entity.MemoStatusType(memo.Status)],
+	}
+	if err := app.auditSink.Append(record); err != nil {
+		log.Errorf("failed to audit memo %s of %s. err=%v", memo.MessageID, memo.UnionUserID, err)
+	}
+}
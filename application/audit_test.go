@@ -0,0 +1,51 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/KDF5000/nomo/infrastructure/audit"
+)
+
+type fakeAuditSink struct {
+	records []*audit.Record
+	err     error
+}
+
+func (s *fakeAuditSink) Append(r *audit.Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func TestAuditMemo(t *testing.T) {
+	sink := &fakeAuditSink{}
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{AuditSink: sink}, newTestNotionBind("gallery"))
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "#科技 notes")); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("expected a record, got %+v", sink.records)
+	}
+	r := sink.records[0]
+	if r.UnionUserID != "lark_xxx" || r.MessageID != "om_xxx" || r.ContentHash != audit.ContentHash("#科技 notes") ||
+		r.Destination != "notion:page_xxx" || r.Status != "saved" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	// the memo is saved anyway
+	sink.err = errors.New("disk full")
+	event := newTestLarkEvent("xxx", "more notes")
+	event.Header.EventID = "event_yyy"
+	if err := app.ProcessMessage(context.TODO(), event); err != nil {
+		t.Fatal(err)
+	}
+	if len(memoRepo.memos) != 2 {
+		t.Fatalf("expected 2 memos, got %+v", memoRepo.memos)
+	}
+}
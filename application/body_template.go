@@ -0,0 +1,79 @@
+package application
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+// bodyTemplateData are the fields of body templates, e.g.
+// `Captured: {{.Time.Format "2006-01-02 15:04"}}\n\n{{.Content}}\n\nTags: {{join .Tags ", "}}`
+type bodyTemplateData struct {
+	Content string
+	// scanned from the content, with the chat tag if on
+	Tags []string
+	// when the memo was sent
+	Time time.Time
+	// name of the source chat
+	Source   string
+	Platform string
+}
+
+var bodyTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// parseBodyTemplate parses text and tries it on a sample memo, so that
+// the wrong fields are found when it's set rather than on memos.
+func parseBodyTemplate(text string) (*template.Template, error) {
+	tmpl, err := newBodyTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := bodyTemplateData{
+		Content:  "#nomo sample",
+		Tags:     []string{"nomo"},
+		Time:     time.Now(),
+		Source:   "chat",
+		Platform: "lark",
+	}
+	if err := tmpl.Execute(ioutil.Discard, &sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func newBodyTemplate(text string) (*template.Template, error) {
+	return template.New("body").Funcs(bodyTemplateFuncs).Parse(text)
+}
+
+// scanTags are the tags of content, in the order they appear, split on
+// any rune of separators and cased by tagCase
+func scanTags(content, separators, tagCase string) []string {
+	var tags []string
+	for _, elem := range utils.ScanContent(content) {
+		if elem.IsTag {
+			tags = append(tags, elem.Text[1:])
+		}
+	}
+	return utils.NormalizeTagCase(utils.SplitTags(tags, separators), tagCase)
+}
+
+// renderBody is the body of the page for data.Content
+func renderBody(text string, data *bodyTemplateData) (string, error) {
+	tmpl, err := newBodyTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid body template, %v", err)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
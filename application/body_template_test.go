@@ -0,0 +1,119 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestRenderBody(t *testing.T) {
+	data := bodyTemplateData{
+		Content:  "#科技 #go nomo",
+		Tags:     scanTags("#科技 #go nomo", "", ""),
+		Time:     time.Date(2022, 4, 15, 5, 20, 0, 0, time.UTC),
+		Source:   "产品讨论群",
+		Platform: "lark",
+	}
+
+	cases := []struct {
+		Template string
+		Expected string
+	}{
+		{Template: "{{.Content}}", Expected: "#科技 #go nomo"},
+		{
+			Template: "Captured: {{.Time.Format \"2006-01-02 15:04\"}}\n\n{{.Content}}\n\nTags: {{join .Tags \", \"}}",
+			Expected: "Captured: 2022-04-15 05:20\n\n#科技 #go nomo\n\nTags: 科技, go",
+		},
+		{Template: "{{.Source}} via {{.Platform}}", Expected: "产品讨论群 via lark"},
+	}
+	for _, tc := range cases {
+		body, err := renderBody(tc.Template, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != tc.Expected {
+			t.Fatalf("template: %s, expected %q, got %q", tc.Template, tc.Expected, body)
+		}
+	}
+}
+
+func TestSetBodyTemplate(t *testing.T) {
+	var s entity.BindSettings
+	for _, value := range []string{"{{.Content", "{{.Contents}}", "{{upper .Content}}"} {
+		if err := ApplySetting(&s, "body_template", value); err == nil {
+			t.Fatalf("expected invalid template %s", value)
+		}
+	}
+	if s.BodyTemplate != "" {
+		t.Fatalf("expected template not set, got %s", s.BodyTemplate)
+	}
+
+	// the template keeps its lines
+	bindRepo := newFakeBindInfoRepo(entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	})
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	app.bindRepo = bindRepo
+
+	event := newTestLarkEvent("xxx", "/set body_template {{.Content}}\n\nTags: {{join .Tags \", \"}}")
+	if err := app.ProcessMessage(context.TODO(), event); err != nil {
+		t.Fatal(err)
+	}
+	bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ := bind.GetSettings()
+	if expected := "{{.Content}}\n\nTags: {{join .Tags \", \"}}"; settings.BodyTemplate != expected {
+		t.Fatalf("expected template %q, got %q", expected, settings.BodyTemplate)
+	}
+
+	if err := ApplySetting(&settings, "body_template", "off"); err != nil || settings.BodyTemplate != "" {
+		t.Fatalf("expected template cleared, got %q, err: %v", settings.BodyTemplate, err)
+	}
+}
+
+func TestBodyTemplatePage(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{
+		NotionTheme:     "gallery",
+		NotionSecretKey: "secret",
+		NotionPageID:    "db_xxx",
+	})
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	}
+	bind.SetSettings(&entity.BindSettings{BodyTemplate: "From {{.Source}}: {{.Content}}"})
+
+	opt := Option{Notion: notion.ClientOption{BaseURI: n.URL, TitleMaxLength: 20}}
+	app := newTestLarkApp(&fakeMemoRepo{}, opt, bind)
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+	app.messenger = &fakeLarkMessenger{chatNames: map[string]string{"oc_xxx": "产品讨论群"}}
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "#科技 nomo")); err != nil {
+		t.Fatal(err)
+	}
+
+	var page string
+	for _, req := range n.Requests() {
+		if req.Method == http.MethodPost && req.Path == "/pages" {
+			page = req.Body
+		}
+	}
+	if !strings.Contains(page, `"content":"From 产品讨论群: "`) {
+		t.Fatalf("expected rendered body, got %s", page)
+	}
+	// the tags are of the content
+	if !strings.Contains(page, `"name":"科技"`) {
+		t.Fatalf("expected tags of the content, got %s", page)
+	}
+}
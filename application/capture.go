@@ -0,0 +1,49 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+var (
+	// ErrCapturePaused is returned when a memo is dropped because
+	// capture of the binding is off
+	ErrCapturePaused = errors.New("capture is paused")
+	// ErrCaptureQueued is returned when a memo is queued until capture
+	// of the binding is on again
+	ErrCaptureQueued = errors.New("capture is paused, memo queued")
+	// ErrMemoTooShort is returned when a memo without tags is dropped for
+	// being shorter than the min length of the binding
+	ErrMemoTooShort = errors.New("memo is too short")
+)
+
+// capturePaused reports whether capture of the binding of unionUserID is
+// paused, the queued memos are kept pending then.
+func (app *larkMessageHandleApp) capturePaused(ctx context.Context, unionUserID string) bool {
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, unionUserID)
+	if err != nil {
+		// left to the writes to fail
+		return false
+	}
+
+	settings, err := bindInfo.GetSettings()
+	if err != nil {
+		log.Warnf("invalid settings of %s, %v", unionUserID, err)
+	}
+	return settings.CapturePaused()
+}
+
+// tooShort reports whether content is shorter than the min length of s,
+// a memo with tags is saved anyway.
+func (app *larkMessageHandleApp) tooShort(s *entity.BindSettings, content string) bool {
+	if s.MinLength <= 0 || utf8.RuneCountInString(strings.TrimSpace(content)) >= s.MinLength {
+		return false
+	}
+	return len(scanTags(content, app.tagSeparators, app.tagCase)) == 0
+}
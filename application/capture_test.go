@@ -0,0 +1,133 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestCapturePaused(t *testing.T) {
+	for _, capture := range []string{entity.CaptureOff, entity.CaptureQueue} {
+		bindRepo := newFakeBindInfoRepo(entity.BindInfo{
+			UnionUserID:  "lark_xxx",
+			BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		})
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{})
+		app.bindRepo = bindRepo
+		writes := 0
+		app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+			writes++
+			return appendResult{PageID: "page_xxx", Pages: 1}, nil
+		}
+		send := func(i int, text string) {
+			event := newTestLarkEvent("xxx", text)
+			event.Header.EventID = fmt.Sprintf("event_%d", i)
+			if err := app.ProcessMessage(context.TODO(), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		send(0, "/set capture "+capture)
+		send(1, "paused memo")
+		if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		if writes != 0 {
+			t.Fatalf("capture: %s, expected nothing written while paused, got %d", capture, writes)
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if len(replies) != 2 || replies[1].Msg == "已保存，可以前往Notion页面查看~" {
+			t.Fatalf("capture: %s, expected paused reply, got %+v", capture, replies)
+		}
+
+		queued := capture == entity.CaptureQueue
+		if queued != (len(memoRepo.memos) == 1) {
+			t.Fatalf("capture: %s, unexpected memos %+v", capture, memoRepo.memos)
+		}
+
+		// resumed, the queued memo is saved by the pending worker
+		send(2, "/set capture on")
+		send(3, "new memo")
+		if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := 1
+		if queued {
+			expected = 2
+		}
+		if writes != expected || len(memoRepo.memos) != expected {
+			t.Fatalf("capture: %s, expected %d memos written, got %d, %+v", capture, expected, writes, memoRepo.memos)
+		}
+		for _, memo := range memoRepo.memos {
+			if memo.Status != uint8(entity.MemoStatusSaved) {
+				t.Fatalf("capture: %s, unexpected memo %+v", capture, memo)
+			}
+		}
+	}
+}
+
+func TestSetCapture(t *testing.T) {
+	bindRepo := newFakeBindInfoRepo(entity.BindInfo{UnionUserID: "lark_xxx"})
+	app := NewAdminApp(bindRepo, &fakeMemoRepo{}, nil, nil, Option{})
+
+	if err := app.SetCapture(context.TODO(), "lark_xxx", entity.CaptureOff); err != nil {
+		t.Fatal(err)
+	}
+	bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if settings, _ := bind.GetSettings(); !settings.CapturePaused() {
+		t.Fatalf("expected capture paused, got %+v", settings)
+	}
+
+	if err := app.SetCapture(context.TODO(), "lark_xxx", "pause"); err == nil {
+		t.Fatal("expected invalid capture")
+	}
+	if err := app.SetCapture(context.TODO(), "lark_yyy", entity.CaptureOn); err == nil {
+		t.Fatal("expected error of unknown binding")
+	}
+}
+
+func TestMinLength(t *testing.T) {
+	cases := []struct {
+		MinLength string
+		Content   string
+		Saved     bool
+	}{
+		{MinLength: "3", Content: "k", Saved: false},
+		{MinLength: "3", Content: " 好 ", Saved: false},
+		// tags save it anyway
+		{MinLength: "10", Content: "#todo", Saved: true},
+		{MinLength: "3", Content: "买牛奶", Saved: true},
+		{MinLength: "off", Content: "k", Saved: true},
+	}
+	for i, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		if err := ApplySetting(&settings, "min_length", tc.MinLength); err != nil {
+			t.Fatal(err)
+		}
+		bind.SetSettings(&settings)
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{}, bind)
+
+		event := newTestLarkEvent("xxx", tc.Content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if tc.Saved != (len(memoRepo.memos) == 1) || len(replies) != 1 ||
+			tc.Saved != (replies[0].Msg == "已保存，可以前往Notion页面查看~") {
+			t.Fatalf("min length: %s, content: %q, expected saved %v, got %+v, %+v",
+				tc.MinLength, tc.Content, tc.Saved, memoRepo.memos, replies)
+		}
+	}
+
+	var s entity.BindSettings
+	if err := ApplySetting(&s, "min_length", "-1"); err == nil {
+		t.Fatal("expected invalid min_length")
+	}
+}
@@ -0,0 +1,120 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+)
+
+const budgetMonthLayout = "2006-01"
+
+// ErrCharBudgetReached is returned when a memo is dropped because it
+// doesn't fit in what's left of the monthly character budget of the binding
+var ErrCharBudgetReached = errors.New("monthly character budget reached")
+
+// charsThisMonth is the count of the characters written by the binding in
+// the month of now in the user's timezone, starting over each month.
+func (app *larkMessageHandleApp) charsThisMonth(s *entity.BindSettings) entity.MonthCount {
+	month := app.clock.Now().In(location(s)).Format(budgetMonthLayout)
+	if s.CharsThisMonth == nil || s.CharsThisMonth.Month != month {
+		return entity.MonthCount{Month: month}
+	}
+	return *s.CharsThisMonth
+}
+
+// charBudgetOf is the monthly character budget of bind, the server's unless
+// the binding has its own
+func (app *larkMessageHandleApp) charBudgetOf(bind *entity.BindInfo) int {
+	if settings, err := bind.GetSettings(); err == nil && settings.CharBudget != nil {
+		return *settings.CharBudget
+	}
+	return app.charBudget
+}
+
+// checkCharBudget fails with ErrCharBudgetReached if content would take
+// the binding over the budget this month, the admin is told the first
+// time of the month. It fails too if the characters can't be counted.
+// Otherwise content is counted right away, so that concurrent memos can't
+// all pass, and given back by releaseChars if it isn't written.
+func (app *larkMessageHandleApp) checkCharBudget(ctx context.Context, bind *entity.BindInfo, content string) error {
+	budget := app.charBudgetOf(bind)
+	if budget <= 0 {
+		return nil
+	}
+
+	chars := utf8.RuneCountInString(content)
+	var reached, notify bool
+	var count entity.MonthCount
+	_, err := app.bindRepo.UpdateSettings(ctx, bind.UnionUserID, func(s *entity.BindSettings) error {
+		count = app.charsThisMonth(s)
+		reached, notify = count.Chars+chars > budget, false
+		if reached {
+			if count.Notified {
+				return repository.ErrSettingsUnchanged
+			}
+			count.Notified, notify = true, true
+		} else {
+			count.Chars += chars
+		}
+		s.CharsThisMonth = &count
+		return nil
+	})
+	if err != nil {
+		// rejected rather than written past the budget
+		return fmt.Errorf("failed to count characters of this month, %v", err)
+	}
+
+	if notify {
+		app.larkNotify(fmt.Sprintf("%s reached the monthly budget of %d characters in %s with %d written, later memos over it are rejected",
+			bind.UnionUserID, budget, count.Month, count.Chars))
+	}
+	if reached {
+		return ErrCharBudgetReached
+	}
+	return nil
+}
+
+// releaseChars gives content counted by checkCharBudget back to the budget
+// when it isn't written
+func (app *larkMessageHandleApp) releaseChars(ctx context.Context, bind *entity.BindInfo, content string) {
+	if app.charBudgetOf(bind) <= 0 {
+		return
+	}
+
+	_, err := app.bindRepo.UpdateSettings(ctx, bind.UnionUserID, func(s *entity.BindSettings) error {
+		count := app.charsThisMonth(s)
+		count.Chars -= utf8.RuneCountInString(content)
+		// the month may be over since counted
+		if count.Chars < 0 {
+			count.Chars = 0
+		}
+		s.CharsThisMonth = &count
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to count characters of this month of %s. err=%v", bind.UnionUserID, err)
+	}
+}
+
+// charBudgetMessage is the reply to a memo over the budget of bindInfo
+func (app *larkMessageHandleApp) charBudgetMessage(ctx context.Context, bindInfo *entity.BindInfo) string {
+	// the count is kept apart from the copy the memo was handled with
+	if latest, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, bindInfo.UnionUserID); err == nil {
+		bindInfo = latest
+	}
+	settings, _ := bindInfo.GetSettings()
+	count, budget := app.charsThisMonth(&settings), app.charBudgetOf(bindInfo)
+	// the budget may be set below what's written
+	left := budget - count.Chars
+	if left < 0 {
+		left = 0
+	}
+	return fmt.Sprintf("本月已保存%d字，剩余%d字，本条超出每月%d字的上限，未保存~",
+		count.Chars, left, budget)
+}
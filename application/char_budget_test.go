@@ -0,0 +1,123 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestCharBudget(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{Timezone: "Asia/Shanghai"})
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{MonthlyCharBudget: 10}, bind)
+	messenger := &fakeLarkMessenger{}
+	app.messenger = messenger
+	var notified []string
+	app.larkNotify = func(msg string) { notified = append(notified, msg) }
+	// 2022-04-30 23:30 in Asia/Shanghai
+	clock := &fakeClock{now: time.Date(2022, 4, 30, 15, 30, 0, 0, time.UTC)}
+	app.clock = clock
+
+	send := func(i int, content string) string {
+		event := newTestLarkEvent("xxx", content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		return messenger.replies[len(messenger.replies)-1].Msg
+	}
+	chars := func() int {
+		stored, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+		settings, _ := stored.GetSettings()
+		if settings.CharsThisMonth == nil {
+			return 0
+		}
+		return settings.CharsThisMonth.Chars
+	}
+
+	// characters, not bytes
+	send(0, "周末去爬山")
+	send(1, "买牛奶")
+	if len(memoRepo.memos) != 2 || chars() != 8 {
+		t.Fatalf("expected 8 characters counted, got %d of %d memos", chars(), len(memoRepo.memos))
+	}
+
+	expected := "本月已保存8字，剩余2字，本条超出每月10字的上限，未保存~"
+	for i := 2; i < 4; i++ {
+		if reply := send(i, "记得交电费"); reply != expected {
+			t.Fatalf("memo %d: expected %q, got %q", i, expected, reply)
+		}
+	}
+	// what fits still goes
+	send(4, "早睡")
+	if len(memoRepo.memos) != 3 || chars() != 10 {
+		t.Fatalf("expected the memos over the budget dropped, got %d characters of %d memos", chars(), len(memoRepo.memos))
+	}
+	// once a month
+	if len(notified) != 1 || !strings.Contains(notified[0], "lark_xxx") || !strings.Contains(notified[0], "2022-04") {
+		t.Fatalf("expected the admin notified once, got %+v", notified)
+	}
+
+	// the month starts over in the timezone
+	clock.Advance(time.Hour)
+	if reply := send(5, "记得交电费"); len(memoRepo.memos) != 4 || strings.Contains(reply, "上限") || chars() != 5 {
+		t.Fatalf("expected the budget reset in May, memos: %d, characters: %d, reply: %q", len(memoRepo.memos), chars(), reply)
+	}
+}
+
+func TestCharBudgetCountFailure(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{MonthlyCharBudget: 10}, newTestNotionBind("gallery"))
+	app.bindRepo.(*fakeBindInfoRepo).settingsErr = errors.New("settings kept changing")
+	writes := 0
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "买牛奶"))
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	if writes != 0 || len(memoRepo.memos) != 0 || len(replies) != 1 ||
+		!strings.Contains(replies[0].Msg, "failed to count characters of this month") {
+		t.Fatalf("expected the memo rejected, got %d writes, %+v, %+v", writes, memoRepo.memos, replies)
+	}
+}
+
+func TestCharBudgetOfBinding(t *testing.T) {
+	cases := []struct {
+		Value string
+		Reply string
+	}{
+		{Value: "default", Reply: "本月已保存5字，剩余1字，本条超出每月6字的上限，未保存~"},
+		{Value: "20", Reply: "已保存，可以前往Notion页面查看~"},
+		{Value: "2", Reply: "本月已保存0字，剩余2字，本条超出每月2字的上限，未保存~"},
+		{Value: "off", Reply: "已保存，可以前往Notion页面查看~"},
+	}
+	for _, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		if err := ApplySetting(&settings, "char_budget", tc.Value); err != nil {
+			t.Fatal(err)
+		}
+		bind.SetSettings(&settings)
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{MonthlyCharBudget: 6}, bind)
+
+		for i, content := range []string{"周末去爬山", "买牛奶"} {
+			event := newTestLarkEvent("xxx", content)
+			event.Header.EventID = fmt.Sprintf("event_%d", i)
+			if err := app.ProcessMessage(context.TODO(), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if reply := replies[len(replies)-1].Msg; reply != tc.Reply {
+			t.Fatalf("char_budget %s: expected %q, got %q", tc.Value, tc.Reply, reply)
+		}
+	}
+}
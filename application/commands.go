@@ -0,0 +1,131 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+)
+
+// CommandUsage is a way to use a command and what it does
+type CommandUsage struct {
+	// e.g. /chat parent_page_id [name]
+	Usage       string
+	Description string
+}
+
+// CommandHandler handles a command of the lark bot and returns the reply.
+// The reply is err if it fails and the reply is empty.
+type CommandHandler func(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error)
+
+// Command is a slash command of the lark bot, listed by /help
+type Command struct {
+	// the command is /Name
+	Name   string
+	Usages []CommandUsage
+	// nil if it's handled before commands are dispatched, like /register
+	// which needs no registered bot
+	Handle CommandHandler
+}
+
+// commandRegistry keeps the commands in the order they're registered
+type commandRegistry struct {
+	commands []*Command
+}
+
+// Register adds cmd, a command of the same name is replaced in place
+func (r *commandRegistry) Register(cmd Command) {
+	for i, c := range r.commands {
+		if c.Name == cmd.Name {
+			r.commands[i] = &cmd
+			return
+		}
+	}
+	r.commands = append(r.commands, &cmd)
+}
+
+// Lookup is the command content starts with, false if it's no command
+func (r *commandRegistry) Lookup(content string) (*Command, bool) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return nil, false
+	}
+
+	name := strings.TrimPrefix(fields[0], "/")
+	for _, cmd := range r.commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// Help lists the usages of the commands, the descriptions aligned
+func (r *commandRegistry) Help() string {
+	width := 0
+	for _, cmd := range r.commands {
+		for _, u := range cmd.Usages {
+			if len(u.Usage) > width {
+				width = len(u.Usage)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Usage:\n")
+	for _, cmd := range r.commands {
+		for _, u := range cmd.Usages {
+			fmt.Fprintf(&sb, "  %-*s %s\n", width, u.Usage, u.Description)
+		}
+	}
+	return sb.String()
+}
+
+// RegisterCommand adds cmd to the commands of the lark bot, listed by /help
+func (app *larkMessageHandleApp) RegisterCommand(cmd Command) {
+	app.commands.Register(cmd)
+}
+
+func (app *larkMessageHandleApp) registerCommands() {
+	app.RegisterCommand(Command{
+		Name:   "register",
+		Usages: []CommandUsage{{"/register app_id secret_key", "register a lark bot"}},
+	})
+	app.RegisterCommand(Command{
+		Name: "bind",
+		Usages: []CommandUsage{
+			{"/bind notion secret_key page_id [theme]", "bind notion page"},
+			{"/bind doc app_id secret_key page_id [theme]", "bind lark doc page"},
+		},
+		Handle: app.handleBindCommand,
+	})
+	app.RegisterCommand(Command{
+		Name:   "set",
+		Usages: []CommandUsage{{"/set key value", "change settings of the binding"}},
+		Handle: func(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error) {
+			if err := app.setBindSettings(ctx, &event.Event.Sender.SenderID, content); err != nil {
+				return "", err
+			}
+			return "设置成功~", nil
+		},
+	})
+	app.RegisterCommand(Command{
+		Name: "chat",
+		Usages: []CommandUsage{
+			{"/chat parent_page_id [name]", "save memos of this chat to a notion subpage"},
+			{"/chat off", "stop saving memos of this chat to the subpage"},
+		},
+		Handle: func(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error) {
+			return app.mapChatPage(ctx, reg, &event.Event, content)
+		},
+	})
+	app.RegisterCommand(Command{
+		Name:   "help",
+		Usages: []CommandUsage{{"/help", "show this help"}},
+		Handle: func(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error) {
+			return app.commands.Help(), nil
+		},
+	})
+}
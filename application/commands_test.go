@@ -0,0 +1,75 @@
+package application
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+)
+
+func TestCommandHelp(t *testing.T) {
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	app.RegisterCommand(Command{
+		Name:   "ping",
+		Usages: []CommandUsage{{"/ping [text]", "check the bot is alive"}},
+		Handle: func(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error) {
+			return "pong", nil
+		},
+	})
+
+	help := app.commands.Help()
+	for _, expected := range []string{
+		"Usage:\n  /register app_id secret_key                 register a lark bot\n",
+		"  /bind doc app_id secret_key page_id [theme] bind lark doc page\n",
+		"  /chat off                                   stop saving memos of this chat to the subpage\n",
+		// new commands show up aligned with the rest
+		"  /ping [text]                                check the bot is alive\n",
+	} {
+		if !strings.Contains(help, expected) {
+			t.Fatalf("expected %q in help, got\n%s", expected, help)
+		}
+	}
+	if strings.Index(help, "/help") > strings.Index(help, "/ping") {
+		t.Fatalf("expected commands in the order registered, got\n%s", help)
+	}
+
+	for i, cmd := range []string{"/help", "/ping hello"} {
+		event := newTestLarkEvent("xxx", cmd)
+		event.Header.EventID = "event_" + cmd
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if expected := []string{help, "pong"}[i]; len(replies) != i+1 || replies[i].Msg != expected {
+			t.Fatalf("command %s, expected reply %q, got %+v", cmd, expected, replies)
+		}
+	}
+
+	// registered again, replaced in place
+	app.RegisterCommand(Command{Name: "ping", Usages: []CommandUsage{{"/ping", "say pong"}}})
+	if help := app.commands.Help(); strings.Contains(help, "check the bot is alive") || !strings.Contains(help, "say pong") {
+		t.Fatalf("expected /ping replaced, got\n%s", help)
+	}
+}
+
+func TestLookupCommand(t *testing.T) {
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	cases := []struct {
+		Content  string
+		Expected string
+	}{
+		{Content: "/set ack reaction", Expected: "set"},
+		{Content: "  /help", Expected: "help"},
+		{Content: "/settings"},
+		{Content: "set ack reaction"},
+		{Content: ""},
+	}
+	for _, tc := range cases {
+		cmd, ok := app.commands.Lookup(tc.Content)
+		if ok != (tc.Expected != "") || ok && cmd.Name != tc.Expected {
+			t.Fatalf("content: %q, expected %q, got %+v", tc.Content, tc.Expected, cmd)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+)
+
+var (
+	// ErrDailyCapReached is returned when a memo is dropped because the
+	// binding has written the daily page cap
+	ErrDailyCapReached = errors.New("daily page cap reached")
+	// ErrDailyCapQueued is returned when a memo over the daily page cap
+	// is queued for the next day
+	ErrDailyCapQueued = errors.New("daily page cap reached, memo queued")
+)
+
+// pagesToday is the count of the writes of the binding on the day of now
+// in the user's timezone.
+func (app *larkMessageHandleApp) pagesToday(s *entity.BindSettings) entity.DayCount {
+	today := app.clock.Now().In(location(s)).Format(streakDayLayout)
+	if s.PagesToday == nil || s.PagesToday.Day != today {
+		return entity.DayCount{Day: today}
+	}
+	return *s.PagesToday
+}
+
+// dailyCapOf is the daily page cap of bind, the server's unless the
+// binding has its own
+func (app *larkMessageHandleApp) dailyCapOf(bind *entity.BindInfo) int {
+	if settings, err := bind.GetSettings(); err == nil && settings.DailyCap != nil {
+		return *settings.DailyCap
+	}
+	return app.dailyCap
+}
+
+// checkDailyCap fails with ErrDailyCapReached once the binding has written
+// the cap today, the admin is told the first time of the day. It fails too
+// if the pages can't be counted. Otherwise a
+// page of the cap is taken for the memo, so that concurrent memos can't
+// all pass, and settled by countPages once it's written.
+func (app *larkMessageHandleApp) checkDailyCap(ctx context.Context, bind *entity.BindInfo) error {
+	limit := app.dailyCapOf(bind)
+	if limit <= 0 {
+		return nil
+	}
+
+	var reached, notify bool
+	var count entity.DayCount
+	_, err := app.bindRepo.UpdateSettings(ctx, bind.UnionUserID, func(s *entity.BindSettings) error {
+		count = app.pagesToday(s)
+		reached, notify = count.Count >= limit, false
+		if reached {
+			if count.Notified {
+				return repository.ErrSettingsUnchanged
+			}
+			count.Notified, notify = true, true
+		} else {
+			count.Count++
+		}
+		s.PagesToday = &count
+		return nil
+	})
+	if err != nil {
+		// rejected rather than written past the cap
+		return fmt.Errorf("failed to count pages of today, %v", err)
+	}
+
+	if notify {
+		later := "rejected"
+		if app.queueOverCap {
+			later = "queued for the next day"
+		}
+		app.larkNotify(fmt.Sprintf("%s reached the daily cap of %d pages on %s, later memos are %s",
+			bind.UnionUserID, limit, count.Day, later))
+	}
+	if reached {
+		return ErrDailyCapReached
+	}
+	return nil
+}
+
+// countPages settles the page taken by checkDailyCap to the n pages the
+// memo wrote, none gives it back.
+func (app *larkMessageHandleApp) countPages(ctx context.Context, bind *entity.BindInfo, n int) {
+	if app.dailyCapOf(bind) <= 0 || n == 1 {
+		return
+	}
+
+	_, err := app.bindRepo.UpdateSettings(ctx, bind.UnionUserID, func(s *entity.BindSettings) error {
+		count := app.pagesToday(s)
+		count.Count += n - 1
+		// the day may be over since taken
+		if count.Count < 0 {
+			count.Count = 0
+		}
+		s.PagesToday = &count
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to count pages of today of %s. err=%v", bind.UnionUserID, err)
+	}
+}
@@ -0,0 +1,295 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestDailyCap(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{Timezone: "Asia/Shanghai"})
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 2}, bind)
+	messenger := &fakeLarkMessenger{}
+	app.messenger = messenger
+	var notified []string
+	app.larkNotify = func(msg string) { notified = append(notified, msg) }
+	// 2022-04-15 23:30 in Asia/Shanghai
+	clock := &fakeClock{now: time.Date(2022, 4, 15, 15, 30, 0, 0, time.UTC)}
+	app.clock = clock
+
+	send := func(i int) string {
+		event := newTestLarkEvent("xxx", fmt.Sprintf("memo %d", i))
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		if len(messenger.replies) == 0 {
+			return ""
+		}
+		return messenger.replies[len(messenger.replies)-1].Msg
+	}
+
+	send(0)
+	send(1)
+	for i := 2; i < 4; i++ {
+		if reply := send(i); !strings.Contains(reply, "达到每日上限") {
+			t.Fatalf("memo %d: expected rejected over the cap, got %q", i, reply)
+		}
+	}
+	if len(memoRepo.memos) != 2 {
+		t.Fatalf("expected the memos over the cap dropped, got %d memos", len(memoRepo.memos))
+	}
+	// once a day
+	if len(notified) != 1 || !strings.Contains(notified[0], "lark_xxx") || !strings.Contains(notified[0], "2022-04-15") {
+		t.Fatalf("expected the admin notified once, got %+v", notified)
+	}
+
+	// past midnight in the timezone only
+	clock.Advance(time.Hour)
+	if reply := send(4); len(memoRepo.memos) != 3 || strings.Contains(reply, "达到每日上限") {
+		t.Fatalf("expected the cap reset the next day, memos: %d, reply: %q", len(memoRepo.memos), reply)
+	}
+}
+
+func TestDailyCapQueue(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 1, QueueOverCap: true, MemoRetryBudget: 3}, bind)
+	messenger := &fakeLarkMessenger{}
+	app.messenger = messenger
+	var notified []string
+	app.larkNotify = func(msg string) { notified = append(notified, msg) }
+	clock := &fakeClock{now: time.Date(2022, 4, 15, 10, 0, 0, 0, time.Local)}
+	app.clock = clock
+
+	for i := 0; i < 2; i++ {
+		event := newTestLarkEvent("xxx", fmt.Sprintf("memo %d", i))
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reply := messenger.replies[len(messenger.replies)-1].Msg; !strings.Contains(reply, "明天会自动保存") {
+		t.Fatalf("expected the memo queued, got %q", reply)
+	}
+	if len(notified) != 1 || !strings.Contains(notified[0], "queued") {
+		t.Fatalf("expected the admin notified, got %+v", notified)
+	}
+
+	// kept pending the same day, not an attempt
+	if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	queued := memoRepo.memos[1]
+	if queued.Status != uint8(entity.MemoStatusPending) || queued.Attempts != 0 {
+		t.Fatalf("expected the memo kept for the next day, got %+v", queued)
+	}
+
+	clock.Advance(24 * time.Hour)
+	if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if queued := memoRepo.memos[1]; queued.Status != uint8(entity.MemoStatusSaved) {
+		t.Fatalf("expected the memo saved the next day, got %+v", queued)
+	}
+}
+
+func TestDailyCapConcurrentMemos(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 3}, bind)
+	app.clock = &fakeClock{now: time.Date(2022, 4, 15, 10, 0, 0, 0, time.Local)}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			event := newTestLarkEvent("xxx", fmt.Sprintf("memo %d", i))
+			content, _ := event.Event.Message.GetMessageRawContent()
+			_, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{}, event, content)
+			errs <- err
+		}(i)
+	}
+	// not undone by the counts of the memos in flight
+	if err := app.setBindSettings(context.TODO(), &lark_message.UserID{UnionID: "xxx"}, "/set ack reaction"); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		if err == nil {
+			saved++
+		} else if !errors.Is(err, ErrDailyCapReached) {
+			t.Fatal(err)
+		}
+	}
+	latest, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ := latest.GetSettings()
+	if saved != 3 || settings.PagesToday == nil || settings.PagesToday.Count != 3 {
+		t.Fatalf("expected the cap kept by concurrent memos, saved %d, count %+v", saved, settings.PagesToday)
+	}
+	if settings.Ack != entity.AckReaction {
+		t.Fatalf("expected the setting kept, got %+v", settings)
+	}
+}
+
+func TestDailyCapCountsPages(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	for _, kv := range [][2]string{{"tag_route", "ideas db_ideas"}, {"tag_route", "projx db_projx"},
+		{"multi_route", "on"}, {"split_heading", "2"}} {
+		if err := ApplySetting(&settings, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bind.SetSettings(&settings)
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 5, Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+	cases := []struct {
+		Content string
+		Pages   int
+	}{
+		// a page in each routed database
+		{Content: "#ideas #projx 新的交互方案", Pages: 2},
+		// the index and a page per section
+		{Content: "## 上午\n写代码\n## 下午\n开会", Pages: 5},
+		// over the cap
+		{Content: "买牛奶", Pages: 5},
+	}
+	for i, tc := range cases {
+		event := newTestLarkEvent("xxx", tc.Content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		app.ProcessMessage(context.TODO(), event)
+
+		got, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+		s, _ := got.GetSettings()
+		if s.PagesToday == nil || s.PagesToday.Count != tc.Pages {
+			t.Fatalf("memo %d: expected %d pages today, got %+v", i, tc.Pages, s.PagesToday)
+		}
+	}
+	if len(memoRepo.memos) != 2 {
+		t.Fatalf("expected the memo over the cap rejected, got %d memos", len(memoRepo.memos))
+	}
+}
+
+func TestDailyCapCountFailure(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 2, QueueOverCap: true}, newTestNotionBind("gallery"))
+	app.bindRepo.(*fakeBindInfoRepo).settingsErr = errors.New("settings kept changing")
+	writes := 0
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "hello"))
+	// neither written past the cap nor queued as over it
+	if writes != 0 || len(memoRepo.memos) != 0 {
+		t.Fatalf("expected the memo rejected, got %d writes, %+v", writes, memoRepo.memos)
+	}
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	if len(replies) != 1 || !strings.Contains(replies[0].Msg, "failed to count pages of today") {
+		t.Fatalf("unexpected replies %+v", replies)
+	}
+}
+
+func TestDailyCapOfBinding(t *testing.T) {
+	cases := []struct {
+		Value string
+		// memos saved of 3 with the server's cap of 2
+		Saved int
+	}{
+		{Value: "default", Saved: 2},
+		{Value: "1", Saved: 1},
+		{Value: "off", Saved: 3},
+	}
+	for _, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		if err := ApplySetting(&settings, "daily_cap", tc.Value); err != nil {
+			t.Fatal(err)
+		}
+		bind.SetSettings(&settings)
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{DailyPageCap: 2}, bind)
+
+		var replies []string
+		for i := 0; i < 3; i++ {
+			event := newTestLarkEvent("xxx", fmt.Sprintf("memo %d", i))
+			event.Header.EventID = fmt.Sprintf("event_%d", i)
+			if err := app.ProcessMessage(context.TODO(), event); err != nil {
+				t.Fatal(err)
+			}
+			replies = append(replies, app.messenger.(*fakeLarkMessenger).replies[i].Msg)
+		}
+		if len(memoRepo.memos) != tc.Saved {
+			t.Fatalf("daily_cap %s: expected %d memos saved, got %d, replies: %v", tc.Value, tc.Saved, len(memoRepo.memos), replies)
+		}
+		if tc.Value == "1" && replies[1] != "今日已保存1条，达到每日上限，本条未保存~" {
+			t.Fatalf("expected the cap of the binding replied, got %q", replies[1])
+		}
+	}
+
+	var settings entity.BindSettings
+	if err := ApplySetting(&settings, "daily_cap", "-1"); err == nil {
+		t.Fatal("expected invalid daily_cap")
+	}
+}
+
+func TestDailyCapRequeueClaimedAgain(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	memoRepo := &fakeMemoRepo{}
+	for _, content := range []string{"memo 0", "memo 1"} {
+		memoRepo.Create(context.TODO(), &entity.Memo{UnionUserID: "lark_xxx", Content: content,
+			BindPlatform: uint8(entity.BindPlatformTypeNotion), Status: uint8(entity.MemoStatusPending)})
+	}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 1, QueueOverCap: true, MemoRetryBudget: 3}, bind)
+	clock := &fakeClock{now: time.Date(2022, 4, 15, 10, 0, 0, 0, time.Local)}
+	app.clock = clock
+	writes := 0
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	// requeued as it was queued each pass of the day, then claimed again
+	for i := 0; i < 2; i++ {
+		if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+			t.Fatal(err)
+		}
+		queued := memoRepo.memos[1]
+		if writes != 1 || queued.Status != uint8(entity.MemoStatusPending) || queued.Attempts != 0 ||
+			queued.BindPlatform != uint8(entity.BindPlatformTypeNotion) || queued.PageID != "" || queued.LastError != "" {
+			t.Fatalf("pass %d, expected the memo requeued as it was, %d writes, got %+v", i, writes, queued)
+		}
+	}
+
+	clock.Advance(24 * time.Hour)
+	if n, err := app.ProcessPendingMemos(context.TODO()); n != 1 || err != nil || writes != 2 {
+		t.Fatalf("expected the memo claimed the next day, got %d, %d writes, err=%v", n, writes, err)
+	}
+	if saved := memoRepo.memos[1]; saved.Status != uint8(entity.MemoStatusSaved) || saved.PageID != "page_xxx" {
+		t.Fatalf("expected the memo saved the next day, got %+v", saved)
+	}
+}
@@ -0,0 +1,65 @@
+package application
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+// databaseDirective is a first line like `@db: work`
+var databaseDirective = regexp.MustCompile(`^\s*@db:[ \t]*(\S+)[ \t]*(?:\r?\n|$)`)
+
+// parseDatabaseDirective returns the alias of the database directive
+// leading content and the content without it, false if there's none.
+func parseDatabaseDirective(content string) (string, string, bool) {
+	m := databaseDirective.FindStringSubmatchIndex(content)
+	if m == nil {
+		return "", content, false
+	}
+	return content[m[2]:m[3]], content[m[1]:], true
+}
+
+// directiveDatabase is the database picked by the directive of content,
+// empty if there's none.
+func directiveDatabase(s *entity.BindSettings, content string) (string, error) {
+	alias, _, ok := parseDatabaseDirective(content)
+	if !ok {
+		return "", nil
+	}
+
+	if id, ok := s.Databases[alias]; ok {
+		return id, nil
+	}
+	if len(s.Databases) == 0 {
+		return "", fmt.Errorf("unknown database %s, add one by `/set db_alias alias database_id`", alias)
+	}
+
+	aliases := make([]string, 0, len(s.Databases))
+	for a := range s.Databases {
+		aliases = append(aliases, a)
+	}
+	sort.Strings(aliases)
+	return "", fmt.Errorf("unknown database %s, aliases: %s", alias, strings.Join(aliases, ", "))
+}
+
+// alias database_id, or alias off
+func setDatabaseAlias(s *entity.BindSettings, value string) error {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return fmt.Errorf("db_alias should be like `alias database_id` or `alias off`")
+	}
+
+	if parts[1] == "off" {
+		delete(s.Databases, parts[0])
+		return nil
+	}
+
+	if s.Databases == nil {
+		s.Databases = make(map[string]string)
+	}
+	s.Databases[parts[0]] = parts[1]
+	return nil
+}
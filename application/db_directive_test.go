@@ -0,0 +1,85 @@
+package application
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestParseDatabaseDirective(t *testing.T) {
+	cases := []struct {
+		Content string
+		Alias   string
+		Rest    string
+		Found   bool
+	}{
+		{Content: "@db: work\n#科技 memo", Alias: "work", Rest: "#科技 memo", Found: true},
+		{Content: "  @db:work  \r\nmemo\nmore", Alias: "work", Rest: "memo\nmore", Found: true},
+		{Content: "@db: work", Alias: "work", Rest: "", Found: true},
+		// only a first line of its own
+		{Content: "memo\n@db: work", Rest: "memo\n@db: work"},
+		{Content: "@db: work memo", Rest: "@db: work memo"},
+		{Content: "@db:\nmemo", Rest: "@db:\nmemo"},
+	}
+	for _, tc := range cases {
+		alias, rest, ok := parseDatabaseDirective(tc.Content)
+		if alias != tc.Alias || rest != tc.Rest || ok != tc.Found {
+			t.Fatalf("content: %q, expected (%q, %q, %v), got (%q, %q, %v)",
+				tc.Content, tc.Alias, tc.Rest, tc.Found, alias, rest, ok)
+		}
+	}
+}
+
+func TestDatabaseDirective(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	for _, value := range []string{"work db_work", "life db_life", "life off", "home db_home"} {
+		if err := ApplySetting(&settings, "db_alias", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bind.SetSettings(&settings)
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+	messenger := &fakeLarkMessenger{}
+	app.messenger = messenger
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "@db: work\n#科技 memo")); err != nil {
+		t.Fatal(err)
+	}
+	var page string
+	for _, req := range n.Requests() {
+		if req.Method == http.MethodPost && req.Path == "/pages" {
+			page = req.Body
+		}
+	}
+	if !strings.Contains(page, `"database_id":"db_work"`) {
+		t.Fatalf("expected page in db_work, got %s", page)
+	}
+	if strings.Contains(page, "@db") || !strings.Contains(page, `"name":"科技"`) {
+		t.Fatalf("expected the directive stripped, got %s", page)
+	}
+
+	// unknown aliases are answered with the valid ones, nothing saved
+	event := newTestLarkEvent("xxx", "@db: life\nmemo")
+	event.Header.EventID = "event_yyy"
+	if err := app.ProcessMessage(context.TODO(), event); err == nil {
+		t.Fatal("expected unknown database error")
+	}
+	last := messenger.replies[len(messenger.replies)-1].Msg
+	if !strings.Contains(last, "unknown database life, aliases: home, work") {
+		t.Fatalf("unexpected reply %s", last)
+	}
+	if len(memoRepo.memos) != 1 || len(n.Requests()) != 2 {
+		t.Fatalf("expected the memo dropped, memos: %d, notion requests: %d", len(memoRepo.memos), len(n.Requests()))
+	}
+}
@@ -0,0 +1,61 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoStats counts the memos processed since the last heartbeat
+type memoStats struct {
+	mu        sync.Mutex
+	processed int
+	failed    int
+}
+
+func (s *memoStats) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed++
+	// paused on purpose, queued memos are saved later
+	if err != nil && !errors.Is(err, ErrNotionWritesPaused) && !errors.Is(err, ErrMemoQueued) &&
+		!errors.Is(err, ErrCapturePaused) && !errors.Is(err, ErrCaptureQueued) && !errors.Is(err, ErrMemoTooShort) &&
+		!errors.Is(err, ErrDailyCapReached) && !errors.Is(err, ErrDailyCapQueued) && !errors.Is(err, ErrCharBudgetReached) {
+		s.failed++
+	}
+}
+
+// reset returns the counts and starts over
+func (s *memoStats) reset() (processed, failed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	processed, failed = s.processed, s.failed
+	s.processed, s.failed = 0, 0
+	return
+}
+
+func heartbeatMessage(uptime time.Duration, processed, failed int) string {
+	rate := 0.0
+	if processed > 0 {
+		rate = float64(failed) * 100 / float64(processed)
+	}
+
+	return fmt.Sprintf("nomo heartbeat\nuptime: %s\nmemos since last heartbeat: %d, failed: %d, error rate: %.1f%%",
+		uptime.Round(time.Second), processed, failed, rate)
+}
+
+// RunHeartbeat tells the admin nomo is alive every interval with the
+// memos processed meanwhile, until ctx is done.
+func (app *larkMessageHandleApp) RunHeartbeat(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-app.clock.After(interval):
+			processed, failed := app.stats.reset()
+			app.larkNotify(heartbeatMessage(now.Sub(app.started), processed, failed))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClockWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeClockWaiter{at: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance moves the clock and fires the waiters due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// Wait blocks until n waiters are waiting
+func (c *fakeClock) Wait(n int) {
+	for {
+		c.mu.Lock()
+		waiting := len(c.waiters)
+		c.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestHeartbeatMessage(t *testing.T) {
+	cases := []struct {
+		Uptime    time.Duration
+		Processed int
+		Failed    int
+		Expected  string
+	}{
+		{
+			Uptime:   90*time.Minute + 300*time.Millisecond,
+			Expected: "nomo heartbeat\nuptime: 1h30m0s\nmemos since last heartbeat: 0, failed: 0, error rate: 0.0%",
+		},
+		{
+			Uptime: time.Hour, Processed: 8, Failed: 1,
+			Expected: "nomo heartbeat\nuptime: 1h0m0s\nmemos since last heartbeat: 8, failed: 1, error rate: 12.5%",
+		},
+	}
+	for _, tc := range cases {
+		if msg := heartbeatMessage(tc.Uptime, tc.Processed, tc.Failed); msg != tc.Expected {
+			t.Fatalf("expected %q, got %q", tc.Expected, msg)
+		}
+	}
+}
+
+func TestRunHeartbeat(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1650000000, 0)}
+	notifications := make(chan string, 10)
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	app.clock, app.started = clock, clock.Now()
+	app.larkNotify = func(msg string) { notifications <- msg }
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go app.RunHeartbeat(ctx, 10*time.Minute)
+
+	app.stats.record(nil)
+	app.stats.record(ErrNotionWritesPaused)
+	app.stats.record(errors.New("failed"))
+	app.stats.record(nil)
+
+	// not due yet
+	clock.Wait(1)
+	clock.Advance(9 * time.Minute)
+	select {
+	case msg := <-notifications:
+		t.Fatalf("unexpected heartbeat %s", msg)
+	default:
+	}
+
+	for i, expected := range []string{
+		heartbeatMessage(10*time.Minute, 4, 1),
+		// counts start over
+		heartbeatMessage(20*time.Minute, 0, 0),
+	} {
+		clock.Advance(time.Minute)
+		if msg := <-notifications; msg != expected {
+			t.Fatalf("heartbeat %d, expected %q, got %q", i, expected, msg)
+		}
+		clock.Wait(1)
+		clock.Advance(9 * time.Minute)
+	}
+
+}
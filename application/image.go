@@ -0,0 +1,143 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	. "github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+const (
+	defaultMaxImageSize = 10 << 20
+	// images are fetched up to this many times of the max size to be
+	// downscaled
+	downscaleFetchFactor = 4
+
+	defaultResourceAttempts   = 3
+	defaultResourceRetryDelay = 500 * time.Millisecond
+)
+
+// ImageStore keeps the images of memos where notion can embed them from
+type ImageStore interface {
+	// Put stores image data named name and returns its public url
+	Put(name, contentType string, data []byte) (string, error)
+}
+
+// ImageDownscaler shrinks images over the max size
+type ImageDownscaler interface {
+	// Downscale returns data downscaled to at most maxSize bytes with its
+	// content type
+	Downscale(data []byte, contentType string, maxSize int64) ([]byte, string, error)
+}
+
+// ErrImagesUnsupported is returned for a memo of images bound to a lark doc,
+// which has no image blocks
+var ErrImagesUnsupported = errors.New("images are not supported by lark docs")
+
+// a line of a markdown image of a stored image
+var imageLine = regexp.MustCompile(`(?m)^\s*!\[[^\]]*\]\(https?://[^\s)]+\)\s*$`)
+
+// hasImage reports whether content has a line of a markdown image
+func hasImage(content string) bool {
+	return imageLine.MatchString(content)
+}
+
+type imageMessage struct {
+	ImageKey string `json:"image_key"`
+}
+
+// isImageMessage reports whether message is an image app can save, only
+// if there's somewhere to store it
+func (app *larkMessageHandleApp) isImageMessage(message *lark_message.Message) bool {
+	return message.MessageType == "image" && app.imageStore != nil
+}
+
+func formatSize(size int64) string {
+	return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+}
+
+// imagePlaceholder is the memo of image imageKey which can't be saved, the
+// original stays in lark
+func (app *larkMessageHandleApp) imagePlaceholder(imageKey string) (string, string) {
+	max := formatSize(app.maxImageSize)
+	return fmt.Sprintf("[图片超过%s，未保存原图: %s]", max, imageKey),
+		fmt.Sprintf("图片超过%s，已保存占位，原图请在飞书中查看~", max)
+}
+
+// downloadPlaceholder is the memo of image imageKey which can't be
+// downloaded from lark
+func downloadPlaceholder(imageKey string) (string, string) {
+	return fmt.Sprintf("[图片下载失败，未保存原图: %s]", imageKey),
+		"图片下载失败，已保存占位，原图请在飞书中查看~"
+}
+
+// downloadImage downloads image imageKey of message up to resourceAttempts
+// times, an image over maxSize isn't tried again.
+func (app *larkMessageHandleApp) downloadImage(reg *entity.LarkBotRegistar, messageID, imageKey string, maxSize int64) ([]byte, string, error) {
+	delay := app.resourceRetryDelay
+	for attempt := 1; ; attempt++ {
+		data, contentType, err := app.messenger.Image(reg.AppID, reg.SecretKey, messageID, imageKey, maxSize)
+		var tooLarge *ResourceTooLargeError
+		if err == nil || errors.As(err, &tooLarge) || attempt >= app.resourceAttempts {
+			return data, contentType, err
+		}
+
+		log.Warnf("failed to download image %s of message %s, attempt %d/%d. err=%v",
+			imageKey, messageID, attempt, app.resourceAttempts, err)
+		if delay > 0 {
+			<-app.clock.After(delay)
+			delay *= 2
+		}
+	}
+}
+
+// imageContent is the memo of image message: a markdown image of the stored
+// image, or a placeholder if it's over the max size or can't be downloaded.
+// note tells the user what's done to such an image.
+func (app *larkMessageHandleApp) imageContent(reg *entity.LarkBotRegistar, message *lark_message.Message) (content, note string, err error) {
+	var img imageMessage
+	if err := json.Unmarshal([]byte(message.Content), &img); err != nil || img.ImageKey == "" {
+		return "", "", fmt.Errorf("invalid image message, %v", err)
+	}
+
+	fetchSize := app.maxImageSize
+	if app.imageDownscaler != nil {
+		fetchSize *= downscaleFetchFactor
+	}
+	data, contentType, err := app.downloadImage(reg, message.MessageID, img.ImageKey, fetchSize)
+	var tooLarge *ResourceTooLargeError
+	if errors.As(err, &tooLarge) {
+		log.Warnf("image %s of message %s is too large, save a placeholder. err=%v", img.ImageKey, message.MessageID, err)
+		content, note = app.imagePlaceholder(img.ImageKey)
+		return content, note, nil
+	}
+	if err != nil {
+		log.Errorf("failed to download image %s of message %s, save a placeholder. err=%v", img.ImageKey, message.MessageID, err)
+		content, note = downloadPlaceholder(img.ImageKey)
+		return content, note, nil
+	}
+
+	if int64(len(data)) > app.maxImageSize {
+		scaled, scaledType, err := app.imageDownscaler.Downscale(data, contentType, app.maxImageSize)
+		if err != nil || int64(len(scaled)) > app.maxImageSize {
+			log.Warnf("failed to downscale image %s of %s, save a placeholder. err=%v", img.ImageKey, formatSize(int64(len(data))), err)
+			content, note = app.imagePlaceholder(img.ImageKey)
+			return content, note, nil
+		}
+		note = fmt.Sprintf("图片超过%s，已压缩后保存~", formatSize(app.maxImageSize))
+		data, contentType = scaled, scaledType
+	}
+
+	url, err := app.imageStore.Put(img.ImageKey, contentType, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store image %s, %v", img.ImageKey, err)
+	}
+	return fmt.Sprintf("![image](%s)", url), note, nil
+}
@@ -0,0 +1,184 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+)
+
+type fakeImageStore struct {
+	puts []string
+}
+
+func (s *fakeImageStore) Put(name, contentType string, data []byte) (string, error) {
+	s.puts = append(s.puts, fmt.Sprintf("%s:%s:%d", name, contentType, len(data)))
+	return "https://img.example.com/" + name, nil
+}
+
+type fakeDownscaler struct{}
+
+func (fakeDownscaler) Downscale(data []byte, contentType string, maxSize int64) ([]byte, string, error) {
+	return data[:maxSize/2], "image/jpeg", nil
+}
+
+func newTestImageEvent(imageKey string) *lark_message.LarkMessageEvent {
+	event := newTestLarkEvent("xxx", "")
+	content, _ := json.Marshal(map[string]string{"image_key": imageKey})
+	event.Event.Message.MessageType = "image"
+	event.Event.Message.Content = string(content)
+	event.Header.EventID = "event_" + imageKey
+	return event
+}
+
+func TestImageMemo(t *testing.T) {
+	cases := []struct {
+		ImageKey   string
+		Downscaler ImageDownscaler
+		Content    string
+		Puts       []string
+		Note       string
+	}{
+		{
+			ImageKey: "img_small",
+			Content:  "![image](https://img.example.com/img_small)",
+			Puts:     []string{"img_small:image/png:1024"},
+		},
+		// over the max size
+		{
+			ImageKey: "img_large",
+			Content:  "[图片超过0.0MB，未保存原图: img_large]",
+			Note:     "图片超过0.0MB，已保存占位，原图请在飞书中查看~",
+		},
+		{
+			ImageKey:   "img_large",
+			Downscaler: fakeDownscaler{},
+			Content:    "![image](https://img.example.com/img_large)",
+			Puts:       []string{"img_large:image/jpeg:1024"},
+			Note:       "图片超过0.0MB，已压缩后保存~",
+		},
+		// too large to be downscaled
+		{
+			ImageKey:   "img_huge",
+			Downscaler: fakeDownscaler{},
+			Content:    "[图片超过0.0MB，未保存原图: img_huge]",
+			Note:       "图片超过0.0MB，已保存占位，原图请在飞书中查看~",
+		},
+	}
+	for _, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		memoRepo := &fakeMemoRepo{}
+		store := &fakeImageStore{}
+		app := newTestLarkApp(memoRepo, Option{ImageStore: store, ImageDownscaler: tc.Downscaler, MaxImageSize: 2048}, bind)
+		messenger := app.messenger.(*fakeLarkMessenger)
+		messenger.images = map[string][]byte{
+			"img_small": make([]byte, 1024),
+			"img_large": make([]byte, 4096),
+			"img_huge":  make([]byte, 2048*downscaleFetchFactor+1),
+		}
+
+		if err := app.ProcessMessage(context.TODO(), newTestImageEvent(tc.ImageKey)); err != nil {
+			t.Fatal(err)
+		}
+		if len(memoRepo.memos) != 1 || memoRepo.memos[0].Content != tc.Content {
+			t.Fatalf("image: %s, expected memo %q, got %+v", tc.ImageKey, tc.Content, memoRepo.memos)
+		}
+		if strings.Join(store.puts, ",") != strings.Join(tc.Puts, ",") {
+			t.Fatalf("image: %s, expected stored %v, got %v", tc.ImageKey, tc.Puts, store.puts)
+		}
+
+		expected := []string{"已保存，可以前往Notion页面查看~"}
+		if tc.Note != "" {
+			expected = append(expected, tc.Note)
+		}
+		var replies []string
+		for _, r := range messenger.replies {
+			replies = append(replies, r.Msg)
+		}
+		if strings.Join(replies, "|") != strings.Join(expected, "|") {
+			t.Fatalf("image: %s, expected replies %v, got %v", tc.ImageKey, expected, replies)
+		}
+	}
+}
+
+func TestImageMemoWithoutStore(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{}, newTestNotionBind("gallery"))
+	if err := app.ProcessMessage(context.TODO(), newTestImageEvent("img_small")); err == nil {
+		t.Fatal("expected unsupported image message")
+	}
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	if len(memoRepo.memos) != 0 || len(replies) != 1 || replies[0].Msg != "目前只支持文本消息，当前类型为 image" {
+		t.Fatalf("expected image rejected, got %+v, %+v", memoRepo.memos, replies)
+	}
+}
+
+func TestImageDownloadRetry(t *testing.T) {
+	cases := []struct {
+		Failures int
+		Content  string
+		Puts     int
+		Note     string
+	}{
+		{Failures: 2, Content: "![image](https://img.example.com/img_small)", Puts: 1},
+		// out of attempts
+		{
+			Failures: 3,
+			Content:  "[图片下载失败，未保存原图: img_small]",
+			Note:     "图片下载失败，已保存占位，原图请在飞书中查看~",
+		},
+	}
+	for _, tc := range cases {
+		memoRepo := &fakeMemoRepo{}
+		store := &fakeImageStore{}
+		app := newTestLarkApp(memoRepo, Option{ImageStore: store}, newTestNotionBind("gallery"))
+		app.resourceRetryDelay = 0
+		messenger := app.messenger.(*fakeLarkMessenger)
+		messenger.images = map[string][]byte{"img_small": make([]byte, 1024)}
+		messenger.imageFailures = map[string]int{"img_small": tc.Failures}
+
+		if err := app.ProcessMessage(context.TODO(), newTestImageEvent("img_small")); err != nil {
+			t.Fatal(err)
+		}
+		if messenger.imageCalls != 3 {
+			t.Fatalf("failures: %d, expected 3 downloads, got %d", tc.Failures, messenger.imageCalls)
+		}
+		if len(memoRepo.memos) != 1 || memoRepo.memos[0].Content != tc.Content || len(store.puts) != tc.Puts {
+			t.Fatalf("failures: %d, expected memo %q, got %+v, stored %v", tc.Failures, tc.Content, memoRepo.memos, store.puts)
+		}
+		if tc.Note != "" {
+			if replies := messenger.replies; len(replies) != 2 || replies[1].Msg != tc.Note {
+				t.Fatalf("failures: %d, expected note %q, got %+v", tc.Failures, tc.Note, replies)
+			}
+		}
+	}
+}
+
+func TestImageMemoLarkDoc(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeLarkDoc),
+		PageInfo:     `{"doc_token": "doc_xxx", "doc_theme": "flat"}`,
+	}
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{ImageStore: &fakeImageStore{}}, bind)
+	messenger := app.messenger.(*fakeLarkMessenger)
+	messenger.images = map[string][]byte{"img_small": make([]byte, 1024)}
+	writes := 0
+	app.handlers[entity.BindPlatformTypeLarkDoc] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		return appendResult{Pages: 1}, nil
+	}
+
+	if err := app.ProcessMessage(context.TODO(), newTestImageEvent("img_small")); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 0 || len(memoRepo.memos) != 0 || len(messenger.replies) != 1 ||
+		messenger.replies[0].Msg != "飞书文档暂不支持图片，本条未保存~" {
+		t.Fatalf("expected the image rejected, got %d writes, memos: %+v, replies: %+v", writes, memoRepo.memos, messenger.replies)
+	}
+}
@@ -0,0 +1,96 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+// links of an index page before the next part is created, long pages are
+// slow to open in notion
+const maxIndexLinks = 1000
+
+func indexPageTitle(part int) string {
+	if part <= 1 {
+		return "Memo Index"
+	}
+	return fmt.Sprintf("Memo Index %d", part)
+}
+
+// addToIndex links page pageID of content from the index page of the
+// binding, which is created on the first memo, or again if it's gone. It
+// only logs failures as the memo is saved anyway.
+func (app *larkMessageHandleApp) addToIndex(ctx context.Context, req *appendRequest, notionKey, pageID, content string) {
+	if req.Settings == nil || req.Settings.IndexPage == nil || pageID == "" {
+		return
+	}
+
+	app.indexPageMu.Lock()
+	defer app.indexPageMu.Unlock()
+	// another memo may have created or filled it since req was read
+	bind, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, req.Bind.UnionUserID)
+	if err != nil {
+		log.Errorf("failed to get the index page of %s. err=%v", req.Bind.UnionUserID, err)
+		return
+	}
+	settings, err := bind.GetSettings()
+	if err != nil || settings.IndexPage == nil {
+		return
+	}
+
+	start := *settings.IndexPage
+	index := start
+	entries := []notion.WeeklyEntry{{Content: content, PageID: pageID}}
+	if index.PageID != "" && index.Links < maxIndexLinks {
+		err = app.notionCli.AppendIndexLinks(notionKey, index.PageID, entries)
+		if err == nil {
+			index.Links++
+		} else if notion.IsNotShared(err) {
+			log.Warnf("index page %s of %s is gone, create it again. err=%v", index.PageID, req.Bind.UnionUserID, err)
+			index.PageID = ""
+		}
+	}
+	if index.PageID == "" || index.Links >= maxIndexLinks {
+		// a full part is followed by the next, a gone one is replaced
+		if index.PageID != "" || index.Part == 0 {
+			index.Part++
+		}
+		var id string
+		if id, err = app.notionCli.CreateIndexPage(notionKey, index.ParentPageID, indexPageTitle(index.Part), entries); err == nil {
+			index.PageID, index.Links = id, 1
+		}
+	}
+	if err != nil {
+		log.Errorf("failed to add page %s to the index page of %s. err=%v", pageID, req.Bind.UnionUserID, err)
+		return
+	}
+
+	_, err = app.bindRepo.UpdateSettings(ctx, req.Bind.UnionUserID, func(s *entity.BindSettings) error {
+		// turned off or moved meanwhile
+		if s.IndexPage == nil || s.IndexPage.ParentPageID != start.ParentPageID {
+			return repository.ErrSettingsUnchanged
+		}
+		latest := *s.IndexPage
+		switch {
+		case latest == start:
+			latest = index
+		case latest.PageID == index.PageID:
+			// linked from by another instance as well
+			latest.Links++
+		default:
+			log.Warnf("index page of %s is changed by another instance, page %s is linked from %s only",
+				req.Bind.UnionUserID, pageID, index.PageID)
+			return repository.ErrSettingsUnchanged
+		}
+		s.IndexPage = &latest
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to keep the index page of %s. err=%v", req.Bind.UnionUserID, err)
+	}
+}
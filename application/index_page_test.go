@@ -0,0 +1,101 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestIndexPage(t *testing.T) {
+	cases := []struct {
+		Name  string
+		Index entity.IndexPage
+		// the index page is gone
+		Gone bool
+		// the index page of the memo, appended to if it's no new title
+		Expected entity.IndexPage
+		Title    string
+	}{
+		{
+			Name:     "first memo",
+			Index:    entity.IndexPage{ParentPageID: "parent_xxx"},
+			Expected: entity.IndexPage{ParentPageID: "parent_xxx", PageID: "page_new", Part: 1, Links: 1},
+			Title:    "Memo Index",
+		},
+		{
+			Name:     "backlink",
+			Index:    entity.IndexPage{ParentPageID: "parent_xxx", PageID: "index_xxx", Part: 1, Links: 5},
+			Expected: entity.IndexPage{ParentPageID: "parent_xxx", PageID: "index_xxx", Part: 1, Links: 6},
+		},
+		{
+			Name:     "gone",
+			Index:    entity.IndexPage{ParentPageID: "parent_xxx", PageID: "index_xxx", Part: 2, Links: 5},
+			Gone:     true,
+			Expected: entity.IndexPage{ParentPageID: "parent_xxx", PageID: "page_new", Part: 2, Links: 1},
+			Title:    "Memo Index 2",
+		},
+		{
+			Name:     "full",
+			Index:    entity.IndexPage{ParentPageID: "parent_xxx", PageID: "index_xxx", Part: 1, Links: maxIndexLinks},
+			Expected: entity.IndexPage{ParentPageID: "parent_xxx", PageID: "page_new", Part: 2, Links: 1},
+			Title:    "Memo Index 2",
+		},
+	}
+	for i, tc := range cases {
+		n := newFakeNotion()
+		// the memo page and a new index page alike
+		n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_new"}`)
+		if tc.Gone {
+			n.Reply(http.MethodPatch, "/blocks/index_xxx/children", http.StatusNotFound, `{"object": "error", "status": 404, "code": "object_not_found"}`)
+		}
+		bind := newTestNotionBind("gallery")
+		index := tc.Index
+		bind.SetSettings(&entity.BindSettings{IndexPage: &index})
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+		event := newTestLarkEvent("xxx", "周会纪要\n讨论了发布计划")
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		n.Close()
+
+		var created, appended []string
+		for _, req := range n.Requests() {
+			switch {
+			case req.Method == http.MethodPost && req.Path == "/pages" && strings.Contains(req.Body, `"page_id":"parent_xxx"`):
+				created = append(created, req.Body)
+			case req.Method == http.MethodPatch && req.Path == "/blocks/index_xxx/children":
+				appended = append(appended, req.Body)
+			}
+		}
+		link := `"content":"周会纪要","link":{"url":"https://www.notion.so/page_new"}`
+		if tc.Title != "" {
+			if len(created) != 1 || !strings.Contains(created[0], `"content":"`+tc.Title+`"`) || !strings.Contains(created[0], link) {
+				t.Fatalf("%s: expected index page %s created with the link, got %v", tc.Name, tc.Title, created)
+			}
+		} else if len(created) != 0 || len(appended) != 1 || !strings.Contains(appended[0], link) {
+			t.Fatalf("%s: expected the link appended, got %v, %v", tc.Name, created, appended)
+		}
+
+		stored, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+		settings, _ := stored.GetSettings()
+		if settings.IndexPage == nil || *settings.IndexPage != tc.Expected {
+			t.Fatalf("%s: expected index %+v, got %+v", tc.Name, tc.Expected, settings.IndexPage)
+		}
+	}
+
+	var s entity.BindSettings
+	if err := ApplySetting(&s, "index_page", "parent_xxx"); err != nil || s.IndexPage.ParentPageID != "parent_xxx" {
+		t.Fatalf("expected index_page set, got %+v, %v", s.IndexPage, err)
+	}
+	if err := ApplySetting(&s, "index_page", "off"); err != nil || s.IndexPage != nil {
+		t.Fatalf("expected index_page off, got %+v, %v", s.IndexPage, err)
+	}
+}
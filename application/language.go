@@ -0,0 +1,95 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+// defaultLanguageConfidence is the confidence a language is routed by if
+// Option.LanguageConfidence is unset
+const defaultLanguageConfidence = 0.6
+
+// LanguageDetector tells the language of text, e.g. zh or en, with a
+// confidence in [0, 1]. It's empty if there's no telling.
+type LanguageDetector interface {
+	DetectLanguage(text string) (lang string, confidence float64)
+}
+
+// scriptDetector tells the language by the script of most of the letters:
+// han for zh, kana for ja, hangul for ko and latin for en.
+type scriptDetector struct{}
+
+func (scriptDetector) DetectLanguage(text string) (string, float64) {
+	counts := make(map[string]int)
+	total := 0
+	for _, r := range text {
+		lang := ""
+		switch {
+		case unicode.Is(unicode.Han, r):
+			lang = "zh"
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			lang = "ja"
+		case unicode.Is(unicode.Hangul, r):
+			lang = "ko"
+		case unicode.Is(unicode.Latin, r):
+			lang = "en"
+		default:
+			continue
+		}
+		counts[lang]++
+		total++
+	}
+	if total == 0 {
+		return "", 0
+	}
+	// japanese is written with han too
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		delete(counts, "zh")
+	}
+
+	best := ""
+	for lang, n := range counts {
+		if best == "" || n > counts[best] || (n == counts[best] && lang < best) {
+			best = lang
+		}
+	}
+	return best, float64(counts[best]) / float64(total)
+}
+
+// memoLanguage is the language of content if the binding routes by
+// languages and the detector is confident enough, empty otherwise.
+func (app *larkMessageHandleApp) memoLanguage(s *entity.BindSettings, content string) string {
+	if len(s.LanguageRoutes) == 0 {
+		return ""
+	}
+
+	lang, confidence := app.languageDetector.DetectLanguage(content)
+	if confidence < app.languageConfidence {
+		return ""
+	}
+	return lang
+}
+
+// lang database_id, or lang off
+func setLanguageRoute(s *entity.BindSettings, value string) error {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return fmt.Errorf("lang_route should be like `zh database_id` or `zh off`")
+	}
+
+	lang := strings.ToLower(parts[0])
+	if parts[1] == "off" {
+		delete(s.LanguageRoutes, lang)
+		return nil
+	}
+
+	if s.LanguageRoutes == nil {
+		s.LanguageRoutes = make(map[string]string)
+	}
+	s.LanguageRoutes[lang] = parts[1]
+	return nil
+}
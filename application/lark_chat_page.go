@@ -0,0 +1,184 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+	"github.com/patrickmn/go-cache"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+// chatName resolves the name of chat chatID, it falls back to the chat id
+// when the name can't be resolved.
+func (app *larkMessageHandleApp) chatName(reg *entity.LarkBotRegistar, chatID string) string {
+	name, ok := app.lookupChatName(reg, chatID)
+	if !ok {
+		return chatID
+	}
+	return name
+}
+
+// lookupChatName is the cached name of chat chatID, false if it can't be resolved
+func (app *larkMessageHandleApp) lookupChatName(reg *entity.LarkBotRegistar, chatID string) (string, bool) {
+	// no chat or no bot to ask, e.g. imported and wechat memos
+	if chatID == "" || reg == nil || reg.AppID == "" {
+		return "", false
+	}
+
+	key := reg.AppID + "/" + chatID
+	if name, ok := app.chatNames.Get(key); ok {
+		return name.(string), true
+	}
+
+	name, err := app.messenger.ChatName(reg.AppID, reg.SecretKey, chatID)
+	if err != nil || name == "" {
+		log.Warnf("failed to get name of chat %s. err=%v", chatID, err)
+		return "", false
+	}
+
+	app.chatNames.Set(key, name, cache.DefaultExpiration)
+	return name, true
+}
+
+// chatTag is the tag of the chat of req if the binding tags memos with it,
+// empty if it's off or the name can't be resolved.
+func (app *larkMessageHandleApp) chatTag(req *appendRequest) string {
+	chatID := req.Event.Event.Message.ChatID
+	if !req.Settings.ChatTag || chatID == "" {
+		return ""
+	}
+
+	name, ok := app.lookupChatName(req.Registar, chatID)
+	if !ok {
+		return ""
+	}
+	return utils.NormalizeTag(name)
+}
+
+var _ MemoTagger = &larkMessageHandleApp{}
+
+// MemoTags are the tags of memo besides those of its content: the tag of
+// its chat, if the binding tags memos with it.
+func (app *larkMessageHandleApp) MemoTags(ctx context.Context, bindInfo *entity.BindInfo, memo *entity.Memo) []string {
+	settings, err := bindInfo.GetSettings()
+	if err != nil || !settings.ChatTag || memo.AppID == "" || memo.ChatID == "" {
+		return nil
+	}
+
+	reg, err := app.getBotRegistar(ctx, memo.AppID)
+	if err != nil {
+		log.Warnf("failed to get bot registar of %s. err=%v", memo.AppID, err)
+		return nil
+	}
+	var event lark_message.LarkMessageEvent
+	event.Event.Message.ChatID = memo.ChatID
+	if tag := app.chatTag(&appendRequest{Registar: reg, Settings: &settings, Event: &event}); tag != "" {
+		return []string{tag}
+	}
+	return nil
+}
+
+// mapChatPage handles `/chat parent_page_id [name]` and `/chat off`,
+// the subpage is named after the chat unless a name is given.
+func (app *larkMessageHandleApp) mapChatPage(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.Event, content string) (string, error) {
+	data := strings.Fields(strings.TrimSpace(content))
+	if len(data) < 2 {
+		return "", fmt.Errorf("command should be like `/chat parent_page_id [name]` or `/chat off`")
+	}
+
+	chatID := event.Message.ChatID
+	user := entity.LarkUserInfo{
+		UserId:  event.Sender.SenderID.UserID,
+		UnionId: event.Sender.SenderID.UnionID,
+		OpenId:  event.Sender.SenderID.OpenID,
+	}
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, user.UnionID())
+	if err != nil {
+		return "", fmt.Errorf("请先绑定Notion页面! %s", err)
+	}
+
+	if entity.BindPlatformType(bindInfo.BindPlatform) != entity.BindPlatformTypeNotion {
+		return "", fmt.Errorf("只有Notion绑定支持群子页面")
+	}
+
+	var page *entity.ChatPage
+	msg := "已取消该群的子页面~"
+	if data[1] != "off" {
+		name := strings.Join(data[2:], " ")
+		if name == "" {
+			name = app.chatName(reg, chatID)
+		}
+		page = &entity.ChatPage{
+			ParentPageID: data[1],
+			Name:         name,
+		}
+		msg = fmt.Sprintf("设置成功，该群的memo将保存到子页面「%s」~", name)
+	}
+
+	_, err = app.bindRepo.UpdateSettings(ctx, bindInfo.UnionUserID, func(s *entity.BindSettings) error {
+		if page == nil {
+			delete(s.ChatPages, chatID)
+			return nil
+		}
+		if s.ChatPages == nil {
+			s.ChatPages = make(map[string]*entity.ChatPage)
+		}
+		s.ChatPages[chatID] = page
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return msg, nil
+}
+
+// resolveChatPage returns the subpage mapped to the chat of the memo,
+// it's created on the first memo and kept in the bind settings.
+func (app *larkMessageHandleApp) resolveChatPage(ctx context.Context, req *appendRequest, pageInfo *entity.NotionPageInfo) (string, error) {
+	chatID := req.Event.Event.Message.ChatID
+	cp, ok := req.Settings.ChatPages[chatID]
+	if !ok || cp == nil {
+		return "", nil
+	}
+
+	if cp.PageID != "" {
+		return cp.PageID, nil
+	}
+
+	// don't create the subpage twice for concurrent memos
+	app.chatPageMu.Lock()
+	defer app.chatPageMu.Unlock()
+	key := req.Bind.UnionUserID + "/" + chatID
+	if id, ok := app.chatPages.Get(key); ok {
+		return id.(string), nil
+	}
+
+	id, err := app.notionCli.CreateSubpage(pageInfo.NotionSecretKey, cp.ParentPageID, cp.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create subpage for chat %s, %v", cp.Name, err)
+	}
+	app.chatPages.SetDefault(key, id)
+
+	cp.PageID = id
+	_, err = app.bindRepo.UpdateSettings(ctx, req.Bind.UnionUserID, func(s *entity.BindSettings) error {
+		// unmapped or mapped elsewhere meanwhile
+		latest, ok := s.ChatPages[chatID]
+		if !ok || latest == nil || latest.ParentPageID != cp.ParentPageID {
+			return repository.ErrSettingsUnchanged
+		}
+		latest.PageID = id
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to keep subpage %s of chat %s. err=%v", id, chatID, err)
+	}
+
+	return id, nil
+}
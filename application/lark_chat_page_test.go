@@ -0,0 +1,243 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func newTestNotionBind(theme string) entity.BindInfo {
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{
+		NotionTheme:     theme,
+		NotionSecretKey: "secret",
+		NotionPageID:    "db_xxx",
+	})
+	return entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	}
+}
+
+func TestChatCommand(t *testing.T) {
+	cases := []struct {
+		Command string
+		Name    string
+	}{
+		{Command: "/chat parent_xxx", Name: "产品讨论群"},
+		{Command: "/chat parent_xxx 周会 记录", Name: "周会 记录"},
+	}
+
+	for _, tc := range cases {
+		bindRepo := newFakeBindInfoRepo(newTestNotionBind("gallery"))
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+		app.bindRepo = bindRepo
+		app.messenger.(*fakeLarkMessenger).chatNames = map[string]string{"oc_xxx": "产品讨论群"}
+
+		if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", tc.Command)); err != nil {
+			t.Fatal(err)
+		}
+
+		bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+		settings, _ := bind.GetSettings()
+		cp := settings.ChatPages["oc_xxx"]
+		if cp == nil || cp.ParentPageID != "parent_xxx" || cp.Name != tc.Name || cp.PageID != "" {
+			t.Fatalf("unexpected chat page %+v", cp)
+		}
+	}
+}
+
+func TestChatCommandUnresolvedName(t *testing.T) {
+	bindRepo := newFakeBindInfoRepo(newTestNotionBind("gallery"))
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	app.bindRepo = bindRepo
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "/chat parent_xxx")); err != nil {
+		t.Fatal(err)
+	}
+
+	bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ := bind.GetSettings()
+	if cp := settings.ChatPages["oc_xxx"]; cp == nil || cp.Name != "oc_xxx" {
+		t.Fatalf("expected chat id as name, got %+v", cp)
+	}
+
+	event := newTestLarkEvent("xxx", "/chat off")
+	event.Header.EventID = "event_yyy"
+	if err := app.ProcessMessage(context.TODO(), event); err != nil {
+		t.Fatal(err)
+	}
+	bind, _ = bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ = bind.GetSettings()
+	if len(settings.ChatPages) != 0 {
+		t.Fatalf("expected chat page removed, got %+v", settings.ChatPages)
+	}
+}
+
+func TestResolveChatPage(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "sub_xxx"}`)
+	n.Reply(http.MethodGet, "/pages/sub_xxx", http.StatusOK, `{"object": "page", "id": "sub_xxx", "last_edited_time": "2022-04-01T00:00:00.000Z"}`)
+
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{
+		ChatPages: map[string]*entity.ChatPage{
+			"oc_xxx": {ParentPageID: "parent_xxx", Name: "产品讨论群"},
+		},
+	})
+	bindRepo := newFakeBindInfoRepo(bind)
+	app := NewLarkMessageHandleApp(bindRepo, newFakeLarkBotRegistarRepo(), &fakeMemoRepo{}, nil, nil,
+		func(msg string) {}, Option{Notion: notion.ClientOption{BaseURI: n.URL}})
+
+	for i := 0; i < 2; i++ {
+		if _, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{},
+			newTestLarkEvent("xxx", "hello"), "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var creates, appends int
+	for _, req := range n.Requests() {
+		switch {
+		case req.Method == http.MethodPost && req.Path == "/pages":
+			creates++
+			if req.Body != `{"properties":{"title":{"type":"title","title":[{"type":"text","text":{"content":"产品讨论群"}}]}},"parent":{"page_id":"parent_xxx"},"children":[]}` {
+				t.Fatalf("unexpected subpage %s", req.Body)
+			}
+		case req.Method == http.MethodPatch && req.Path == "/blocks/sub_xxx/children":
+			appends++
+		}
+	}
+	// the subpage is created once and cached for the next memo
+	if creates != 1 || appends != 2 {
+		t.Fatalf("expected 1 subpage and 2 appends, got %d, %d", creates, appends)
+	}
+
+	saved, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ := saved.GetSettings()
+	if settings.ChatPages["oc_xxx"].PageID != "sub_xxx" {
+		t.Fatalf("expected subpage kept in settings, got %+v", settings.ChatPages["oc_xxx"])
+	}
+
+	// memos of other chats take the normal path
+	other := newTestLarkEvent("xxx", "hello")
+	other.Event.Message.ChatID = "oc_yyy"
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+	res, err := app.handleNotionAppend(context.TODO(), &appendRequest{
+		Registar: &entity.LarkBotRegistar{},
+		Bind:     &bind,
+		Settings: &entity.BindSettings{},
+		Event:    other,
+		Content:  "hello",
+	})
+	if err != nil || res.PageID != "page_xxx" {
+		t.Fatalf("expected page in database, got %+v, %v", res, err)
+	}
+}
+
+func TestChatNameProperty(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodGet, "/databases/db_xxx", http.StatusOK, `{"object": "database", "id": "db_xxx", "properties": {
+		"Name": {"name": "Name", "type": "title"},
+		"Channel": {"name": "Channel", "type": "select"}
+	}}`)
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+	cases := []struct {
+		ChatNames map[string]string
+		Value     string
+	}{
+		{ChatNames: map[string]string{"oc_xxx": "产品讨论群"}, Value: `{"type":"select","select":{"name":"产品讨论群"}}`},
+		// the chat can't be resolved
+		{ChatNames: nil, Value: `{"type":"select","select":{"name":"oc_xxx"}}`},
+	}
+	for _, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		bind.Settings = `{"chat_property": "Channel"}`
+		app := NewLarkMessageHandleApp(newFakeBindInfoRepo(bind), newFakeLarkBotRegistarRepo(), &fakeMemoRepo{}, nil, nil,
+			func(msg string) {}, Option{Notion: notion.ClientOption{BaseURI: n.URL}})
+		messenger := &fakeLarkMessenger{chatNames: tc.ChatNames}
+		app.messenger = messenger
+
+		reg := &entity.LarkBotRegistar{AppID: "cli_xxx", SecretKey: "secret"}
+		for i := 0; i < 2; i++ {
+			if _, err := app.appendContent(context.TODO(), reg, newTestLarkEvent("xxx", "hello"), "hello"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var page struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		reqs := n.Requests()
+		if err := json.Unmarshal([]byte(reqs[len(reqs)-1].Body), &page); err != nil {
+			t.Fatal(err)
+		}
+		if string(page.Properties["Channel"]) != tc.Value {
+			t.Fatalf("expected %s, got %s", tc.Value, page.Properties["Channel"])
+		}
+	}
+}
+
+func TestChatTag(t *testing.T) {
+	cases := []struct {
+		ChatNames map[string]string
+		Content   string
+		Tags      string
+	}{
+		{
+			ChatNames: map[string]string{"oc_xxx": "产品 讨论群"},
+			Content:   "#科技 nomo",
+			Tags:      `"Tags":{"type":"multi_select","multi_select":[{"name":"科技"},{"name":"产品_讨论群"}]}`,
+		},
+		// tagged in the content already
+		{
+			ChatNames: map[string]string{"oc_xxx": "科技"},
+			Content:   "#科技 nomo",
+			Tags:      `"Tags":{"type":"multi_select","multi_select":[{"name":"科技"}]}`,
+		},
+		// the name can't be resolved
+		{
+			Content: "nomo",
+		},
+	}
+
+	for _, tc := range cases {
+		n := newFakeNotion()
+		n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+		bind := newTestNotionBind("gallery")
+		bind.SetSettings(&entity.BindSettings{ChatTag: true})
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+		app.messenger = &fakeLarkMessenger{chatNames: tc.ChatNames}
+
+		if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", tc.Content)); err != nil {
+			t.Fatal(err)
+		}
+
+		var page string
+		for _, req := range n.Requests() {
+			if req.Method == http.MethodPost && req.Path == "/pages" {
+				page = req.Body
+			}
+		}
+		if page == "" {
+			t.Fatalf("content: %s, expected the page saved", tc.Content)
+		}
+		if tc.Tags == "" && strings.Contains(page, `"Tags"`) {
+			t.Fatalf("content: %s, expected no tags, got %s", tc.Content, page)
+		}
+		if !strings.Contains(page, tc.Tags) {
+			t.Fatalf("content: %s, expected %s, got %s", tc.Content, tc.Tags, page)
+		}
+		n.Close()
+	}
+}
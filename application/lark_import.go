@@ -0,0 +1,146 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+)
+
+// max number of memos in one import
+const MaxImportItems = 1000
+
+type IImportApp interface {
+	ImportMemos(ctx context.Context, unionUserID string, items []ImportItem) (*ImportResult, error)
+}
+
+type ImportItem struct {
+	Content string `json:"content"`
+	// creation time of the note, now if zero
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ImportItemResult struct {
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	MemoID uint   `json:"memo_id,omitempty"`
+	PageID string `json:"page_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportResult struct {
+	Total   int                `json:"total"`
+	Saved   int                `json:"saved"`
+	Pending int                `json:"pending"`
+	Failed  int                `json:"failed"`
+	Items   []ImportItemResult `json:"items"`
+}
+
+const (
+	importStatusSaved   = "saved"
+	importStatusPending = "pending"
+	importStatusFailed  = "failed"
+)
+
+var _ IImportApp = &larkMessageHandleApp{}
+
+// ImportMemos saves the existing notes of a user to the bound notion page one
+// by one at the import rate, a failed item doesn't stop the others.
+func (app *larkMessageHandleApp) ImportMemos(ctx context.Context, unionUserID string, items []ImportItem) (*ImportResult, error) {
+	if len(items) > MaxImportItems {
+		return nil, fmt.Errorf("too many memos, at most %d at a time", MaxImportItems)
+	}
+
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, unionUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// lark doc needs the bot the memo comes from
+	if entity.BindPlatformType(bindInfo.BindPlatform) != entity.BindPlatformTypeNotion {
+		return nil, fmt.Errorf("only notion binding supports import. platform=%d", bindInfo.BindPlatform)
+	}
+
+	var ticker *time.Ticker
+	if app.importRate > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(app.importRate))
+		defer ticker.Stop()
+	}
+
+	res := &ImportResult{Total: len(items), Items: make([]ImportItemResult, 0, len(items))}
+	for i := range items {
+		if ticker != nil && i > 0 {
+			select {
+			case <-ctx.Done():
+				return res, ctx.Err()
+			case <-ticker.C:
+			}
+		}
+
+		item := app.importMemo(ctx, bindInfo, &items[i])
+		item.Index = i
+		switch item.Status {
+		case importStatusSaved:
+			res.Saved++
+		case importStatusPending:
+			res.Pending++
+		default:
+			res.Failed++
+		}
+		res.Items = append(res.Items, item)
+
+		if (i+1)%10 == 0 || i+1 == len(items) {
+			log.Infof("import memos of %s, %d/%d processed, %d failed", unionUserID, i+1, len(items), res.Failed)
+		}
+	}
+
+	return res, nil
+}
+
+// importMemo takes item through the same steps as a memo sent to the bot,
+// redaction, the capture switch, the daily cap and the character budget
+// included.
+func (app *larkMessageHandleApp) importMemo(ctx context.Context, bindInfo *entity.BindInfo, item *ImportItem) ImportItemResult {
+	content := strings.TrimSpace(item.Content)
+	if content == "" {
+		return ImportItemResult{Status: importStatusFailed, Error: "empty content"}
+	}
+
+	createdAt := item.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	var event lark_message.LarkMessageEvent
+	event.Event.Message.CreatedTime = strconv.FormatInt(createdAt.UnixNano()/int64(time.Millisecond), 10)
+
+	memo, err := app.processMemo(ctx, &appendRequest{
+		Registar: &entity.LarkBotRegistar{},
+		Bind:     bindInfo,
+		Event:    &event,
+		Content:  content,
+	})
+	var res ImportItemResult
+	if memo != nil {
+		res.MemoID = memo.ID
+	}
+	var partial *partialWriteError
+	switch {
+	case err == nil || errors.As(err, &partial):
+		res.Status, res.PageID = importStatusSaved, memo.PageID
+	case memo != nil && memo.ID != 0 && entity.MemoStatusType(memo.Status) == entity.MemoStatusPending:
+		res.Status = importStatusPending
+	default:
+		res.Status = importStatusFailed
+	}
+	if err != nil && res.Status != importStatusPending {
+		res.Error = err.Error()
+	}
+	return res
+}
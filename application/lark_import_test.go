@@ -0,0 +1,135 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestImportMemos(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{ImportRate: 100}, bind)
+
+	var createdTimes []string
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		createdTimes = append(createdTimes, req.Event.Event.Message.CreatedTime)
+		if strings.Contains(req.Content, "fail") {
+			return appendResult{}, fmt.Errorf("notion is down")
+		}
+		return appendResult{PageID: "page_" + req.Content, Pages: 1}, nil
+	}
+
+	items := []ImportItem{
+		{Content: "first", CreatedAt: time.Unix(1650000000, 0)},
+		{Content: "please fail"},
+		{Content: "  "},
+		{Content: "last"},
+	}
+	res, err := app.ImportMemos(context.TODO(), "lark_xxx", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Total != 4 || res.Saved != 2 || res.Failed != 2 || len(res.Items) != 4 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	expected := []ImportItemResult{
+		{Index: 0, Status: importStatusSaved, MemoID: 1, PageID: "page_first"},
+		{Index: 1, Status: importStatusFailed, MemoID: 2, Error: "notion is down"},
+		{Index: 2, Status: importStatusFailed, Error: "empty content"},
+		{Index: 3, Status: importStatusSaved, MemoID: 3, PageID: "page_last"},
+	}
+	for i := range expected {
+		if res.Items[i] != expected[i] {
+			t.Fatalf("expected %+v, got %+v", expected[i], res.Items[i])
+		}
+	}
+
+	// each imported note is kept as a memo
+	if len(memoRepo.memos) != 3 || memoRepo.memos[1].Status != uint8(entity.MemoStatusFailed) ||
+		memoRepo.memos[1].LastError != "notion is down" {
+		t.Fatalf("unexpected memos %+v", memoRepo.memos)
+	}
+	if createdTimes[0] != "1650000000000" {
+		t.Fatalf("expected creation time of the note, got %s", createdTimes[0])
+	}
+
+	if _, err := app.ImportMemos(context.TODO(), "lark_yyy", items); err == nil {
+		t.Fatal("expected error of unbound user")
+	}
+	if _, err := app.ImportMemos(context.TODO(), "lark_xxx", make([]ImportItem, MaxImportItems+1)); err == nil {
+		t.Fatal("expected error of too many memos")
+	}
+}
+
+func TestImportMemosLikeSent(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{RedactPatterns: []string{"card"}})
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{DailyPageCap: 2}, bind)
+	app.clock = &fakeClock{now: time.Date(2022, 4, 15, 10, 0, 0, 0, time.Local)}
+
+	var written []string
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		written = append(written, req.Content)
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	items := []ImportItem{
+		{Content: "卡号 4111 1111 1111 1111 记得还款"},
+		{Content: "second"},
+		{Content: "over the cap"},
+	}
+	res, err := app.ImportMemos(context.TODO(), "lark_xxx", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written) != 2 || written[0] != "卡号 [已隐藏] 记得还款" || memoRepo.memos[0].Content != written[0] {
+		t.Fatalf("expected the card redacted, got %v", written)
+	}
+	if res.Saved != 2 || res.Failed != 1 || res.Items[2].Error != ErrDailyCapReached.Error() {
+		t.Fatalf("expected the last memo over the cap, got %+v", res)
+	}
+	latest, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if settings, _ := latest.GetSettings(); settings.PagesToday == nil || settings.PagesToday.Count != 2 {
+		t.Fatalf("expected the imported pages counted, got %+v", settings.PagesToday)
+	}
+}
+
+func TestImportMemosWithoutChat(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	for _, kv := range [][2]string{{"body_template", "{{.Source}}|{{.Content}}"}, {"chat_property", "Chat"}, {"chat_tag", "on"}} {
+		if err := ApplySetting(&settings, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bind.SetSettings(&settings)
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{}, bind)
+	messenger := app.messenger.(*fakeLarkMessenger)
+	var body string
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		body = app.pageBody(req, req.Content, nil)
+		app.pageOptions(req)
+		app.chatTag(req)
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	res, err := app.ImportMemos(context.TODO(), "lark_xxx", []ImportItem{{Content: "imported"}})
+	if err != nil || res.Saved != 1 {
+		t.Fatalf("expected the memo imported, got %+v, err=%v", res, err)
+	}
+	// no bot of imported memos to ask for the chat name
+	if messenger.chatNameCalls != 0 || body != "|imported" {
+		t.Fatalf("expected no chat name looked up, got %d calls, body %q", messenger.chatNameCalls, body)
+	}
+}
@@ -3,8 +3,11 @@ package application
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/KDF5000/pkg/log"
@@ -18,53 +21,191 @@ import (
 	. "github.com/KDF5000/nomo/infrastructure/utils"
 )
 
-var (
-	helpInfo = `
-	Usage:
-	  /register app_id secret_key                 register a lark bot
-	  /bind notion secret_key page_id [theme]     bind notion page
-	  /bind doc app_id secret_key page_id [theme] bind lark doc page
-`
-)
-
 type ILarkMessageHandleApp interface {
 	ProcessMessage(ctx context.Context, event *lark_message.LarkMessageEvent) error
 	VerifyURL(ctx context.Context, event *lark_message.UrlVerificationEvent) (*lark_message.UrlVerificationResult, error)
 }
 
-type appendHandler func(ctx context.Context, reg *entity.LarkBotRegistar, pageInfo string, content string) error
+type appendResult struct {
+	// id of the page created for content if any, the first of several
+	PageID string
+	// ids of all the pages created, of a memo written to several databases
+	PageIDs []string
+	// the page is read back after created
+	Verified bool
+	// number of pages created or appended to, counted by the daily cap. A
+	// failed write may have created some too
+	Pages int
+	// failures of a memo written to some of its databases only
+	Partial error
+}
+
+type appendRequest struct {
+	Registar *entity.LarkBotRegistar
+	Bind     *entity.BindInfo
+	Settings *entity.BindSettings
+	Event    *lark_message.LarkMessageEvent
+	Content  string
+}
+
+type appendHandler func(ctx context.Context, req *appendRequest) (appendResult, error)
 
 type larkMessageHandleApp struct {
 	bindRepo        repository.BindInfoRepository
 	botRegistarRepo repository.LarkBotRegistarRepository
+	memoRepo        repository.MemoRepository
+	analyticsRepo   repository.AnalyticsRepository
 	larkNotify      LarkNotify
+	messenger       LarkMessenger
 	notionCli       *notion.NotionClient
 	larkDocWrapper  *lark_doc.LarkDocWrapper
+	notionWrites    *notionWriteSwitch
+	clock           Clock
+	started         time.Time
+	stats           *memoStats
 
 	// use different handle for diff theme
 	handlers map[entity.BindPlatformType]appendHandler
 	// case message for deduplication
 	eventCache *cache.Cache
+	// union user id/chat id => subpage just created, until it's kept in bind settings
+	chatPages *cache.Cache
+	// app id/chat id => chat name
+	chatNames  *cache.Cache
+	chatPageMu sync.Mutex
+	// index pages are changed by a memo at a time, not to create one twice
+	indexPageMu sync.Mutex
+	// keep the bindings of the same notion page on other platforms in sync
+	syncSharedBindings bool
+	// warn of the capabilities the integration lacks on bind
+	checkCapabilities bool
+	// slash commands of the bot, listed by /help
+	commands *commandRegistry
+	// images are saved if there's a store, those over the max size are
+	// downscaled if there's a downscaler, otherwise saved as placeholders
+	imageStore      ImageStore
+	imageDownscaler ImageDownscaler
+	maxImageSize    int64
+	// downloads of an image, waiting resourceRetryDelay doubled after each
+	// failed one
+	resourceAttempts   int
+	resourceRetryDelay time.Duration
+	// key of the sealed originals of redacted memos, not kept if empty
+	redactionKey string
+	// language of memos for language routes, confident from languageConfidence
+	languageDetector   LanguageDetector
+	languageConfidence float64
+	// audit trail of the memos, none if nil
+	auditSink AuditSink
+	// database id => true once warned of its tag options for the day
+	tagOptionsWarned *cache.Cache
+	// keep inbound event metadata with each memo
+	storeMetadata bool
+	// keep the original message with each memo
+	storeRawContent bool
+	// read notion pages back after created
+	verifyWrites bool
+	// explain access errors of notion writes and mark the bindings
+	accessHints bool
+	// max number of writes tried for a memo
+	retryBudget int
+	// runes tags are split on, and their case
+	tagSeparators string
+	tagCase       string
+	// queue memos for the pending worker, woken by pendingWake
+	queueInbound bool
+	pendingWake  chan struct{}
+	// max notion writes of a binding a day, and whether to queue the memos over it
+	dailyCap     int
+	queueOverCap bool
+	// max characters written for a binding a month
+	charBudget int
+	// max runes of content in logs and notifications
+	previewLen int
+	// memos imported per second
+	importRate int
+	// max runes of a reply and how to send a longer one
+	replyMaxLen   int
+	replyOverflow string
+	// keep anonymized analytics of memos
+	analytics     bool
+	analyticsSalt string
 }
 
 var _ ILarkMessageHandleApp = &larkMessageHandleApp{}
 
 func NewLarkMessageHandleApp(repo repository.BindInfoRepository,
 	registarRepo repository.LarkBotRegistarRepository,
-	notifier LarkNotify) *larkMessageHandleApp {
+	memoRepo repository.MemoRepository,
+	flagRepo repository.FlagRepository,
+	analyticsRepo repository.AnalyticsRepository,
+	notifier LarkNotify, opt Option) *larkMessageHandleApp {
 	app := &larkMessageHandleApp{
-		bindRepo:        repo,
-		botRegistarRepo: registarRepo,
-		larkNotify:      notifier,
-		notionCli:       &notion.NotionClient{},
-		larkDocWrapper:  &lark_doc.LarkDocWrapper{},
-		handlers:        make(map[entity.BindPlatformType]appendHandler),
-		eventCache:      cache.New(3*time.Minute, 10*time.Minute),
+		bindRepo:           repo,
+		botRegistarRepo:    registarRepo,
+		memoRepo:           memoRepo,
+		analyticsRepo:      analyticsRepo,
+		larkNotify:         notifier,
+		messenger:          NewLarkMessenger(NewLarkOpenAPI(opt.LarkOpenAPI)),
+		notionCli:          notion.NewNotionClient(opt.Notion),
+		larkDocWrapper:     &lark_doc.LarkDocWrapper{},
+		notionWrites:       newNotionWriteSwitch(flagRepo),
+		clock:              RealClock,
+		started:            RealClock.Now(),
+		stats:              &memoStats{},
+		handlers:           make(map[entity.BindPlatformType]appendHandler),
+		eventCache:         cache.New(3*time.Minute, 10*time.Minute),
+		chatPages:          cache.New(10*time.Minute, 30*time.Minute),
+		chatNames:          cache.New(30*time.Minute, time.Hour),
+		tagOptionsWarned:   cache.New(24*time.Hour, time.Hour),
+		auditSink:          opt.AuditSink,
+		languageDetector:   opt.LanguageDetector,
+		languageConfidence: opt.LanguageConfidence,
+		redactionKey:       opt.RedactionKey,
+		syncSharedBindings: opt.SyncSharedBindings,
+		checkCapabilities:  opt.CheckCapabilities,
+		storeMetadata:      opt.StoreMemoMetadata,
+		storeRawContent:    opt.StoreRawContent,
+		verifyWrites:       opt.VerifyNotionWrites,
+		accessHints:        opt.NotionAccessHints,
+		retryBudget:        opt.MemoRetryBudget,
+		tagSeparators:      opt.Notion.TagSeparators,
+		tagCase:            opt.Notion.TagCase,
+		queueInbound:       opt.QueueInbound,
+		pendingWake:        make(chan struct{}, 1),
+		commands:           &commandRegistry{},
+		imageStore:         opt.ImageStore,
+		imageDownscaler:    opt.ImageDownscaler,
+		maxImageSize:       opt.MaxImageSize,
+		resourceAttempts:   opt.ResourceAttempts,
+		resourceRetryDelay: defaultResourceRetryDelay,
+		dailyCap:           opt.DailyPageCap,
+		queueOverCap:       opt.QueueOverCap,
+		charBudget:         opt.MonthlyCharBudget,
+		previewLen:         opt.PreviewLength,
+		importRate:         opt.ImportRate,
+		replyMaxLen:        opt.ReplyMaxLength,
+		replyOverflow:      opt.ReplyOverflow,
+		analytics:          opt.MemoAnalytics && analyticsRepo != nil,
+		analyticsSalt:      opt.AnalyticsSalt,
+	}
+	if app.languageDetector == nil {
+		app.languageDetector = scriptDetector{}
+	}
+	if app.languageConfidence <= 0 {
+		app.languageConfidence = defaultLanguageConfidence
+	}
+	if app.maxImageSize <= 0 {
+		app.maxImageSize = defaultMaxImageSize
+	}
+	if app.resourceAttempts <= 0 {
+		app.resourceAttempts = defaultResourceAttempts
 	}
 
 	// register handler for diffrent theme
 	app.handlers[entity.BindPlatformTypeLarkDoc] = app.handleLarkAppend
 	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+	app.registerCommands()
 
 	return app
 }
@@ -97,9 +238,30 @@ func (app *larkMessageHandleApp) registerLarkBot(ctx context.Context, header *la
 	return &reg, nil
 }
 
-func (app *larkMessageHandleApp) isBindCommand(content string) bool {
-	data := strings.TrimSpace(content)
-	return strings.HasPrefix(data, "/bind")
+// /set key value
+func (app *larkMessageHandleApp) setBindSettings(ctx context.Context, userID *lark_message.UserID, content string) error {
+	data := strings.Fields(strings.TrimSpace(content))
+	if len(data) < 3 {
+		return fmt.Errorf("command should be like `/set key value`, keys: %s", SettingKeys())
+	}
+
+	user := entity.LarkUserInfo{
+		UserId:  userID.UserID,
+		UnionId: userID.UnionID,
+		OpenId:  userID.OpenID,
+	}
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, user.UnionID())
+	if err != nil {
+		return fmt.Errorf("请先绑定Notion页面! %s", err)
+	}
+
+	// the value keeps its spaces and lines, e.g. of a template
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(content), data[0]))
+	value := strings.TrimSpace(strings.TrimPrefix(rest, data[1]))
+	_, err = app.bindRepo.UpdateSettings(ctx, bindInfo.UnionUserID, func(s *entity.BindSettings) error {
+		return ApplySetting(s, data[1], value)
+	})
+	return err
 }
 
 func (app *larkMessageHandleApp) isValidTheme(theme string) bool {
@@ -116,7 +278,7 @@ func (app *larkMessageHandleApp) isValidTheme(theme string) bool {
 func (app *larkMessageHandleApp) bindLakrDocPage(ctx context.Context, userID *lark_message.UserID, content string) (err error) {
 	data := strings.Fields(strings.TrimSpace(content))
 	if len(data) < 3 {
-		return fmt.Errorf(helpInfo)
+		return fmt.Errorf("%s", app.commands.Help())
 	}
 
 	theme := DefaultTheme
@@ -156,17 +318,38 @@ func (app *larkMessageHandleApp) bindLakrDocPage(ctx context.Context, userID *la
 	return app.bindRepo.UpdateOrInsert(ctx, &bindInfo)
 }
 
+// /bind notion secret_key page_id [theme] or /bind doc page_id [theme]
+func (app *larkMessageHandleApp) handleBindCommand(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error) {
+	parts := strings.Fields(strings.TrimSpace(content))
+	var note string
+	var err error
+	switch {
+	case len(parts) > 1 && parts[1] == "notion":
+		note, err = app.bindNotionPage(ctx, &event.Event.Sender.SenderID, content)
+	case len(parts) > 1 && parts[1] == "doc":
+		err = app.bindLakrDocPage(ctx, &event.Event.Sender.SenderID, content)
+	default:
+		log.Errorf("invalid bind command. %s", Preview(content, app.previewLen))
+		return app.commands.Help(), fmt.Errorf("invalid bind command, %s", Preview(content, app.previewLen))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return bindSuccMessage(note), nil
+}
+
 // /bind notion secret_key page_id [theme]
-func (app *larkMessageHandleApp) bindNotionPage(ctx context.Context, userID *lark_message.UserID, content string) (err error) {
+func (app *larkMessageHandleApp) bindNotionPage(ctx context.Context, userID *lark_message.UserID, content string) (note string, err error) {
 	data := strings.Fields(strings.TrimSpace(content))
 	if len(data) < 4 {
-		return fmt.Errorf(helpInfo)
+		return "", fmt.Errorf("%s", app.commands.Help())
 	}
 
 	theme := DefaultTheme
 	if len(data) > 4 {
 		if !app.isValidTheme(data[4]) {
-			return fmt.Errorf("invalid theme, must be one of [flat, gallery]")
+			return "", fmt.Errorf("invalid theme, must be one of [flat, gallery]")
 		}
 
 		theme = data[4]
@@ -195,96 +378,589 @@ func (app *larkMessageHandleApp) bindNotionPage(ctx context.Context, userID *lar
 		NotionTheme:     theme,
 	}
 	if info, err = json.Marshal(&pageInfo); err != nil {
-		return err
+		return "", err
 	}
 	bindInfo.PageInfo = string(info)
 
-	return app.bindRepo.UpdateOrInsert(ctx, &bindInfo)
+	note, err = bindNotion(ctx, app.bindRepo, &bindInfo, app.syncSharedBindings)
+	if err == nil && app.checkCapabilities {
+		note = joinNotes(note, capabilityNote(app.notionCli, &pageInfo))
+	}
+	return note, err
 }
 
-func (app *larkMessageHandleApp) handleLarkAppend(ctx context.Context, reg *entity.LarkBotRegistar, pageInfo string, content string) error {
+func (app *larkMessageHandleApp) handleLarkAppend(ctx context.Context, req *appendRequest) (appendResult, error) {
 	var docInfo entity.LarkDocPageInfo
-	if err := json.Unmarshal([]byte(pageInfo), &docInfo); err != nil {
-		return err
+	if err := json.Unmarshal([]byte(req.Bind.PageInfo), &docInfo); err != nil {
+		return appendResult{}, err
 	}
 
+	reg, content := req.Registar, req.Content
+	// the docs bound on the other platforms are written by their own app
+	if docInfo.AppID != "" {
+		reg = &entity.LarkBotRegistar{AppID: docInfo.AppID, SecretKey: docInfo.SecretKey}
+	}
 	// log.Infof("token: %s, theme: %s, content: %s", docInfo.DocToken, docInfo.DocTheme, content)
 
+	var res appendResult
 	var err error
 	switch docInfo.DocTheme {
 	case "flat":
-		err = app.larkDocWrapper.InsertBlock(reg.AppID, reg.SecretKey, docInfo.DocToken, content)
+		if err = app.larkDocWrapper.InsertBlock(reg.AppID, reg.SecretKey, docInfo.DocToken, content); err == nil {
+			res.Pages = 1
+		}
 	default:
 		err = fmt.Errorf("invalid theme %s", docInfo.DocTheme)
 	}
 
-	return err
+	return res, err
 }
 
-func (app *larkMessageHandleApp) handleNotionAppend(ctx context.Context, reg *entity.LarkBotRegistar, pageStr string, content string) error {
+func (app *larkMessageHandleApp) handleNotionAppend(ctx context.Context, req *appendRequest) (appendResult, error) {
 	var pageInfo entity.NotionPageInfo
-	if err := json.Unmarshal([]byte(pageStr), &pageInfo); err != nil {
-		return err
+	if err := json.Unmarshal([]byte(req.Bind.PageInfo), &pageInfo); err != nil {
+		return appendResult{}, err
 	}
 
 	// log.Infof("key: %s, id: %s, theme: %s, content: %s",
 	// 	pageInfo.NotionSecretKey, pageInfo.NotionPageID, pageInfo.NotionTheme, content)
 
-	var err error
+	// the database directive picks the database of gallery memos
+	dbDirective, err := directiveDatabase(req.Settings, req.Content)
+	if err != nil {
+		return appendResult{}, err
+	}
+	_, content, _ := parseDatabaseDirective(req.Content)
+	tags := scanTags(content, app.tagSeparators, app.tagCase)
+	chatTag := app.chatTag(req)
+	if chatTag != "" {
+		tags = append(tags, chatTag)
+	}
+	body := app.pageBody(req, content, tags)
+	var res appendResult
+	if scratchPageID := scratchPage(req.Settings, tags); scratchPageID != "" {
+		err = app.notionCli.AppendScratch(pageInfo.NotionSecretKey, scratchPageID,
+			scratchSeparator(req.Settings, eventTime(req.Event)), body)
+		if err == nil {
+			res.Pages = 1
+		}
+		return res, err
+	}
+	// memos of a mapped chat are appended to its own subpage
+	chatPageID, err := app.resolveChatPage(ctx, req, &pageInfo)
+	if err != nil {
+		return res, err
+	}
+	if chatPageID != "" {
+		if err = app.notionCli.AppendBlock(pageInfo.NotionSecretKey, chatPageID, body); err == nil {
+			res.Pages = 1
+		}
+		return res, err
+	}
+
 	switch pageInfo.NotionTheme {
 	case "flat":
-		err = app.notionCli.AppendBlock(pageInfo.NotionSecretKey, pageInfo.NotionPageID, content)
+		if err = app.notionCli.AppendBlock(pageInfo.NotionSecretKey, pageInfo.NotionPageID, body); err == nil {
+			res.Pages = 1
+		}
 	case "gallery":
-		err = app.notionCli.AddNewPage2Database(pageInfo.NotionSecretKey, pageInfo.NotionPageID, content)
+		dbId := routeDatabase(req.Settings, tags, content, app.memoLanguage(req.Settings, content), pageInfo.NotionPageID)
+		if dbDirective != "" {
+			dbId = dbDirective
+		}
+		opts := app.pageOptions(req)
+		if chatTag != "" {
+			opts.Tags = []string{chatTag}
+		}
+		if body != content {
+			opts.Body = body
+		}
+		var streak entity.Streak
+		if req.Settings.StreakProperty != "" {
+			streak = advanceStreak(req.Settings.Streak, app.memoTime(req), location(req.Settings))
+			opts.Numbers = map[string]int64{req.Settings.StreakProperty: int64(streak.Days)}
+		}
+		var sections []notion.Section
+		if req.Settings.SplitHeading > 0 {
+			sections = notion.SplitSections(body, req.Settings.SplitHeading)
+		}
+		// the directive picks a single database
+		dbIds := []string{dbId}
+		if dbDirective == "" {
+			dbIds = galleryDatabases(req.Settings, tags, dbId)
+		}
+		var failed []string
+		created, written := 0, 0
+		for _, id := range dbIds {
+			pageID, pages, werr := app.createGalleryPage(pageInfo.NotionSecretKey, id, content, sections, opts)
+			res.Pages += pages
+			if werr == nil {
+				created++
+				app.warnTagOptions(req, pageInfo.NotionSecretKey, id, tags)
+				app.addToIndex(ctx, req, pageInfo.NotionSecretKey, pageID, content)
+				if app.verifyWrites {
+					werr = app.notionCli.VerifyPage(pageInfo.NotionSecretKey, pageID, content)
+				}
+			}
+			// the memo keeps the first page created
+			if res.PageID == "" && pageID != "" {
+				res.PageID, res.Verified = pageID, app.verifyWrites && werr == nil
+			}
+			if pageID != "" {
+				res.PageIDs = append(res.PageIDs, pageID)
+			}
+			if werr != nil {
+				err = werr
+				failed = append(failed, fmt.Sprintf("%s: %v", id, werr))
+			} else {
+				written++
+			}
+		}
+		if created > 0 && streak.Days > 0 {
+			app.keepStreak(ctx, req)
+		}
+		if len(dbIds) > 1 && written > 0 && len(failed) > 0 {
+			res.Partial = &partialWriteError{written: written, failed: failed}
+			err = nil
+		}
 	default:
 		err = fmt.Errorf("invalid theme %s", pageInfo.NotionTheme)
 	}
 
-	return err
+	return res, err
+}
+
+// createGalleryPage creates the page of content in database dbId, split
+// into a page per section under an index if there's more than one, and
+// returns the number of pages created with it. Of a split failed midway,
+// only the index is known to be created.
+func (app *larkMessageHandleApp) createGalleryPage(notionKey, dbId, content string, sections []notion.Section, opts notion.PageOptions) (string, int, error) {
+	var pageID string
+	var err error
+	// a single section isn't worth an index
+	if len(sections) > 1 {
+		pageID, err = app.notionCli.AddSectionPages2Database(notionKey, dbId, content, sections, opts)
+		if err == nil {
+			return pageID, 1 + len(sections), nil
+		}
+	} else {
+		pageID, err = app.notionCli.AddNewPage2Database(notionKey, dbId, content, opts)
+	}
+	if pageID == "" {
+		return "", 0, err
+	}
+	return pageID, 1, err
+}
+
+func (app *larkMessageHandleApp) newMemo(event *lark_message.LarkMessageEvent, bindInfo *entity.BindInfo, content string) *entity.Memo {
+	memo := &entity.Memo{
+		UnionUserID:  bindInfo.UnionUserID,
+		BindPlatform: bindInfo.BindPlatform,
+		AppID:        event.Header.AppID,
+		ChatID:       event.Event.Message.ChatID,
+		MessageID:    event.Event.Message.MessageID,
+		Content:      content,
+		Status:       uint8(entity.MemoStatusSaved),
+	}
+
+	if app.storeRawContent {
+		if raw, err := event.Event.Message.GetMessageText(); err == nil && raw != content {
+			memo.RawContent = raw
+		}
+	}
+
+	if app.storeMetadata {
+		platform := "lark"
+		if entity.UserPlatformType(bindInfo.UserPlatform) == entity.UserPlatformTypeWx {
+			platform = "wechat"
+		}
+		meta := entity.MemoMetadata{
+			Platform:   platform,
+			AppID:      event.Header.AppID,
+			EventID:    event.Header.EventID,
+			MessageID:  event.Event.Message.MessageID,
+			ChatID:     event.Event.Message.ChatID,
+			CreateTime: event.Event.Message.CreatedTime,
+		}
+		data, _ := json.Marshal(&meta)
+		memo.Metadata = string(data)
+	}
+
+	return memo
+}
+
+// eventTime is when the message of event was sent, zero if unknown
+func eventTime(event *lark_message.LarkMessageEvent) time.Time {
+	// lark sends the create time in milliseconds
+	ms, err := strconv.ParseInt(event.Event.Message.CreatedTime, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// pageBody is content rendered by the body template of the binding,
+// content itself if there's none or it fails.
+func (app *larkMessageHandleApp) pageBody(req *appendRequest, content string, tags []string) string {
+	if req.Settings == nil || req.Settings.BodyTemplate == "" {
+		return content
+	}
+
+	data := bodyTemplateData{
+		Content:  content,
+		Tags:     tags,
+		Time:     app.memoTime(req),
+		Platform: "lark",
+	}
+	// resolving the chat name costs an api call
+	if strings.Contains(req.Settings.BodyTemplate, ".Source") {
+		data.Source = app.chatName(req.Registar, req.Event.Event.Message.ChatID)
+	}
+	body, err := renderBody(req.Settings.BodyTemplate, &data)
+	if err != nil {
+		log.Warnf("render body template of %s error, save the content as is. err=%v", req.Bind.UnionUserID, err)
+		return content
+	}
+	return body
 }
 
-func (app *larkMessageHandleApp) appendContent(ctx context.Context, registar *entity.LarkBotRegistar, event *lark_message.Event, content string) error {
+func (app *larkMessageHandleApp) pageOptions(req *appendRequest) notion.PageOptions {
+	opts := notion.PageOptions{CreatedAt: eventTime(req.Event)}
+	if req.Settings != nil {
+		// dates like 明天 in the memo are of the user's day
+		opts.CreatedAt = opts.CreatedAt.In(location(req.Settings))
+	}
+
+	if req.Settings != nil && req.Settings.SortField != "" {
+		opts.SortField = &notion.SortField{
+			Property: req.Settings.SortField,
+			Strategy: req.Settings.SortStrategy,
+		}
+	}
+
+	if req.Settings != nil && req.Settings.ChatProperty != "" && req.Event.Event.Message.ChatID != "" {
+		opts.ChatProperty = req.Settings.ChatProperty
+		opts.ChatName = app.chatName(req.Registar, req.Event.Event.Message.ChatID)
+	}
+
+	if req.Settings != nil && req.Settings.TimezoneProperty != "" {
+		opts.TimezoneProperty = req.Settings.TimezoneProperty
+		opts.Timezone = req.Settings.Timezone
+	}
+
+	if req.Settings != nil {
+		opts.RelatedProperty = req.Settings.RelatedProperty
+	}
+
+	// the template is checked when it's set
+	if req.Settings != nil && req.Settings.PageTemplate != "" {
+		template, err := notion.ParsePageTemplate(req.Settings.PageTemplate)
+		if err != nil {
+			log.Warnf("invalid page template of %s, save the memo alone. err=%v", req.Bind.UnionUserID, err)
+		}
+		opts.Template = template
+	}
+
+	// the content has the names in place of the mentions, queued memos
+	// have no message to find them in
+	if req.Settings != nil && req.Settings.MentionProperty != "" {
+		if text, err := req.Event.Event.Message.GetMessageRawContent(); err == nil {
+			if mentions := memoMentions(&req.Event.Event.Message, text); len(mentions) > 0 {
+				opts.MentionProperty = req.Settings.MentionProperty
+				opts.Mentions = notionMentions(req.Settings, mentions)
+			}
+		}
+	}
+	return opts
+}
+
+func (app *larkMessageHandleApp) saveMemo(ctx context.Context, memo *entity.Memo) {
+	// the memo has been handled, never fail it because of bookkeeping
+	if err := app.memoRepo.Create(ctx, memo); err != nil {
+		log.Errorf("failed to save memo. err=%v", err)
+	}
+	app.saveAnalytics(ctx, memo)
+	app.auditMemo(memo)
+}
+
+func (app *larkMessageHandleApp) saveAnalytics(ctx context.Context, memo *entity.Memo) {
+	if app.analytics {
+		row := newMemoAnalytics(app.analyticsSalt, memo.Content, memo.BindPlatform, entity.MemoStatusType(memo.Status))
+		if err := app.analyticsRepo.Create(ctx, row); err != nil {
+			log.Errorf("failed to save memo analytics. err=%v", err)
+		}
+	}
+}
+
+// appendContent returns the binding of the sender once it's found
+func (app *larkMessageHandleApp) appendContent(ctx context.Context, registar *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (*entity.BindInfo, error) {
+	sender := &event.Event.Sender.SenderID
 	user := entity.LarkUserInfo{
-		UserId:  event.Sender.SenderID.UserID,
-		UnionId: event.Sender.SenderID.UnionID,
-		OpenId:  event.Sender.SenderID.OpenID,
+		UserId:  sender.UserID,
+		UnionId: sender.UnionID,
+		OpenId:  sender.OpenID,
 	}
 
 	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, user.UnionID())
 	if err != nil {
 		log.Error(err.Error())
-		return fmt.Errorf("请先绑定Notion页面! %s", err)
+		return nil, fmt.Errorf("请先绑定Notion页面! %s", err)
 	}
 
+	_, err = app.processMemo(ctx, &appendRequest{
+		Registar: registar,
+		Bind:     bindInfo,
+		Event:    event,
+		Content:  content,
+	})
+	return bindInfo, err
+}
+
+// processMemo takes the content of req through the steps of every memo,
+// however it came in: normalized, redacted, paused, capped and written,
+// then kept. It returns the memo unless it's rejected before made one,
+// which is only stored if it has an ID.
+func (app *larkMessageHandleApp) processMemo(ctx context.Context, req *appendRequest) (*entity.Memo, error) {
+	bindInfo, event, content := req.Bind, req.Event, req.Content
 	handler, ok := app.handlers[entity.BindPlatformType(bindInfo.BindPlatform)]
 	if !ok {
-		return fmt.Errorf("invalid bind platform. platform=%d", bindInfo.BindPlatform)
+		return nil, fmt.Errorf("invalid bind platform. platform=%d", bindInfo.BindPlatform)
+	}
+
+	settings, err := bindInfo.GetSettings()
+	if err != nil {
+		log.Warnf("invalid settings of %s, %v", bindInfo.UnionUserID, err)
+	}
+
+	original := content
+	content = normalizeContent(&settings, content)
+	if settings.MentionProperty != "" {
+		content = replaceMentions(content, memoMentions(&event.Event.Message, content))
+	}
+	content, redacted := redactContent(&settings, content)
+	// rather than failing the memo later on
+	if _, err := directiveDatabase(&settings, content); err != nil {
+		return nil, err
+	}
+	// likely sent by accident
+	if app.tooShort(&settings, content) {
+		return nil, ErrMemoTooShort
+	}
+	if entity.BindPlatformType(bindInfo.BindPlatform) == entity.BindPlatformTypeLarkDoc && hasImage(content) {
+		return nil, ErrImagesUnsupported
+	}
+
+	memo := app.newMemo(event, bindInfo, content)
+	if redacted {
+		app.keepOriginal(&settings, memo, original)
+	}
+	switch settings.Capture {
+	case entity.CaptureOff:
+		return memo, ErrCapturePaused
+	case entity.CaptureQueue:
+		memo.Status = uint8(entity.MemoStatusPending)
+		app.saveMemo(ctx, memo)
+		return memo, ErrCaptureQueued
+	}
+
+	// queue the memo until notion writes are enabled again
+	if entity.BindPlatformType(bindInfo.BindPlatform) == entity.BindPlatformTypeNotion &&
+		!app.notionWrites.Enabled(ctx) {
+		memo.Status = uint8(entity.MemoStatusPending)
+		app.saveMemo(ctx, memo)
+		return memo, ErrNotionWritesPaused
+	}
+
+	if app.queueInbound {
+		return memo, app.queueMemo(ctx, memo)
+	}
+
+	if err := app.checkDailyCap(ctx, bindInfo); err != nil {
+		if !errors.Is(err, ErrDailyCapReached) || !app.queueOverCap {
+			return memo, err
+		}
+		memo.Status = uint8(entity.MemoStatusPending)
+		app.saveMemo(ctx, memo)
+		return memo, ErrDailyCapQueued
+	}
+	if err := app.checkCharBudget(ctx, bindInfo, content); err != nil {
+		app.countPages(ctx, bindInfo, 0)
+		return memo, err
 	}
 
-	return handler(ctx, registar, bindInfo.PageInfo, content)
+	res, err := handler(ctx, &appendRequest{
+		Registar: req.Registar,
+		Bind:     bindInfo,
+		Settings: &settings,
+		Event:    event,
+		Content:  content,
+	})
+	app.countPages(ctx, bindInfo, res.Pages)
+	if err != nil {
+		app.releaseChars(ctx, bindInfo, content)
+	}
+	memo.Attempts = 1
+	memo.PageID, memo.Verified = res.PageID, res.Verified
+	if len(res.PageIDs) > 0 {
+		memo.SetPages(res.PageIDs)
+	}
+	access := app.updateNotionAccess(ctx, bindInfo, &settings, err)
+	if err != nil {
+		memo.Status = uint8(entity.MemoStatusFailed)
+		memo.LastError = err.Error()
+		if access != "" {
+			// retrying won't help until the page is shared again
+			err = &notionAccessError{access: access, err: err}
+		} else if int(memo.Attempts) < app.retryBudget {
+			// left to the pending worker while the budget lasts
+			memo.Status = uint8(entity.MemoStatusPending)
+			err = &memoRetryError{err: err}
+		}
+	}
+	app.saveMemo(ctx, memo)
+	if err == nil && res.Partial != nil {
+		return memo, res.Partial
+	}
+	return memo, err
+}
+
+// replyTruncatedNote ends a truncated reply
+const replyTruncatedNote = "\n…内容过长，完整内容请前往Notion查看"
+
+// replyMaxLenOf is the reply length limit of bindInfo, the server's unless
+// the binding has its own. bindInfo is nil if the sender isn't bound.
+func (app *larkMessageHandleApp) replyMaxLenOf(bindInfo *entity.BindInfo) int {
+	if bindInfo == nil {
+		return app.replyMaxLen
+	}
+	if settings, err := bindInfo.GetSettings(); err == nil && settings.ReplyMaxLength != nil {
+		return *settings.ReplyMaxLength
+	}
+	return app.replyMaxLen
+}
+
+// replyMessages fits msg into the reply length limit maxLen, by splitting
+// it into several messages or truncating it.
+func (app *larkMessageHandleApp) replyMessages(msg string, maxLen int) []string {
+	if maxLen <= 0 || len([]rune(msg)) <= maxLen {
+		return []string{msg}
+	}
+
+	if app.replyOverflow == ReplyOverflowTruncate {
+		note := []rune(replyTruncatedNote)
+		keep := maxLen - len(note)
+		if keep < 0 {
+			keep = 0
+		}
+		return []string{string([]rune(msg)[:keep]) + replyTruncatedNote}
+	}
+
+	return SplitMessage(msg, maxLen)
+}
+
+func (app *larkMessageHandleApp) reply(reg *entity.LarkBotRegistar, message *lark_message.Message, msg string) {
+	app.replyTo(reg, message, nil, msg)
+}
+
+// replyTo replies msg to message of bindInfo within its reply length limit
+func (app *larkMessageHandleApp) replyTo(reg *entity.LarkBotRegistar, message *lark_message.Message, bindInfo *entity.BindInfo, msg string) {
+	// split messages are sent one by one to keep them in order
+	for _, part := range app.replyMessages(msg, app.replyMaxLenOf(bindInfo)) {
+		err := app.messenger.Reply(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, part)
+		// sent in order once lark tokens are available again
+		if errors.Is(err, ErrReplyQueued) {
+			log.Infof("reply to lark message %s queued, no tenant access token for now", message.MessageID)
+			continue
+		}
+		if err != nil {
+			log.Errorf("failed to reply lark message %s. err=%v", message.MessageID, err)
+			return
+		}
+	}
+}
+
+// ackSaved tells the sender the memo is saved, by a reply or
+// a reaction according to the settings of the binding.
+func (app *larkMessageHandleApp) ackSaved(reg *entity.LarkBotRegistar, message *lark_message.Message, bindInfo *entity.BindInfo) {
+	settings, err := bindInfo.GetSettings()
+	if err != nil {
+		log.Warnf("invalid settings of %s, %v", bindInfo.UnionUserID, err)
+	}
+
+	if settings.QuietSuccess() {
+		return
+	}
+
+	if settings.Ack == entity.AckReaction || settings.Ack == entity.AckBoth {
+		err := app.messenger.AddReaction(reg.AppID, reg.SecretKey, message.MessageID, ReactionDone)
+		if err == nil && settings.Ack == entity.AckReaction {
+			return
+		}
+
+		// reactions may not be permitted for the bot
+		if err != nil {
+			log.Warnf("failed to add reaction to %s, fallback to reply. err=%v", message.MessageID, err)
+		}
+	}
+
+	app.replyTo(reg, message, bindInfo, "已保存，可以前往Notion页面查看~")
+}
+
+// replyMemo replies msg to a memo of bindInfo unless the binding wants no
+// replies at all, bindInfo is nil if the sender isn't bound.
+func (app *larkMessageHandleApp) replyMemo(reg *entity.LarkBotRegistar, message *lark_message.Message, bindInfo *entity.BindInfo, msg string) {
+	if bindInfo != nil {
+		if settings, err := bindInfo.GetSettings(); err == nil && settings.QuietFailures() {
+			log.Infof("reply to memo %s of %s suppressed: %s", message.MessageID, bindInfo.UnionUserID,
+				Preview(msg, app.previewLen))
+			return
+		}
+	}
+	app.replyTo(reg, message, bindInfo, msg)
+}
+
+// senderBind is the binding of the sender of event, nil if not bound
+func (app *larkMessageHandleApp) senderBind(ctx context.Context, event *lark_message.LarkMessageEvent) *entity.BindInfo {
+	sender := &event.Event.Sender.SenderID
+	user := entity.LarkUserInfo{UserId: sender.UserID, UnionId: sender.UnionID, OpenId: sender.OpenID}
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, user.UnionID())
+	if err != nil {
+		return nil
+	}
+	return bindInfo
 }
 
 func (app *larkMessageHandleApp) getBotRegistar(ctx context.Context, appId string) (*entity.LarkBotRegistar, error) {
 	return app.botRegistarRepo.GetLarkBotRegistarByUnionUserID(ctx, appId)
 }
 
+// eventPreview formats event for logs and notifications with the message
+// content cut to a preview.
+func (app *larkMessageHandleApp) eventPreview(event *lark_message.LarkMessageEvent) string {
+	e := *event
+	e.Event.Message.Content = Preview(e.Event.Message.Content, app.previewLen)
+	return fmt.Sprintf("%+v", e)
+}
+
 func (app *larkMessageHandleApp) ProcessMessage(ctx context.Context, event *lark_message.LarkMessageEvent) error {
 	if _, ok := app.eventCache.Get(event.Header.EventID); ok {
-		return fmt.Errorf("repeated lark message +%v", *event)
+		return fmt.Errorf("repeated lark message %s", app.eventPreview(event))
 	}
 	app.eventCache.Set(event.Header.EventID, true, cache.DefaultExpiration)
 
 	message := &event.Event.Message
-	if message.MessageType != "text" {
+	if message.MessageType != "text" && !app.isImageMessage(message) {
 		// msg := fmt.Sprintf("unsupported message type: %s, app_id: %s  chat_id: %s, messageid: %s",
 		// event.Event.Message.MessageType, event.Header.AppID, message.ChatID, message.MessageID)
-		msg, _ := event.Event.JsonString()
+		e := event.Event
+		e.Message.Content = Preview(e.Message.Content, app.previewLen)
+		msg, _ := e.JsonString()
 		if message.ChatID != "" && event.Event.Message.MessageType != "" {
 			app.larkNotify(msg)
 		}
 
 		if reg, err := app.getBotRegistar(ctx, event.Header.AppID); err == nil {
-			ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID,
+			app.reply(reg, message,
 				fmt.Sprintf("目前只支持文本消息，当前类型为 %s", event.Event.Message.MessageType))
 		}
 		return fmt.Errorf("%s", msg)
@@ -293,7 +969,7 @@ func (app *larkMessageHandleApp) ProcessMessage(ctx context.Context, event *lark
 	content, err := message.GetMessageRawContent()
 	if err != nil {
 		log.Errorf("failed to get message content. err=%v", err)
-		app.larkNotify(fmt.Sprintf("event: %+v, err: %v", *event, err.Error()))
+		app.larkNotify(fmt.Sprintf("event: %s, err: %v", app.eventPreview(event), err.Error()))
 		return err
 	}
 
@@ -301,60 +977,74 @@ func (app *larkMessageHandleApp) ProcessMessage(ctx context.Context, event *lark
 	if app.isRegisterCommand(content) {
 		reg, err := app.registerLarkBot(ctx, &event.Header, content)
 		if err != nil {
-			msg := fmt.Sprintf("register lark bot error. event: %+v, err: %v", event, err)
+			msg := fmt.Sprintf("register lark bot error. event: %s, err: %v", app.eventPreview(event), err)
 			app.larkNotify(msg)
 			return err
 		}
 
-		ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, "注册成功!")
+		app.reply(reg, message, "注册成功!")
 		return nil
 	}
 
 	reg, err := app.getBotRegistar(ctx, event.Header.AppID)
 	if err != nil {
-		app.larkNotify(fmt.Sprintf("Failed to get bot registar. event: %+v, err: %v", *event, err))
+		app.larkNotify(fmt.Sprintf("Failed to get bot registar. event: %s, err: %v", app.eventPreview(event), err))
 		return err
 	}
 
-	// /bind notion secret_key page_id [theme] or /bind doc page_id [theme]
-	if app.isBindCommand(content) {
-		parts := strings.Fields(strings.TrimSpace(content))
-		if len(parts) < 2 {
-			log.Errorf("invalid bind command. %s", content)
-			ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, helpInfo)
-			return fmt.Errorf("invalid bind command, %s", content)
-		}
-
-		switch parts[1] {
-		case "notion":
-			err = app.bindNotionPage(ctx, &event.Event.Sender.SenderID, content)
-		case "doc":
-			err = app.bindLakrDocPage(ctx, &event.Event.Sender.SenderID, content)
-		default:
-			log.Errorf("invalid bind command. %s", content)
-			ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, helpInfo)
-			return fmt.Errorf("invalid bind command, %s", content)
+	// images are saved as memos of the stored images
+	var imageNote string
+	if app.isImageMessage(message) {
+		if content, imageNote, err = app.imageContent(reg, message); err != nil {
+			log.Errorf("failed to save image of message %s. err=%v", message.MessageID, err)
+			app.reply(reg, message, fmt.Sprintf("图片保存失败, %v", err))
+			return err
 		}
+	}
 
+	// /bind, /set, /chat, /help...
+	if cmd, ok := app.commands.Lookup(content); ok && cmd.Handle != nil {
+		msg, err := cmd.Handle(ctx, reg, event, content)
 		if err != nil {
-			log.Errorf("failed to bind page. err=%v", err)
-			ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, err.Error())
+			log.Errorf("failed to handle command /%s. err=%v", cmd.Name, err)
+			if msg == "" {
+				msg = err.Error()
+			}
+			app.replyTo(reg, message, app.senderBind(ctx, event), msg)
 			return err
 		}
 
-		ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, "绑定成功~")
+		app.replyTo(reg, message, app.senderBind(ctx, event), msg)
 		return nil
 	}
 
 	// log.Infof("content==> %s", content)
-	if err := app.appendContent(ctx, reg, &event.Event, content); err != nil {
+	bindInfo, err := app.appendContent(ctx, reg, event, content)
+	app.stats.record(err)
+	if msg, ok := app.memoNotice(ctx, bindInfo, err); ok {
+		if msg != "" {
+			app.replyMemo(reg, message, bindInfo, msg)
+		}
+		return nil
+	}
+	var partialErr *partialWriteError
+	if errors.As(err, &partialErr) {
+		log.Errorf("failed to write content to some of the databases. err=%v", err)
+		app.ackSaved(reg, message, bindInfo)
+		app.replyMemo(reg, message, bindInfo, err.Error())
+		return nil
+	}
+	if err != nil {
 		msg := fmt.Sprintf("向Notion页面写入失败, %v", err)
 		log.Errorf(msg)
-		ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, err.Error())
+		app.replyMemo(reg, message, bindInfo, err.Error())
 		return err
 	}
 
-	ReplyLarkMessage(reg.AppID, reg.SecretKey, message.ChatID, message.MessageID, "已保存，可以前往Notion页面查看~")
+	app.ackSaved(reg, message, bindInfo)
+	if imageNote != "" {
+		app.replyMemo(reg, message, bindInfo, imageNote)
+	}
 	return nil
 }
 
@@ -1,11 +1,515 @@
 package application
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+	"github.com/KDF5000/pkg/log"
 )
 
 func TestSplit(t *testing.T) {
 	a := "/bind a   b  "
 	t.Logf("%+v", strings.Fields(a))
 }
+
+func newTestLarkEvent(unionID, text string) *lark_message.LarkMessageEvent {
+	content, _ := json.Marshal(&lark_message.TextMessage{Text: text})
+	var event lark_message.LarkMessageEvent
+	event.Schema = "2.0"
+	event.Header = lark_message.EventHeader{
+		EventID: "event_xxx",
+		AppID:   "cli_xxx",
+	}
+	event.Event.Sender.SenderID.UnionID = unionID
+	event.Event.Message = lark_message.Message{
+		MessageID:   "om_xxx",
+		ChatID:      "oc_xxx",
+		CreatedTime: "1650000000000",
+		MessageType: "text",
+		Content:     string(content),
+	}
+	return &event
+}
+
+func newTestLarkApp(memoRepo *fakeMemoRepo, opt Option, binds ...entity.BindInfo) *larkMessageHandleApp {
+	reg := entity.LarkBotRegistar{AppID: "cli_xxx", SecretKey: "secret"}
+	app := NewLarkMessageHandleApp(newFakeBindInfoRepo(binds...), newFakeLarkBotRegistarRepo(reg),
+		memoRepo, nil, nil, func(msg string) {}, opt)
+	app.messenger = &fakeLarkMessenger{}
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+	return app
+}
+
+func TestAppendContentMetadata(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	event := newTestLarkEvent("xxx", "#科技 technology change our life!")
+	content, _ := event.Event.Message.GetMessageRawContent()
+
+	for _, store := range []bool{true, false} {
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{StoreMemoMetadata: store}, bind)
+		if _, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{}, event, content); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(memoRepo.memos) != 1 {
+			t.Fatalf("expected 1 memo, got %d", len(memoRepo.memos))
+		}
+		memo := memoRepo.memos[0]
+		if memo.Content != content || memo.PageID != "page_xxx" ||
+			memo.Status != uint8(entity.MemoStatusSaved) {
+			t.Fatalf("unexpected memo %+v", memo)
+		}
+
+		if !store {
+			if memo.Metadata != "" {
+				t.Fatalf("expected no metadata, got %s", memo.Metadata)
+			}
+			continue
+		}
+
+		var meta entity.MemoMetadata
+		if err := json.Unmarshal([]byte(memo.Metadata), &meta); err != nil {
+			t.Fatal(err)
+		}
+		expected := entity.MemoMetadata{
+			Platform:   "lark",
+			AppID:      "cli_xxx",
+			EventID:    "event_xxx",
+			MessageID:  "om_xxx",
+			ChatID:     "oc_xxx",
+			CreateTime: "1650000000000",
+		}
+		if meta != expected {
+			t.Fatalf("expected: %+v, got: %+v", expected, meta)
+		}
+		if strings.Contains(memo.Metadata, "technology") {
+			t.Fatalf("metadata should not contain content, %s", memo.Metadata)
+		}
+	}
+}
+
+func TestAppendContentRawContent(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	raw := "@_user_1 #科技 technology change our life!"
+	mentioned := newTestLarkEvent("xxx", raw)
+	mentioned.Event.Message.Mentions = []lark_message.MentionEvent{{Key: "@_user_1"}}
+
+	cases := []struct {
+		Event    *lark_message.LarkMessageEvent
+		Store    bool
+		Expected string
+	}{
+		{Event: mentioned, Store: true, Expected: raw},
+		{Event: mentioned, Store: false, Expected: ""},
+		// same as the content, not kept twice
+		{Event: newTestLarkEvent("xxx", "#科技 technology"), Store: true, Expected: ""},
+	}
+	for _, tc := range cases {
+		content, _ := tc.Event.Event.Message.GetMessageRawContent()
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{StoreRawContent: tc.Store}, bind)
+		if _, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{}, tc.Event, content); err != nil {
+			t.Fatal(err)
+		}
+
+		memo := memoRepo.memos[0]
+		if memo.Content != content || memo.RawContent != tc.Expected {
+			t.Fatalf("store: %v, expected raw content %q, got %+v", tc.Store, tc.Expected, memo)
+		}
+	}
+}
+
+func TestProcessMessageAck(t *testing.T) {
+	cases := []struct {
+		Ack         string
+		ReactionErr error
+		Reactions   int
+		Replies     int
+	}{
+		{Ack: "", Reactions: 0, Replies: 1},
+		{Ack: entity.AckReply, Reactions: 0, Replies: 1},
+		{Ack: entity.AckReaction, Reactions: 1, Replies: 0},
+		{Ack: entity.AckBoth, Reactions: 1, Replies: 1},
+		// reaction not permitted, fallback to reply
+		{Ack: entity.AckReaction, ReactionErr: fmt.Errorf("no permission"), Reactions: 0, Replies: 1},
+	}
+
+	for _, tc := range cases {
+		bind := entity.BindInfo{
+			UnionUserID:  "lark_xxx",
+			BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		}
+		bind.SetSettings(&entity.BindSettings{Ack: tc.Ack})
+
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{}, bind)
+		messenger := app.messenger.(*fakeLarkMessenger)
+		messenger.reactionErr = tc.ReactionErr
+		if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(messenger.reactions) != tc.Reactions || len(messenger.replies) != tc.Replies {
+			t.Fatalf("ack: %s, expected %d reactions and %d replies, got %+v, %+v",
+				tc.Ack, tc.Reactions, tc.Replies, messenger.reactions, messenger.replies)
+		}
+		if tc.Reactions > 0 && messenger.reactions[0] != "om_xxx:"+utils.ReactionDone {
+			t.Fatalf("unexpected reaction %s", messenger.reactions[0])
+		}
+	}
+}
+
+func TestProcessSetCommand(t *testing.T) {
+	bindRepo := newFakeBindInfoRepo(entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	})
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	app.bindRepo = bindRepo
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "/set ack reaction")); err != nil {
+		t.Fatal(err)
+	}
+
+	bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ := bind.GetSettings()
+	if settings.Ack != entity.AckReaction {
+		t.Fatalf("expected ack reaction, got %+v", settings)
+	}
+
+	event := newTestLarkEvent("xxx", "/set ack emoji")
+	event.Header.EventID = "event_yyy"
+	if err := app.ProcessMessage(context.TODO(), event); err == nil {
+		t.Fatal("expected invalid ack error")
+	}
+}
+
+func TestAppendContentVerify(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{
+		NotionTheme:     "gallery",
+		NotionSecretKey: "secret",
+		NotionPageID:    "db_xxx",
+	})
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	}
+	opt := Option{
+		Notion:             notion.ClientOption{BaseURI: n.URL, TitleMaxLength: 20},
+		VerifyNotionWrites: true,
+	}
+	event := newTestLarkEvent("xxx", "hello")
+
+	cases := []struct {
+		Page     string
+		Verified bool
+		Status   entity.MemoStatusType
+	}{
+		{
+			Page:     `{"object": "page", "id": "page_xxx", "properties": {"Name": {"type": "title", "title": [{"plain_text": "hello"}]}}}`,
+			Verified: true,
+			Status:   entity.MemoStatusSaved,
+		},
+		{
+			Page:     `{"object": "page", "id": "page_xxx", "properties": {"Name": {"type": "title", "title": [{"plain_text": "other"}]}}}`,
+			Verified: false,
+			Status:   entity.MemoStatusFailed,
+		},
+	}
+	for _, tc := range cases {
+		n.Reply(http.MethodGet, "/pages/page_xxx", http.StatusOK, tc.Page)
+
+		memoRepo := &fakeMemoRepo{}
+		app := NewLarkMessageHandleApp(newFakeBindInfoRepo(bind), newFakeLarkBotRegistarRepo(),
+			memoRepo, nil, nil, func(msg string) {}, opt)
+		_, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{}, event, "hello")
+		if tc.Verified != (err == nil) {
+			t.Fatalf("verified: %v, err: %v", tc.Verified, err)
+		}
+
+		memo := memoRepo.memos[0]
+		if memo.PageID != "page_xxx" || memo.Verified != tc.Verified || memo.Status != uint8(tc.Status) {
+			t.Fatalf("unexpected memo %+v", memo)
+		}
+	}
+}
+
+func TestSetSortField(t *testing.T) {
+	bindRepo := newFakeBindInfoRepo(entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	})
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{})
+	app.bindRepo = bindRepo
+
+	for i, cmd := range []string{"/set sort_field Order", "/set sort_strategy timestamp"} {
+		event := newTestLarkEvent("xxx", cmd)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	settings, _ := bind.GetSettings()
+	opts := app.pageOptions(&appendRequest{Settings: &settings, Event: newTestLarkEvent("xxx", "hello")})
+	if opts.SortField == nil || opts.SortField.Property != "Order" ||
+		opts.SortField.Strategy != notion.SortStrategyTimestamp || opts.CreatedAt.Unix() != 1650000000 {
+		t.Fatalf("unexpected page options %+v", opts)
+	}
+
+	if err := ApplySetting(&settings, "sort_strategy", "random"); err == nil {
+		t.Fatal("expected invalid sort_strategy error")
+	}
+	if err := ApplySetting(&settings, "sort_field", "off"); err != nil || app.pageOptions(&appendRequest{
+		Settings: &settings, Event: newTestLarkEvent("xxx", "hello")}).SortField != nil {
+		t.Fatalf("sort field should be disabled, err: %v", err)
+	}
+}
+
+func TestPreviewInLogs(t *testing.T) {
+	var buf bytes.Buffer
+	std := log.Default()
+	log.ResetDefault(log.New(&buf, log.InfoLevel))
+	defer log.ResetDefault(std)
+
+	var notified []string
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{PreviewLength: 10})
+	app.larkNotify = func(msg string) { notified = append(notified, msg) }
+
+	secret := "0123456789abcdefghijklmn"
+	event := newTestLarkEvent("xxx", "/bind wiki "+secret)
+	if err := app.ProcessMessage(context.TODO(), event); err == nil {
+		t.Fatal("expected invalid bind command error")
+	}
+
+	if !strings.Contains(buf.String(), "invalid bind command. /bind wiki…") || strings.Contains(buf.String(), "abcdef") {
+		t.Fatalf("content should be truncated in logs, got %s", buf.String())
+	}
+
+	// events notified to admin keep the preview of content only
+	event = newTestLarkEvent("xxx", secret)
+	event.Header.EventID = "event_yyy"
+	event.Header.AppID = "cli_yyy"
+	app.ProcessMessage(context.TODO(), event)
+	if len(notified) != 1 || strings.Contains(notified[0], "abcdef") || !strings.Contains(notified[0], "…") {
+		t.Fatalf("content should be truncated in notifications, got %+v", notified)
+	}
+}
+
+func TestReplyOverflow(t *testing.T) {
+	reg := &entity.LarkBotRegistar{AppID: "cli_xxx", SecretKey: "secret"}
+	message := &newTestLarkEvent("xxx", "hello").Event.Message
+	msg := "第一段内容\n第二段内容\n第三段内容"
+
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{ReplyMaxLength: 12})
+	app.reply(reg, message, msg)
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	expected := []string{"第一段内容\n第二段内容", "第三段内容"}
+	if len(replies) != len(expected) {
+		t.Fatalf("expected %d replies, got %+v", len(expected), replies)
+	}
+	for i := range expected {
+		if replies[i].Msg != expected[i] || replies[i].MessageID != "om_xxx" {
+			t.Fatalf("reply %d: expected %q, got %+v", i, expected[i], replies[i])
+		}
+	}
+
+	app = newTestLarkApp(&fakeMemoRepo{}, Option{ReplyMaxLength: 30, ReplyOverflow: ReplyOverflowTruncate})
+	app.reply(reg, message, msg+"\n"+msg)
+	replies = app.messenger.(*fakeLarkMessenger).replies
+	if len(replies) != 1 || len([]rune(replies[0].Msg)) != 30 ||
+		!strings.HasPrefix(replies[0].Msg, "第一段") || !strings.HasSuffix(replies[0].Msg, replyTruncatedNote) {
+		t.Fatalf("unexpected truncated reply %+v", replies)
+	}
+
+	// short replies are untouched
+	app.reply(reg, message, "已保存")
+	if replies = app.messenger.(*fakeLarkMessenger).replies; replies[1].Msg != "已保存" {
+		t.Fatalf("unexpected reply %+v", replies[1])
+	}
+}
+
+func TestReplyMaxLengthOfBinding(t *testing.T) {
+	reg := &entity.LarkBotRegistar{AppID: "cli_xxx", SecretKey: "secret"}
+	message := &newTestLarkEvent("xxx", "hello").Event.Message
+	msg := "第一段内容\n第二段内容\n第三段内容"
+
+	cases := []struct {
+		Value   string
+		Replies int
+	}{
+		{Value: "default", Replies: 1},
+		{Value: "12", Replies: 2},
+		{Value: "off", Replies: 1},
+	}
+	for _, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		if err := ApplySetting(&settings, "reply_max_length", tc.Value); err != nil {
+			t.Fatal(err)
+		}
+		bind.SetSettings(&settings)
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{ReplyMaxLength: 4000}, bind)
+
+		app.replyMemo(reg, message, &bind, msg)
+		if replies := app.messenger.(*fakeLarkMessenger).replies; len(replies) != tc.Replies {
+			t.Fatalf("reply_max_length %s: expected %d replies, got %+v", tc.Value, tc.Replies, replies)
+		}
+	}
+
+	// the replies of commands of the binding too
+	bind := newTestNotionBind("gallery")
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{ReplyMaxLength: 4000}, bind)
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "/set reply_max_length 12")); err != nil {
+		t.Fatal(err)
+	}
+	app.commands.Register(Command{Name: "long", Handle: func(ctx context.Context, reg *entity.LarkBotRegistar, event *lark_message.LarkMessageEvent, content string) (string, error) {
+		return msg, nil
+	}})
+	event := newTestLarkEvent("xxx", "/long")
+	event.Header.EventID = "event_long"
+	if err := app.ProcessMessage(context.TODO(), event); err != nil {
+		t.Fatal(err)
+	}
+	if replies := app.messenger.(*fakeLarkMessenger).replies; len(replies) != 3 {
+		t.Fatalf("expected the reply of the command split, got %+v", replies)
+	}
+}
+
+func TestNormalizeTypography(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	if err := ApplySetting(&settings, "typography", "on"); err != nil {
+		t.Fatal(err)
+	}
+	bind.SetSettings(&settings)
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{}, bind)
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "it’s “done” — run `echo “hi”`")); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "it's \"done\" -- run `echo “hi”`"; len(memoRepo.memos) != 1 || memoRepo.memos[0].Content != expected {
+		t.Fatalf("expected memo %q, got %+v", expected, memoRepo.memos)
+	}
+}
+
+func TestReplySuppression(t *testing.T) {
+	cases := []struct {
+		Replies string
+		Fail    bool
+		Replied bool
+	}{
+		{Replies: entity.RepliesAll, Replied: true},
+		{Replies: entity.RepliesErrors},
+		{Replies: entity.RepliesErrors, Fail: true, Replied: true},
+		{Replies: entity.RepliesNone},
+		{Replies: entity.RepliesNone, Fail: true},
+	}
+	for _, tc := range cases {
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		for key, value := range map[string]string{"replies": tc.Replies, "ack": entity.AckBoth} {
+			if err := ApplySetting(&settings, key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bind.SetSettings(&settings)
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{}, bind)
+		messenger := &fakeLarkMessenger{}
+		app.messenger = messenger
+		if tc.Fail {
+			app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+				return appendResult{}, errors.New("notion is down")
+			}
+		}
+
+		app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "memo"))
+		if replied := len(messenger.replies) > 0 || len(messenger.reactions) > 0; replied != tc.Replied {
+			t.Fatalf("replies: %s, failed: %v, expected replied %v, got %+v %+v",
+				tc.Replies, tc.Fail, tc.Replied, messenger.replies, messenger.reactions)
+		}
+		// saved either way
+		if len(memoRepo.memos) != 1 {
+			t.Fatalf("replies: %s, expected the memo kept, got %d", tc.Replies, len(memoRepo.memos))
+		}
+	}
+
+	var s entity.BindSettings
+	if err := ApplySetting(&s, "replies", "quiet"); err == nil {
+		t.Fatal("expected invalid replies")
+	}
+}
+
+func TestTimezoneProperty(t *testing.T) {
+	cases := []struct {
+		Type     string
+		Timezone string
+		Expected string
+	}{
+		{Type: "rich_text", Timezone: "Asia/Shanghai", Expected: `"Zone":{"type":"rich_text","rich_text":[{"type":"text","text":{"content":"Asia/Shanghai"}}]}`},
+		{Type: "select", Timezone: "Europe/Berlin", Expected: `"Zone":{"type":"select","select":{"name":"Europe/Berlin"}}`},
+		// the server's timezone isn't labeled
+		{Type: "select", Timezone: "off"},
+	}
+	for _, tc := range cases {
+		n := newFakeNotion()
+		n.Reply(http.MethodGet, "/databases/db_xxx", http.StatusOK, fmt.Sprintf(
+			`{"object": "database", "id": "db_xxx", "properties": {"Name": {"type": "title"}, "Zone": {"type": "%s"}}}`, tc.Type))
+		n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		for key, value := range map[string]string{"timezone": tc.Timezone, "timezone_property": "Zone"} {
+			if err := ApplySetting(&settings, key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bind.SetSettings(&settings)
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+		if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "standup notes")); err != nil {
+			t.Fatal(err)
+		}
+
+		var page string
+		for _, req := range n.Requests() {
+			if req.Method == http.MethodPost && req.Path == "/pages" {
+				page = req.Body
+			}
+		}
+		n.Close()
+		if tc.Expected == "" && strings.Contains(page, `"Zone"`) {
+			t.Fatalf("timezone: %s, expected no timezone label, got %s", tc.Timezone, page)
+		}
+		if !strings.Contains(page, tc.Expected) {
+			t.Fatalf("timezone: %s, expected %s, got %s", tc.Timezone, tc.Expected, page)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+)
+
+const (
+	// number of pending memos loaded at a time
+	pendingMemoBatch = 50
+	// memos processing longer are taken as left by a worker gone, and
+	// pending again
+	pendingMemoLease = 10 * time.Minute
+)
+
+// ErrMemoQueued is returned when an inbound memo is queued for the
+// pending worker
+var ErrMemoQueued = errors.New("memo queued")
+
+// queueMemo stores memo as pending and wakes the pending worker. Unlike
+// the memos saved after written, a memo not stored is lost, so it fails.
+func (app *larkMessageHandleApp) queueMemo(ctx context.Context, memo *entity.Memo) error {
+	memo.Status = uint8(entity.MemoStatusPending)
+	if err := app.memoRepo.Create(ctx, memo); err != nil {
+		return fmt.Errorf("failed to queue memo, %v", err)
+	}
+	app.saveAnalytics(ctx, memo)
+	app.auditMemo(memo)
+
+	select {
+	case app.pendingWake <- struct{}{}:
+	default:
+		// woken already
+	}
+	return ErrMemoQueued
+}
+
+// ProcessPendingMemos writes a batch of the memos of each account queued
+// while notion writes were disabled, over the daily cap or failed with
+// retry budget left, and returns the number of memos handled. A memo is
+// claimed before written, the other instances skip it meanwhile.
+func (app *larkMessageHandleApp) ProcessPendingMemos(ctx context.Context) (int, error) {
+	if !app.notionWrites.Enabled(ctx) {
+		return 0, nil
+	}
+
+	if n, err := app.memoRepo.ReleaseMemos(ctx, app.clock.Now().Add(-pendingMemoLease)); err != nil {
+		log.Errorf("failed to release the memos processing over %s. err=%v", pendingMemoLease, err)
+	} else if n > 0 {
+		log.Warnf("%d memos processing over %s are pending again", n, pendingMemoLease)
+	}
+
+	accounts, err := app.memoRepo.ListAccountsByStatus(ctx, entity.MemoStatusPending)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, account := range accounts {
+		// kept until capture is on again
+		if app.capturePaused(ctx, account) {
+			continue
+		}
+
+		memos, err := app.memoRepo.ListMemosByStatus(ctx, account, entity.MemoStatusPending, pendingMemoBatch)
+		if err != nil {
+			return count, err
+		}
+
+		for i := range memos {
+			// stop as soon as writes are disabled again
+			if !app.notionWrites.Enabled(ctx) {
+				return count, nil
+			}
+			claimed, err := app.memoRepo.ClaimMemo(ctx, account, memos[i].ID)
+			if err != nil {
+				return count, err
+			}
+			// the account is being processed by another worker, or an
+			// older memo is written first
+			if !claimed {
+				break
+			}
+			app.processPendingMemo(ctx, &memos[i])
+			count++
+			// later memos of the account wait for the retry to keep the order
+			if memos[i].Status == uint8(entity.MemoStatusPending) {
+				break
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// memoRetryError is returned when a failed memo is left to the pending
+// worker to retry
+type memoRetryError struct {
+	err error
+}
+
+func (e *memoRetryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *memoRetryError) Unwrap() error {
+	return e.err
+}
+
+func (app *larkMessageHandleApp) processPendingMemo(ctx context.Context, memo *entity.Memo) {
+	// memos queued by old versions have no app id, nobody to tell then
+	reg := &entity.LarkBotRegistar{}
+	if memo.AppID != "" {
+		var err error
+		if reg, err = app.getBotRegistar(ctx, memo.AppID); err != nil {
+			log.Errorf("failed to get bot registar of pending memo %d. err=%v", memo.ID, err)
+			reg = &entity.LarkBotRegistar{}
+		}
+	}
+	message := &lark_message.Message{ChatID: memo.ChatID, MessageID: memo.MessageID}
+
+	queued := *memo
+	bindInfo, err := app.writePendingMemo(ctx, reg, memo)
+	if errors.Is(err, ErrDailyCapReached) && app.queueOverCap {
+		// kept for the next day as it was queued, it's no failed attempt
+		*memo = queued
+		memo.Status = uint8(entity.MemoStatusPending)
+		if err := app.memoRepo.Update(ctx, memo.UnionUserID, memo); err != nil {
+			log.Errorf("failed to release pending memo %d. err=%v", memo.ID, err)
+		}
+		return
+	}
+	memo.Attempts++
+	if err == nil {
+		memo.Status = uint8(entity.MemoStatusSaved)
+		memo.LastError = ""
+	} else {
+		log.Errorf("failed to write pending memo %d, attempts: %d. err=%v", memo.ID, memo.Attempts, err)
+		memo.Status = uint8(entity.MemoStatusFailed)
+		memo.LastError = err.Error()
+		if int(memo.Attempts) < app.retryBudget {
+			memo.Status = uint8(entity.MemoStatusPending)
+		}
+	}
+
+	if err := app.memoRepo.Update(ctx, memo.UnionUserID, memo); err != nil {
+		log.Errorf("failed to update pending memo %d. err=%v", memo.ID, err)
+	}
+	// the trail tells where a queued memo went in the end
+	if entity.MemoStatusType(memo.Status) != entity.MemoStatusPending {
+		app.auditMemo(memo)
+	}
+
+	if memo.ID == 0 || reg.AppID == "" || message.MessageID == "" {
+		return
+	}
+	switch entity.MemoStatusType(memo.Status) {
+	case entity.MemoStatusSaved:
+		app.ackSaved(reg, message, bindInfo)
+	case entity.MemoStatusFailed:
+		// echo the content so that it's not lost
+		app.replyMemo(reg, message, bindInfo, fmt.Sprintf("尝试保存%d次后仍然失败，错误: %s\n原始内容:\n%s",
+			memo.Attempts, memo.LastError, memo.Content))
+	}
+}
+
+func (app *larkMessageHandleApp) writePendingMemo(ctx context.Context, reg *entity.LarkBotRegistar, memo *entity.Memo) (*entity.BindInfo, error) {
+	bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, memo.UnionUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the binding may be changed since the memo was queued
+	handler, ok := app.handlers[entity.BindPlatformType(bindInfo.BindPlatform)]
+	if !ok {
+		return bindInfo, fmt.Errorf("invalid bind platform. platform=%d", bindInfo.BindPlatform)
+	}
+
+	settings, err := bindInfo.GetSettings()
+	if err != nil {
+		log.Warnf("invalid settings of %s, %v", bindInfo.UnionUserID, err)
+	}
+
+	if err := app.checkDailyCap(ctx, bindInfo); err != nil {
+		return bindInfo, err
+	}
+	if err := app.checkCharBudget(ctx, bindInfo, memo.Content); err != nil {
+		app.countPages(ctx, bindInfo, 0)
+		return bindInfo, err
+	}
+
+	var event lark_message.LarkMessageEvent
+	event.Header.AppID = memo.AppID
+	event.Event.Message.ChatID = memo.ChatID
+	event.Event.Message.MessageID = memo.MessageID
+	event.Event.Message.CreatedTime = strconv.FormatInt(memo.CreatedAt.UnixNano()/int64(time.Millisecond), 10)
+	res, err := handler(ctx, &appendRequest{
+		Registar: reg,
+		Bind:     bindInfo,
+		Settings: &settings,
+		Event:    &event,
+		Content:  memo.Content,
+	})
+	app.countPages(ctx, bindInfo, res.Pages)
+	if err != nil {
+		app.releaseChars(ctx, bindInfo, memo.Content)
+		return bindInfo, err
+	}
+	// saved as the written pages aren't to be duplicated by a retry
+	if res.Partial != nil {
+		log.Errorf("pending memo %d is written to some of the databases only. err=%v", memo.ID, res.Partial)
+	}
+
+	memo.BindPlatform = bindInfo.BindPlatform
+	memo.PageID = res.PageID
+	memo.Verified = res.Verified
+	if len(res.PageIDs) > 0 {
+		memo.SetPages(res.PageIDs)
+	}
+	return bindInfo, nil
+}
+
+// RunPendingWorker resumes the pending memos batch by batch every interval,
+// or as soon as a memo is queued, once notion writes are enabled, until
+// ctx is done.
+func (app *larkMessageHandleApp) RunPendingWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-app.pendingWake:
+		}
+
+		n, err := app.ProcessPendingMemos(ctx)
+		if err != nil {
+			log.Errorf("failed to process pending memos. err=%v", err)
+		}
+		if n > 0 {
+			log.Infof("%d pending memos processed", n)
+		}
+		app.flushReplies()
+	}
+}
+
+// flushReplies sends the replies queued while lark tokens were unavailable
+func (app *larkMessageHandleApp) flushReplies() {
+	flusher, ok := app.messenger.(interface{ FlushReplies() int })
+	if !ok {
+		return
+	}
+	if left := flusher.FlushReplies(); left > 0 {
+		log.Infof("%d lark replies still queued", left)
+	}
+}
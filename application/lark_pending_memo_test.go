@@ -0,0 +1,207 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestMemoRetryBudget(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+
+	cases := []struct {
+		Budget   int
+		Failures int
+		Attempts uint8
+		Status   entity.MemoStatusType
+	}{
+		{Budget: 1, Failures: 1, Attempts: 1, Status: entity.MemoStatusFailed},
+		{Budget: 3, Failures: 2, Attempts: 3, Status: entity.MemoStatusSaved},
+		{Budget: 3, Failures: 5, Attempts: 3, Status: entity.MemoStatusFailed},
+	}
+	for _, tc := range cases {
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{MemoRetryBudget: tc.Budget}, bind)
+		writes := 0
+		app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+			writes++
+			if writes <= tc.Failures {
+				return appendResult{}, fmt.Errorf("notion is down")
+			}
+			return appendResult{PageID: "page_xxx", Pages: 1}, nil
+		}
+
+		app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "hello"))
+		for i := 0; i < 5; i++ {
+			if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		memo := memoRepo.memos[0]
+		if writes != int(tc.Attempts) || memo.Attempts != tc.Attempts || memo.Status != uint8(tc.Status) {
+			t.Fatalf("budget: %d, writes: %d, unexpected memo %+v", tc.Budget, writes, memo)
+		}
+
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		last := replies[len(replies)-1].Msg
+		switch tc.Status {
+		case entity.MemoStatusSaved:
+			if memo.PageID != "page_xxx" || memo.LastError != "" || !strings.HasPrefix(last, "已保存") {
+				t.Fatalf("unexpected memo %+v, reply: %s", memo, last)
+			}
+		case entity.MemoStatusFailed:
+			if memo.LastError != "notion is down" {
+				t.Fatalf("unexpected memo %+v", memo)
+			}
+			// retried memos end up with a final message
+			if tc.Budget > 1 && (!strings.Contains(last, fmt.Sprintf("%d次", tc.Attempts)) ||
+				!strings.Contains(last, "notion is down") || !strings.HasSuffix(last, "\nhello")) {
+				t.Fatalf("unexpected final reply: %s", last)
+			}
+		}
+	}
+}
+
+func TestQueueInbound(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{QueueInbound: true, MemoRetryBudget: 3}, bind)
+	var writes []string
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes = append(writes, req.Content)
+		// the first write of the first memo fails
+		if len(writes) == 1 {
+			return appendResult{}, fmt.Errorf("notion is down")
+		}
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	for i, text := range []string{"first", "second", "third"} {
+		event := newTestLarkEvent("xxx", text)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		event.Event.Message.MessageID = fmt.Sprintf("om_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// stored and acked without writes, the worker is woken
+	if len(writes) != 0 || len(app.messenger.(*fakeLarkMessenger).replies) != 0 {
+		t.Fatalf("expected memos queued only, writes: %v", writes)
+	}
+	for _, memo := range memoRepo.memos {
+		if memo.Status != uint8(entity.MemoStatusPending) {
+			t.Fatalf("expected pending memo, got %+v", memo)
+		}
+	}
+	select {
+	case <-app.pendingWake:
+	default:
+		t.Fatal("expected the pending worker woken")
+	}
+
+	// later memos wait for the retry of the first
+	if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if len(writes) != 1 {
+		t.Fatalf("expected later memos to wait, writes: %v", writes)
+	}
+	if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"first", "first", "second", "third"}
+	if strings.Join(writes, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected writes %v, got %v", expected, writes)
+	}
+	for _, memo := range memoRepo.memos {
+		if memo.Status != uint8(entity.MemoStatusSaved) {
+			t.Fatalf("expected saved memo, got %+v", memo)
+		}
+	}
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	if len(replies) != 3 || !strings.HasPrefix(replies[0].Msg, "已保存") {
+		t.Fatalf("expected memos acked after saved, got %+v", replies)
+	}
+}
+
+func TestPendingMemosClaimed(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	memoRepo := &fakeMemoRepo{}
+	for _, content := range []string{"one", "two", "three"} {
+		memoRepo.Create(context.TODO(), &entity.Memo{UnionUserID: "lark_xxx", Content: content, Status: uint8(entity.MemoStatusPending)})
+	}
+
+	// instances sharing the memos
+	var mu sync.Mutex
+	var writes []string
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		app := newTestLarkApp(memoRepo, Option{}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+			mu.Lock()
+			writes = append(writes, req.Content)
+			mu.Unlock()
+			return appendResult{PageID: "page_xxx", Pages: 1}, nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				if _, err := app.ProcessPendingMemos(context.TODO()); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if strings.Join(writes, ",") != "one,two,three" {
+		t.Fatalf("expected each memo written once in order, got %v", writes)
+	}
+	for _, m := range memoRepo.memos {
+		if m.Status != uint8(entity.MemoStatusSaved) {
+			t.Fatalf("unexpected memo %+v", m)
+		}
+	}
+}
+
+func TestPendingMemoLease(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	memoRepo := &fakeMemoRepo{}
+	memoRepo.Create(context.TODO(), &entity.Memo{UnionUserID: "lark_xxx", Content: "hello", Status: uint8(entity.MemoStatusPending)})
+	// claimed by an instance gone before it's written
+	if claimed, _ := memoRepo.ClaimMemo(context.TODO(), "lark_xxx", 1); !claimed {
+		t.Fatal("expected the memo claimed")
+	}
+
+	app := newTestLarkApp(memoRepo, Option{}, bind)
+	clock := &fakeClock{now: time.Now()}
+	app.clock = clock
+	if n, _ := app.ProcessPendingMemos(context.TODO()); n != 0 {
+		t.Fatalf("unexpected memo of another worker processed, %d", n)
+	}
+	clock.Advance(pendingMemoLease + time.Second)
+	if n, _ := app.ProcessPendingMemos(context.TODO()); n != 1 || memoRepo.memos[0].Status != uint8(entity.MemoStatusSaved) {
+		t.Fatalf("expected the memo released and saved, got %d, %+v", n, memoRepo.memos[0])
+	}
+}
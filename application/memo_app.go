@@ -0,0 +1,109 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+// IMemoApp saves the memos of the other platforms, e.g. wechat, through
+// the steps of the lark memos: the notion write switch, the capture switch,
+// the caps, the pending queue and the memo records.
+type IMemoApp interface {
+	// SaveMemo saves content of message messageID of bindInfo sent at
+	// sentAt and returns what to reply to the sender, empty if nothing. It
+	// fails only if the memo failed to be written.
+	SaveMemo(ctx context.Context, bindInfo *entity.BindInfo, messageID, content string, sentAt time.Time) (string, error)
+}
+
+var _ IMemoApp = &larkMessageHandleApp{}
+
+func (app *larkMessageHandleApp) SaveMemo(ctx context.Context, bindInfo *entity.BindInfo, messageID, content string, sentAt time.Time) (string, error) {
+	settings, err := bindInfo.GetSettings()
+	if err != nil {
+		log.Warnf("invalid settings of %s, %v", bindInfo.UnionUserID, err)
+	}
+
+	// no bot of the memo, to be replied by the platform
+	var event lark_message.LarkMessageEvent
+	event.Event.Message.MessageID = messageID
+	event.Event.Message.CreatedTime = strconv.FormatInt(sentAt.UnixNano()/int64(time.Millisecond), 10)
+	_, err = app.processMemo(ctx, &appendRequest{
+		Registar: &entity.LarkBotRegistar{},
+		Bind:     bindInfo,
+		Event:    &event,
+		Content:  content,
+	})
+	app.stats.record(err)
+
+	msg, ok := app.memoNotice(ctx, bindInfo, err)
+	var partialErr *partialWriteError
+	switch {
+	case ok:
+	case errors.As(err, &partialErr):
+		log.Errorf("failed to write content of %s to some of the databases. err=%v", bindInfo.UnionUserID, err)
+		msg = err.Error()
+	case err != nil:
+		return "", err
+	default:
+		if settings.QuietSuccess() {
+			return "", nil
+		}
+		return MessageNotionSaveSucc, nil
+	}
+
+	if settings.QuietFailures() {
+		log.Infof("reply to memo of %s suppressed: %s", bindInfo.UnionUserID, utils.Preview(msg, app.previewLen))
+		return "", nil
+	}
+	return msg, nil
+}
+
+// memoNotice is what the sender of a memo of bindInfo is told when it's
+// paused, queued, rejected or left to retry with err, whatever platform it
+// came from. It reports false for the other outcomes, saved or failed. An
+// empty notice is nothing to tell.
+func (app *larkMessageHandleApp) memoNotice(ctx context.Context, bindInfo *entity.BindInfo, err error) (string, bool) {
+	var retryErr *memoRetryError
+	switch {
+	case err == nil:
+		return "", false
+	case errors.Is(err, ErrNotionWritesPaused):
+		return "Notion写入暂停中，已暂存，恢复后会自动保存~", true
+	// no commands on wechat, the capture is switched by the admin there
+	case errors.Is(err, ErrCapturePaused) && entity.UserPlatformType(bindInfo.UserPlatform) == entity.UserPlatformTypeWx:
+		return "记录已暂停，本条未保存~", true
+	case errors.Is(err, ErrCapturePaused):
+		return "记录已暂停，本条未保存，发送 /set capture on 恢复~", true
+	case errors.Is(err, ErrMemoTooShort):
+		settings, _ := bindInfo.GetSettings()
+		return fmt.Sprintf("内容不足%d个字，可能是误发，本条未保存~ 带上#标签 可以照常保存", settings.MinLength), true
+	case errors.Is(err, ErrImagesUnsupported):
+		return "飞书文档暂不支持图片，本条未保存~", true
+	// acked once the pending worker saves it
+	case errors.Is(err, ErrMemoQueued):
+		return "", true
+	case errors.Is(err, ErrCaptureQueued) && entity.UserPlatformType(bindInfo.UserPlatform) == entity.UserPlatformTypeWx:
+		return "记录已暂停，已暂存，恢复后会自动保存~", true
+	case errors.Is(err, ErrCaptureQueued):
+		return "记录已暂停，已暂存，发送 /set capture on 恢复后会自动保存~", true
+	case errors.Is(err, ErrDailyCapReached):
+		return fmt.Sprintf("今日已保存%d条，达到每日上限，本条未保存~", app.dailyCapOf(bindInfo)), true
+	case errors.Is(err, ErrDailyCapQueued):
+		return "今日已达每日上限，已暂存，明天会自动保存~", true
+	case errors.Is(err, ErrCharBudgetReached):
+		return app.charBudgetMessage(ctx, bindInfo), true
+	case errors.As(err, &retryErr):
+		log.Errorf("failed to append content, will retry. err=%v", err)
+		return fmt.Sprintf("保存失败，稍后会自动重试~ %v", err), true
+	}
+	return "", false
+}
@@ -0,0 +1,92 @@
+package application
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+// setMentionUser maps a lark user, by union id or name, to a notion user
+// for people properties. The name may have spaces, the notion user id is
+// the last field.
+func setMentionUser(s *entity.BindSettings, value string) error {
+	i := strings.LastIndexAny(value, " \t")
+	if i < 0 {
+		return fmt.Errorf("mention_user should be like `user notion_user_id` or `user off`")
+	}
+
+	user, notionUser := strings.TrimSpace(value[:i]), value[i+1:]
+	if notionUser == "off" {
+		delete(s.MentionUsers, user)
+		return nil
+	}
+
+	if s.MentionUsers == nil {
+		s.MentionUsers = make(map[string]string)
+	}
+	s.MentionUsers[user] = notionUser
+	return nil
+}
+
+// memoMentions are the users @mentioned in text, the content of message
+// with the mentions of the bot in front trimmed.
+func memoMentions(message *lark_message.Message, text string) []lark_message.MentionEvent {
+	var mentions []lark_message.MentionEvent
+	for _, m := range message.Mentions {
+		if m.Key != "" && containsKey(text, m.Key) {
+			mentions = append(mentions, m)
+		}
+	}
+	return mentions
+}
+
+// containsKey reports whether key is in text, not as a part of a longer
+// key like @_user_10 for @_user_1
+func containsKey(text, key string) bool {
+	for i := strings.Index(text, key); i >= 0; {
+		end := i + len(key)
+		if end == len(text) || text[end] < '0' || text[end] > '9' {
+			return true
+		}
+		next := strings.Index(text[end:], key)
+		if next < 0 {
+			return false
+		}
+		i = end + next
+	}
+	return false
+}
+
+// replaceMentions replaces the mention keys in content, e.g. @_user_1, by
+// the names of the users.
+func replaceMentions(content string, mentions []lark_message.MentionEvent) string {
+	if len(mentions) == 0 {
+		return content
+	}
+
+	// @_user_10 before @_user_1
+	sorted := append([]lark_message.MentionEvent(nil), mentions...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i].Key) > len(sorted[j].Key) })
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, m := range sorted {
+		pairs = append(pairs, m.Key, "@"+m.Name)
+	}
+	return strings.NewReplacer(pairs...).Replace(content)
+}
+
+// notionMentions are mentions with the notion users they're mapped to
+func notionMentions(s *entity.BindSettings, mentions []lark_message.MentionEvent) []notion.Mention {
+	var result []notion.Mention
+	for _, m := range mentions {
+		user, ok := s.MentionUsers[m.ID.UnionID]
+		if !ok || m.ID.UnionID == "" {
+			user = s.MentionUsers[m.Name]
+		}
+		result = append(result, notion.Mention{Name: m.Name, NotionUserID: user})
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+var testMentions = []lark_message.MentionEvent{
+	{Key: "@_user_1", Name: "nomo"},
+	{Key: "@_user_2", ID: lark_message.UserID{UnionID: "on_alice"}, Name: "Alice"},
+	{Key: "@_user_10", ID: lark_message.UserID{UnionID: "on_bob"}, Name: "Bob Li"},
+}
+
+func TestReplaceMentions(t *testing.T) {
+	message := &lark_message.Message{Mentions: testMentions}
+	// the bot in front is trimmed already
+	text := " sync with @_user_2 and @_user_10 on #计划, @_user_2"
+
+	mentions := memoMentions(message, text)
+	if len(mentions) != 2 || mentions[0].Name != "Alice" || mentions[1].Name != "Bob Li" {
+		t.Fatalf("expected Alice and Bob Li mentioned, got %+v", mentions)
+	}
+	if content := replaceMentions(text, mentions); content != " sync with @Alice and @Bob Li on #计划, @Alice" {
+		t.Fatalf("unexpected content %q", content)
+	}
+
+	var s entity.BindSettings
+	for _, value := range []string{"on_alice notion_alice", "Bob Li notion_bob", "Carol notion_carol", "Carol off"} {
+		if err := ApplySetting(&s, "mention_user", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ApplySetting(&s, "mention_user", "notion_dave"); err == nil {
+		t.Fatal("expected invalid mention_user")
+	}
+	expected := []notion.Mention{{Name: "Alice", NotionUserID: "notion_alice"}, {Name: "Bob Li", NotionUserID: "notion_bob"}}
+	if got := notionMentions(&s, mentions); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestMentionProperty(t *testing.T) {
+	cases := []struct {
+		Type     string
+		Expected string
+	}{
+		{Type: "rich_text", Expected: `"With":{"type":"rich_text","rich_text":[{"type":"text","text":{"content":"Alice, Bob Li"}}]}`},
+		// unmapped users are left out
+		{Type: "people", Expected: `"With":{"people":[{"id":"notion_alice","object":"user"}],"type":"people"}`},
+	}
+	for _, tc := range cases {
+		n := newFakeNotion()
+		n.Reply(http.MethodGet, "/databases/db_xxx", http.StatusOK, fmt.Sprintf(
+			`{"object": "database", "id": "db_xxx", "properties": {"Name": {"type": "title"}, "With": {"type": "%s"}}}`, tc.Type))
+		n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+		bind := newTestNotionBind("gallery")
+		bind.SetSettings(&entity.BindSettings{
+			MentionProperty: "With",
+			MentionUsers:    map[string]string{"on_alice": "notion_alice"},
+		})
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+		event := newTestLarkEvent("xxx", "@_user_1 sync with @_user_2 and @_user_10")
+		event.Event.Message.Mentions = testMentions
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		var page string
+		for _, req := range n.Requests() {
+			if req.Method == http.MethodPost && req.Path == "/pages" {
+				page = req.Body
+			}
+		}
+		n.Close()
+		if !strings.Contains(page, tc.Expected) {
+			t.Fatalf("type: %s, expected %s, got %s", tc.Type, tc.Expected, page)
+		}
+		// no markup left in the body
+		if strings.Contains(page, "@_user") || !strings.Contains(page, "sync with @Alice and @Bob Li") {
+			t.Fatalf("expected the mentions replaced by names, got %s", page)
+		}
+		if content := memoRepo.memos[0].Content; strings.Contains(content, "@_user") {
+			t.Fatalf("expected the memo without markup, got %q", content)
+		}
+	}
+}
@@ -8,8 +8,8 @@ import (
 
 	"github.com/KDF5000/nomo/domain/entity"
 	"github.com/KDF5000/nomo/domain/repository"
-	"github.com/KDF5000/nomo/infrastructure/lark_doc"
 	"github.com/KDF5000/nomo/infrastructure/notion"
+	"github.com/KDF5000/nomo/infrastructure/utils"
 	"github.com/KDF5000/pkg/log"
 )
 
@@ -49,16 +49,50 @@ type messageHandler struct {
 	bindRepo        repository.BindInfoRepository
 	botRegistarRepo repository.LarkBotRegistarRepository
 	notionCli       *notion.NotionClient
-	larkDocWrapper  *lark_doc.LarkDocWrapper
+	// max runes of content in logs
+	previewLen int
+	// keep the bindings of the same notion page on other platforms in sync
+	syncSharedBindings bool
+	// warn of the capabilities the integration lacks on bind
+	checkCapabilities bool
+	// transform content of each user platform before saved
+	transformers map[entity.UserPlatformType]func(content string) string
 }
 
-func NewMessageHandler(bind repository.BindInfoRepository, registar repository.LarkBotRegistarRepository) *messageHandler {
-	return &messageHandler{
-		bindRepo:        bind,
-		botRegistarRepo: registar,
-		notionCli:       &notion.NotionClient{},
-		larkDocWrapper:  &lark_doc.LarkDocWrapper{},
+func NewMessageHandler(bind repository.BindInfoRepository, registar repository.LarkBotRegistarRepository, opt Option) *messageHandler {
+	h := &messageHandler{
+		bindRepo:           bind,
+		botRegistarRepo:    registar,
+		notionCli:          notion.NewNotionClient(opt.Notion),
+		previewLen:         opt.PreviewLength,
+		syncSharedBindings: opt.SyncSharedBindings,
+		checkCapabilities:  opt.CheckCapabilities,
+		transformers:       make(map[entity.UserPlatformType]func(content string) string),
 	}
+
+	if unwrapper, err := utils.NewLinkUnwrapper(opt.WXUnwrapPatterns); err != nil {
+		log.Errorf("wechat links won't be unwrapped. err=%v", err)
+	} else {
+		h.transformers[entity.UserPlatformTypeWx] = unwrapper.Unwrap
+	}
+
+	return h
+}
+
+// Transform returns content of platform to save
+func (h *messageHandler) Transform(platform entity.UserPlatformType, content string) string {
+	if transform, ok := h.transformers[platform]; ok {
+		return transform(content)
+	}
+	return content
+}
+
+// normalizeContent applies the content settings of a binding to content
+func normalizeContent(s *entity.BindSettings, content string) string {
+	if s.NormalizeTypography {
+		content = utils.NormalizeTypography(content)
+	}
+	return content
 }
 
 func (h *messageHandler) ParseRegisterCommand(content string) (*RegisterCommand, bool, error) {
@@ -83,12 +117,11 @@ func (app *messageHandler) ParseBindCommand(content string) (*BindCommand, bool,
 		return nil, false, fmt.Errorf("not bind command")
 	}
 
-	log.Infof("data: %s", data)
+	log.Infof("data: %s", utils.Preview(data, app.previewLen))
 	parts := strings.Fields(strings.TrimSpace(content))
 	if len(parts) < 4 {
 		return nil, true, fmt.Errorf(HelpInfo)
 	}
-	log.Infof("parts: %v", parts)
 
 	var cmd BindCommand
 	switch parts[1] {
@@ -174,7 +207,7 @@ func (h *messageHandler) BindLarkDocPage(ctx context.Context, platform entity.Us
 }
 
 // /bind notion secret_key page_id [theme]
-func (app *messageHandler) BindNotionPage(ctx context.Context, platform entity.UserPlatformType, unionId, userInfo string, cmd *BindCommand) (err error) {
+func (app *messageHandler) BindNotionPage(ctx context.Context, platform entity.UserPlatformType, unionId, userInfo string, cmd *BindCommand) (note string, err error) {
 	// user info
 	var bindInfo entity.BindInfo
 	bindInfo.UserPlatform = uint8(platform)
@@ -191,34 +224,12 @@ func (app *messageHandler) BindNotionPage(ctx context.Context, platform entity.U
 
 	var info []byte
 	if info, err = json.Marshal(&pageInfo); err != nil {
-		return err
+		return "", err
 	}
 	bindInfo.PageInfo = string(info)
-	return app.bindRepo.UpdateOrInsert(ctx, &bindInfo)
-}
-
-func (app *messageHandler) AppendLarkDoc(ctx context.Context, pageInfo *entity.LarkDocPageInfo, content string) error {
-	var err error
-	switch pageInfo.DocTheme {
-	case "flat":
-		err = app.larkDocWrapper.InsertBlock(pageInfo.AppID, pageInfo.SecretKey, pageInfo.DocToken, content)
-	default:
-		err = fmt.Errorf("invalid theme %s", pageInfo.DocTheme)
+	note, err = bindNotion(ctx, app.bindRepo, &bindInfo, app.syncSharedBindings)
+	if err == nil && app.checkCapabilities {
+		note = joinNotes(note, capabilityNote(app.notionCli, &pageInfo))
 	}
-
-	return err
-}
-
-func (app *messageHandler) AppendNotionPage(ctx context.Context, pageInfo *entity.NotionPageInfo, content string) error {
-	var err error
-	switch pageInfo.NotionTheme {
-	case "flat":
-		err = app.notionCli.AppendBlock(pageInfo.NotionSecretKey, pageInfo.NotionPageID, content)
-	case "gallery":
-		err = app.notionCli.AddNewPage2Database(pageInfo.NotionSecretKey, pageInfo.NotionPageID, content)
-	default:
-		err = fmt.Errorf("invalid theme %s", pageInfo.NotionTheme)
-	}
-
-	return err
+	return note, err
 }
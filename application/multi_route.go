@@ -0,0 +1,46 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+// partialWriteError is a memo written to some of the databases it's routed
+// to, the memo is saved and not retried, so that the written pages aren't
+// duplicated
+type partialWriteError struct {
+	written int
+	// database id: error of the failed ones
+	failed []string
+}
+
+func (e *partialWriteError) Error() string {
+	return fmt.Sprintf("已保存到%d个数据库，以下数据库保存失败:\n%s", e.written, strings.Join(e.failed, "\n"))
+}
+
+// tagRouteDatabases are the databases of all the routed tags of tags, in
+// the order of the tags without duplicates
+func tagRouteDatabases(s *entity.BindSettings, tags []string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if id, ok := s.TagRoutes[tag]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// galleryDatabases are the databases of a gallery memo routed to dbId,
+// all the databases of its routed tags with multi_route on
+func galleryDatabases(s *entity.BindSettings, tags []string, dbId string) []string {
+	if s.MultiRoute {
+		if ids := tagRouteDatabases(s, tags); len(ids) > 1 {
+			return ids
+		}
+	}
+	return []string{dbId}
+}
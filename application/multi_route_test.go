@@ -0,0 +1,113 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestMultiRoute(t *testing.T) {
+	cases := []struct {
+		Content string
+		Multi   bool
+		// databases failing to create pages
+		Failing []string
+		// databases of the pages
+		Expected []string
+		Reply    string
+		Status   entity.MemoStatusType
+	}{
+		{
+			Content:  "#ideas #projx 新的交互方案",
+			Multi:    true,
+			Expected: []string{"db_ideas", "db_projx"},
+			Reply:    "已保存，可以前往Notion页面查看~",
+			Status:   entity.MemoStatusSaved,
+		},
+		// the first routed tag wins without multi_route
+		{
+			Content:  "#ideas #projx 新的交互方案",
+			Expected: []string{"db_ideas"},
+			Reply:    "已保存，可以前往Notion页面查看~",
+			Status:   entity.MemoStatusSaved,
+		},
+		{
+			Content:  "#projx 新的交互方案",
+			Multi:    true,
+			Expected: []string{"db_projx"},
+			Reply:    "已保存，可以前往Notion页面查看~",
+			Status:   entity.MemoStatusSaved,
+		},
+		// saved and not retried, so that the page in db_ideas isn't duplicated
+		{
+			Content:  "#ideas #projx 新的交互方案",
+			Multi:    true,
+			Failing:  []string{"db_projx"},
+			Expected: []string{"db_ideas", "db_projx"},
+			Reply:    "已保存到1个数据库，以下数据库保存失败:\ndb_projx: ",
+			Status:   entity.MemoStatusSaved,
+		},
+		{
+			Content:  "#ideas #projx 新的交互方案",
+			Multi:    true,
+			Failing:  []string{"db_ideas", "db_projx"},
+			Expected: []string{"db_ideas", "db_projx"},
+			Reply:    "code=400",
+			Status:   entity.MemoStatusFailed,
+		},
+	}
+	for i, tc := range cases {
+		n := newFakeNotion()
+		n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+		for _, db := range tc.Failing {
+			n.ReplyMatching(http.MethodPost, "/pages", `"database_id":"`+db+`"`, http.StatusBadRequest,
+				`{"object": "error", "status": 400, "code": "validation_error"}`)
+		}
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		for _, kv := range [][2]string{{"tag_route", "ideas db_ideas"}, {"tag_route", "projx db_projx"}, {"multi_route", "off"}} {
+			if kv[0] == "multi_route" && tc.Multi {
+				kv[1] = "on"
+			}
+			if err := ApplySetting(&settings, kv[0], kv[1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bind.SetSettings(&settings)
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+		event := newTestLarkEvent("xxx", tc.Content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		app.ProcessMessage(context.TODO(), event)
+		n.Close()
+
+		var dbs []string
+		for _, req := range n.Requests() {
+			if req.Method == http.MethodPost && req.Path == "/pages" {
+				for _, db := range []string{"db_ideas", "db_projx"} {
+					if strings.Contains(req.Body, `"database_id":"`+db+`"`) {
+						dbs = append(dbs, db)
+					}
+				}
+			}
+		}
+		if strings.Join(dbs, ",") != strings.Join(tc.Expected, ",") {
+			t.Fatalf("case %d: expected pages in %v, got %v", i, tc.Expected, dbs)
+		}
+
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if len(replies) == 0 || !strings.HasPrefix(replies[len(replies)-1].Msg, tc.Reply) {
+			t.Fatalf("case %d: expected reply %q, got %+v", i, tc.Reply, replies)
+		}
+		if len(memoRepo.memos) != 1 || entity.MemoStatusType(memoRepo.memos[0].Status) != tc.Status {
+			t.Fatalf("case %d: expected memo %v, got %+v", i, tc.Status, memoRepo.memos)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package application
+
+import (
+	"context"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+var notionAccessHints = map[string]string{
+	entity.NotionAccessNotShared:  "Notion页面没有共享给集成，请在页面右上角的Share中邀请集成后重试~",
+	entity.NotionAccessRestricted: "集成没有Notion页面的编辑权限，请在页面右上角的Share中将集成的权限改为Can edit后重试~",
+}
+
+// notionAccessError is a write failed for the access of the integration
+// to the bound notion page, it reads as the hint to fix the sharing.
+type notionAccessError struct {
+	access string
+	err    error
+}
+
+func (e *notionAccessError) Error() string {
+	return notionAccessHints[e.access]
+}
+
+func (e *notionAccessError) Unwrap() error {
+	return e.err
+}
+
+// notionAccess is the access of the integration that err is caused by,
+// empty if it isn't an access error.
+func notionAccess(err error) string {
+	switch {
+	case notion.IsRestricted(err):
+		return entity.NotionAccessRestricted
+	case notion.IsNotShared(err):
+		return entity.NotionAccessNotShared
+	}
+	return ""
+}
+
+// updateNotionAccess marks bindInfo with the access of the integration
+// found by a notion write failed with err, or nil if succeeded, and
+// returns the access.
+func (app *larkMessageHandleApp) updateNotionAccess(ctx context.Context, bindInfo *entity.BindInfo,
+	settings *entity.BindSettings, err error) string {
+	if !app.accessHints || entity.BindPlatformType(bindInfo.BindPlatform) != entity.BindPlatformTypeNotion {
+		return ""
+	}
+
+	access := notionAccess(err)
+	if access != "" {
+		log.Warnf("notion page of %s is %s. err=%v", bindInfo.UnionUserID, access, err)
+	}
+	if access == settings.NotionAccess {
+		return access
+	}
+
+	settings.NotionAccess = access
+	if _, err := app.bindRepo.UpdateSettings(ctx, bindInfo.UnionUserID, func(s *entity.BindSettings) error {
+		s.NotionAccess = access
+		return nil
+	}); err != nil {
+		log.Errorf("failed to mark notion access of %s. err=%v", bindInfo.UnionUserID, err)
+	}
+	return access
+}
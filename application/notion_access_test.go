@@ -0,0 +1,121 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestNotionAccessHints(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{
+		NotionTheme:     "gallery",
+		NotionSecretKey: "secret",
+		NotionPageID:    "db_xxx",
+	})
+	bindRepo := newFakeBindInfoRepo(entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	})
+
+	cases := []struct {
+		Code   int
+		Body   string
+		Access string
+		Reply  string
+		Status entity.MemoStatusType
+	}{
+		{
+			Code:   http.StatusNotFound,
+			Body:   `{"object": "error", "status": 404, "code": "object_not_found", "message": "Could not find database with ID: db_xxx."}`,
+			Access: entity.NotionAccessNotShared,
+			Reply:  notionAccessHints[entity.NotionAccessNotShared],
+			Status: entity.MemoStatusFailed,
+		},
+		{
+			Code:   http.StatusForbidden,
+			Body:   `{"object": "error", "status": 403, "code": "restricted_resource", "message": "API token does not have access to this resource."}`,
+			Access: entity.NotionAccessRestricted,
+			Reply:  notionAccessHints[entity.NotionAccessRestricted],
+			Status: entity.MemoStatusFailed,
+		},
+		// other errors are retried as usual
+		{
+			Code:   http.StatusBadGateway,
+			Body:   `{"object": "error", "status": 502, "code": "internal_server_error"}`,
+			Access: "",
+			Status: entity.MemoStatusPending,
+		},
+		// shared again
+		{
+			Code:   http.StatusOK,
+			Body:   `{"object": "page", "id": "page_xxx"}`,
+			Access: "",
+			Reply:  "已保存，可以前往Notion页面查看~",
+			Status: entity.MemoStatusSaved,
+		},
+	}
+	for i, tc := range cases {
+		n.Reply(http.MethodPost, "/pages", tc.Code, tc.Body)
+
+		memoRepo := &fakeMemoRepo{}
+		opt := Option{
+			Notion:            notion.ClientOption{BaseURI: n.URL},
+			MemoRetryBudget:   3,
+			NotionAccessHints: true,
+		}
+		app := newTestLarkApp(memoRepo, opt)
+		app.bindRepo = bindRepo
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+		messenger := &fakeLarkMessenger{}
+		app.messenger = messenger
+
+		event := newTestLarkEvent("xxx", "hello")
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		app.ProcessMessage(context.TODO(), event)
+
+		bind, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+		settings, _ := bind.GetSettings()
+		if settings.NotionAccess != tc.Access {
+			t.Fatalf("case %d: expected access %q, got %q", i, tc.Access, settings.NotionAccess)
+		}
+		if memo := memoRepo.memos[0]; memo.Status != uint8(tc.Status) || memo.LastError == tc.Reply {
+			t.Fatalf("case %d: unexpected memo %+v", i, memo)
+		}
+		if tc.Reply != "" && (len(messenger.replies) != 1 || messenger.replies[0].Msg != tc.Reply) {
+			t.Fatalf("case %d: expected reply %s, got %+v", i, tc.Reply, messenger.replies)
+		}
+	}
+}
+
+func TestNotionAccessHintsDisabled(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusForbidden, `{"object": "error", "code": "restricted_resource"}`)
+
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{NotionTheme: "gallery", NotionPageID: "db_xxx"})
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	}
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+	_, err := app.appendContent(context.TODO(), &entity.LarkBotRegistar{}, newTestLarkEvent("xxx", "hello"), "hello")
+	if _, ok := err.(*notion.APIError); !ok {
+		t.Fatalf("expected the notion error, got %v", err)
+	}
+	got, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if settings, _ := got.GetSettings(); settings.NotionAccess != "" {
+		t.Fatalf("expected binding not marked, got %+v", settings)
+	}
+}
@@ -0,0 +1,52 @@
+package application
+
+import (
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+const (
+	messageNoReadContent   = "注意：集成缺少Read content权限，无法读取页面，请在 https://www.notion.so/my-integrations 的Capabilities中开启~"
+	messageNoInsertContent = "注意：集成缺少Insert content权限，memo将无法保存，请在 https://www.notion.so/my-integrations 的Capabilities中开启~"
+)
+
+// capabilityNote warns of what the integration of pageInfo lacks for
+// nomo, empty if nothing or it can't be checked
+func capabilityNote(cli *notion.NotionClient, pageInfo *entity.NotionPageInfo) string {
+	// gallery memos are pages of the bound database
+	caps, err := cli.CheckCapabilities(pageInfo.NotionSecretKey, pageInfo.NotionPageID, pageInfo.NotionTheme == "gallery")
+	if err != nil {
+		log.Warnf("failed to check capabilities of the integration on page %s. err=%v", pageInfo.NotionPageID, err)
+		return ""
+	}
+
+	var notes []string
+	if !caps.Shared {
+		notes = append(notes, notionAccessHints[entity.NotionAccessNotShared])
+	}
+	if !caps.ReadContent {
+		notes = append(notes, messageNoReadContent)
+	}
+	if !caps.InsertContent {
+		notes = append(notes, messageNoInsertContent)
+	}
+	if len(notes) > 0 {
+		log.Warnf("integration on page %s lacks capabilities, %+v", pageInfo.NotionPageID, caps)
+	}
+	return strings.Join(notes, "\n")
+}
+
+// joinNotes joins the notes which aren't empty by lines
+func joinNotes(notes ...string) string {
+	var lines []string
+	for _, note := range notes {
+		if note != "" {
+			lines = append(lines, note)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
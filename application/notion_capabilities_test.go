@@ -0,0 +1,82 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+const restrictedBody = `{"object": "error", "status": 403, "code": "restricted_resource", "message": "Insufficient permissions for this endpoint."}`
+
+func TestCheckCapabilitiesOnBind(t *testing.T) {
+	cases := []struct {
+		Command string
+		// restricted requests of the probes
+		Restricted []string
+		Expected   string
+	}{
+		{Command: "/bind notion secret db_xxx gallery", Expected: "绑定成功~"},
+		// read only
+		{
+			Command:    "/bind notion secret db_xxx gallery",
+			Restricted: []string{"PATCH /blocks/db_xxx/children"},
+			Expected:   "绑定成功~\n" + messageNoInsertContent,
+		},
+		{
+			Command:    "/bind notion secret page_xxx flat",
+			Restricted: []string{"GET /blocks/page_xxx/children", "PATCH /blocks/page_xxx/children"},
+			Expected:   "绑定成功~\n" + messageNoReadContent + "\n" + messageNoInsertContent,
+		},
+	}
+	for i, tc := range cases {
+		n := newFakeNotion()
+		for _, req := range tc.Restricted {
+			var method, path string
+			fmt.Sscan(req, &method, &path)
+			n.Reply(method, path, http.StatusForbidden, restrictedBody)
+		}
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{
+			Notion:            notion.ClientOption{BaseURI: n.URL},
+			CheckCapabilities: true,
+		})
+
+		event := newTestLarkEvent("xxx", tc.Command)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		n.Close()
+
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if len(replies) != 1 || replies[0].Msg != tc.Expected {
+			t.Fatalf("command: %s, restricted: %v, expected %q, got %+v", tc.Command, tc.Restricted, tc.Expected, replies)
+		}
+		if _, err := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx"); err != nil {
+			t.Fatalf("command: %s, expected bound anyway, got %v", tc.Command, err)
+		}
+	}
+}
+
+func TestCheckCapabilitiesNotShared(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodGet, "/databases/db_xxx", http.StatusNotFound, `{"object": "error", "status": 404, "code": "object_not_found"}`)
+
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}, CheckCapabilities: true})
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "/bind notion secret db_xxx gallery")); err != nil {
+		t.Fatal(err)
+	}
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	expected := "绑定成功~\n" + notionAccessHints[entity.NotionAccessNotShared]
+	if len(replies) != 1 || replies[0].Msg != expected {
+		t.Fatalf("expected %q, got %+v", expected, replies)
+	}
+	// nothing else is probed
+	if reqs := n.Requests(); len(reqs) != 1 {
+		t.Fatalf("expected one probe, got %+v", reqs)
+	}
+}
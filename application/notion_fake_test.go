@@ -0,0 +1,89 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+type notionRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeNotion records the requests sent to notion and replies with the
+// response registered for "METHOD /path" and a body it contains, then for
+// "METHOD /path", or `{}` by default.
+type fakeNotion struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	requests  []notionRequest
+	responses map[string]fakeNotionResponse
+	matches   []fakeNotionMatch
+}
+
+type fakeNotionResponse struct {
+	Code int
+	Body string
+}
+
+type fakeNotionMatch struct {
+	Request  string
+	Contains string
+	fakeNotionResponse
+}
+
+func newFakeNotion() *fakeNotion {
+	n := &fakeNotion{responses: make(map[string]fakeNotionResponse)}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	return n
+}
+
+func (n *fakeNotion) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	n.mu.Lock()
+	n.requests = append(n.requests, notionRequest{Method: r.Method, Path: r.URL.Path, Body: string(body)})
+	resp, ok := n.responses[r.Method+" "+r.URL.Path]
+	for _, m := range n.matches {
+		if m.Request == r.Method+" "+r.URL.Path && strings.Contains(string(body), m.Contains) {
+			resp, ok = m.fakeNotionResponse, true
+			break
+		}
+	}
+	n.mu.Unlock()
+
+	if !ok {
+		resp = fakeNotionResponse{Code: http.StatusOK, Body: "{}"}
+	}
+	w.WriteHeader(resp.Code)
+	w.Write([]byte(resp.Body))
+}
+
+func (n *fakeNotion) Reply(method, path string, code int, body string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.responses[method+" "+path] = fakeNotionResponse{Code: code, Body: body}
+}
+
+// ReplyMatching replies to the requests of method and path whose body
+// contains contains
+func (n *fakeNotion) ReplyMatching(method, path, contains string, code int, body string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.matches = append(n.matches, fakeNotionMatch{
+		Request:            method + " " + path,
+		Contains:           contains,
+		fakeNotionResponse: fakeNotionResponse{Code: code, Body: body},
+	})
+}
+
+func (n *fakeNotion) Requests() []notionRequest {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notionRequest(nil), n.requests...)
+}
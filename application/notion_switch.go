@@ -0,0 +1,73 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/gorm"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+)
+
+// ErrNotionWritesPaused is returned when a memo is queued because notion
+// writes are disabled by the admin
+var ErrNotionWritesPaused = errors.New("notion writes are paused")
+
+// notionWriteSwitch is the global kill-switch of notion writes. The flag is
+// kept in the db so that it's shared by all instances, and cached for a few
+// seconds since it's checked before every write.
+type notionWriteSwitch struct {
+	flagRepo repository.FlagRepository
+	cache    *cache.Cache
+}
+
+func newNotionWriteSwitch(repo repository.FlagRepository) *notionWriteSwitch {
+	return &notionWriteSwitch{
+		flagRepo: repo,
+		cache:    cache.New(5*time.Second, time.Minute),
+	}
+}
+
+// Enabled reports whether notion writes are allowed, writes are enabled
+// unless the flag is explicitly turned off.
+func (s *notionWriteSwitch) Enabled(ctx context.Context) bool {
+	if s == nil || s.flagRepo == nil {
+		return true
+	}
+
+	if v, ok := s.cache.Get(entity.FlagNotionWritesEnabled); ok {
+		return v.(bool)
+	}
+
+	enabled := true
+	flag, err := s.flagRepo.GetFlag(ctx, entity.FlagNotionWritesEnabled)
+	switch {
+	case err == nil:
+		if enabled, err = strconv.ParseBool(flag.Value); err != nil {
+			log.Warnf("invalid flag %s=%s, %v", flag.Name, flag.Value, err)
+			enabled = true
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	default:
+		// don't block writes because the flag can't be read
+		log.Errorf("failed to get flag %s. err=%v", entity.FlagNotionWritesEnabled, err)
+		return true
+	}
+
+	s.cache.Set(entity.FlagNotionWritesEnabled, enabled, cache.DefaultExpiration)
+	return enabled
+}
+
+func (s *notionWriteSwitch) Set(ctx context.Context, enabled bool) error {
+	if err := s.flagRepo.SetFlag(ctx, entity.FlagNotionWritesEnabled, strconv.FormatBool(enabled)); err != nil {
+		return err
+	}
+
+	s.cache.Set(entity.FlagNotionWritesEnabled, enabled, cache.DefaultExpiration)
+	return nil
+}
@@ -0,0 +1,67 @@
+package application
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestNotionWriteSwitch(t *testing.T) {
+	bind := entity.BindInfo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+	}
+	flagRepo := newFakeFlagRepo()
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{}, bind)
+	app.notionWrites = newNotionWriteSwitch(flagRepo)
+
+	writes := 0
+	app.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		if req.Event.Event.Message.ChatID != "oc_xxx" {
+			t.Fatalf("unexpected chat id %s", req.Event.Event.Message.ChatID)
+		}
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	// the admin flips the switch of another instance
+	admin := NewAdminApp(newFakeBindInfoRepo(), memoRepo, flagRepo, nil, Option{})
+	if !admin.NotionWritesEnabled(context.TODO()) {
+		t.Fatal("notion writes should be enabled by default")
+	}
+	if err := admin.SetNotionWrites(context.TODO(), false); err != nil {
+		t.Fatal(err)
+	}
+	app.notionWrites.cache.Flush()
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "hello")); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 0 || len(memoRepo.memos) != 1 || memoRepo.memos[0].Status != uint8(entity.MemoStatusPending) {
+		t.Fatalf("memo should be queued, writes: %d, memos: %+v", writes, memoRepo.memos)
+	}
+	replies := app.messenger.(*fakeLarkMessenger).replies
+	if len(replies) != 1 {
+		t.Fatalf("expected 1 reply, got %+v", replies)
+	}
+
+	// nothing happens until writes are enabled
+	if n, err := app.ProcessPendingMemos(context.TODO()); n != 0 || err != nil {
+		t.Fatalf("processed %d pending memos, err: %v", n, err)
+	}
+
+	if err := admin.SetNotionWrites(context.TODO(), true); err != nil {
+		t.Fatal(err)
+	}
+	app.notionWrites.cache.Flush()
+
+	if n, err := app.ProcessPendingMemos(context.TODO()); n != 1 || err != nil {
+		t.Fatalf("processed %d pending memos, err: %v", n, err)
+	}
+	memo := memoRepo.memos[0]
+	if writes != 1 || memo.Status != uint8(entity.MemoStatusSaved) || memo.PageID != "page_xxx" {
+		t.Fatalf("pending memo should be written, writes: %d, memo: %+v", writes, memo)
+	}
+}
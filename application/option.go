@@ -0,0 +1,96 @@
+package application
+
+import "github.com/KDF5000/nomo/infrastructure/notion"
+
+const (
+	// send a long reply in several messages
+	ReplyOverflowSplit = "split"
+	// cut a long reply and point to notion
+	ReplyOverflowTruncate = "truncate"
+)
+
+// Option holds the tunables shared by the message handle apps
+type Option struct {
+	Notion notion.ClientOption
+	// lark open api base uri, utils.DefaultLarkOpenAPI if empty
+	LarkOpenAPI string
+	// wechat redirect urls replaced with the real ones before saved,
+	// like `host/path?param` with the real url in param
+	WXUnwrapPatterns []string
+
+	// keep inbound event metadata(message id, chat id...) with each memo
+	StoreMemoMetadata bool
+	// keep the original message too if it differs from the processed content
+	StoreRawContent bool
+	// tell users how to fix the sharing of notion pages the integration
+	// can't access or write, and mark the bindings
+	NotionAccessHints bool
+	// probe the capabilities of the integration on bind and warn of the
+	// ones nomo needs but it lacks, it costs two api calls
+	CheckCapabilities bool
+	// read notion pages back after created, it costs an extra api call
+	VerifyNotionWrites bool
+	// max number of writes tried for a memo, failed memos are retried by
+	// the pending worker until it runs out, <= 1 means no retry
+	MemoRetryBudget int
+	// queue memos as pending and leave the writes to the pending worker,
+	// so that events are acked as soon as the memos are stored
+	QueueInbound bool
+	// max notion writes of a binding a day in the user's timezone, the
+	// admin is told once it's reached, <= 0 means no limit. The default of
+	// the bindings without `/set daily_cap`
+	DailyPageCap int
+	// keep memos over the cap pending for the next day instead of rejecting them
+	QueueOverCap bool
+	// max characters of memos written for a binding a month in the user's
+	// timezone, the admin is told once it's reached, <= 0 means no limit.
+	// The default of the bindings without `/set char_budget`
+	MonthlyCharBudget int
+
+	// max runes of a lark reply, <= 0 means no limit. The default of the
+	// bindings without `/set reply_max_length`
+	ReplyMaxLength int
+	// how to send a longer reply: split(default) or truncate
+	ReplyOverflow string
+
+	// memos imported per second, <= 0 means no limit
+	ImportRate int
+
+	// max runes of content in logs and admin notifications, <= 0 keeps all
+	PreviewLength int
+
+	// keep an anonymized row(content hash, length, tags) of each memo for analytics
+	MemoAnalytics bool
+	// key of the content hash in analytics
+	AnalyticsSalt string
+
+	// detects the language of memos for language routes, by the script of
+	// the letters if nil. Languages detected with less confidence, 0.6 if
+	// 0, are routed as undetermined
+	LanguageDetector   LanguageDetector
+	LanguageConfidence float64
+
+	// where the images of lark memos are stored, they're rejected as
+	// unsupported messages if nil
+	ImageStore ImageStore
+	// downscales the images over MaxImageSize, they're saved as
+	// placeholders if nil
+	ImageDownscaler ImageDownscaler
+	// max bytes of images saved, 10MB if 0
+	MaxImageSize int64
+	// times a lark image is downloaded before a placeholder is saved
+	// instead, 3 if 0
+	ResourceAttempts int
+
+	// rebinding a notion page updates the bindings of the same page and
+	// secret key on the other platforms too, they're only warned of if off
+	SyncSharedBindings bool
+
+	// key of the originals of redacted memos kept for the users, they
+	// aren't kept if empty
+	RedactionKey string
+
+	// hash-chained record of each memo(who, when, content hash, destination),
+	// none if nil
+	AuditSink AuditSink
+}
@@ -0,0 +1,88 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestPageTemplate(t *testing.T) {
+	n := newFakeNotion()
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	if err := ApplySetting(&settings, "page_template", "## Context\n\n## Details\n{body}\n## Action Items\n- 待补充"); err != nil {
+		t.Fatal(err)
+	}
+	bind.SetSettings(&settings)
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+	if err := app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "周会讨论了发布计划")); err != nil {
+		t.Fatal(err)
+	}
+	n.Close()
+
+	var page *core.Page
+	for _, req := range n.Requests() {
+		if req.Method == http.MethodPost && req.Path == "/pages" {
+			page = &core.Page{}
+			if err := json.Unmarshal([]byte(req.Body), page); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if page == nil {
+		t.Fatalf("expected a page created, got %+v", n.Requests())
+	}
+
+	var got []string
+	for _, block := range page.Children {
+		var text core.RichTextArrary
+		switch block.Type {
+		case core.BLOCK_HEADING2:
+			text = block.Heading2Block.Text
+		case core.BLOCK_PARAGRAPH:
+			text = block.ParagraphBlock.Text
+		}
+		if len(text) == 0 {
+			t.Fatalf("unexpected block %+v", block)
+		}
+		got = append(got, block.Type+": "+text[0].Text.Content)
+	}
+	expected := []string{
+		"heading_2: Context",
+		"heading_2: Details",
+		"paragraph: 周会讨论了发布计划",
+		"heading_2: Action Items",
+		"paragraph: - 待补充",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected blocks %v, got %v", expected, got)
+	}
+
+	if err := ApplySetting(&settings, "page_template", "off"); err != nil || settings.PageTemplate != "" {
+		t.Fatalf("expected page_template off, got %q, %v", settings.PageTemplate, err)
+	}
+}
+
+func TestPageTemplateInvalid(t *testing.T) {
+	for _, value := range []string{
+		"## Context\n## Details",
+		"{body}\n## Details\n{body}",
+		"## Details: {body}",
+		"#### Details\n{body}",
+		"##\n{body}",
+	} {
+		var s entity.BindSettings
+		if err := ApplySetting(&s, "page_template", value); err == nil {
+			t.Fatalf("template: %q, expected invalid", value)
+		}
+	}
+}
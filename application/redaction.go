@@ -0,0 +1,157 @@
+package application
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+// redactMask replaces the redacted values in content
+const redactMask = "[已隐藏]"
+
+// redactPresets are the patterns set by name by `/set redact name`
+var redactPresets = map[string]string{
+	// 13 to 19 digits, grouped by spaces or dashes
+	"card":  `\b(?:\d[ -]?){12,18}\d\b`,
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+}
+
+func redactPattern(pattern string) string {
+	if preset, ok := redactPresets[pattern]; ok {
+		return preset
+	}
+	return pattern
+}
+
+// redactContent masks the matches of the redaction patterns of s in
+// content, and reports whether there were any.
+func redactContent(s *entity.BindSettings, content string) (string, bool) {
+	redacted := false
+	for _, pattern := range s.RedactPatterns {
+		// validated when set
+		re, err := regexp.Compile(redactPattern(pattern))
+		if err != nil {
+			log.Warnf("skip invalid redaction pattern %s, err=%v", pattern, err)
+			continue
+		}
+		if re.MatchString(content) {
+			content = re.ReplaceAllLiteralString(content, redactMask)
+			redacted = true
+		}
+	}
+	return content, redacted
+}
+
+// pattern, a preset like card or email, pattern off, or off for all. The
+// pattern may have spaces.
+func setRedact(s *entity.BindSettings, value string) error {
+	if value == "off" {
+		s.RedactPatterns = nil
+		return nil
+	}
+
+	pattern := value
+	off := strings.HasSuffix(value, " off")
+	if off {
+		pattern = strings.TrimSpace(strings.TrimSuffix(value, " off"))
+	}
+	if _, err := regexp.Compile(redactPattern(pattern)); err != nil {
+		return fmt.Errorf("invalid pattern of redact, %v", err)
+	}
+
+	for i, p := range s.RedactPatterns {
+		if p != pattern {
+			continue
+		}
+		if off {
+			s.RedactPatterns = append(s.RedactPatterns[:i], s.RedactPatterns[i+1:]...)
+			if len(s.RedactPatterns) == 0 {
+				s.RedactPatterns = nil
+			}
+		}
+		return nil
+	}
+	if !off {
+		s.RedactPatterns = append(s.RedactPatterns, pattern)
+	}
+	return nil
+}
+
+// userCipher is the AES-GCM cipher of the user unionUserID, keyed by key
+// and the user so that a sealed content opens for its user only
+func userCipher(key, unionUserID string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(unionUserID))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealOriginal encrypts the content of unionUserID before it's redacted
+func sealOriginal(key, unionUserID, content string) (string, error) {
+	gcm, err := userCipher(key, unionUserID)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(content), nil)), nil
+}
+
+// OpenOriginal decrypts the original of a redacted memo of unionUserID,
+// sealed with key.
+func OpenOriginal(key, unionUserID, sealed string) (string, error) {
+	gcm, err := userCipher(key, unionUserID)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("sealed original too short")
+	}
+	content, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// keepOriginal keeps original, the content of memo before redacted, sealed
+// if the binding wants it and there's a key. The raw message is dropped as
+// it has the redacted values.
+func (app *larkMessageHandleApp) keepOriginal(s *entity.BindSettings, memo *entity.Memo, original string) {
+	memo.RawContent = ""
+	if !s.RedactKeepOriginal {
+		return
+	}
+	if app.redactionKey == "" {
+		log.Warnf("no redaction key, the original of the memo of %s isn't kept", memo.UnionUserID)
+		return
+	}
+
+	sealed, err := sealOriginal(app.redactionKey, memo.UnionUserID, original)
+	if err != nil {
+		log.Errorf("failed to seal the original of the memo of %s. err=%v", memo.UnionUserID, err)
+		return
+	}
+	memo.SealedOriginal = sealed
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestRedactContent(t *testing.T) {
+	cases := []struct {
+		Patterns []string
+		Content  string
+		Expected string
+		Redacted bool
+	}{
+		{
+			Patterns: []string{"card"},
+			Content:  "卡号 4111 1111 1111 1111 记得还款",
+			Expected: "卡号 [已隐藏] 记得还款",
+			Redacted: true,
+		},
+		{
+			Patterns: []string{"card"},
+			Content:  "card 4111-1111-1111-1111",
+			Expected: "card [已隐藏]",
+			Redacted: true,
+		},
+		// normal text and short numbers are left intact
+		{
+			Patterns: []string{"card", "email"},
+			Content:  "2024年6月10日 买了3本书，电话 13800138000",
+			Expected: "2024年6月10日 买了3本书，电话 13800138000",
+		},
+		{
+			Patterns: []string{"email"},
+			Content:  "联系 alice.w@example.com 或 bob@example.org",
+			Expected: "联系 [已隐藏] 或 [已隐藏]",
+			Redacted: true,
+		},
+		{
+			Patterns: []string{`token=\w+`},
+			Content:  "url?token=abc123&x=1",
+			Expected: "url?[已隐藏]&x=1",
+			Redacted: true,
+		},
+		{Content: "4111 1111 1111 1111", Expected: "4111 1111 1111 1111"},
+	}
+	for _, tc := range cases {
+		s := entity.BindSettings{RedactPatterns: tc.Patterns}
+		content, redacted := redactContent(&s, tc.Content)
+		if content != tc.Expected || redacted != tc.Redacted {
+			t.Fatalf("patterns: %v, content: %q, expected %q(%v), got %q(%v)",
+				tc.Patterns, tc.Content, tc.Expected, tc.Redacted, content, redacted)
+		}
+	}
+}
+
+func TestSetRedact(t *testing.T) {
+	var s entity.BindSettings
+	for _, value := range []string{"card", "email", `id \d+`, "card"} {
+		if err := ApplySetting(&s, "redact", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.RedactPatterns) != 3 {
+		t.Fatalf("expected 3 patterns, got %v", s.RedactPatterns)
+	}
+	if err := ApplySetting(&s, "redact", "email off"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.RedactPatterns) != 2 || s.RedactPatterns[1] != `id \d+` {
+		t.Fatalf("expected email removed, got %v", s.RedactPatterns)
+	}
+	if err := ApplySetting(&s, "redact", "off"); err != nil || s.RedactPatterns != nil {
+		t.Fatalf("expected no patterns, got %v, err=%v", s.RedactPatterns, err)
+	}
+	if err := ApplySetting(&s, "redact", "a(b"); err == nil {
+		t.Fatal("expected invalid pattern")
+	}
+}
+
+func TestRedactMemo(t *testing.T) {
+	const content = "卡号 4111 1111 1111 1111"
+	for i, keep := range []string{"off", "on"} {
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		if err := ApplySetting(&settings, "redact", "card"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ApplySetting(&settings, "redact_keep", keep); err != nil {
+			t.Fatal(err)
+		}
+		bind.SetSettings(&settings)
+		memoRepo := &fakeMemoRepo{}
+		app := newTestLarkApp(memoRepo, Option{StoreRawContent: true, RedactionKey: "secret"}, bind)
+
+		event := newTestLarkEvent("xxx", content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		if len(memoRepo.memos) != 1 {
+			t.Fatalf("expected a memo, got %+v", memoRepo.memos)
+		}
+		memo := memoRepo.memos[0]
+		if memo.Content != "卡号 [已隐藏]" || memo.RawContent != "" {
+			t.Fatalf("expected redacted memo, got %+v", memo)
+		}
+
+		if keep == "off" {
+			if memo.SealedOriginal != "" {
+				t.Fatalf("expected no original kept, got %+v", memo)
+			}
+			continue
+		}
+		original, err := OpenOriginal("secret", memo.UnionUserID, memo.SealedOriginal)
+		if err != nil || original != content {
+			t.Fatalf("expected original %q, got %q, err=%v", content, original, err)
+		}
+		// sealed for the user only
+		if _, err := OpenOriginal("secret", "lark_yyy", memo.SealedOriginal); err == nil {
+			t.Fatal("expected the original not opened for another user")
+		}
+	}
+}
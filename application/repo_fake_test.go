@@ -0,0 +1,405 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+type fakeBindInfoRepo struct {
+	mu    sync.Mutex
+	binds map[string]entity.BindInfo
+	// returned by UpdateSettings if set
+	settingsErr error
+}
+
+func newFakeBindInfoRepo(binds ...entity.BindInfo) *fakeBindInfoRepo {
+	repo := &fakeBindInfoRepo{binds: make(map[string]entity.BindInfo)}
+	for _, b := range binds {
+		repo.binds[b.UnionUserID] = b
+	}
+	return repo
+}
+
+func (repo *fakeBindInfoRepo) UpdateOrInsert(ctx context.Context, b *entity.BindInfo) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if b.Settings == "" {
+		b.Settings = repo.binds[b.UnionUserID].Settings
+	}
+	repo.binds[b.UnionUserID] = *b
+	return nil
+}
+
+func (repo *fakeBindInfoRepo) GetBindInfoByUnionUserID(ctx context.Context, id string) (*entity.BindInfo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	b, ok := repo.binds[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &b, nil
+}
+
+func (repo *fakeBindInfoRepo) UpdateSettings(ctx context.Context, id string, update func(s *entity.BindSettings) error) (*entity.BindSettings, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	b, ok := repo.binds[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if repo.settingsErr != nil {
+		return nil, repo.settingsErr
+	}
+	settings, err := b.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	if err := update(&settings); err != nil {
+		if errors.Is(err, repository.ErrSettingsUnchanged) {
+			return &settings, nil
+		}
+		return nil, err
+	}
+	if err := b.SetSettings(&settings); err != nil {
+		return nil, err
+	}
+	repo.binds[id] = b
+	return &settings, nil
+}
+
+func (repo *fakeBindInfoRepo) ListBindInfosByNotionPage(ctx context.Context, pageID string) ([]entity.BindInfo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var binds []entity.BindInfo
+	for _, b := range repo.binds {
+		var pageInfo entity.NotionPageInfo
+		if json.Unmarshal([]byte(b.PageInfo), &pageInfo) == nil && pageInfo.NotionPageID == pageID &&
+			entity.BindPlatformType(b.BindPlatform) == entity.BindPlatformTypeNotion {
+			binds = append(binds, b)
+		}
+	}
+	sort.Slice(binds, func(i, j int) bool { return binds[i].UnionUserID < binds[j].UnionUserID })
+	return binds, nil
+}
+
+type fakeMemoRepo struct {
+	mu    sync.Mutex
+	memos []entity.Memo
+}
+
+func (repo *fakeMemoRepo) Create(ctx context.Context, m *entity.Memo) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if m.UnionUserID == "" {
+		return repository.ErrAccountRequired
+	}
+	m.ID = uint(len(repo.memos) + 1)
+	repo.memos = append(repo.memos, *m)
+	return nil
+}
+
+// get returns the index of memo id of accountID
+func (repo *fakeMemoRepo) get(accountID string, id uint) (int, error) {
+	if accountID == "" {
+		return 0, repository.ErrAccountRequired
+	}
+	if id == 0 || int(id) > len(repo.memos) || repo.memos[id-1].UnionUserID != accountID {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return int(id - 1), nil
+}
+
+func (repo *fakeMemoRepo) Update(ctx context.Context, accountID string, m *entity.Memo) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	i, err := repo.get(accountID, m.ID)
+	if err != nil {
+		return err
+	}
+	if m.UnionUserID != accountID {
+		return gorm.ErrRecordNotFound
+	}
+	reviewed := repo.memos[i].Reviewed
+	repo.memos[i] = *m
+	repo.memos[i].Reviewed = reviewed
+	return nil
+}
+
+func (repo *fakeMemoRepo) GetMemoByID(ctx context.Context, accountID string, id uint) (*entity.Memo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	i, err := repo.get(accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	m := repo.memos[i]
+	return &m, nil
+}
+
+func (repo *fakeMemoRepo) ListMemos(ctx context.Context, accountID string) ([]entity.Memo, error) {
+	return repo.ListMemosByStatus(ctx, accountID, 0, len(repo.memos))
+}
+
+// status 0 matches all memos
+func (repo *fakeMemoRepo) ListMemosByStatus(ctx context.Context, accountID string, status entity.MemoStatusType, limit int) ([]entity.Memo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if accountID == "" {
+		return nil, repository.ErrAccountRequired
+	}
+	var memos []entity.Memo
+	for _, m := range repo.memos {
+		if m.UnionUserID == accountID && (status == 0 || m.Status == uint8(status)) && len(memos) < limit {
+			memos = append(memos, m)
+		}
+	}
+	return memos, nil
+}
+
+func (repo *fakeMemoRepo) ListMemosToReview(ctx context.Context, accountID string, since time.Time, limit int) ([]entity.Memo, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if accountID == "" {
+		return nil, repository.ErrAccountRequired
+	}
+	var memos []entity.Memo
+	for _, m := range repo.memos {
+		if m.UnionUserID == accountID && m.Status == uint8(entity.MemoStatusSaved) && !m.Reviewed &&
+			!m.CreatedAt.Before(since) && len(memos) < limit {
+			memos = append(memos, m)
+		}
+	}
+	return memos, nil
+}
+
+func (repo *fakeMemoRepo) MarkMemosReviewed(ctx context.Context, accountID string, ids []uint) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for _, id := range ids {
+		i, err := repo.get(accountID, id)
+		if err != nil {
+			return err
+		}
+		repo.memos[i].Reviewed = true
+	}
+	return nil
+}
+
+func (repo *fakeMemoRepo) ClaimMemo(ctx context.Context, accountID string, id uint) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	i, err := repo.get(accountID, id)
+	if err != nil {
+		return false, err
+	}
+	if repo.memos[i].Status != uint8(entity.MemoStatusPending) {
+		return false, nil
+	}
+	for _, m := range repo.memos[:i] {
+		if m.UnionUserID == accountID &&
+			(m.Status == uint8(entity.MemoStatusPending) || m.Status == uint8(entity.MemoStatusProcessing)) {
+			return false, nil
+		}
+	}
+	repo.memos[i].Status = uint8(entity.MemoStatusProcessing)
+	repo.memos[i].UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (repo *fakeMemoRepo) ReleaseMemos(ctx context.Context, before time.Time) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	n := 0
+	for i := range repo.memos {
+		if m := &repo.memos[i]; m.Status == uint8(entity.MemoStatusProcessing) && m.UpdatedAt.Before(before) {
+			m.Status = uint8(entity.MemoStatusPending)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (repo *fakeMemoRepo) ListAccountsByStatus(ctx context.Context, status entity.MemoStatusType) ([]string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	seen := make(map[string]bool)
+	var accounts []string
+	for _, m := range repo.memos {
+		if m.Status == uint8(status) && !seen[m.UnionUserID] {
+			seen[m.UnionUserID] = true
+			accounts = append(accounts, m.UnionUserID)
+		}
+	}
+	return accounts, nil
+}
+
+func (repo *fakeMemoRepo) CountMemosByError(ctx context.Context, statuses ...entity.MemoStatusType) ([]entity.MemoErrorCount, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	var counts []entity.MemoErrorCount
+	for _, m := range repo.memos {
+		for _, status := range statuses {
+			if m.Status != uint8(status) {
+				continue
+			}
+			found := false
+			for i := range counts {
+				if counts[i].Status == m.Status && counts[i].LastError == m.LastError {
+					counts[i].Count++
+					found = true
+				}
+			}
+			if !found {
+				counts = append(counts, entity.MemoErrorCount{Status: m.Status, LastError: m.LastError, Count: 1})
+			}
+		}
+	}
+	return counts, nil
+}
+
+type fakeFlagRepo struct {
+	mu    sync.Mutex
+	flags map[string]string
+}
+
+func newFakeFlagRepo() *fakeFlagRepo {
+	return &fakeFlagRepo{flags: make(map[string]string)}
+}
+
+func (repo *fakeFlagRepo) GetFlag(ctx context.Context, name string) (*entity.Flag, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	v, ok := repo.flags[name]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &entity.Flag{Name: name, Value: v}, nil
+}
+
+func (repo *fakeFlagRepo) SetFlag(ctx context.Context, name, value string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.flags[name] = value
+	return nil
+}
+
+type fakeAnalyticsRepo struct {
+	mu   sync.Mutex
+	rows []entity.MemoAnalytics
+}
+
+func (repo *fakeAnalyticsRepo) Create(ctx context.Context, a *entity.MemoAnalytics) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	a.ID = uint(len(repo.rows) + 1)
+	repo.rows = append(repo.rows, *a)
+	return nil
+}
+
+type fakeLarkBotRegistarRepo struct {
+	mu   sync.Mutex
+	regs map[string]entity.LarkBotRegistar
+}
+
+func newFakeLarkBotRegistarRepo(regs ...entity.LarkBotRegistar) *fakeLarkBotRegistarRepo {
+	repo := &fakeLarkBotRegistarRepo{regs: make(map[string]entity.LarkBotRegistar)}
+	for _, r := range regs {
+		repo.regs[r.AppID] = r
+	}
+	return repo
+}
+
+func (repo *fakeLarkBotRegistarRepo) UpdateOrInsert(ctx context.Context, b *entity.LarkBotRegistar) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.regs[b.AppID] = *b
+	return nil
+}
+
+func (repo *fakeLarkBotRegistarRepo) GetLarkBotRegistarByUnionUserID(ctx context.Context, appID string) (*entity.LarkBotRegistar, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	r, ok := repo.regs[appID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &r, nil
+}
+
+type larkReply struct {
+	ChatID    string
+	MessageID string
+	Msg       string
+}
+
+type fakeLarkMessenger struct {
+	mu          sync.Mutex
+	replies     []larkReply
+	reactions   []string
+	reactionErr error
+	// chat id => name
+	chatNames     map[string]string
+	chatNameCalls int
+	// image key => image
+	images map[string][]byte
+	// image key => downloads failing before it's returned
+	imageFailures map[string]int
+	imageCalls    int
+}
+
+func (m *fakeLarkMessenger) Reply(appID, secretKey, chatID, messageID, msg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, larkReply{ChatID: chatID, MessageID: messageID, Msg: msg})
+	return nil
+}
+
+func (m *fakeLarkMessenger) AddReaction(appID, secretKey, messageID, emojiType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reactionErr != nil {
+		return m.reactionErr
+	}
+	m.reactions = append(m.reactions, messageID+":"+emojiType)
+	return nil
+}
+
+func (m *fakeLarkMessenger) ChatName(appID, secretKey, chatID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chatNameCalls++
+	name, ok := m.chatNames[chatID]
+	if !ok {
+		return "", fmt.Errorf("chat %s not found", chatID)
+	}
+	return name, nil
+}
+
+func (m *fakeLarkMessenger) Image(appID, secretKey, messageID, imageKey string, maxSize int64) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.imageCalls++
+	if m.imageFailures[imageKey] > 0 {
+		m.imageFailures[imageKey]--
+		return nil, "", fmt.Errorf("download image %s timeout", imageKey)
+	}
+	image, ok := m.images[imageKey]
+	if !ok {
+		return nil, "", fmt.Errorf("image %s not found", imageKey)
+	}
+	if int64(len(image)) > maxSize {
+		return nil, "", &utils.ResourceTooLargeError{Size: int64(len(image)), Max: maxSize}
+	}
+	return image, "image/png", nil
+}
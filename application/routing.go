@@ -0,0 +1,142 @@
+package application
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+// routeDatabase is the database for a gallery memo of content with tags:
+// the route of its first routed tag, then the first regex route it matches,
+// then the route of its language lang, empty if undetermined, then the first
+// size route it's shorter than, otherwise the bound database dbId.
+func routeDatabase(s *entity.BindSettings, tags []string, content, lang, dbId string) string {
+	for _, tag := range tags {
+		if id, ok := s.TagRoutes[tag]; ok {
+			return id
+		}
+	}
+
+	for _, route := range s.RegexRoutes {
+		// validated when set
+		re, err := regexp.Compile(route.Pattern)
+		if err != nil {
+			log.Warnf("skip invalid regex route %s, err=%v", route.Pattern, err)
+			continue
+		}
+		if re.MatchString(content) {
+			return route.DatabaseID
+		}
+	}
+
+	if id, ok := s.LanguageRoutes[lang]; ok && lang != "" {
+		return id
+	}
+
+	length := len([]rune(content))
+	for _, route := range s.SizeRoutes {
+		if length < route.MaxLength {
+			return route.DatabaseID
+		}
+	}
+
+	return dbId
+}
+
+// tag database_id, or tag off
+func setTagRoute(s *entity.BindSettings, value string) error {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return fmt.Errorf("tag_route should be like `tag database_id` or `tag off`")
+	}
+
+	tag := strings.TrimPrefix(parts[0], "#")
+	if parts[1] == "off" {
+		delete(s.TagRoutes, tag)
+		return nil
+	}
+
+	if s.TagRoutes == nil {
+		s.TagRoutes = make(map[string]string)
+	}
+	s.TagRoutes[tag] = parts[1]
+	return nil
+}
+
+// pattern database_id, pattern off, or off for all. the pattern may have
+// spaces, the database id is the last field.
+func setRegexRoute(s *entity.BindSettings, value string) error {
+	if value == "off" {
+		s.RegexRoutes = nil
+		return nil
+	}
+
+	i := strings.LastIndexAny(value, " \t\n")
+	if i < 0 {
+		return fmt.Errorf("regex_route should be like `pattern database_id`, `pattern off` or `off`")
+	}
+	pattern, dbId := strings.TrimSpace(value[:i]), value[i+1:]
+	if _, err := regexp.Compile(pattern); err != nil {
+		return fmt.Errorf("invalid pattern of regex_route, %v", err)
+	}
+
+	// a pattern set again keeps its place
+	for i := range s.RegexRoutes {
+		if s.RegexRoutes[i].Pattern != pattern {
+			continue
+		}
+		if dbId == "off" {
+			s.RegexRoutes = append(s.RegexRoutes[:i], s.RegexRoutes[i+1:]...)
+		} else {
+			s.RegexRoutes[i].DatabaseID = dbId
+		}
+		if len(s.RegexRoutes) == 0 {
+			s.RegexRoutes = nil
+		}
+		return nil
+	}
+	if dbId != "off" {
+		s.RegexRoutes = append(s.RegexRoutes, entity.RegexRoute{Pattern: pattern, DatabaseID: dbId})
+	}
+	return nil
+}
+
+// max_length database_id, max_length off, or off for all
+func setSizeRoute(s *entity.BindSettings, value string) error {
+	if value == "off" {
+		s.SizeRoutes = nil
+		return nil
+	}
+
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return fmt.Errorf("size_route should be like `max_length database_id`, `max_length off` or `off`")
+	}
+	maxLength, err := strconv.Atoi(parts[0])
+	if err != nil || maxLength <= 0 {
+		return fmt.Errorf("invalid max length of size_route %s", parts[0])
+	}
+
+	routes := s.SizeRoutes[:0]
+	for _, route := range s.SizeRoutes {
+		if route.MaxLength != maxLength {
+			routes = append(routes, route)
+		}
+	}
+	if parts[1] != "off" {
+		routes = append(routes, entity.SizeRoute{MaxLength: maxLength, DatabaseID: parts[1]})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].MaxLength < routes[j].MaxLength })
+
+	s.SizeRoutes = routes
+	if len(routes) == 0 {
+		s.SizeRoutes = nil
+	}
+	return nil
+}
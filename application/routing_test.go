@@ -0,0 +1,248 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestRouteDatabase(t *testing.T) {
+	var s entity.BindSettings
+	for key, value := range map[string]string{
+		"tag_route":  "#科技 db_tech",
+		"size_route": "140 db_fleeting",
+	} {
+		if err := ApplySetting(&s, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ApplySetting(&s, "size_route", "20 db_tiny"); err != nil {
+		t.Fatal(err)
+	}
+
+	long := strings.Repeat("长", 140)
+	cases := []struct {
+		Content  string
+		Expected string
+	}{
+		// tags win over size
+		{Content: "#科技 go", Expected: "db_tech"},
+		{Content: "#美食 #科技 " + long, Expected: "db_tech"},
+		// the smallest threshold first
+		{Content: "quick", Expected: "db_tiny"},
+		{Content: strings.Repeat("长", 19), Expected: "db_tiny"},
+		{Content: strings.Repeat("长", 20), Expected: "db_fleeting"},
+		{Content: "#美食 " + strings.Repeat("长", 100), Expected: "db_fleeting"},
+		{Content: strings.Repeat("长", 139), Expected: "db_fleeting"},
+		// the bound database by default
+		{Content: long, Expected: "db_xxx"},
+	}
+	for _, tc := range cases {
+		if id := routeDatabase(&s, scanTags(tc.Content, "", ""), tc.Content, "", "db_xxx"); id != tc.Expected {
+			t.Fatalf("content: %s, expected %s, got %s", tc.Content, tc.Expected, id)
+		}
+	}
+}
+
+func TestRouteSettings(t *testing.T) {
+	var s entity.BindSettings
+	for _, value := range []string{"140 db_fleeting", "20 db_tiny", "140 db_short", "20 off"} {
+		if err := ApplySetting(&s, "size_route", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []entity.SizeRoute{{MaxLength: 140, DatabaseID: "db_short"}}
+	if !reflect.DeepEqual(s.SizeRoutes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, s.SizeRoutes)
+	}
+	if err := ApplySetting(&s, "size_route", "off"); err != nil || s.SizeRoutes != nil {
+		t.Fatalf("expected size routes cleared, got %+v, err: %v", s.SizeRoutes, err)
+	}
+
+	if err := ApplySetting(&s, "tag_route", "科技 db_tech"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplySetting(&s, "tag_route", "#科技 off"); err != nil || len(s.TagRoutes) != 0 {
+		t.Fatalf("expected tag route removed, got %+v, err: %v", s.TagRoutes, err)
+	}
+
+	for key, value := range map[string]string{
+		"size_route": "short db_xxx",
+		"tag_route":  "科技",
+	} {
+		if err := ApplySetting(&s, key, value); err == nil {
+			t.Fatalf("expected invalid %s %s", key, value)
+		}
+	}
+	if err := ApplySetting(&s, "size_route", "-1 db_xxx"); err == nil {
+		t.Fatal("expected invalid max length")
+	}
+}
+
+func TestRegexRoutes(t *testing.T) {
+	var s entity.BindSettings
+	for key, value := range map[string]string{
+		"tag_route":  "#科技 db_tech",
+		"size_route": "20 db_tiny",
+	} {
+		if err := ApplySetting(&s, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, value := range []string{`(?i)invoice\s+#?\d+ db_finance`, `发票|报销 db_expense`, `.* db_catchall`} {
+		if err := ApplySetting(&s, "regex_route", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		Content  string
+		Expected string
+	}{
+		// tags win over patterns
+		{Content: "#科技 invoice 42", Expected: "db_tech"},
+		// the first match wins, and patterns win over size
+		{Content: "Invoice #42 发票", Expected: "db_finance"},
+		{Content: "报销", Expected: "db_expense"},
+		{Content: "quick", Expected: "db_catchall"},
+	}
+	for _, tc := range cases {
+		if id := routeDatabase(&s, scanTags(tc.Content, "", ""), tc.Content, "", "db_xxx"); id != tc.Expected {
+			t.Fatalf("content: %s, expected %s, got %s", tc.Content, tc.Expected, id)
+		}
+	}
+
+	// no match falls back to size routes and the bound database
+	if err := ApplySetting(&s, "regex_route", ".* off"); err != nil {
+		t.Fatal(err)
+	}
+	if id := routeDatabase(&s, nil, "quick", "", "db_xxx"); id != "db_tiny" {
+		t.Fatalf("expected db_tiny, got %s", id)
+	}
+	if id := routeDatabase(&s, nil, strings.Repeat("长", 20), "", "db_xxx"); id != "db_xxx" {
+		t.Fatalf("expected db_xxx, got %s", id)
+	}
+}
+
+func TestRegexRouteSettings(t *testing.T) {
+	var s entity.BindSettings
+	for _, value := range []string{"a db_a", "b c db_bc", "a db_aa"} {
+		if err := ApplySetting(&s, "regex_route", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a pattern set again keeps its place
+	expected := []entity.RegexRoute{{Pattern: "a", DatabaseID: "db_aa"}, {Pattern: "b c", DatabaseID: "db_bc"}}
+	if !reflect.DeepEqual(s.RegexRoutes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, s.RegexRoutes)
+	}
+
+	for _, value := range []string{"db_xxx", "(unclosed db_xxx"} {
+		if err := ApplySetting(&s, "regex_route", value); err == nil {
+			t.Fatalf("expected invalid regex_route %s", value)
+		}
+	}
+
+	if err := ApplySetting(&s, "regex_route", "a off"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.RegexRoutes) != 1 || s.RegexRoutes[0].Pattern != "b c" {
+		t.Fatalf("expected route of a removed, got %+v", s.RegexRoutes)
+	}
+	if err := ApplySetting(&s, "regex_route", "off"); err != nil || s.RegexRoutes != nil {
+		t.Fatalf("expected regex routes cleared, got %+v, err: %v", s.RegexRoutes, err)
+	}
+}
+
+// fakeDetector tells the languages of texts it knows
+type fakeDetector map[string]struct {
+	Lang       string
+	Confidence float64
+}
+
+func (d fakeDetector) DetectLanguage(text string) (string, float64) {
+	result := d[text]
+	return result.Lang, result.Confidence
+}
+
+func TestLanguageRoute(t *testing.T) {
+	detector := fakeDetector{
+		"今天读完了一本书":              {Lang: "zh", Confidence: 0.95},
+		"finished a book today": {Lang: "en", Confidence: 0.9},
+		"ok 好":                  {Lang: "en", Confidence: 0.5},
+		"42":                    {},
+		"guten tag":             {Lang: "de", Confidence: 0.8},
+	}
+	cases := []struct {
+		Content  string
+		Expected string
+	}{
+		{Content: "今天读完了一本书", Expected: "db_zh"},
+		{Content: "finished a book today", Expected: "db_en"},
+		// low confidence, undetermined and unrouted languages go to the default
+		{Content: "ok 好", Expected: "db_xxx"},
+		{Content: "42", Expected: "db_xxx"},
+		{Content: "guten tag", Expected: "db_xxx"},
+	}
+
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	for _, value := range []string{"zh db_zh", "EN db_en", "ja db_ja", "ja off"} {
+		if err := ApplySetting(&settings, "lang_route", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(settings.LanguageRoutes, map[string]string{"zh": "db_zh", "en": "db_en"}) {
+		t.Fatalf("unexpected language routes %+v", settings.LanguageRoutes)
+	}
+	bind.SetSettings(&settings)
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}, LanguageDetector: detector}, bind)
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+	for i, tc := range cases {
+		event := newTestLarkEvent("xxx", tc.Content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		var page string
+		for _, req := range n.Requests() {
+			if req.Method == http.MethodPost && req.Path == "/pages" {
+				page = req.Body
+			}
+		}
+		if !strings.Contains(page, `"database_id":"`+tc.Expected+`"`) {
+			t.Fatalf("content: %s, expected page in %s, got %s", tc.Content, tc.Expected, page)
+		}
+	}
+}
+
+func TestScriptDetector(t *testing.T) {
+	cases := []struct {
+		Text       string
+		Lang       string
+		Confidence float64
+	}{
+		{Text: "今天天气不错", Lang: "zh", Confidence: 1},
+		{Text: "nice weather", Lang: "en", Confidence: 1},
+		{Text: "今日はいい天気", Lang: "ja", Confidence: 1},
+		{Text: "用Go写了", Lang: "zh", Confidence: 0.6},
+		{Text: "2024 ...", Lang: "", Confidence: 0},
+	}
+	for _, tc := range cases {
+		lang, confidence := (scriptDetector{}).DetectLanguage(tc.Text)
+		if lang != tc.Lang || confidence != tc.Confidence {
+			t.Fatalf("text: %s, expected %s/%v, got %s/%v", tc.Text, tc.Lang, tc.Confidence, lang, confidence)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package application
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+const defaultScratchSeparator = "—— {time} ——"
+
+// scratchPage is the scratch page of the first tag of tags mapped to one,
+// empty if none is
+func scratchPage(s *entity.BindSettings, tags []string) string {
+	if s == nil {
+		return ""
+	}
+	for _, tag := range tags {
+		if id, ok := s.ScratchPages[tag]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// scratchSeparator is the line before a memo of scratch pages at t, in the
+// user's timezone
+func scratchSeparator(s *entity.BindSettings, t time.Time) string {
+	separator := s.ScratchSeparator
+	if separator == "" {
+		separator = defaultScratchSeparator
+	}
+	return strings.ReplaceAll(separator, "{time}", t.In(location(s)).Format("2006-01-02 15:04"))
+}
+
+// tag page_id, or tag off
+func setScratchPage(s *entity.BindSettings, value string) error {
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return fmt.Errorf("scratch_page should be like `tag page_id` or `tag off`")
+	}
+
+	tag := strings.TrimPrefix(parts[0], "#")
+	if parts[1] == "off" {
+		delete(s.ScratchPages, tag)
+		return nil
+	}
+
+	if s.ScratchPages == nil {
+		s.ScratchPages = make(map[string]string)
+	}
+	s.ScratchPages[tag] = parts[1]
+	return nil
+}
@@ -0,0 +1,85 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestScratchPage(t *testing.T) {
+	cases := []struct {
+		Separator string
+		Content   string
+		// the separator appended to the scratch page, empty if the memo
+		// takes the normal path
+		Expected string
+	}{
+		{Content: "#scratch 想到一个点子", Expected: "—— 2022-04-15 13:20 ——"},
+		{Separator: "=== {time} ===", Content: "#scratch 想到一个点子", Expected: "=== 2022-04-15 13:20 ==="},
+		{Content: "#todo 想到一个点子"},
+		{Content: "想到一个点子"},
+	}
+	for i, tc := range cases {
+		n := newFakeNotion()
+		bind := newTestNotionBind("gallery")
+		var settings entity.BindSettings
+		for k, v := range map[string]string{"scratch_page": "#scratch scratch_xxx", "timezone": "Asia/Shanghai"} {
+			if err := ApplySetting(&settings, k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tc.Separator != "" {
+			if err := ApplySetting(&settings, "scratch_separator", tc.Separator); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bind.SetSettings(&settings)
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+		event := newTestLarkEvent("xxx", tc.Content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		n.Close()
+
+		var appended, created []notionRequest
+		for _, req := range n.Requests() {
+			switch {
+			case req.Method == http.MethodPatch && req.Path == "/blocks/scratch_xxx/children":
+				appended = append(appended, req)
+			case req.Method == http.MethodPost && req.Path == "/pages":
+				created = append(created, req)
+			}
+		}
+		if tc.Expected == "" {
+			if len(appended) != 0 || len(created) != 1 || !strings.Contains(created[0].Body, `"database_id":"db_xxx"`) {
+				t.Fatalf("content: %s, expected a page of db_xxx, got %+v, %+v", tc.Content, appended, created)
+			}
+			continue
+		}
+		if len(appended) != 1 || len(created) != 0 {
+			t.Fatalf("content: %s, expected appended to the scratch page, got %+v, %+v", tc.Content, appended, created)
+		}
+		body := appended[0].Body
+		separator, memo := strings.Index(body, `"content":"`+tc.Expected+`"`), strings.Index(body, "想到一个点子")
+		if separator < 0 || memo < separator {
+			t.Fatalf("content: %s, expected %s before the memo, got %s", tc.Content, tc.Expected, body)
+		}
+	}
+
+	var s entity.BindSettings
+	if err := ApplySetting(&s, "scratch_page", "scratch"); err == nil {
+		t.Fatal("expected invalid scratch_page")
+	}
+	ApplySetting(&s, "scratch_page", "scratch scratch_xxx")
+	if err := ApplySetting(&s, "scratch_page", "#scratch off"); err != nil || scratchPage(&s, []string{"scratch"}) != "" {
+		t.Fatalf("expected scratch page off, got %+v, err=%v", s.ScratchPages, err)
+	}
+}
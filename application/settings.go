@@ -0,0 +1,299 @@
+package application
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+type settingSetter func(s *entity.BindSettings, value string) error
+
+// bindSettings are the keys accepted by `/set key value`
+var bindSettings = map[string]settingSetter{
+	"ack": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case entity.AckReply, entity.AckReaction, entity.AckBoth:
+			s.Ack = value
+			return nil
+		}
+		return fmt.Errorf("invalid ack, must be one of [reply, reaction, both]")
+	},
+	"replies": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case entity.RepliesAll, entity.RepliesErrors, entity.RepliesNone:
+			s.Replies = value
+			return nil
+		}
+		return fmt.Errorf("invalid replies, must be one of [all, errors, none]")
+	},
+	"capture": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case entity.CaptureOn, entity.CaptureOff, entity.CaptureQueue:
+			s.Capture = value
+			return nil
+		}
+		return fmt.Errorf("invalid capture, must be one of [on, off, queue]")
+	},
+	// off or 0 saves memos of any length
+	"min_length": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.MinLength = 0
+			return nil
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid min_length, must be a number of characters or off")
+		}
+		s.MinLength = n
+		return nil
+	},
+	// off for no limit, default for the server's
+	"daily_cap": func(s *entity.BindSettings, value string) error {
+		n, err := limitSetting(value)
+		if err != nil {
+			return fmt.Errorf("invalid daily_cap, must be a number of pages, off or default")
+		}
+		s.DailyCap = n
+		return nil
+	},
+	// off for no limit, default for the server's
+	"char_budget": func(s *entity.BindSettings, value string) error {
+		n, err := limitSetting(value)
+		if err != nil {
+			return fmt.Errorf("invalid char_budget, must be a number of characters, off or default")
+		}
+		s.CharBudget = n
+		return nil
+	},
+	// off for no limit, default for the server's
+	"reply_max_length": func(s *entity.BindSettings, value string) error {
+		n, err := limitSetting(value)
+		if err != nil {
+			return fmt.Errorf("invalid reply_max_length, must be a number of characters, off or default")
+		}
+		s.ReplyMaxLength = n
+		return nil
+	},
+	// off stops populating it
+	"sort_field": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			value = ""
+		}
+		s.SortField = value
+		return nil
+	},
+	// off stops populating it
+	"chat_property": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			value = ""
+		}
+		s.ChatProperty = value
+		return nil
+	},
+	// off stops populating it
+	"mention_property": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			value = ""
+		}
+		s.MentionProperty = value
+		return nil
+	},
+	// off stops linking related pages
+	"related_property": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			value = ""
+		}
+		s.RelatedProperty = value
+		return nil
+	},
+	// `user notion_user_id` or `user off`, user is the lark union id or name
+	"mention_user": setMentionUser,
+	"chat_tag": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case "on", "off":
+			s.ChatTag = value == "on"
+			return nil
+		}
+		return fmt.Errorf("invalid chat_tag, must be on or off")
+	},
+	// smart quotes and dashes to ascii
+	"typography": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case "on", "off":
+			s.NormalizeTypography = value == "on"
+			return nil
+		}
+		return fmt.Errorf("invalid typography, must be on or off")
+	},
+	"redact": setRedact,
+	"redact_keep": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case "on", "off":
+			s.RedactKeepOriginal = value == "on"
+			return nil
+		}
+		return fmt.Errorf("invalid redact_keep, must be on or off")
+	},
+	// max level of the headings split on, off stops splitting
+	"split_heading": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.SplitHeading = 0
+			return nil
+		}
+
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 1 || level > 6 {
+			return fmt.Errorf("invalid split_heading, must be a heading level in [1, 6] or off")
+		}
+		s.SplitHeading = level
+		return nil
+	},
+	// off saves the content as is
+	"body_template": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.BodyTemplate = ""
+			return nil
+		}
+		if _, err := parseBodyTemplate(value); err != nil {
+			return fmt.Errorf("invalid body_template, %v", err)
+		}
+		s.BodyTemplate = value
+		return nil
+	},
+	// off creates pages of the memo alone
+	"page_template": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.PageTemplate = ""
+			return nil
+		}
+		if _, err := notion.ParsePageTemplate(value); err != nil {
+			return fmt.Errorf("invalid page_template, %v", err)
+		}
+		s.PageTemplate = value
+		return nil
+	},
+	// off uses the server's
+	"timezone": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.Timezone = ""
+			return nil
+		}
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("invalid timezone, must be an IANA name like Asia/Shanghai")
+		}
+		s.Timezone = value
+		return nil
+	},
+	// off stops populating it
+	"timezone_property": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			value = ""
+		}
+		s.TimezoneProperty = value
+		return nil
+	},
+	// a parent page id, off stops the weekly review pages
+	"weekly_review": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.WeeklyReview = nil
+			return nil
+		}
+		// the pages of another parent start over
+		if s.WeeklyReview == nil || s.WeeklyReview.ParentPageID != value {
+			s.WeeklyReview = &entity.WeeklyReview{ParentPageID: value}
+		}
+		return nil
+	},
+	// a parent page id, off stops adding links to the index page
+	"index_page": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.IndexPage = nil
+			return nil
+		}
+		// the index of another parent starts over
+		if s.IndexPage == nil || s.IndexPage.ParentPageID != value {
+			s.IndexPage = &entity.IndexPage{ParentPageID: value}
+		}
+		return nil
+	},
+	// off stops populating it and forgets the streak
+	"streak_property": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			s.StreakProperty = ""
+			s.Streak = nil
+			return nil
+		}
+		s.StreakProperty = value
+		return nil
+	},
+	"db_alias":  setDatabaseAlias,
+	"tag_route": setTagRoute,
+	"multi_route": func(s *entity.BindSettings, value string) error {
+		switch value {
+		case "on", "off":
+			s.MultiRoute = value == "on"
+			return nil
+		}
+		return fmt.Errorf("invalid multi_route, must be on or off")
+	},
+	"regex_route":  setRegexRoute,
+	"size_route":   setSizeRoute,
+	"lang_route":   setLanguageRoute,
+	"scratch_page": setScratchPage,
+	// off is a line of the time
+	"scratch_separator": func(s *entity.BindSettings, value string) error {
+		if value == "off" {
+			value = ""
+		}
+		s.ScratchSeparator = value
+		return nil
+	},
+	"sort_strategy": func(s *entity.BindSettings, value string) error {
+		if !notion.ValidSortStrategy(value) {
+			return fmt.Errorf("invalid sort_strategy, must be one of [%s, %s]",
+				notion.SortStrategyOrder, notion.SortStrategyTimestamp)
+		}
+		s.SortStrategy = value
+		return nil
+	},
+}
+
+// limitSetting is the limit of value: nil for default, 0 for off, or a
+// positive number
+func limitSetting(value string) (*int, error) {
+	switch value {
+	case "default":
+		return nil, nil
+	case "off":
+		value = "0"
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid limit %s", value)
+	}
+	return &n, nil
+}
+
+func SettingKeys() string {
+	keys := make([]string, 0, len(bindSettings))
+	for k := range bindSettings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+func ApplySetting(s *entity.BindSettings, key, value string) error {
+	setter, ok := bindSettings[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %s, keys: %s", key, SettingKeys())
+	}
+
+	return setter(s, value)
+}
@@ -0,0 +1,131 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+)
+
+var userPlatformNames = map[entity.UserPlatformType]string{
+	entity.UserPlatformTypeLark: "飞书",
+	entity.UserPlatformTypeWx:   "微信",
+}
+
+// notionPageInfo is the notion page info of bind, false if it's not bound
+// to notion
+func notionPageInfo(bind *entity.BindInfo) (entity.NotionPageInfo, bool) {
+	var pageInfo entity.NotionPageInfo
+	if bind == nil || entity.BindPlatformType(bind.BindPlatform) != entity.BindPlatformTypeNotion {
+		return pageInfo, false
+	}
+	if err := json.Unmarshal([]byte(bind.PageInfo), &pageInfo); err != nil {
+		return pageInfo, false
+	}
+	return pageInfo, true
+}
+
+// sharedBindings are the bindings of the notion page of pageInfo with the
+// same secret key on the platforms other than that of bind, taken as the
+// bindings of the same user there. A user has one binding per platform, the
+// other accounts on the platform of bind, or the platforms where more than
+// one binding shares the page, are someone else's and never matched.
+func sharedBindings(ctx context.Context, repo repository.BindInfoRepository, bind *entity.BindInfo, pageInfo *entity.NotionPageInfo) ([]entity.BindInfo, error) {
+	binds, err := repo.ListBindInfosByNotionPage(ctx, pageInfo.NotionPageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []entity.BindInfo
+	perPlatform := make(map[uint8]int)
+	for _, other := range binds {
+		otherInfo, ok := notionPageInfo(&other)
+		if ok && other.UnionUserID != bind.UnionUserID && other.UserPlatform != bind.UserPlatform &&
+			otherInfo.NotionSecretKey == pageInfo.NotionSecretKey {
+			shared = append(shared, other)
+			perPlatform[other.UserPlatform]++
+		}
+	}
+
+	var owned []entity.BindInfo
+	for _, other := range shared {
+		if perPlatform[other.UserPlatform] == 1 {
+			owned = append(owned, other)
+		}
+	}
+	return owned, nil
+}
+
+func sharedPlatforms(binds []entity.BindInfo) string {
+	names := make([]string, 0, len(binds))
+	for _, bind := range binds {
+		name, ok := userPlatformNames[entity.UserPlatformType(bind.UserPlatform)]
+		if !ok {
+			name = bind.UnionUserID
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "、")
+}
+
+// bindNotion saves the notion binding bindInfo, returning a note about the
+// other bindings sharing its database. With sync, the bindings sharing the
+// database bound before get the new page info too, their settings are
+// kept as they're per platform.
+func bindNotion(ctx context.Context, repo repository.BindInfoRepository, bindInfo *entity.BindInfo, sync bool) (string, error) {
+	previous, err := repo.GetBindInfoByUnionUserID(ctx, bindInfo.UnionUserID)
+	if err != nil {
+		previous = nil
+	}
+	if err := repo.UpdateOrInsert(ctx, bindInfo); err != nil {
+		return "", err
+	}
+
+	pageInfo, _ := notionPageInfo(bindInfo)
+	if old, ok := notionPageInfo(previous); ok && sync && old != pageInfo {
+		binds, err := sharedBindings(ctx, repo, bindInfo, &old)
+		if err != nil {
+			log.Errorf("failed to find bindings sharing page %s of %s. err=%v", old.NotionPageID, bindInfo.UnionUserID, err)
+		}
+
+		var synced []entity.BindInfo
+		for i := range binds {
+			binds[i].PageInfo = bindInfo.PageInfo
+			// left out of the write, they may be changed meanwhile
+			binds[i].Settings = ""
+			if err := repo.UpdateOrInsert(ctx, &binds[i]); err != nil {
+				log.Errorf("failed to sync the binding of %s with %s. err=%v", binds[i].UnionUserID, bindInfo.UnionUserID, err)
+				continue
+			}
+			synced = append(synced, binds[i])
+		}
+		if len(synced) > 0 {
+			return fmt.Sprintf("已同步更新%s上共享该数据库的绑定~", sharedPlatforms(synced)), nil
+		}
+	}
+
+	binds, err := sharedBindings(ctx, repo, bindInfo, &pageInfo)
+	if err != nil {
+		log.Errorf("failed to find bindings sharing page %s of %s. err=%v", pageInfo.NotionPageID, bindInfo.UnionUserID, err)
+		return "", nil
+	}
+	if len(binds) == 0 {
+		return "", nil
+	}
+	if sync {
+		return fmt.Sprintf("该页面也绑定在%s上，之后两边的绑定会保持同步~", sharedPlatforms(binds)), nil
+	}
+	return fmt.Sprintf("注意：该页面也绑定在%s上，两边的memo会保存到同一个页面，修改一边的绑定不会同步到另一边~", sharedPlatforms(binds)), nil
+}
+
+func bindSuccMessage(note string) string {
+	if note == "" {
+		return MessageBindSucc
+	}
+	return MessageBindSucc + "\n" + note
+}
@@ -0,0 +1,133 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func newTestWXNotionBind(secretKey, pageID string) entity.BindInfo {
+	pageInfo, _ := json.Marshal(&entity.NotionPageInfo{
+		NotionTheme:     "gallery",
+		NotionSecretKey: secretKey,
+		NotionPageID:    pageID,
+	})
+	return entity.BindInfo{
+		UserPlatform: uint8(entity.UserPlatformTypeWx),
+		UnionUserID:  "wx_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		PageInfo:     string(pageInfo),
+	}
+}
+
+func TestSharedBindingWarning(t *testing.T) {
+	cases := []struct {
+		WX       entity.BindInfo
+		Expected string
+	}{
+		{
+			WX:       newTestWXNotionBind("secret", "db_xxx"),
+			Expected: "绑定成功~\n注意：该页面也绑定在微信上，两边的memo会保存到同一个页面，修改一边的绑定不会同步到另一边~",
+		},
+		// someone else's integration
+		{WX: newTestWXNotionBind("secret_yyy", "db_xxx"), Expected: "绑定成功~"},
+		{WX: newTestWXNotionBind("secret", "db_yyy"), Expected: "绑定成功~"},
+	}
+	for i, tc := range cases {
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{}, tc.WX)
+		event := newTestLarkEvent("xxx", "/bind notion secret db_xxx gallery")
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if len(replies) != 1 || replies[0].Msg != tc.Expected {
+			t.Fatalf("wechat binding: %s, expected %q, got %+v", tc.WX.PageInfo, tc.Expected, replies)
+		}
+	}
+}
+
+func TestSyncSharedBindings(t *testing.T) {
+	wx := newTestWXNotionBind("secret", "db_xxx")
+	wx.SetSettings(&entity.BindSettings{Ack: entity.AckReaction})
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{SyncSharedBindings: true}, newTestNotionBind("gallery"), wx)
+
+	bind := func(i int, content string) string {
+		event := newTestLarkEvent("xxx", content)
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		return replies[len(replies)-1].Msg
+	}
+	wxPageInfo := func() entity.NotionPageInfo {
+		b, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "wx_xxx")
+		pageInfo, _ := notionPageInfo(b)
+		return pageInfo
+	}
+
+	// the secret key is rotated
+	if msg := bind(0, "/bind notion secret_new db_xxx flat"); msg != "绑定成功~\n已同步更新微信上共享该数据库的绑定~" {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	expected := entity.NotionPageInfo{NotionTheme: "flat", NotionSecretKey: "secret_new", NotionPageID: "db_xxx"}
+	if got := wxPageInfo(); got != expected {
+		t.Fatalf("expected the wechat binding synced to %+v, got %+v", expected, got)
+	}
+	// the settings are per platform
+	b, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "wx_xxx")
+	if s, _ := b.GetSettings(); s.Ack != entity.AckReaction {
+		t.Fatalf("expected the wechat settings kept, got %+v", s)
+	}
+
+	// the same binding again, nothing to sync
+	if msg := bind(1, "/bind notion secret_new db_xxx flat"); msg != "绑定成功~\n该页面也绑定在微信上，之后两边的绑定会保持同步~" {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+
+	// moved to another page along with the wechat binding
+	if msg := bind(2, "/bind notion secret_new db_yyy"); msg != "绑定成功~\n已同步更新微信上共享该数据库的绑定~" {
+		t.Fatalf("unexpected reply %q", msg)
+	}
+	if got := wxPageInfo(); got.NotionPageID != "db_yyy" {
+		t.Fatalf("expected the wechat binding moved to db_yyy, got %+v", got)
+	}
+}
+
+func TestSharedBindingsOfOtherAccounts(t *testing.T) {
+	// another lark account with the same integration
+	other := newTestNotionBind("gallery")
+	other.UnionUserID, other.UserPlatform = "lark_yyy", uint8(entity.UserPlatformTypeLark)
+	// more than one wechat account, none of them taken as the user's
+	wx, wx2 := newTestWXNotionBind("secret", "db_xxx"), newTestWXNotionBind("secret", "db_xxx")
+	wx2.UnionUserID = "wx_yyy"
+
+	cases := []struct {
+		Binds []entity.BindInfo
+	}{
+		{Binds: []entity.BindInfo{newTestNotionBind("gallery"), other}},
+		{Binds: []entity.BindInfo{newTestNotionBind("gallery"), wx, wx2}},
+	}
+	for i, tc := range cases {
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{SyncSharedBindings: true}, tc.Binds...)
+		event := newTestLarkEvent("xxx", "/bind notion secret_new db_xxx flat")
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+		replies := app.messenger.(*fakeLarkMessenger).replies
+		if len(replies) != 1 || replies[0].Msg != "绑定成功~" {
+			t.Fatalf("case %d, expected no shared binding, got %+v", i, replies)
+		}
+		for _, b := range tc.Binds[1:] {
+			got, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), b.UnionUserID)
+			if got.PageInfo != b.PageInfo {
+				t.Fatalf("case %d, expected the binding of %s left, got %s", i, b.UnionUserID, got.PageInfo)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+)
+
+const streakDayLayout = "2006-01-02"
+
+// location is the timezone of the binding, the server's if unset or unknown
+func location(s *entity.BindSettings) *time.Location {
+	if s.Timezone == "" {
+		return time.Local
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		log.Warnf("invalid timezone %s, use the server's. err=%v", s.Timezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// advanceStreak is streak after a memo at t in loc: continued by a memo the
+// day after the last one, unchanged on the same day, and reset to 1 once a
+// day is missed. Memos older than the last day, e.g. imported, count for nothing.
+func advanceStreak(streak *entity.Streak, t time.Time, loc *time.Location) entity.Streak {
+	day := t.In(loc)
+	today := day.Format(streakDayLayout)
+	if streak == nil || streak.LastDay == "" {
+		return entity.Streak{Days: 1, LastDay: today}
+	}
+
+	switch {
+	case streak.LastDay >= today:
+		return *streak
+	case streak.LastDay == day.AddDate(0, 0, -1).Format(streakDayLayout):
+		return entity.Streak{Days: streak.Days + 1, LastDay: today}
+	}
+	return entity.Streak{Days: 1, LastDay: today}
+}
+
+// memoTime is when the memo of req was sent, now if unknown
+func (app *larkMessageHandleApp) memoTime(req *appendRequest) time.Time {
+	if t := eventTime(req.Event); !t.IsZero() {
+		return t
+	}
+	return app.clock.Now()
+}
+
+// keepStreak stores the streak of the binding after the memo of req is
+// saved, advanced from the latest streak as other memos may have moved it.
+func (app *larkMessageHandleApp) keepStreak(ctx context.Context, req *appendRequest) {
+	t := app.memoTime(req)
+	_, err := app.bindRepo.UpdateSettings(ctx, req.Bind.UnionUserID, func(s *entity.BindSettings) error {
+		// turned off meanwhile
+		if s.StreakProperty == "" {
+			return repository.ErrSettingsUnchanged
+		}
+		streak := advanceStreak(s.Streak, t, location(s))
+		if s.Streak != nil && *s.Streak == streak {
+			return repository.ErrSettingsUnchanged
+		}
+		s.Streak = &streak
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to keep streak of %s. err=%v", req.Bind.UnionUserID, err)
+	}
+}
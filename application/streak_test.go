@@ -0,0 +1,152 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestAdvanceStreak(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	// 2022-04-15 23:30 in loc
+	night := time.Date(2022, 4, 15, 15, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		Name     string
+		Streak   *entity.Streak
+		At       time.Time
+		Expected entity.Streak
+	}{
+		{Name: "first", At: night, Expected: entity.Streak{Days: 1, LastDay: "2022-04-15"}},
+		{
+			Name:     "same day",
+			Streak:   &entity.Streak{Days: 3, LastDay: "2022-04-15"},
+			At:       night,
+			Expected: entity.Streak{Days: 3, LastDay: "2022-04-15"},
+		},
+		// still the 15th in UTC
+		{
+			Name:     "next day in the timezone",
+			Streak:   &entity.Streak{Days: 3, LastDay: "2022-04-15"},
+			At:       night.Add(time.Hour),
+			Expected: entity.Streak{Days: 4, LastDay: "2022-04-16"},
+		},
+		{
+			Name:     "missed a day",
+			Streak:   &entity.Streak{Days: 3, LastDay: "2022-04-15"},
+			At:       night.Add(25 * time.Hour),
+			Expected: entity.Streak{Days: 1, LastDay: "2022-04-17"},
+		},
+		{
+			Name:     "older memo",
+			Streak:   &entity.Streak{Days: 3, LastDay: "2022-04-16"},
+			At:       night,
+			Expected: entity.Streak{Days: 3, LastDay: "2022-04-16"},
+		},
+	}
+	for _, tc := range cases {
+		if streak := advanceStreak(tc.Streak, tc.At, loc); streak != tc.Expected {
+			t.Fatalf("%s: expected %+v, got %+v", tc.Name, tc.Expected, streak)
+		}
+	}
+}
+
+func TestStreakProperty(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{StreakProperty: "Streak", Timezone: "Asia/Shanghai"})
+	bindRepo := newFakeBindInfoRepo(bind)
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}})
+	app.bindRepo = bindRepo
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+	// 2022-04-15 23:30 in Asia/Shanghai
+	clock := &fakeClock{now: time.Date(2022, 4, 15, 15, 30, 0, 0, time.UTC)}
+	app.clock = clock
+
+	cases := []struct {
+		Advance time.Duration
+		Days    int
+	}{
+		{Advance: 0, Days: 1},
+		// past midnight in the timezone only
+		{Advance: time.Hour, Days: 2},
+		{Advance: 12 * time.Hour, Days: 2},
+		{Advance: 24 * time.Hour, Days: 3},
+		// the 19th is missed
+		{Advance: 48 * time.Hour, Days: 1},
+	}
+	for i, tc := range cases {
+		clock.Advance(tc.Advance)
+		event := newTestLarkEvent("xxx", "journal")
+		event.Header.EventID = fmt.Sprintf("event_%d", i)
+		// sent now on the clock
+		event.Event.Message.CreatedTime = ""
+		if err := app.ProcessMessage(context.TODO(), event); err != nil {
+			t.Fatal(err)
+		}
+
+		var page string
+		for _, req := range n.Requests() {
+			if req.Method == http.MethodPost && req.Path == "/pages" {
+				page = req.Body
+			}
+		}
+		if expected := fmt.Sprintf(`"Streak":{"number":%d,"type":"number"}`, tc.Days); !strings.Contains(page, expected) {
+			t.Fatalf("memo %d: expected %s, got %s", i, expected, page)
+		}
+
+		stored, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+		settings, _ := stored.GetSettings()
+		if settings.Streak == nil || settings.Streak.Days != tc.Days {
+			t.Fatalf("memo %d: expected streak of %d days kept, got %+v", i, tc.Days, settings.Streak)
+		}
+	}
+}
+
+func TestStreakNotKeptOnFailure(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusBadGateway, `{"object": "error", "status": 502}`)
+
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{StreakProperty: "Streak"})
+	bindRepo := newFakeBindInfoRepo(bind)
+	app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}})
+	app.bindRepo = bindRepo
+	app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+
+	app.ProcessMessage(context.TODO(), newTestLarkEvent("xxx", "journal"))
+	stored, _ := bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if settings, _ := stored.GetSettings(); settings.Streak != nil {
+		t.Fatalf("expected no streak for a failed memo, got %+v", settings.Streak)
+	}
+}
+
+func TestStreakSettings(t *testing.T) {
+	var s entity.BindSettings
+	if err := ApplySetting(&s, "timezone", "Mars/Olympus"); err == nil {
+		t.Fatal("expected invalid timezone")
+	}
+	for key, value := range map[string]string{"timezone": "Asia/Shanghai", "streak_property": "Streak"} {
+		if err := ApplySetting(&s, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if location(&s).String() != "Asia/Shanghai" {
+		t.Fatalf("unexpected location %s", location(&s))
+	}
+
+	s.Streak = &entity.Streak{Days: 3, LastDay: "2022-04-15"}
+	if err := ApplySetting(&s, "streak_property", "off"); err != nil || s.StreakProperty != "" || s.Streak != nil {
+		t.Fatalf("expected streak off and forgotten, got %+v, err: %v", s, err)
+	}
+}
@@ -0,0 +1,30 @@
+package application
+
+import (
+	"fmt"
+
+	"github.com/KDF5000/pkg/log"
+)
+
+// warnTagOptions tells the sender once a day that the Tags of database
+// dbId, with tags of the memo just written, have nearly as many options
+// as notion allows, after which new tags fail the writes.
+func (app *larkMessageHandleApp) warnTagOptions(req *appendRequest, notionKey, dbId string, tags []string) {
+	// imported memos have no message to reply to
+	message := &req.Event.Event.Message
+	if message.MessageID == "" {
+		return
+	}
+	if _, warned := app.tagOptionsWarned.Get(dbId); warned {
+		return
+	}
+
+	count, near := app.notionCli.TagOptions(notionKey, dbId, tags)
+	if !near {
+		return
+	}
+	app.tagOptionsWarned.SetDefault(dbId, true)
+	log.Warnf("database %s of %s has %d tag options, near the limit", dbId, req.Bind.UnionUserID, count)
+	app.replyMemo(req.Registar, message, req.Bind, fmt.Sprintf(
+		"提示: Notion数据库的Tags已有%d个选项, 接近上限, 之后的新标签可能保存失败, 建议清理不再使用的标签", count))
+}
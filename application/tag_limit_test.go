@@ -0,0 +1,55 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestWarnTagOptions(t *testing.T) {
+	cases := []struct {
+		Options int
+		Warned  bool
+	}{
+		{Options: 20},
+		{Options: 95, Warned: true},
+	}
+	for _, tc := range cases {
+		options := make([]string, 0, tc.Options)
+		for i := 0; i < tc.Options; i++ {
+			options = append(options, fmt.Sprintf(`{"name": "tag%d"}`, i))
+		}
+		n := newFakeNotion()
+		n.Reply(http.MethodGet, "/databases/db_xxx", http.StatusOK, fmt.Sprintf(`{"object": "database", "id": "db_xxx",
+			"properties": {"Name": {"type": "title"}, "Tags": {"type": "multi_select", "multi_select": {"options": [%s]}}}}`,
+			strings.Join(options, ",")))
+		n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "page_xxx"}`)
+
+		app := newTestLarkApp(&fakeMemoRepo{}, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, newTestNotionBind("gallery"))
+		app.handlers[entity.BindPlatformTypeNotion] = app.handleNotionAppend
+		// warned once a day
+		for i := 0; i < 2; i++ {
+			event := newTestLarkEvent("xxx", fmt.Sprintf("#new%d notes", i))
+			event.Header.EventID = fmt.Sprintf("event_%d", i)
+			if err := app.ProcessMessage(context.TODO(), event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		n.Close()
+
+		warnings := 0
+		for _, reply := range app.messenger.(*fakeLarkMessenger).replies {
+			if strings.Contains(reply.Msg, "Tags已有") {
+				warnings++
+			}
+		}
+		if tc.Warned != (warnings == 1) || warnings > 1 {
+			t.Fatalf("options: %d, expected warned %v, got %d warnings", tc.Options, tc.Warned, warnings)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+// weekOf is the ISO week of t in loc, like 2024-W23
+func weekOf(t time.Time, loc *time.Location) string {
+	year, week := t.In(loc).ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// memos added to the weekly review at a time
+const weeklyReviewBatch = 100
+
+func weeklyPageTitle(week string) string {
+	return "Week " + week
+}
+
+// weekStart is the monday of ISO week like 2024-W23 in loc
+func weekStart(week string, loc *time.Location) (time.Time, error) {
+	var year, n int
+	if _, err := fmt.Sscanf(week, "%d-W%d", &year, &n); err != nil {
+		return time.Time{}, fmt.Errorf("invalid week %s, %v", week, err)
+	}
+
+	// january 4th is always in week 1
+	jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, loc)
+	sinceMonday := (int(jan4.Weekday()) + 6) % 7
+	return jan4.AddDate(0, 0, (n-1)*7-sinceMonday), nil
+}
+
+// weekMemos are the memos of a week in the order they were saved
+type weekMemos struct {
+	Week  string
+	Memos []entity.Memo
+}
+
+// groupWeeks groups memos by week in loc. A memo of a week before current
+// or the week of the memos before it, e.g. saved late by a retry, goes with
+// the latest of them, the pages of earlier weeks aren't kept.
+func groupWeeks(memos []entity.Memo, current string, loc *time.Location) []weekMemos {
+	var weeks []weekMemos
+	for _, memo := range memos {
+		week := weekOf(memo.CreatedAt, loc)
+		if week < current {
+			week = current
+		}
+		if n := len(weeks); n > 0 && weeks[n-1].Week >= week {
+			weeks[n-1].Memos = append(weeks[n-1].Memos, memo)
+			continue
+		}
+		weeks = append(weeks, weekMemos{Week: week, Memos: []entity.Memo{memo}})
+	}
+	return weeks
+}
+
+func weeklyEntries(memos []entity.Memo) []notion.WeeklyEntry {
+	entries := make([]notion.WeeklyEntry, 0, len(memos))
+	for _, memo := range memos {
+		entries = append(entries, notion.WeeklyEntry{Content: memo.Content, PageID: memo.PageID})
+	}
+	return entries
+}
+
+func memoIDs(memos []entity.Memo) []uint {
+	ids := make([]uint, 0, len(memos))
+	for _, memo := range memos {
+		ids = append(ids, memo.ID)
+	}
+	return ids
+}
+
+// markLegacyReviewed marks the memos up to the cursor of old versions
+// reviewed, they were added by them.
+func (app *larkMessageHandleApp) markLegacyReviewed(ctx context.Context, accountID string, review *entity.WeeklyReview, since time.Time) error {
+	for review.LastMemoID != 0 {
+		memos, err := app.memoRepo.ListMemosToReview(ctx, accountID, since, weeklyReviewBatch)
+		if err != nil {
+			return err
+		}
+
+		var ids []uint
+		for _, memo := range memos {
+			if memo.ID <= review.LastMemoID {
+				ids = append(ids, memo.ID)
+			}
+		}
+		if err := app.memoRepo.MarkMemosReviewed(ctx, accountID, ids); err != nil {
+			return err
+		}
+		if len(ids) < weeklyReviewBatch {
+			review.LastMemoID = 0
+		}
+	}
+	return nil
+}
+
+// updateWeeklyReview adds the saved memos not reviewed yet of the binding
+// to the pages of their weeks, a batch at a time, a page is created for a
+// new week. It starts at the current week when the binding just opted in.
+func (app *larkMessageHandleApp) updateWeeklyReview(ctx context.Context, bindInfo *entity.BindInfo, settings *entity.BindSettings) (int, error) {
+	review := *settings.WeeklyReview
+	var pageInfo entity.NotionPageInfo
+	if err := json.Unmarshal([]byte(bindInfo.PageInfo), &pageInfo); err != nil {
+		return 0, err
+	}
+
+	loc := location(settings)
+	if review.Since == "" {
+		review.Since = review.Week
+	}
+	if review.Since == "" {
+		review.Since = weekOf(app.clock.Now(), loc)
+	}
+	since, err := weekStart(review.Since, loc)
+	if err != nil {
+		return 0, err
+	}
+	if err := app.markLegacyReviewed(ctx, bindInfo.UnionUserID, &review, since); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for {
+		memos, lerr := app.memoRepo.ListMemosToReview(ctx, bindInfo.UnionUserID, since, weeklyReviewBatch)
+		if lerr != nil {
+			err = lerr
+			break
+		}
+
+		for _, week := range groupWeeks(memos, review.Week, loc) {
+			entries := weeklyEntries(week.Memos)
+			if week.Week == review.Week && review.PageID != "" {
+				err = app.notionCli.AppendWeeklyEntries(pageInfo.NotionSecretKey, review.PageID, entries)
+			} else {
+				var id string
+				id, err = app.notionCli.CreateWeeklyPage(pageInfo.NotionSecretKey, review.ParentPageID,
+					weeklyPageTitle(week.Week), entries)
+				if err == nil {
+					review.Week, review.PageID = week.Week, id
+				}
+			}
+			if err != nil {
+				break
+			}
+			// added twice by the next run if it fails
+			if err = app.memoRepo.MarkMemosReviewed(ctx, bindInfo.UnionUserID, memoIDs(week.Memos)); err != nil {
+				break
+			}
+			count += len(week.Memos)
+		}
+		if err != nil || len(memos) < weeklyReviewBatch {
+			break
+		}
+	}
+
+	// keep what's done, the rest is retried in the next run
+	if review != *settings.WeeklyReview {
+		_, serr := app.bindRepo.UpdateSettings(ctx, bindInfo.UnionUserID, func(s *entity.BindSettings) error {
+			// turned off or moved meanwhile
+			if s.WeeklyReview == nil || s.WeeklyReview.ParentPageID != review.ParentPageID {
+				return repository.ErrSettingsUnchanged
+			}
+			s.WeeklyReview = &review
+			return nil
+		})
+		if serr != nil {
+			log.Errorf("failed to keep weekly review of %s. err=%v", bindInfo.UnionUserID, serr)
+		}
+	}
+	return count, err
+}
+
+// UpdateWeeklyReviews updates the weekly review pages of the accounts with
+// saved memos which opted in, returning the number of memos added.
+func (app *larkMessageHandleApp) UpdateWeeklyReviews(ctx context.Context) (int, error) {
+	accounts, err := app.memoRepo.ListAccountsByStatus(ctx, entity.MemoStatusSaved)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, account := range accounts {
+		bindInfo, err := app.bindRepo.GetBindInfoByUnionUserID(ctx, account)
+		if err != nil || entity.BindPlatformType(bindInfo.BindPlatform) != entity.BindPlatformTypeNotion {
+			continue
+		}
+		settings, err := bindInfo.GetSettings()
+		if err != nil || settings.WeeklyReview == nil {
+			continue
+		}
+
+		n, err := app.updateWeeklyReview(ctx, bindInfo, &settings)
+		if err != nil {
+			log.Errorf("failed to update weekly review of %s. err=%v", account, err)
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// RunWeeklyReview updates the weekly review pages every interval until ctx
+// is done.
+func (app *larkMessageHandleApp) RunWeeklyReview(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-app.clock.After(interval):
+			n, err := app.UpdateWeeklyReviews(ctx)
+			if err != nil {
+				log.Errorf("failed to update weekly reviews. err=%v", err)
+			}
+			if n > 0 {
+				log.Infof("%d memos added to weekly reviews", n)
+			}
+		}
+	}
+}
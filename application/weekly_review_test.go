@@ -0,0 +1,241 @@
+package application
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+)
+
+func TestWeekStart(t *testing.T) {
+	for week, expected := range map[string]string{
+		"2024-W24": "2024-06-10",
+		"2021-W01": "2021-01-04",
+		"2020-W53": "2020-12-28",
+		"2026-W01": "2025-12-29",
+	} {
+		start, err := weekStart(week, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := start.Format(streakDayLayout); got != expected || weekOf(start, time.UTC) != week {
+			t.Fatalf("week: %s, expected %s, got %s", week, expected, got)
+		}
+	}
+	if _, err := weekStart("2024-06", time.UTC); err == nil {
+		t.Fatal("expected error of invalid week")
+	}
+}
+
+func TestGroupWeeks(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	// sunday in utc, monday in shanghai
+	sunday := time.Date(2024, 6, 9, 17, 0, 0, 0, time.UTC)
+	memo := func(id uint, createdAt time.Time) entity.Memo {
+		m := entity.Memo{Content: "memo", Status: uint8(entity.MemoStatusSaved)}
+		m.ID, m.CreatedAt = id, createdAt
+		return m
+	}
+	memos := []entity.Memo{
+		memo(1, sunday.Add(-7*24*time.Hour-2*time.Hour)),
+		memo(2, sunday.Add(-2*time.Hour)),
+		memo(3, sunday),
+		// saved late by a retry
+		memo(4, sunday.Add(-7*24*time.Hour)),
+	}
+
+	cases := []struct {
+		Loc      *time.Location
+		Current  string
+		Expected string
+	}{
+		{Loc: time.UTC, Expected: "2024-W22:1 2024-W23:2,3,4"},
+		{Loc: shanghai, Expected: "2024-W22:1 2024-W23:2 2024-W24:3,4"},
+		{Loc: shanghai, Current: "2024-W23", Expected: "2024-W23:1,2 2024-W24:3,4"},
+	}
+	for _, tc := range cases {
+		var groups []string
+		for _, week := range groupWeeks(memos, tc.Current, tc.Loc) {
+			var ids []string
+			for _, m := range week.Memos {
+				ids = append(ids, string(rune('0'+m.ID)))
+			}
+			groups = append(groups, week.Week+":"+strings.Join(ids, ","))
+		}
+		if got := strings.Join(groups, " "); got != tc.Expected {
+			t.Fatalf("loc: %s, current: %q, expected %s, got %s", tc.Loc, tc.Current, tc.Expected, got)
+		}
+	}
+}
+
+func TestUpdateWeeklyReviews(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "week_xxx"}`)
+
+	bind := newTestNotionBind("gallery")
+	var settings entity.BindSettings
+	for k, v := range map[string]string{"weekly_review": "parent_xxx", "timezone": "Asia/Shanghai"} {
+		if err := ApplySetting(&settings, k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bind.SetSettings(&settings)
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+	// monday in shanghai
+	clock := &fakeClock{now: time.Date(2024, 6, 10, 2, 0, 0, 0, time.UTC)}
+	app.clock = clock
+
+	save := func(content, pageID string, createdAt time.Time) {
+		m := entity.Memo{UnionUserID: "lark_xxx", Content: content, PageID: pageID, Status: uint8(entity.MemoStatusSaved)}
+		m.CreatedAt = createdAt
+		memoRepo.Create(context.TODO(), &m)
+	}
+	// the week before opting in is left out
+	save("last week", "", time.Date(2024, 6, 5, 2, 0, 0, 0, time.UTC))
+	save("读书笔记\n第一章", "1234-abcd", time.Date(2024, 6, 9, 17, 0, 0, 0, time.UTC))
+	save("买牛奶", "", time.Date(2024, 6, 10, 1, 0, 0, 0, time.UTC))
+
+	run := func(expected int) []notionRequest {
+		before := len(n.Requests())
+		count, err := app.UpdateWeeklyReviews(context.TODO())
+		if err != nil || count != expected {
+			t.Fatalf("expected %d memos, got %d, err=%v", expected, count, err)
+		}
+		return n.Requests()[before:]
+	}
+
+	reqs := run(2)
+	if len(reqs) != 1 || reqs[0].Method != http.MethodPost || reqs[0].Path != "/pages" {
+		t.Fatalf("expected the weekly page created, got %+v", reqs)
+	}
+	for _, expected := range []string{
+		`"parent":{"page_id":"parent_xxx"}`,
+		`"content":"Week 2024-W24"`,
+		// linked to the page of the memo, or copied
+		`"text":{"content":"读书笔记","link":{"url":"https://www.notion.so/1234abcd"}}`,
+		`"text":{"content":"买牛奶"}`,
+	} {
+		if !strings.Contains(reqs[0].Body, expected) {
+			t.Fatalf("expected %s in %s", expected, reqs[0].Body)
+		}
+	}
+	if strings.Contains(reqs[0].Body, "last week") {
+		t.Fatalf("unexpected memo of last week in %s", reqs[0].Body)
+	}
+
+	// nothing new
+	if reqs := run(0); len(reqs) != 0 {
+		t.Fatalf("unexpected requests %+v", reqs)
+	}
+
+	// appended to the page of the week
+	save("周三", "", time.Date(2024, 6, 12, 1, 0, 0, 0, time.UTC))
+	reqs = run(1)
+	if len(reqs) != 1 || reqs[0].Method != http.MethodPatch || reqs[0].Path != "/blocks/week_xxx/children" ||
+		!strings.Contains(reqs[0].Body, "周三") {
+		t.Fatalf("expected the memo appended to the weekly page, got %+v", reqs)
+	}
+
+	// sunday night in shanghai is still the week, monday starts another
+	save("周日", "", time.Date(2024, 6, 16, 15, 0, 0, 0, time.UTC))
+	save("下周一", "", time.Date(2024, 6, 16, 16, 30, 0, 0, time.UTC))
+	reqs = run(2)
+	if len(reqs) != 2 || reqs[0].Path != "/blocks/week_xxx/children" || !strings.Contains(reqs[0].Body, "周日") ||
+		reqs[1].Path != "/pages" || !strings.Contains(reqs[1].Body, `"content":"Week 2024-W25"`) ||
+		!strings.Contains(reqs[1].Body, "下周一") {
+		t.Fatalf("expected the week boundary in shanghai, got %+v", reqs)
+	}
+
+	// a memo of the week before saved after the later ones, by a retry
+	late := entity.Memo{UnionUserID: "lark_xxx", Content: "重试的", Status: uint8(entity.MemoStatusPending)}
+	late.CreatedAt = time.Date(2024, 6, 14, 1, 0, 0, 0, time.UTC)
+	memoRepo.Create(context.TODO(), &late)
+	save("周二", "", time.Date(2024, 6, 18, 1, 0, 0, 0, time.UTC))
+	if reqs := run(1); len(reqs) != 1 || !strings.Contains(reqs[0].Body, "周二") {
+		t.Fatalf("expected the saved memo added, got %+v", reqs)
+	}
+	late.Status = uint8(entity.MemoStatusSaved)
+	memoRepo.Update(context.TODO(), "lark_xxx", &late)
+	if reqs := run(1); len(reqs) != 1 || reqs[0].Path != "/blocks/week_xxx/children" || !strings.Contains(reqs[0].Body, "重试的") {
+		t.Fatalf("expected the late memo added to the current week, got %+v", reqs)
+	}
+
+	got, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	s, _ := got.GetSettings()
+	if review := s.WeeklyReview; review.Since != "2024-W24" || review.Week != "2024-W25" || review.PageID != "week_xxx" {
+		t.Fatalf("unexpected weekly review %+v", review)
+	}
+}
+
+func TestWeeklyReviewLegacyCursor(t *testing.T) {
+	n := newFakeNotion()
+	defer n.Close()
+
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{WeeklyReview: &entity.WeeklyReview{
+		ParentPageID: "parent_xxx", Week: "2024-W24", PageID: "week_xxx", LastMemoID: 1}})
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{Notion: notion.ClientOption{BaseURI: n.URL}}, bind)
+	app.clock = &fakeClock{now: time.Date(2024, 6, 12, 2, 0, 0, 0, time.UTC)}
+	for _, content := range []string{"added by old versions", "周三"} {
+		m := entity.Memo{UnionUserID: "lark_xxx", Content: content, Status: uint8(entity.MemoStatusSaved)}
+		m.CreatedAt = time.Date(2024, 6, 11, 1, 0, 0, 0, time.UTC)
+		memoRepo.Create(context.TODO(), &m)
+	}
+
+	count, err := app.UpdateWeeklyReviews(context.TODO())
+	reqs := n.Requests()
+	if err != nil || count != 1 || len(reqs) != 1 || strings.Contains(reqs[0].Body, "old versions") {
+		t.Fatalf("expected the memos up to the cursor left out, got %d, %+v, err=%v", count, reqs, err)
+	}
+	got, _ := app.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if s, _ := got.GetSettings(); s.WeeklyReview.LastMemoID != 0 || s.WeeklyReview.Since != "2024-W24" {
+		t.Fatalf("expected the cursor dropped, got %+v", s.WeeklyReview)
+	}
+}
+
+func TestRunWeeklyReview(t *testing.T) {
+	bind := newTestNotionBind("gallery")
+	bind.SetSettings(&entity.BindSettings{WeeklyReview: &entity.WeeklyReview{ParentPageID: "parent_xxx"}})
+	memoRepo := &fakeMemoRepo{}
+	app := newTestLarkApp(memoRepo, Option{}, bind)
+	clock := &fakeClock{now: time.Unix(1718000000, 0)}
+	app.clock = clock
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go app.RunWeeklyReview(ctx, time.Hour)
+
+	m := entity.Memo{UnionUserID: "lark_xxx", Content: "hello", Status: uint8(entity.MemoStatusSaved)}
+	m.CreatedAt = clock.Now()
+	memoRepo.Create(context.TODO(), &m)
+
+	updated := func() bool {
+		memo, _ := memoRepo.GetMemoByID(context.TODO(), "lark_xxx", 1)
+		return memo.Reviewed
+	}
+
+	// not due yet
+	clock.Wait(1)
+	clock.Advance(59 * time.Minute)
+	if updated() {
+		t.Fatal("unexpected weekly review before the interval")
+	}
+
+	n := newFakeNotion()
+	defer n.Close()
+	n.Reply(http.MethodPost, "/pages", http.StatusOK, `{"object": "page", "id": "week_xxx"}`)
+	app.notionCli = notion.NewNotionClient(notion.ClientOption{BaseURI: n.URL})
+	clock.Advance(time.Minute)
+	// the next wait starts once the run is done
+	clock.Wait(1)
+	if !updated() {
+		t.Fatal("expected weekly review updated after the interval")
+	}
+}
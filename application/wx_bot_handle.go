@@ -9,6 +9,7 @@ import (
 
 	"github.com/KDF5000/nomo/domain/entity"
 	"github.com/KDF5000/nomo/domain/repository"
+	"github.com/KDF5000/nomo/infrastructure/utils"
 	"github.com/KDF5000/pkg/log"
 	"github.com/eatmoreapple/openwechat"
 	"github.com/skip2/go-qrcode"
@@ -47,14 +48,17 @@ Hi, welcome to use Nomo assistant~
 
 type wxBotHandleApp struct {
 	messageHandler *messageHandler
+	// saves the memos like the lark ones
+	memos IMemoApp
 
 	bind     repository.BindInfoRepository
 	registar repository.LarkBotRegistarRepository
 }
 
-func NewWXBotHandleApp(bind repository.BindInfoRepository, registar repository.LarkBotRegistarRepository) *wxBotHandleApp {
+func NewWXBotHandleApp(bind repository.BindInfoRepository, registar repository.LarkBotRegistarRepository, memos IMemoApp, opt Option) *wxBotHandleApp {
 	return &wxBotHandleApp{
-		messageHandler: NewMessageHandler(bind, registar),
+		messageHandler: NewMessageHandler(bind, registar, opt),
+		memos:          memos,
 		bind:           bind,
 		registar:       registar,
 	}
@@ -90,12 +94,13 @@ func (app *wxBotHandleApp) processMessage(ctx context.Context, notify Notifer, m
 			UserName: sender.PYInitial,
 		}
 		data, _ := json.Marshal(&userInfo)
+		var note string
 		switch cmd.Platform {
 		case entity.BindPlatformTypeLarkDoc:
 			err = app.messageHandler.BindLarkDocPage(ctx, entity.UserPlatformTypeWx,
 				userInfo.UnionID(), string(data), cmd)
 		case entity.BindPlatformTypeNotion:
-			err = app.messageHandler.BindNotionPage(ctx, entity.UserPlatformTypeWx,
+			note, err = app.messageHandler.BindNotionPage(ctx, entity.UserPlatformTypeWx,
 				userInfo.UnionID(), string(data), cmd)
 		default:
 			return fmt.Errorf("unknown platform %d", cmd.Platform)
@@ -105,7 +110,7 @@ func (app *wxBotHandleApp) processMessage(ctx context.Context, notify Notifer, m
 			notify(fmt.Sprintf("绑定账号失败，%s", err))
 			return err
 		}
-		notify(MessageBindSucc)
+		notify(bindSuccMessage(note))
 		return nil
 	}
 
@@ -118,31 +123,21 @@ func (app *wxBotHandleApp) processMessage(ctx context.Context, notify Notifer, m
 		return fmt.Errorf("%s, %s", MessageNotBind, err)
 	}
 
-	switch entity.BindPlatformType(bindInfo.BindPlatform) {
-	case entity.BindPlatformTypeNotion:
-		var pageInfo entity.NotionPageInfo
-		if err := json.Unmarshal([]byte(bindInfo.PageInfo), &pageInfo); err != nil {
-			notify(ErrInvalidBindPageInfo)
-			return fmt.Errorf("unmarshal bind page info. info: %s, err: %v", bindInfo.PageInfo, err)
-		}
-		err = app.messageHandler.AppendNotionPage(ctx, &pageInfo, content)
-	case entity.BindPlatformTypeLarkDoc:
-		var pageInfo entity.LarkDocPageInfo
-		if err := json.Unmarshal([]byte(bindInfo.PageInfo), &pageInfo); err != nil {
-			notify(ErrInvalidBindPageInfo)
-			return fmt.Errorf("unmarshal bind page info. info: %s, err: %v", bindInfo.PageInfo, err)
-		}
-		err = app.messageHandler.AppendLarkDoc(ctx, &pageInfo, content)
-	default:
-		return fmt.Errorf("unknown bind platform %d", bindInfo.BindPlatform)
+	sentAt := time.Now()
+	if message.CreateTime > 0 {
+		sentAt = time.Unix(message.CreateTime, 0)
 	}
-
+	reply, err := app.memos.SaveMemo(ctx, bindInfo, message.MsgId, app.messageHandler.Transform(entity.UserPlatformTypeWx, content), sentAt)
 	if err != nil {
-		notify(ErrAppendFailed)
+		if settings, serr := bindInfo.GetSettings(); serr != nil || !settings.QuietFailures() {
+			notify(ErrAppendFailed)
+		}
 		return err
 	}
 
-	notify(MessageNotionSaveSucc)
+	if reply != "" {
+		notify(reply)
+	}
 	return nil
 }
 
@@ -160,8 +155,12 @@ func (app *wxBotHandleApp) handlePrivateUserMessage(message *openwechat.Message)
 		return notify(ErrMessageTypeNotSupport)
 	}
 
-	sender, _ := message.Sender()
-	log.Infof("receive message: %+v, sender: %+v", *message, *sender)
+	var senderName string
+	if sender, err := message.Sender(); err == nil {
+		senderName = sender.NickName
+	}
+	log.Infof("receive message: %s, sender: %s",
+		utils.Preview(message.Content, app.messageHandler.previewLen), senderName)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	return app.processMessage(ctx, notify, message)
@@ -22,16 +22,19 @@ type WXMessageHandleApp struct {
 
 	bind           repository.BindInfoRepository
 	messageHandler *messageHandler
+	// saves the memos like the lark ones
+	memos IMemoApp
 	// case message for deduplication
 	eventCache *cache.Cache
 }
 
-func NewWXMessageHandleApp(token string, bind repository.BindInfoRepository, registar repository.LarkBotRegistarRepository) *WXMessageHandleApp {
+func NewWXMessageHandleApp(token string, bind repository.BindInfoRepository, registar repository.LarkBotRegistarRepository, memos IMemoApp, opt Option) *WXMessageHandleApp {
 	app := &WXMessageHandleApp{
 		token:          token,
-		messageHandler: NewMessageHandler(bind, registar),
+		messageHandler: NewMessageHandler(bind, registar, opt),
 		eventCache:     cache.New(3*time.Minute, 10*time.Minute),
 		bind:           bind,
+		memos:          memos,
 	}
 
 	return app
@@ -62,12 +65,13 @@ func (app *WXMessageHandleApp) ProcessMessage(ctx context.Context, message *wx_m
 			UserName: message.FromUserName,
 		}
 		data, _ := json.Marshal(&userInfo)
+		var note string
 		switch cmd.Platform {
 		case entity.BindPlatformTypeLarkDoc:
 			err = app.messageHandler.BindLarkDocPage(ctx, entity.UserPlatformTypeWx,
 				userInfo.UnionID(), string(data), cmd)
 		case entity.BindPlatformTypeNotion:
-			err = app.messageHandler.BindNotionPage(ctx, entity.UserPlatformTypeWx,
+			note, err = app.messageHandler.BindNotionPage(ctx, entity.UserPlatformTypeWx,
 				userInfo.UnionID(), string(data), cmd)
 		default:
 			return "", fmt.Errorf("unknown platform %d", cmd.Platform)
@@ -76,7 +80,7 @@ func (app *WXMessageHandleApp) ProcessMessage(ctx context.Context, message *wx_m
 		if err != nil {
 			return "", err
 		}
-		return MessageBindSucc, nil
+		return bindSuccMessage(note), nil
 	}
 
 	userInfo := entity.WXUserInfo{
@@ -88,30 +92,21 @@ func (app *WXMessageHandleApp) ProcessMessage(ctx context.Context, message *wx_m
 		return MessageWechatWelcome, nil
 	}
 
-	switch entity.BindPlatformType(bindInfo.BindPlatform) {
-	case entity.BindPlatformTypeNotion:
-		var pageInfo entity.NotionPageInfo
-		if err := json.Unmarshal([]byte(bindInfo.PageInfo), &pageInfo); err != nil {
-			log.Errorf("unmarshal bind page info. info: %s, err: %v", bindInfo.PageInfo, err)
-			return ErrInvalidBindPageInfo, nil
-		}
-		err = app.messageHandler.AppendNotionPage(ctx, &pageInfo, content)
-	case entity.BindPlatformTypeLarkDoc:
-		var pageInfo entity.LarkDocPageInfo
-		if err := json.Unmarshal([]byte(bindInfo.PageInfo), &pageInfo); err != nil {
-			log.Errorf("unmarshal bind page info. info: %s, err: %v", bindInfo.PageInfo, err)
-			return ErrInvalidBindPageInfo, nil
-		}
-		err = app.messageHandler.AppendLarkDoc(ctx, &pageInfo, content)
-	default:
-		return "", fmt.Errorf("unknown bind platform")
+	sentAt := time.Now()
+	if message.CreateTime > 0 {
+		sentAt = time.Unix(int64(message.CreateTime), 0)
 	}
-
+	reply, err := app.memos.SaveMemo(ctx, bindInfo, message.MsgId, app.messageHandler.Transform(entity.UserPlatformTypeWx, content), sentAt)
 	if err != nil {
+		if settings, serr := bindInfo.GetSettings(); serr == nil && settings.QuietFailures() {
+			log.Errorf("append notion error of %s, reply suppressed. err=%v", bindInfo.UnionUserID, err)
+			return "", nil
+		}
 		return "", fmt.Errorf("append notion error, %v", err)
 	}
 
-	return MessageNotionSaveSucc, nil
+	// an empty reply sends nothing to the user
+	return reply, nil
 }
 
 func (app *WXMessageHandleApp) VerifyURL(ctx context.Context, message interface{}) (interface{}, error) {
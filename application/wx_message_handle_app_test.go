@@ -0,0 +1,179 @@
+package application
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/infrastructure/audit"
+	"github.com/KDF5000/nomo/infrastructure/message/wx_message"
+)
+
+// newTestWXApp returns the wechat app saving memos by the lark app of the
+// bindings, wx_xxx is bound to notion.
+func newTestWXApp(memoRepo *fakeMemoRepo, opt Option, binds ...entity.BindInfo) (*WXMessageHandleApp, *larkMessageHandleApp) {
+	binds = append(binds, newTestWXNotionBind("secret", "db_xxx"))
+	memos := newTestLarkApp(memoRepo, opt, binds...)
+	return NewWXMessageHandleApp("token", memos.bindRepo, memos.botRegistarRepo, memos, opt), memos
+}
+
+func newTestWXMessage(content string) *wx_message.WxMessage {
+	return &wx_message.WxMessage{FromUserName: "xxx", MsgType: "text", MsgId: "1234567890123456", Content: content, CreateTime: 1650000000}
+}
+
+func TestWXNotionWriteSwitch(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app, memos := newTestWXApp(memoRepo, Option{})
+	flagRepo := newFakeFlagRepo()
+	memos.notionWrites = newNotionWriteSwitch(flagRepo)
+	writes := 0
+	memos.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	admin := NewAdminApp(newFakeBindInfoRepo(), memoRepo, flagRepo, nil, Option{})
+	if err := admin.SetNotionWrites(context.TODO(), false); err != nil {
+		t.Fatal(err)
+	}
+	memos.notionWrites.cache.Flush()
+
+	reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("hello"))
+	if err != nil || reply != "Notion写入暂停中，已暂存，恢复后会自动保存~" {
+		t.Fatalf("expected the memo queued, got %q, err=%v", reply, err)
+	}
+	if writes != 0 || len(memoRepo.memos) != 1 || memoRepo.memos[0].Status != uint8(entity.MemoStatusPending) ||
+		memoRepo.memos[0].UnionUserID != "wx_xxx" {
+		t.Fatalf("expected the memo pending, writes: %d, memos: %+v", writes, memoRepo.memos)
+	}
+
+	if err := admin.SetNotionWrites(context.TODO(), true); err != nil {
+		t.Fatal(err)
+	}
+	memos.notionWrites.cache.Flush()
+	if n, err := memos.ProcessPendingMemos(context.TODO()); n != 1 || err != nil || writes != 1 ||
+		memoRepo.memos[0].Status != uint8(entity.MemoStatusSaved) {
+		t.Fatalf("expected the memo saved once writes are enabled, got %d, %+v, err=%v", n, memoRepo.memos, err)
+	}
+
+	// written right away then
+	reply, err = app.ProcessMessage(context.TODO(), newTestWXMessage("world"))
+	if err != nil || reply != MessageNotionSaveSucc || writes != 2 {
+		t.Fatalf("expected the memo saved, got %q, %d writes, err=%v", reply, writes, err)
+	}
+}
+
+func TestWXCaptureSwitch(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app, memos := newTestWXApp(memoRepo, Option{})
+	writes := 0
+	memos.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		writes++
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+	admin := NewAdminApp(memos.bindRepo, memoRepo, newFakeFlagRepo(), nil, Option{})
+
+	if err := admin.SetCapture(context.TODO(), "wx_xxx", "off"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("hello"))
+	if err != nil || reply != "记录已暂停，本条未保存~" || writes != 0 || len(memoRepo.memos) != 0 {
+		t.Fatalf("expected the memo dropped, got %q, %d writes, memos: %+v, err=%v", reply, writes, memoRepo.memos, err)
+	}
+
+	if err := admin.SetCapture(context.TODO(), "wx_xxx", "queue"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err = app.ProcessMessage(context.TODO(), newTestWXMessage("hello"))
+	if err != nil || reply != "记录已暂停，已暂存，恢复后会自动保存~" || writes != 0 || len(memoRepo.memos) != 1 ||
+		memoRepo.memos[0].Status != uint8(entity.MemoStatusPending) {
+		t.Fatalf("expected the memo queued, got %q, %d writes, memos: %+v, err=%v", reply, writes, memoRepo.memos, err)
+	}
+
+	if err := admin.SetCapture(context.TODO(), "wx_xxx", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := memos.ProcessPendingMemos(context.TODO()); n != 1 || err != nil || writes != 1 {
+		t.Fatalf("expected the queued memo saved once capture is on, got %d, %d writes, err=%v", n, writes, err)
+	}
+}
+
+func TestWXDailyCap(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app, memos := newTestWXApp(memoRepo, Option{DailyPageCap: 1})
+	memos.clock = &fakeClock{now: time.Date(2022, 4, 15, 8, 0, 0, 0, time.UTC)}
+	memos.handlers[entity.BindPlatformTypeNotion] = func(ctx context.Context, req *appendRequest) (appendResult, error) {
+		return appendResult{PageID: "page_xxx", Pages: 1}, nil
+	}
+
+	if reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("memo 0")); err != nil || reply != MessageNotionSaveSucc {
+		t.Fatalf("expected the memo saved, got %q, err=%v", reply, err)
+	}
+	reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("memo 1"))
+	if err != nil || !strings.Contains(reply, "达到每日上限") || len(memoRepo.memos) != 1 {
+		t.Fatalf("expected the memo over the cap rejected, got %q, memos: %+v, err=%v", reply, memoRepo.memos, err)
+	}
+
+	stored, _ := memos.bindRepo.GetBindInfoByUnionUserID(context.TODO(), "wx_xxx")
+	settings, _ := stored.GetSettings()
+	if settings.PagesToday == nil || settings.PagesToday.Count != 1 {
+		t.Fatalf("expected the page counted on the wechat binding, got %+v", settings.PagesToday)
+	}
+}
+
+func TestWXCharBudget(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app, memos := newTestWXApp(memoRepo, Option{MonthlyCharBudget: 6})
+	memos.clock = &fakeClock{now: time.Date(2022, 4, 15, 8, 0, 0, 0, time.UTC)}
+
+	if reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("周末去爬山")); err != nil || reply != MessageNotionSaveSucc {
+		t.Fatalf("expected the memo saved, got %q, err=%v", reply, err)
+	}
+	expected := "本月已保存5字，剩余1字，本条超出每月6字的上限，未保存~"
+	reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("买牛奶"))
+	if err != nil || reply != expected || len(memoRepo.memos) != 1 {
+		t.Fatalf("expected %q, got %q, memos: %+v, err=%v", expected, reply, memoRepo.memos, err)
+	}
+}
+
+func TestWXMinLength(t *testing.T) {
+	memoRepo := &fakeMemoRepo{}
+	app, memos := newTestWXApp(memoRepo, Option{})
+	if _, err := memos.bindRepo.UpdateSettings(context.TODO(), "wx_xxx", func(s *entity.BindSettings) error {
+		return ApplySetting(s, "min_length", "3")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "内容不足3个字，可能是误发，本条未保存~ 带上#标签 可以照常保存"
+	if reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("k")); err != nil || reply != expected || len(memoRepo.memos) != 0 {
+		t.Fatalf("expected %q, got %q, memos: %+v, err=%v", expected, reply, memoRepo.memos, err)
+	}
+	if reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("买牛奶")); err != nil || reply != MessageNotionSaveSucc || len(memoRepo.memos) != 1 {
+		t.Fatalf("expected the memo saved, got %q, memos: %+v, err=%v", reply, memoRepo.memos, err)
+	}
+}
+
+func TestWXMemoAudit(t *testing.T) {
+	sink := &fakeAuditSink{}
+	memoRepo := &fakeMemoRepo{}
+	app, _ := newTestWXApp(memoRepo, Option{AuditSink: sink})
+
+	if reply, err := app.ProcessMessage(context.TODO(), newTestWXMessage("#科技 notes")); err != nil || reply != MessageNotionSaveSucc {
+		t.Fatalf("expected the memo saved, got %q, err=%v", reply, err)
+	}
+	if len(memoRepo.memos) != 1 || memoRepo.memos[0].UnionUserID != "wx_xxx" ||
+		memoRepo.memos[0].MessageID != "1234567890123456" || memoRepo.memos[0].Content != "#科技 notes" {
+		t.Fatalf("expected the memo stored, got %+v", memoRepo.memos)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("expected a record, got %+v", sink.records)
+	}
+	r := sink.records[0]
+	if r.UnionUserID != "wx_xxx" || r.MessageID != "1234567890123456" || r.ContentHash != audit.ContentHash("#科技 notes") ||
+		r.Destination != "notion:page_xxx" || r.Status != "saved" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+}
@@ -20,8 +20,17 @@ import (
 	"github.com/joho/godotenv"
 
 	"github.com/KDF5000/nomo/application"
+	"github.com/KDF5000/nomo/infrastructure/audit"
 	"github.com/KDF5000/nomo/infrastructure/persistence"
+	"github.com/KDF5000/nomo/infrastructure/utils"
 	"github.com/KDF5000/nomo/interfaces"
+	"github.com/KDF5000/nomo/interfaces/common"
+)
+
+// set by build.sh with -ldflags
+var (
+	GitSHA    = "dev"
+	BuildTime = ""
 )
 
 func initLog() {
@@ -47,12 +56,12 @@ func initLog() {
 	log.ResetDefault(logger)
 }
 
-func bootWechatbot(repos *persistence.Repositories) {
+func bootWechatbot(repos *persistence.Repositories, memos application.IMemoApp, opt application.Option) {
 	log.Info("start wechat bot in background...")
 	//bot := openwechat.DefaultBot()
 	bot := openwechat.DefaultBot(openwechat.Desktop) // 桌面模式，上面登录不上的可以尝试切换这种模式
 
-	app := application.NewWXBotHandleApp(repos.BindInfoRepo, repos.LarkBotRegistarRepo)
+	app := application.NewWXBotHandleApp(repos.BindInfoRepo, repos.LarkBotRegistarRepo, memos, opt)
 	bot.MessageHandler = app.Handler
 
 	// 注册登陆二维码回调
@@ -82,6 +91,7 @@ func main() {
 
 	initLog()
 	log.Infof(".env file may has loaded. path=%s/.env", dir)
+	log.Infof("nomo version %s, built at %s", GitSHA, BuildTime)
 	host := os.Getenv("DB_HOST")
 	password := os.Getenv("DB_PASSWORD")
 	user := os.Getenv("DB_USER")
@@ -98,6 +108,13 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	// stopped in the reverse order, the database is closed last
+	lifecycle := utils.NewLifecycle()
+	lifecycle.Register(utils.Component{
+		Name: "database",
+		Stop: func(ctx context.Context) error { return repos.Close() },
+	})
+
 	// register routers
 	router := gin.Default()
 	router.Use(cors.New(cors.Config{
@@ -130,8 +147,58 @@ func main() {
 		}
 	}
 
-	larkMsgHandler := interfaces.NewLarkMessageHandler(
-		application.NewLarkMessageHandleApp(repos.BindInfoRepo, repos.LarkBotRegistarRepo, notify))
+	appOpt := loadAppOption()
+	if path := os.Getenv("AUDIT_LOG_PATH"); path != "" {
+		sink, err := audit.NewFileSink(path)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		appOpt.AuditSink = sink
+		lifecycle.Register(utils.Component{
+			Name: "audit sink",
+			Stop: func(ctx context.Context) error { return sink.Close() },
+		})
+	}
+	// lark images are saved only with somewhere notion can read them from
+	imageDir := os.Getenv("IMAGE_STORE_DIR")
+	if imageDir != "" {
+		store, err := utils.NewDirImageStore(imageDir, os.Getenv("IMAGE_STORE_URL"))
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		appOpt.ImageStore = store
+	}
+	// wait a while for a free handler, but answer the platform before it times out
+	acquireWait := time.Duration(envInt("INBOUND_ACQUIRE_WAIT_MS", 1000)) * time.Millisecond
+	larkApp := application.NewLarkMessageHandleApp(repos.BindInfoRepo, repos.LarkBotRegistarRepo,
+		repos.MemoRepo, repos.FlagRepo, repos.AnalyticsRepo, notify, appOpt)
+	// queued memos are stored before the events are acked, but those of images
+	larkMsgHandler := interfaces.NewLarkMessageHandler(larkApp,
+		utils.NewLimiter(envInt("LARK_MAX_CONCURRENT_HANDLERS", 0), acquireWait), appOpt.QueueInbound)
+	// the events acked before the server stopped are done before the database closes
+	lifecycle.Register(utils.Component{
+		Name: "lark message handler",
+		Stop: larkMsgHandler.Wait,
+	})
+	// memos queued while notion writes are disabled, failed or queued inbound
+	pendingInterval := time.Duration(envInt("PENDING_MEMO_INTERVAL_SEC", 60)) * time.Second
+	lifecycle.Register(utils.WorkerComponent("pending memo worker", func(ctx context.Context) {
+		larkApp.RunPendingWorker(ctx, pendingInterval)
+	}))
+
+	// off by default, the admin is told about failures anyway
+	if interval := envInt("HEARTBEAT_INTERVAL_MIN", 0); interval > 0 {
+		lifecycle.Register(utils.WorkerComponent("heartbeat", func(ctx context.Context) {
+			larkApp.RunHeartbeat(ctx, time.Duration(interval)*time.Minute)
+		}))
+	}
+
+	// off by default, bindings opt in by `/set weekly_review parent_page_id`
+	if interval := envInt("WEEKLY_REVIEW_INTERVAL_MIN", 0); interval > 0 {
+		lifecycle.Register(utils.WorkerComponent("weekly review", func(ctx context.Context) {
+			larkApp.RunWeeklyReview(ctx, time.Duration(interval)*time.Minute)
+		}))
+	}
 
 	maxNum := 4
 	if n, err := strconv.Atoi(os.Getenv("CONVERTOR_MAX_WORKERS")); err != nil {
@@ -139,19 +206,43 @@ func main() {
 	}
 	posterHandler := interfaces.NewPosterHandler(application.NewPosterApp(maxNum))
 
+	if imageDir != "" {
+		router.Static("/images", imageDir)
+	}
+
 	v1 := router.Group("/api/v1")
 	v1.POST("/message/lark", larkMsgHandler.HandleMessage)
 	v1.GET("/poster/:id", posterHandler.GenPoster)
 	v1.GET("/screenshot", posterHandler.Screenshot)
 
 	wxMsgHandler := interfaces.NewWXMessageHandler(
-		application.NewWXMessageHandleApp(os.Getenv("WX_TOKEN"), repos.BindInfoRepo, repos.LarkBotRegistarRepo))
+		application.NewWXMessageHandleApp(os.Getenv("WX_TOKEN"), repos.BindInfoRepo, repos.LarkBotRegistarRepo, larkApp, appOpt),
+		utils.NewLimiter(envInt("WX_MAX_CONCURRENT_HANDLERS", 0), acquireWait))
 	// wechat handler
 	v1.GET("/wx", wxMsgHandler.UrlVerification)
 	v1.POST("/wx", wxMsgHandler.HandleMessage)
 
+	// admin apis are only enabled with a token
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		adminHandler := interfaces.NewAdminHandler(
+			application.NewAdminApp(repos.BindInfoRepo, repos.MemoRepo, repos.FlagRepo, larkApp, appOpt))
+		admin := v1.Group("/admin", common.AdminAuth(adminToken))
+		admin.POST("/memo/reprocess", adminHandler.ReprocessTags)
+		admin.GET("/memo/queue", adminHandler.GetMemoQueue)
+		admin.GET("/notion/writes", adminHandler.GetNotionWrites)
+		admin.POST("/notion/writes", adminHandler.SetNotionWrites)
+		admin.POST("/bind/capture", adminHandler.SetCapture)
+	}
+
+	// bulk import is only enabled with a token or account keys
+	importToken, keys := os.Getenv("IMPORT_TOKEN"), importKeys()
+	if importToken != "" || len(keys) > 0 {
+		importHandler := interfaces.NewImportHandler(larkApp)
+		v1.POST("/import", common.AccountAuth(importToken, keys, "union_user_id"), importHandler.Import)
+	}
+
 	// start wechatbot in background
-	// go bootWechatbot(repos)
+	// go bootWechatbot(repos, larkApp, appOpt)
 
 	srv := &http.Server{
 		Addr:    addr,
@@ -175,23 +266,35 @@ func main() {
 		}
 	}
 
-	// Initializing the server in a goroutine so that
-	// it won't block the graceful shutdown handling below
-	go func() {
-		log.Infof("begin to start http/https server on %s(https: %v)...", addr, useHttps)
-		var err error
-		if useHttps {
-			err = srv.ListenAndServeTLS(os.Getenv("HTTPS_CERT_FILE"), os.Getenv("HTTPS_KEY_FILE"))
-		} else {
-			err = srv.ListenAndServe()
-		}
-		if err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
-		}
-	}()
+	// registered last to stop accepting messages first
+	lifecycle.Register(utils.Component{
+		Name: "http server",
+		// Initializing the server in a goroutine so that
+		// it won't block the graceful shutdown handling below
+		Start: func(ctx context.Context) error {
+			go func() {
+				log.Infof("begin to start http/https server on %s(https: %v)...", addr, useHttps)
+				var err error
+				if useHttps {
+					err = srv.ListenAndServeTLS(os.Getenv("HTTPS_CERT_FILE"), os.Getenv("HTTPS_KEY_FILE"))
+				} else {
+					err = srv.ListenAndServe()
+				}
+				if err != nil && err != http.ErrServerClosed {
+					log.Fatalf("listen: %s\n", err)
+				}
+			}()
+			return nil
+		},
+		Stop: srv.Shutdown,
+	})
+
+	if err := lifecycle.Start(context.Background()); err != nil {
+		log.Fatal(err.Error())
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 5 seconds.
+	// a timeout of SHUTDOWN_TIMEOUT_SEC, 5 seconds by default.
 	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscall.SIGTERM
 	// kill -2 is syscall.SIGINT
@@ -199,11 +302,12 @@ func main() {
 	signal.Notify(quit, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-quit
 	log.Infof("Receive signal `%v`, shutting down server...\n", sig)
-	// The context is used to inform the server it has 5 seconds to finish
-	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// The context is used to inform the server and the workers how long
+	// they have to finish what they are currently handling
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(envInt("SHUTDOWN_TIMEOUT_SEC", 5))*time.Second)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := lifecycle.Stop(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+
+	"github.com/KDF5000/nomo/application"
+	"github.com/KDF5000/nomo/infrastructure/notion"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Warnf("invalid %s env %q, use default %d", key, v, def)
+		return def
+	}
+
+	return n
+}
+
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Warnf("invalid %s env %q, use default %v", key, v, def)
+		return def
+	}
+
+	return b
+}
+
+// notionUserAgent is NOTION_USER_AGENT if set, otherwise
+// nomo/<version> with NOTION_UA_CONTACT as the comment, e.g. `nomo/1a2b3c4 (+ops@example.com)`
+func notionUserAgent() string {
+	if ua := os.Getenv("NOTION_USER_AGENT"); ua != "" {
+		return ua
+	}
+
+	ua := fmt.Sprintf("%s/%s", notion.DefaultUserAgent, GitSHA)
+	if contact := os.Getenv("NOTION_UA_CONTACT"); contact != "" {
+		ua = fmt.Sprintf("%s (+%s)", ua, contact)
+	}
+	return ua
+}
+
+// wxUnwrapPatterns is WX_UNWRAP_PATTERNS separated by comma,
+// utils.DefaultWXUnwrapPatterns if empty, none if off
+func wxUnwrapPatterns() []string {
+	v := os.Getenv("WX_UNWRAP_PATTERNS")
+	switch v {
+	case "":
+		return utils.DefaultWXUnwrapPatterns
+	case "off":
+		return nil
+	}
+
+	var patterns []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// importKeys is IMPORT_KEYS of `key:union_user_id` separated by comma,
+// key => the account it may import for
+func importKeys() map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("IMPORT_KEYS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Warnf("invalid import key, should be like key:union_user_id")
+			continue
+		}
+		keys[parts[0]] = parts[1]
+	}
+	return keys
+}
+
+func loadAppOption() application.Option {
+	// 0 for the defaults
+	previewTimeout := time.Duration(envInt("NOTION_LINK_PREVIEW_TIMEOUT_MS", 0)) * time.Millisecond
+	previewMaxBytes := int64(envInt("NOTION_LINK_PREVIEW_MAX_KB", 0)) << 10
+	// latin tags are lowercased unless turned off, e.g. by "off"
+	tagCase := os.Getenv("NOTION_TAG_CASE")
+	if tagCase == "" {
+		tagCase = utils.TagCaseLower
+	}
+
+	return application.Option{
+		Notion: notion.ClientOption{
+			TitleMaxLength:          envInt("NOTION_TITLE_MAX_LENGTH", 0),
+			TitleProperty:           os.Getenv("NOTION_TITLE_PROPERTY"),
+			TitleDedup:              os.Getenv("NOTION_TITLE_DEDUP"),
+			MarkdownLists:           envBool("NOTION_MARKDOWN_LISTS", false),
+			AutoListMaxLength:       envInt("NOTION_AUTO_LIST_MAX_LENGTH", 0),
+			ColorMarkup:             os.Getenv("NOTION_COLOR_MARKUP"),
+			UserAgent:               notionUserAgent(),
+			Bookmarks:               envBool("NOTION_BOOKMARKS", false),
+			LooseLinkMatch:          envBool("NOTION_BOOKMARK_LOOSE_MATCH", false),
+			LinkPreviews:            envBool("NOTION_LINK_PREVIEWS", false),
+			LinkPreviewTimeout:      previewTimeout,
+			LinkPreviewMaxBytes:     previewMaxBytes,
+			CreateMissingProperties: envBool("NOTION_CREATE_MISSING_PROPERTIES", false),
+			TagSeparators:           os.Getenv("NOTION_TAG_SEPARATORS"),
+			TagCase:                 tagCase,
+			LazySchema:              envBool("NOTION_LAZY_SCHEMA", false),
+			DateMentions:            envBool("NOTION_DATE_MENTIONS", false),
+			RelatedWindow:           time.Duration(envInt("NOTION_RELATED_DAYS", 0)) * 24 * time.Hour,
+			RelatedLimit:            envInt("NOTION_RELATED_MAX", 0),
+			MaxPageTags:             envInt("NOTION_MAX_PAGE_TAGS", 0),
+			MaxTagOptions:           envInt("NOTION_MAX_TAG_OPTIONS", 0),
+			TagOptionsMargin:        envInt("NOTION_TAG_OPTIONS_MARGIN", 0),
+		},
+		LarkOpenAPI:        os.Getenv("LARK_OPEN_API"),
+		WXUnwrapPatterns:   wxUnwrapPatterns(),
+		StoreMemoMetadata:  envBool("MEMO_STORE_METADATA", false),
+		StoreRawContent:    envBool("MEMO_STORE_RAW_CONTENT", false),
+		NotionAccessHints:  envBool("NOTION_ACCESS_HINTS", true),
+		CheckCapabilities:  envBool("NOTION_CHECK_CAPABILITIES", true),
+		VerifyNotionWrites: envBool("NOTION_VERIFY_WRITES", false),
+		MemoRetryBudget:    envInt("MEMO_RETRY_BUDGET", 3),
+		QueueInbound:       envBool("LARK_INBOUND_QUEUE", false),
+		DailyPageCap:       envInt("DAILY_PAGE_CAP", 0),
+		QueueOverCap:       envBool("DAILY_PAGE_CAP_QUEUE", false),
+		MonthlyCharBudget:  envInt("MONTHLY_CHAR_BUDGET", 0),
+		PreviewLength:      envInt("LOG_PREVIEW_LENGTH", 64),
+		ImportRate:         envInt("IMPORT_RATE", 3),
+		ReplyMaxLength:     envInt("LARK_REPLY_MAX_LENGTH", 4000),
+		ReplyOverflow:      os.Getenv("LARK_REPLY_OVERFLOW"),
+		MemoAnalytics:      envBool("MEMO_ANALYTICS", false),
+		AnalyticsSalt:      os.Getenv("MEMO_ANALYTICS_SALT"),
+		LanguageConfidence: float64(envInt("LANGUAGE_ROUTE_CONFIDENCE", 0)) / 100,
+		RedactionKey:       os.Getenv("REDACTION_KEY"),
+		SyncSharedBindings: envBool("SYNC_SHARED_BINDINGS", false),
+		MaxImageSize:       int64(envInt("LARK_MAX_IMAGE_MB", 0)) << 20,
+		ResourceAttempts:   envInt("LARK_RESOURCE_ATTEMPTS", 0),
+	}
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"gorm.io/gorm"
@@ -28,6 +29,228 @@ type BindInfo struct {
 	UserInfo     string `json:"user_info" gorm:"column:user_info" comment:"json fromat user info for specified platform"`
 	BindPlatform uint8  `json:"bind_platform" gorm:"column:bind_platform" comment:"0: notion, 1: larkdoc"`
 	PageInfo     string `json:"page_info" gorm:"column:page_info" comment:"json string for page info"`
+	Settings     string `json:"settings" gorm:"column:settings;type:text" comment:"json string for bind settings"`
+}
+
+const (
+	NotionAccessNotShared  = "not_shared"
+	NotionAccessRestricted = "restricted"
+)
+
+const (
+	CaptureOn = "on"
+	// memos are dropped until it's on again
+	CaptureOff = "off"
+	// memos are queued until it's on again
+	CaptureQueue = "queue"
+)
+
+const (
+	AckReply    = "reply"
+	AckReaction = "reaction"
+	AckBoth     = "both"
+)
+
+const (
+	RepliesAll = "all"
+	// no acks of saved memos
+	RepliesErrors = "errors"
+	// no replies to memos at all, failures included
+	RepliesNone = "none"
+)
+
+// BindSettings are the per binding tunables, changed by `/set key value`
+type BindSettings struct {
+	// how to acknowledge a saved memo: reply(default), reaction or both
+	Ack string `json:"ack,omitempty"`
+	// replies to memos: all(default), errors or none, memos are saved either way
+	Replies string `json:"replies,omitempty"`
+	// whether memos are saved: on(default), off or queue, paused without unbinding
+	Capture string `json:"capture,omitempty"`
+	// memos of fewer runes are rejected unless they have tags, 0 for no minimum
+	MinLength int `json:"min_length,omitempty"`
+	// max notion writes a day, 0 for no limit, the server's if nil
+	DailyCap *int `json:"daily_cap,omitempty"`
+	// max characters written a month, 0 for no limit, the server's if nil
+	CharBudget *int `json:"char_budget,omitempty"`
+	// max runes of a lark reply, 0 for no limit, the server's if nil
+	ReplyMaxLength *int `json:"reply_max_length,omitempty"`
+	// chat id => notion subpage for memos of the chat
+	ChatPages map[string]*ChatPage `json:"chat_pages,omitempty"`
+	// property of gallery pages populated for sorting, none if empty
+	SortField string `json:"sort_field,omitempty"`
+	// how to populate the sort field: order(default) or timestamp
+	SortStrategy string `json:"sort_strategy,omitempty"`
+	// property of gallery pages for the name of the source chat, none if empty
+	ChatProperty string `json:"chat_property,omitempty"`
+	// property of gallery pages for the users @mentioned in memos, none if
+	// empty. The mentions in the content are replaced by the names then
+	MentionProperty string `json:"mention_property,omitempty"`
+	// lark union id or name => notion user id, for people properties
+	MentionUsers map[string]string `json:"mention_users,omitempty"`
+	// self-relation property of gallery pages linking the recent pages that
+	// share a tag, none if empty
+	RelatedProperty string `json:"related_property,omitempty"`
+	// tag memos with the name of the source chat
+	ChatTag bool `json:"chat_tag,omitempty"`
+	// split gallery memos into a page per heading of level 1 to this,
+	// linked from an index page, 0 disables it
+	SplitHeading int `json:"split_heading,omitempty"`
+	// alias => database a gallery memo picks by a first line `@db: alias`
+	Databases map[string]string `json:"databases,omitempty"`
+	// tag => database for gallery memos with the tag, checked before size routes
+	TagRoutes map[string]string `json:"tag_routes,omitempty"`
+	// gallery memos with several routed tags go to the databases of all of them
+	MultiRoute bool `json:"multi_route,omitempty"`
+	// databases for gallery memos matching patterns, checked in order
+	// after tag routes and before size routes
+	RegexRoutes []RegexRoute `json:"regex_routes,omitempty"`
+	// language, e.g. zh or en => database for gallery memos detected in it,
+	// checked after regex routes and before size routes
+	LanguageRoutes map[string]string `json:"language_routes,omitempty"`
+	// tag => page the memos with the tag are appended to, with
+	// ScratchSeparator before each. Checked before chat pages and routes
+	ScratchPages map[string]string `json:"scratch_pages,omitempty"`
+	// line before each memo of scratch pages, {time} is the time of the
+	// memo. A line of the time if empty
+	ScratchSeparator string `json:"scratch_separator,omitempty"`
+	// databases for short gallery memos, ordered by max length
+	SizeRoutes []SizeRoute `json:"size_routes,omitempty"`
+	// patterns or presets(card, email) of the values masked in memos before saved
+	RedactPatterns []string `json:"redact_patterns,omitempty"`
+	// keep the content before redacted with the memo, sealed for the user
+	RedactKeepOriginal bool `json:"redact_keep_original,omitempty"`
+	// straighten smart quotes and dashes of prose, code is kept as it is
+	NormalizeTypography bool `json:"normalize_typography,omitempty"`
+	// go text/template of the body of notion pages, the content as is if empty
+	BodyTemplate string `json:"body_template,omitempty"`
+	// headings and text of gallery pages with a line of {body} where the
+	// memo goes, the memo alone if empty
+	PageTemplate string `json:"page_template,omitempty"`
+	// IANA name of the user's timezone, e.g. Asia/Shanghai, the server's if empty
+	Timezone string `json:"timezone,omitempty"`
+	// text or select property of gallery pages for the timezone, none if
+	// empty. Left unset while the timezone is the server's
+	TimezoneProperty string `json:"timezone_property,omitempty"`
+	// number property of gallery pages for the current streak, none if empty
+	StreakProperty string `json:"streak_property,omitempty"`
+	// consecutive days with memos, kept while the streak property is set
+	Streak *Streak `json:"streak,omitempty"`
+	// weekly review page of the memos, off if nil
+	WeeklyReview *WeeklyReview `json:"weekly_review,omitempty"`
+	// index page listing links to the gallery pages of memos, off if nil
+	IndexPage *IndexPage `json:"index_page,omitempty"`
+	// notion writes of the day, counted while there's a daily cap
+	PagesToday *DayCount `json:"pages_today,omitempty"`
+	// characters written in the month, counted while there's a monthly budget
+	CharsThisMonth *MonthCount `json:"chars_this_month,omitempty"`
+	// access of the integration to the bound notion page found by the
+	// last write: not_shared or restricted, empty if writable
+	NotionAccess string `json:"notion_access,omitempty"`
+}
+
+// SizeRoute sends memos shorter than MaxLength runes to database DatabaseID
+type SizeRoute struct {
+	MaxLength  int    `json:"max_length"`
+	DatabaseID string `json:"database_id"`
+}
+
+// RegexRoute sends memos matching regexp Pattern to database DatabaseID
+type RegexRoute struct {
+	Pattern    string `json:"pattern"`
+	DatabaseID string `json:"database_id"`
+}
+
+// Streak counts the consecutive days with at least one memo
+type Streak struct {
+	Days int `json:"days"`
+	// last day with a memo, 2006-01-02 in the user's timezone
+	LastDay string `json:"last_day"`
+}
+
+// WeeklyReview aggregates the memos of a week into a page under
+// ParentPageID, one page a week
+type WeeklyReview struct {
+	ParentPageID string `json:"parent_page_id"`
+	// the week of the first run, memos of earlier weeks are left out
+	Since string `json:"since,omitempty"`
+	// the last week aggregated, 2006-W01 in the user's timezone
+	Week string `json:"week,omitempty"`
+	// page of Week
+	PageID string `json:"page_id,omitempty"`
+	// the last memo aggregated by old versions, the memos up to it are
+	// marked reviewed in the next run. Memos are marked one by one now
+	LastMemoID uint `json:"last_memo_id,omitempty"`
+}
+
+// IndexPage lists links to the pages of memos, created under ParentPageID
+// on the first memo. A full one is followed by the next part
+type IndexPage struct {
+	ParentPageID string `json:"parent_page_id"`
+	PageID       string `json:"page_id,omitempty"`
+	// part of PageID from 1, and the links on it
+	Part  int `json:"part,omitempty"`
+	Links int `json:"links,omitempty"`
+}
+
+// DayCount counts the notion writes of a day
+type DayCount struct {
+	// 2006-01-02 in the user's timezone
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+	// the admin is told of the cap once a day
+	Notified bool `json:"notified,omitempty"`
+}
+
+// MonthCount counts the characters written in a month
+type MonthCount struct {
+	// 2006-01 in the user's timezone
+	Month string `json:"month"`
+	Chars int    `json:"chars"`
+	// the admin is told of the budget once a month
+	Notified bool `json:"notified,omitempty"`
+}
+
+type ChatPage struct {
+	ParentPageID string `json:"parent_page_id"`
+	Name         string `json:"name"`
+	// created under the parent on the first memo of the chat
+	PageID string `json:"page_id,omitempty"`
+}
+
+// CapturePaused reports whether memos aren't saved for now
+func (s *BindSettings) CapturePaused() bool {
+	return s.Capture == CaptureOff || s.Capture == CaptureQueue
+}
+
+// QuietSuccess reports whether saved memos are not acked
+func (s *BindSettings) QuietSuccess() bool {
+	return s.Replies == RepliesErrors || s.Replies == RepliesNone
+}
+
+// QuietFailures reports whether memos get no replies even if they fail
+func (s *BindSettings) QuietFailures() bool {
+	return s.Replies == RepliesNone
+}
+
+func (b *BindInfo) GetSettings() (BindSettings, error) {
+	var s BindSettings
+	if b.Settings == "" {
+		return s, nil
+	}
+
+	err := json.Unmarshal([]byte(b.Settings), &s)
+	return s, err
+}
+
+func (b *BindInfo) SetSettings(s *BindSettings) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	b.Settings = string(data)
+	return nil
 }
 
 func (b *BindInfo) BeforeSave(db *gorm.DB) error {
@@ -0,0 +1,13 @@
+package entity
+
+import "gorm.io/gorm"
+
+const FlagNotionWritesEnabled = "notion_writes_enabled"
+
+// Flag is a runtime switch which can be flipped without redeploying
+type Flag struct {
+	gorm.Model
+
+	Name  string `json:"name" gorm:"column:name;size:64;uniqueIndex;not null"`
+	Value string `json:"value" gorm:"column:value"`
+}
@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type MemoStatusType uint8
+
+const (
+	MemoStatusSaved MemoStatusType = iota + 1
+	MemoStatusFailed
+	// waits for notion writes to be enabled again, or to be retried
+	MemoStatusPending
+	// claimed from pending by a worker writing it
+	MemoStatusProcessing
+)
+
+type Memo struct {
+	gorm.Model
+
+	UnionUserID    string `json:"union_user_id" gorm:"column:union_user_id;size:255;index"`
+	BindPlatform   uint8  `json:"bind_platform" gorm:"column:bind_platform" comment:"1: notion, 2: larkdoc"`
+	AppID          string `json:"app_id" gorm:"column:app_id;size:255"`
+	ChatID         string `json:"chat_id" gorm:"column:chat_id;size:255"`
+	MessageID      string `json:"message_id" gorm:"column:message_id;size:255"`
+	Content        string `json:"content" gorm:"column:content;type:text"`
+	RawContent     string `json:"raw_content" gorm:"column:raw_content;type:text" comment:"original message before processed, empty if same as content"`
+	SealedOriginal string `json:"-" gorm:"column:sealed_original;type:text" comment:"content before redacted, aes-gcm sealed for the user"`
+	Status         uint8  `json:"status" gorm:"column:status;index" comment:"1: saved, 2: failed, 3: pending, 4: processing"`
+	PageID         string `json:"page_id" gorm:"column:page_id;size:255" comment:"page created for the memo, empty for flat theme"`
+	PageIDs        string `json:"page_ids" gorm:"column:page_ids;type:text" comment:"comma separated pages of a memo written to several databases, the first is PageID"`
+	Verified       bool   `json:"verified" gorm:"column:verified" comment:"the page is read back after created"`
+	Metadata       string `json:"metadata" gorm:"column:metadata;type:text" comment:"json string for inbound event metadata"`
+	Attempts       uint8  `json:"attempts" gorm:"column:attempts" comment:"number of writes tried"`
+	LastError      string `json:"last_error" gorm:"column:last_error;type:text"`
+	// set by MemoRepository.MarkMemosReviewed only, other writes leave it
+	Reviewed bool `json:"reviewed" gorm:"column:reviewed" comment:"added to the weekly review"`
+}
+
+// Pages are the ids of all the pages created for the memo
+func (m *Memo) Pages() []string {
+	if m.PageIDs != "" {
+		return strings.Split(m.PageIDs, ",")
+	}
+	if m.PageID != "" {
+		return []string{m.PageID}
+	}
+	return nil
+}
+
+// SetPages keeps ids of the pages created for the memo, ids[0] as PageID
+func (m *Memo) SetPages(ids []string) {
+	m.PageID, m.PageIDs = "", ""
+	if len(ids) > 0 {
+		m.PageID = ids[0]
+	}
+	if len(ids) > 1 {
+		m.PageIDs = strings.Join(ids, ",")
+	}
+}
+
+// MemoErrorCount is the number of memos in Status that failed with LastError,
+// empty if they never did
+type MemoErrorCount struct {
+	Status    uint8
+	LastError string
+	Count     int
+}
+
+// MemoMetadata is the inbound event info kept for debugging,
+// it never contains the memo content.
+type MemoMetadata struct {
+	Platform   string `json:"platform"`
+	AppID      string `json:"app_id,omitempty"`
+	EventID    string `json:"event_id,omitempty"`
+	MessageID  string `json:"message_id,omitempty"`
+	ChatID     string `json:"chat_id,omitempty"`
+	CreateTime string `json:"create_time,omitempty"`
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "gorm.io/gorm"
+
+// MemoAnalytics is the anonymized representation of a memo for usage
+// analytics, it never contains the memo content.
+type MemoAnalytics struct {
+	gorm.Model
+
+	ContentHash  string `json:"content_hash" gorm:"column:content_hash;size:64;index" comment:"hmac-sha256 of content"`
+	Length       int    `json:"length" gorm:"column:length" comment:"content length in runes"`
+	Tags         string `json:"tags" gorm:"column:tags;type:text" comment:"json array of tags"`
+	BindPlatform uint8  `json:"bind_platform" gorm:"column:bind_platform" comment:"1: notion, 2: larkdoc"`
+	Status       uint8  `json:"status" gorm:"column:status" comment:"1: saved, 2: failed, 3: pending"`
+}
@@ -0,0 +1,11 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+type AnalyticsRepository interface {
+	Create(ctx context.Context, a *entity.MemoAnalytics) error
+}
@@ -2,11 +2,24 @@ package repository
 
 import (
 	"context"
+	"errors"
 
 	"github.com/KDF5000/nomo/domain/entity"
 )
 
+// ErrSettingsUnchanged is returned by the update of UpdateSettings to keep
+// the settings as they are
+var ErrSettingsUnchanged = errors.New("settings unchanged")
+
 type BindInfoRepository interface {
+	// UpdateOrInsert saves b, the stored settings are left alone if b has none
 	UpdateOrInsert(ctx context.Context, b *entity.BindInfo) error
 	GetBindInfoByUnionUserID(ctx context.Context, id string) (*entity.BindInfo, error)
+	// ListBindInfosByNotionPage returns the notion bindings of page or
+	// database pageID
+	ListBindInfosByNotionPage(ctx context.Context, pageID string) ([]entity.BindInfo, error)
+	// UpdateSettings applies update to the latest settings of binding id and
+	// stores them unless they were changed meanwhile, update is applied to
+	// the changed ones again then. It returns the settings stored.
+	UpdateSettings(ctx context.Context, id string, update func(s *entity.BindSettings) error) (*entity.BindSettings, error)
 }
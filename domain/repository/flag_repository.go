@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+type FlagRepository interface {
+	GetFlag(ctx context.Context, name string) (*entity.Flag, error)
+	SetFlag(ctx context.Context, name, value string) error
+}
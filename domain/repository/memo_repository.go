@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+// ErrAccountRequired is returned by MemoRepository for queries without an account
+var ErrAccountRequired = errors.New("account id is required")
+
+// MemoRepository scopes every query to an account, the union user id of the
+// memo owner, so one account can never touch the memos of another one.
+type MemoRepository interface {
+	// m.UnionUserID is the account of the memo
+	Create(ctx context.Context, m *entity.Memo) error
+	Update(ctx context.Context, accountID string, m *entity.Memo) error
+	GetMemoByID(ctx context.Context, accountID string, id uint) (*entity.Memo, error)
+	ListMemos(ctx context.Context, accountID string) ([]entity.Memo, error)
+	ListMemosByStatus(ctx context.Context, accountID string, status entity.MemoStatusType, limit int) ([]entity.Memo, error)
+	// ListMemosToReview returns the oldest limit saved memos of accountID
+	// created since, which aren't reviewed yet
+	ListMemosToReview(ctx context.Context, accountID string, since time.Time, limit int) ([]entity.Memo, error)
+	// MarkMemosReviewed marks memos ids of accountID added to the weekly review
+	MarkMemosReviewed(ctx context.Context, accountID string, ids []uint) error
+	// ClaimMemo moves pending memo id of accountID to processing, false if
+	// it's not pending, e.g. claimed by another worker already, or an older
+	// memo of the account is pending or processing, which is written first
+	ClaimMemo(ctx context.Context, accountID string, id uint) (bool, error)
+	// ReleaseMemos moves the memos of all accounts processing since before
+	// back to pending, those of a worker gone while writing them
+	ReleaseMemos(ctx context.Context, before time.Time) (int, error)
+	// ListAccountsByStatus returns the accounts having memos in status
+	ListAccountsByStatus(ctx context.Context, status entity.MemoStatusType) ([]string, error)
+	// CountMemosByError counts the memos of all accounts in statuses by their
+	// last error, nothing of the memos themselves is returned
+	CountMemosByError(ctx context.Context, statuses ...entity.MemoStatusType) ([]entity.MemoErrorCount, error)
+}
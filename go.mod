@@ -21,5 +21,6 @@ require (
 	go.uber.org/multierr v1.8.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0
 	gorm.io/driver/mysql v1.3.0
+	gorm.io/driver/sqlite v1.3.0
 	gorm.io/gorm v1.23.0
 )
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is an entry of the audit trail of a captured memo. Each record
+// carries the hash of the one before it, so an edited, removed or
+// reordered record breaks the chain from there on.
+type Record struct {
+	Seq         uint64    `json:"seq"`
+	Time        time.Time `json:"time"`
+	UnionUserID string    `json:"union_user_id"`
+	Platform    string    `json:"platform"`
+	MessageID   string    `json:"message_id,omitempty"`
+	// sha256 of the content, the content itself is never kept
+	ContentHash string `json:"content_hash"`
+	// where the memo went, e.g. notion:<page id>
+	Destination string `json:"destination"`
+	Status      string `json:"status"`
+	PrevHash    string `json:"prev_hash"`
+	Hash        string `json:"hash"`
+}
+
+// ContentHash is the hash of content kept in records
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// digest is the hash of r, all the fields but Hash itself
+func (r Record) digest() string {
+	r.Hash = ""
+	data, _ := json.Marshal(&r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// FileSink appends the records as json lines to a file, which is only
+// ever appended to, continuing the chain of the records in it.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+	last string
+}
+
+// NewFileSink opens the audit file at path, created if missing. It fails
+// if the records in it don't chain.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	last, err := Verify(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("audit file %s is broken, %w", path, err)
+	}
+
+	sink := &FileSink{file: file}
+	if last != nil {
+		sink.seq, sink.last = last.Seq, last.Hash
+	}
+	return sink, nil
+}
+
+// Append chains r to the last record and writes it, r gets the sequence
+// number and the hashes.
+func (s *FileSink) Append(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.Seq, r.PrevHash = s.seq+1, s.last
+	r.Hash = r.digest()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.seq, s.last = r.Seq, r.Hash
+	return nil
+}
+
+// Close closes the audit file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// Verify checks the chain of the records read from r, returning the last
+// one, nil if there's none, or the first record that breaks the chain.
+func Verify(r io.Reader) (*Record, error) {
+	var last *Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid record at line %d, %v", line, err)
+		}
+
+		var seq uint64 = 1
+		var prev string
+		if last != nil {
+			seq, prev = last.Seq+1, last.Hash
+		}
+		if record.Seq != seq || record.PrevHash != prev {
+			return nil, fmt.Errorf("record %d at line %d doesn't follow record %d", record.Seq, line, seq-1)
+		}
+		if record.Hash != record.digest() {
+			return nil, fmt.Errorf("record %d at line %d is modified", record.Seq, line)
+		}
+		last = &record
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return last, nil
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendRecords(t *testing.T, path string, users ...string) {
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for _, user := range users {
+		r := &Record{
+			Time:        time.Unix(1650000000, 0).UTC(),
+			UnionUserID: user,
+			Platform:    "lark",
+			ContentHash: ContentHash("memo of " + user),
+			Destination: "notion:page_" + user,
+			Status:      "saved",
+		}
+		if err := sink.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHashChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	appendRecords(t, path, "a", "b")
+	// reopened, the chain goes on
+	appendRecords(t, path, "c")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := Verify(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Seq != 3 || last.UnionUserID != "c" {
+		t.Fatalf("expected record 3 of c last, got %+v", last)
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	cases := []struct {
+		Name     string
+		Trail    string
+		Expected string
+	}{
+		{
+			Name:     "modified",
+			Trail:    lines[0] + strings.Replace(lines[1], `"union_user_id":"b"`, `"union_user_id":"x"`, 1) + lines[2],
+			Expected: "record 2 at line 2 is modified",
+		},
+		{
+			Name:     "removed",
+			Trail:    lines[0] + lines[2],
+			Expected: "record 3 at line 2 doesn't follow record 1",
+		},
+		{
+			Name:     "reordered",
+			Trail:    lines[1] + lines[0] + lines[2],
+			Expected: "record 2 at line 1 doesn't follow record 0",
+		},
+	}
+	for _, tc := range cases {
+		_, err := Verify(strings.NewReader(tc.Trail))
+		if err == nil || err.Error() != tc.Expected {
+			t.Fatalf("%s: expected %q, got %v", tc.Name, tc.Expected, err)
+		}
+	}
+
+	// a broken trail isn't appended to
+	if err := ioutil.WriteFile(path, []byte(lines[0]+lines[2]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileSink(path); err == nil {
+		t.Fatal("expected the broken trail rejected")
+	}
+}
@@ -0,0 +1,63 @@
+package lark_message
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaV2 is the schema of the events nomo handles
+const SchemaV2 = "2.0"
+
+type eventBatch struct {
+	Schema string            `json:"schema"`
+	Events []json.RawMessage `json:"events"`
+}
+
+// ParseEvents parses the events of schema 2.0 in a callback body: a single
+// event, or a batch of them as an array or under "events" with the schema
+// of the batch. Events of a batch which can't be parsed are skipped and
+// counted in skipped, so the rest are still handled. There are no events
+// for a body of no schema, e.g. the url verification.
+func ParseEvents(data []byte) (events []LarkMessageEvent, skipped int, err error) {
+	data = bytes.TrimSpace(data)
+	var items []json.RawMessage
+	schema := ""
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		var batch eventBatch
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, 0, err
+		}
+		if batch.Events == nil {
+			var event LarkMessageEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return nil, 0, err
+			}
+			if event.Schema == "" {
+				return nil, 0, nil
+			}
+			return []LarkMessageEvent{event}, 0, nil
+		}
+		items, schema = batch.Events, batch.Schema
+	}
+
+	for _, item := range items {
+		var event LarkMessageEvent
+		if err := json.Unmarshal(item, &event); err != nil || event.Header.EventID == "" {
+			skipped++
+			continue
+		}
+		if event.Schema == "" {
+			event.Schema = schema
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 && skipped > 0 {
+		return nil, skipped, fmt.Errorf("none of the %d events of the batch is valid", skipped)
+	}
+	return events, skipped, nil
+}
@@ -73,14 +73,23 @@ type UrlVerificationResult struct {
 	Challenge string `json:"challenge"`
 }
 
-func (msg *Message) GetMessageRawContent() (string, error) {
+// GetMessageText returns the text exactly as it's sent
+func (msg *Message) GetMessageText() (string, error) {
 	var text TextMessage
 	if err := json.Unmarshal([]byte(msg.Content), &text); err != nil {
 		return "", fmt.Errorf("parse content error, content=%s, err=%v", msg.Content, err)
 	}
 
+	return text.Text, nil
+}
+
+func (msg *Message) GetMessageRawContent() (string, error) {
+	content, err := msg.GetMessageText()
+	if err != nil {
+		return "", err
+	}
+
 	// trim left @user
-	content := text.Text
 	for _, mention := range msg.Mentions {
 		content = strings.TrimLeft(content, mention.Key)
 	}
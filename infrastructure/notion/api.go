@@ -0,0 +1,185 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+// notionAPI covers the endpoints notion-sdk-go doesn't expose or
+// doesn't return enough from, e.g. the id of a created page.
+type notionAPI struct {
+	baseURI   string
+	userAgent string
+	client    *http.Client
+}
+
+func newNotionAPI(baseURI, userAgent string) *notionAPI {
+	if baseURI == "" {
+		baseURI = core.BASE_URI
+	}
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	return &notionAPI{
+		baseURI:   baseURI,
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (api *notionAPI) do(secretKey, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		if payload, err = encodeMentions(payload); err != nil {
+			return err
+		}
+		if payload, err = encodeLinks(payload); err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(payload)
+	}
+
+	req, err := http.NewRequest(method, api.baseURI+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Notion-Version", core.NOTION_VERSION)
+	req.Header.Set("User-Agent", api.userAgent)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secretKey))
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// CreatePage creates page, with rawProperties merged into its properties
+// for the values core.PropertyValue can't encode.
+func (api *notionAPI) CreatePage(secretKey string, page *core.Page, rawProperties map[string]interface{}) (*core.Page, error) {
+	in, err := withRawProperties(page, rawProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	var created core.Page
+	if err := api.do(secretKey, http.MethodPost, "/pages", in, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// withRawProperties is v with rawProperties merged into its properties,
+// v itself if there's none.
+func withRawProperties(v interface{}, rawProperties map[string]interface{}) (interface{}, error) {
+	if len(rawProperties) == 0 {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make(map[string]interface{})
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+
+	properties, _ := payload["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+	for name, value := range rawProperties {
+		properties[name] = value
+	}
+	payload["properties"] = properties
+	return payload, nil
+}
+
+// UpdatePageProperties overwrites properties of page pageID, with
+// rawProperties like CreatePage.
+func (api *notionAPI) UpdatePageProperties(secretKey, pageID string, properties map[string]core.PropertyValue, rawProperties map[string]interface{}) error {
+	payload := struct {
+		Properties map[string]core.PropertyValue `json:"properties"`
+	}{
+		Properties: properties,
+	}
+
+	in, err := withRawProperties(&payload, rawProperties)
+	if err != nil {
+		return err
+	}
+	return api.do(secretKey, http.MethodPatch, fmt.Sprintf("/pages/%s", pageID), in, nil)
+}
+
+func (api *notionAPI) RetrievePage(secretKey, pageID string) (*core.Page, error) {
+	var page core.Page
+	if err := api.do(secretKey, http.MethodGet, fmt.Sprintf("/pages/%s", pageID), nil, &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+type blockChildren struct {
+	Object     string       `json:"object"`
+	NextCursor string       `json:"next_cursor"`
+	HasMore    bool         `json:"has_more"`
+	Results    []core.Block `json:"results"`
+}
+
+func (api *notionAPI) RetrieveBlockChildren(secretKey, blockID, startCursor string, pageSize int) (*blockChildren, error) {
+	path := fmt.Sprintf("/blocks/%s/children?page_size=%d", blockID, pageSize)
+	if startCursor != "" {
+		path = fmt.Sprintf("%s&start_cursor=%s", path, startCursor)
+	}
+
+	var children blockChildren
+	if err := api.do(secretKey, http.MethodGet, path, nil, &children); err != nil {
+		return nil, err
+	}
+
+	return &children, nil
+}
+
+func (api *notionAPI) AppendBlockChildren(secretKey, blockID string, blocks []*core.Block) error {
+	payload := struct {
+		Children []*core.Block `json:"children"`
+	}{
+		Children: blocks,
+	}
+
+	return api.do(secretKey, http.MethodPatch, fmt.Sprintf("/blocks/%s/children", blockID), &payload, nil)
+}
@@ -0,0 +1,46 @@
+package notion
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// runs of fewer lines are left as paragraphs
+const minAutoListLines = 2
+
+// autoList prefixes the lines of the runs of consecutive non-empty lines
+// of at most maxLength runes each with `- `, so markdownBlocks makes them
+// bulleted list items. Runs with a longer line are taken as prose and kept,
+// and so are lines which are list items already. It reports whether any
+// run is converted.
+func autoList(content string, maxLength int) (string, bool) {
+	lines := strings.Split(content, "\n")
+	converted := false
+	for start := 0; start < len(lines); {
+		if strings.TrimSpace(lines[start]) == "" {
+			start++
+			continue
+		}
+
+		end, short := start, true
+		for ; end < len(lines) && strings.TrimSpace(lines[end]) != ""; end++ {
+			if utf8.RuneCountInString(strings.TrimSpace(lines[end])) > maxLength {
+				short = false
+			}
+		}
+		if short && end-start >= minAutoListLines {
+			for i := start; i < end; i++ {
+				if !bulletItemRegexp.MatchString(lines[i]) {
+					lines[i] = "- " + strings.TrimSpace(lines[i])
+				}
+			}
+			converted = true
+		}
+		start = end
+	}
+
+	if !converted {
+		return content, false
+	}
+	return strings.Join(lines, "\n"), true
+}
@@ -0,0 +1,59 @@
+package notion
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+func TestAutoList(t *testing.T) {
+	prose := "今天读完了一本关于分布式系统的书，最大的收获是理解了共识算法为什么需要多数派。\n明天打算把笔记整理出来，顺便复习一下之前看过的论文。"
+	cases := []struct {
+		Content string
+		Blocks  []testBlock
+	}{
+		{
+			Content: "买菜\n牛奶\n鸡蛋",
+			Blocks: []testBlock{
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "买菜"},
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "牛奶"},
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "鸡蛋"},
+			},
+		},
+		{
+			Content: prose,
+			Blocks:  []testBlock{{Type: core.BLOCK_PARAGRAPH, Text: prose}},
+		},
+		// a single short line isn't a list
+		{
+			Content: "早点睡",
+			Blocks:  []testBlock{{Type: core.BLOCK_PARAGRAPH, Text: "早点睡"}},
+		},
+		// only the runs of short lines, list items are kept
+		{
+			Content: prose + "\n\n待办:\n- 写周报\n回邮件",
+			Blocks: []testBlock{
+				{Type: core.BLOCK_PARAGRAPH, Text: prose},
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "待办:"},
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "写周报"},
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "回邮件"},
+			},
+		},
+	}
+
+	client := NewNotionClient(ClientOption{AutoListMaxLength: 20})
+	for _, tc := range cases {
+		blocks := toTestBlocks(client.contentBlocks(tc.Content, time.Now()))
+		if !reflect.DeepEqual(blocks, tc.Blocks) {
+			t.Fatalf("content: %q, expected %+v, got %+v", tc.Content, tc.Blocks, blocks)
+		}
+	}
+
+	// off by default
+	blocks := toTestBlocks(NewNotionClient(ClientOption{}).contentBlocks("买菜\n牛奶", time.Now()))
+	if len(blocks) != 1 || blocks[0].Type != core.BLOCK_PARAGRAPH {
+		t.Fatalf("expected one paragraph, got %+v", blocks)
+	}
+}
@@ -0,0 +1,66 @@
+package notion
+
+import (
+	"errors"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+	"github.com/KDF5000/pkg/log"
+)
+
+// Capabilities are what the integration can do with a bound page, as far
+// as probing it tells
+type Capabilities struct {
+	Shared        bool
+	ReadContent   bool
+	InsertContent bool
+}
+
+// CheckCapabilities probes the integration of notionKey on page pageId, or
+// database if isDatabase, since the notion api doesn't list the
+// capabilities. Reading is probed by retrieving it and inserting by
+// appending no blocks to it. A capability is taken as granted unless notion
+// refuses it as restricted, err is of the failures of the requests.
+func (c *NotionClient) CheckCapabilities(notionKey, pageId string, isDatabase bool) (Capabilities, error) {
+	caps := Capabilities{Shared: true, ReadContent: true, InsertContent: true}
+
+	var err error
+	if isDatabase {
+		_, err = c.api.RetrieveDatabase(notionKey, pageId)
+	} else {
+		_, err = c.api.RetrieveBlockChildren(notionKey, pageId, "", 1)
+	}
+	if err := requestError(err); err != nil {
+		return caps, err
+	}
+	switch {
+	case IsNotShared(err):
+		caps.Shared = false
+		// nothing else can be told of a page not shared
+		return caps, nil
+	case IsRestricted(err):
+		caps.ReadContent = false
+	}
+
+	err = c.api.AppendBlockChildren(notionKey, pageId, []*core.Block{})
+	if err := requestError(err); err != nil {
+		return caps, err
+	}
+	if IsRestricted(err) {
+		caps.InsertContent = false
+	}
+	return caps, nil
+}
+
+// requestError is err of a probe if the request failed, nil if notion
+// answered. Errors other than an access one, e.g. a validation error, tell
+// nothing of the capability and are only logged.
+func requestError(err error) error {
+	var e *APIError
+	if err == nil || !errors.As(err, &e) {
+		return err
+	}
+	if !IsNotShared(err) && !IsRestricted(err) {
+		log.Warnf("capability probe got no answer of access. err=%v", err)
+	}
+	return nil
+}
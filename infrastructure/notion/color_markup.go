@@ -0,0 +1,101 @@
+package notion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+// ColorMarkupBraces is the preset color markup `{red:important}`
+const ColorMarkupBraces = "braces"
+
+var colorMarkupPresets = map[string]string{
+	ColorMarkupBraces: `\{(?P<color>[A-Za-z_]+):(?P<text>[^{}]+)\}`,
+}
+
+// the colors of notion rich text
+var textColors = map[string]bool{
+	"default": true, "gray": true, "brown": true, "orange": true, "yellow": true,
+	"green": true, "blue": true, "purple": true, "pink": true, "red": true,
+	"gray_background": true, "brown_background": true, "orange_background": true,
+	"yellow_background": true, "green_background": true, "blue_background": true,
+	"purple_background": true, "pink_background": true, "red_background": true,
+}
+
+// compileColorMarkup compiles markup, a preset or a regexp with the groups
+// color and text, nil if it's empty
+func compileColorMarkup(markup string) (*regexp.Regexp, error) {
+	if markup == "" {
+		return nil, nil
+	}
+	if preset, ok := colorMarkupPresets[markup]; ok {
+		markup = preset
+	}
+
+	re, err := regexp.Compile(markup)
+	if err != nil {
+		return nil, err
+	}
+	if re.SubexpIndex("color") < 0 || re.SubexpIndex("text") < 0 {
+		return nil, fmt.Errorf("color markup %s should have the groups color and text", markup)
+	}
+	return re, nil
+}
+
+type colorSegment struct {
+	Text string
+	// empty if it's no markup
+	Color string
+}
+
+// colorSegments splits text on the color markup, the markup of an unknown
+// color is the default color
+func colorSegments(re *regexp.Regexp, text string) []colorSegment {
+	var segments []colorSegment
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > last {
+			segments = append(segments, colorSegment{Text: text[last:m[0]]})
+		}
+		color := strings.ToLower(submatch(re, text, m, "color"))
+		if !textColors[color] {
+			color = "default"
+		}
+		segments = append(segments, colorSegment{Text: submatch(re, text, m, "text"), Color: color})
+		last = m[1]
+	}
+	if last < len(text) {
+		segments = append(segments, colorSegment{Text: text[last:]})
+	}
+	return segments
+}
+
+func submatch(re *regexp.Regexp, text string, m []int, name string) string {
+	i := re.SubexpIndex(name)
+	if m[2*i] < 0 {
+		return ""
+	}
+	return text[m[2*i]:m[2*i+1]]
+}
+
+// coloredRichText is styledRichText of text in the colors of its markup,
+// the tags in it are still highlighted
+func (c *NotionClient) coloredRichText(text string) core.RichTextArrary {
+	if c.colorMarkup == nil {
+		return styledRichText(text)
+	}
+
+	var texts core.RichTextArrary
+	for _, segment := range colorSegments(c.colorMarkup, text) {
+		styled := styledRichText(segment.Text)
+		for i := range styled {
+			if segment.Color != "" && styled[i].Annotations.Color == "default" {
+				styled[i].Annotations.Color = segment.Color
+			}
+		}
+		texts = append(texts, styled...)
+	}
+	return texts
+}
@@ -0,0 +1,75 @@
+package notion
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type coloredText struct {
+	Text  string
+	Color string
+}
+
+func TestColorMarkup(t *testing.T) {
+	cases := []struct {
+		Markup   string
+		Content  string
+		Expected []coloredText
+	}{
+		{
+			Markup:   ColorMarkupBraces,
+			Content:  "这是{red:重点}和{Blue_Background:背景}",
+			Expected: []coloredText{{"这是", "default"}, {"重点", "red"}, {"和", "default"}, {"背景", "blue_background"}},
+		},
+		// unknown colors fall back to the default
+		{
+			Markup:   ColorMarkupBraces,
+			Content:  "{magenta:重点}",
+			Expected: []coloredText{{"重点", "default"}},
+		},
+		// tags in it are still highlighted
+		{
+			Markup:   ColorMarkupBraces,
+			Content:  "{green:完成 #todo}",
+			Expected: []coloredText{{"完成 ", "green"}, {"#todo", "blue"}},
+		},
+		{
+			Markup:   `\[\[(?P<color>\w+)\|(?P<text>[^\]]+)\]\]`,
+			Content:  "[[orange|注意]] {red:不是}",
+			Expected: []coloredText{{"注意", "orange"}, {" {red:不是}", "default"}},
+		},
+		// off
+		{
+			Content:  "{red:重点}",
+			Expected: []coloredText{{"{red:重点}", "default"}},
+		},
+		// invalid markup is off
+		{
+			Markup:   `\{(?P<color>\w+)\}`,
+			Content:  "{red}",
+			Expected: []coloredText{{"{red}", "default"}},
+		},
+	}
+	for _, tc := range cases {
+		client := NewNotionClient(ClientOption{ColorMarkup: tc.Markup})
+		blocks := client.contentBlocks(tc.Content, time.Now())
+		if len(blocks) != 1 {
+			t.Fatalf("content: %s, expected a paragraph, got %+v", tc.Content, blocks)
+		}
+		var got []coloredText
+		for _, text := range blocks[0].ParagraphBlock.Text {
+			got = append(got, coloredText{text.Text.Content, text.Annotations.Color})
+		}
+		if !reflect.DeepEqual(got, tc.Expected) {
+			t.Fatalf("markup: %s, content: %s, expected %+v, got %+v", tc.Markup, tc.Content, tc.Expected, got)
+		}
+	}
+}
+
+func TestColorMarkupTitle(t *testing.T) {
+	client := NewNotionClient(ClientOption{ColorMarkup: ColorMarkupBraces, TitleMaxLength: 20})
+	if title := client.pageTitle("{red:重点} 明天交"); title != "重点 明天交" {
+		t.Fatalf("expected the title without markup, got %q", title)
+	}
+}
@@ -0,0 +1,217 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+const typeMention = "mention"
+
+// DateParser finds the dates in text, the relative ones counted from now
+type DateParser interface {
+	ParseDates(text string, now time.Time) []DateMatch
+}
+
+// DateMatch is the date written as text[Start:End]
+type DateMatch struct {
+	Start int
+	End   int
+	Date  time.Time
+	// the time of day is given too
+	HasTime bool
+}
+
+var (
+	// 2024-06-01, 2024/6/1, 2024年6月1日 or 今天/明天/后天,
+	// followed by an optional 15:00 or 下午3点(半|20分)
+	dateRegexp = regexp.MustCompile(`(?:(\d{4})[-/](\d{1,2})[-/](\d{1,2})|(\d{4})年(\d{1,2})月(\d{1,2})[日号]|(今天|明天|后天))` +
+		`(?:[ T]?(\d{1,2}):(\d{2})|\s*(上午|中午|下午|晚上)?(\d{1,2})[点时](半|(\d{1,2})分)?)?`)
+	relativeDays = map[string]int{"今天": 0, "明天": 1, "后天": 2}
+)
+
+// defaultDateParser knows the dates of dateRegexp, in the location of now
+type defaultDateParser struct{}
+
+func (defaultDateParser) ParseDates(text string, now time.Time) []DateMatch {
+	var matches []DateMatch
+	for _, loc := range dateRegexp.FindAllStringSubmatchIndex(text, -1) {
+		group := func(i int) string {
+			if loc[2*i] < 0 {
+				return ""
+			}
+			return text[loc[2*i]:loc[2*i+1]]
+		}
+		// not a part of a longer number
+		if r, _ := utf8.DecodeLastRuneInString(text[:loc[0]]); unicode.IsDigit(r) {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(text[loc[1]:]); unicode.IsDigit(r) {
+			continue
+		}
+
+		var year, month, day int
+		switch {
+		case group(1) != "":
+			year, month, day = atoi(group(1)), atoi(group(2)), atoi(group(3))
+		case group(4) != "":
+			year, month, day = atoi(group(4)), atoi(group(5)), atoi(group(6))
+		default:
+			d := now.AddDate(0, 0, relativeDays[group(7)])
+			year, month, day = d.Year(), int(d.Month()), d.Day()
+		}
+
+		hour, minute, hasTime := 0, 0, true
+		switch {
+		case group(8) != "":
+			hour, minute = atoi(group(8)), atoi(group(9))
+		case group(11) != "":
+			hour = atoi(group(11))
+			if period := group(10); period != "" && period != "上午" && hour < 12 {
+				hour += 12
+			}
+			if group(12) == "半" {
+				minute = 30
+			} else if group(13) != "" {
+				minute = atoi(group(13))
+			}
+		default:
+			hasTime = false
+		}
+		if hour > 23 || minute > 59 {
+			continue
+		}
+
+		date := time.Date(year, time.Month(month), day, hour, minute, 0, 0, now.Location())
+		// 2024-02-30 isn't a date
+		if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+			continue
+		}
+		matches = append(matches, DateMatch{Start: loc[0], End: loc[1], Date: date, HasTime: hasTime})
+	}
+	return matches
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// dateParser is the parser of date mentions, nil if they're off
+func (c *NotionClient) dateParser() DateParser {
+	if !c.option.DateMentions {
+		return nil
+	}
+	if c.option.DateParser != nil {
+		return c.option.DateParser
+	}
+	return defaultDateParser{}
+}
+
+// withDateMentions splits the dates out of the text objects of texts as
+// date mentions with the same annotations, the rest of the text is kept.
+func (c *NotionClient) withDateMentions(texts core.RichTextArrary, now time.Time) core.RichTextArrary {
+	parser := c.dateParser()
+	if parser == nil {
+		return texts
+	}
+
+	var result core.RichTextArrary
+	for _, text := range texts {
+		if text.Type != core.TYPE_TEXT || text.Text == nil || text.Text.Link != "" {
+			result = append(result, text)
+			continue
+		}
+
+		content := text.Text.Content
+		matches := parser.ParseDates(content, now)
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+		last := 0
+		for _, match := range matches {
+			if match.Start < last || match.End > len(content) || match.Start >= match.End {
+				continue
+			}
+			if match.Start > last {
+				result = append(result, textWith(text, content[last:match.Start]))
+			}
+			result = append(result, dateMention(content[match.Start:match.End], match, text.Annotations))
+			last = match.End
+		}
+		if last == 0 {
+			result = append(result, text)
+		} else if last < len(content) {
+			result = append(result, textWith(text, content[last:]))
+		}
+	}
+	return result
+}
+
+func textWith(text core.RichTextObject, content string) core.RichTextObject {
+	text.Text = &core.TextObject{Content: content}
+	return text
+}
+
+// dateMention is a mention of the date of match, which core.RichTextObject
+// can't hold. It's sent as a mention with the date as the href and the
+// text it's written as, rewritten into a date mention by encodeMentions.
+func dateMention(content string, match DateMatch, annotations *core.AnnotationObject) core.RichTextObject {
+	start := match.Date.Format("2006-01-02")
+	if match.HasTime {
+		start = match.Date.Format(time.RFC3339)
+	}
+
+	return core.RichTextObject{
+		Type:        typeMention,
+		Href:        start,
+		Annotations: annotations,
+		Text:        &core.TextObject{Content: content},
+	}
+}
+
+// encodeMentions rewrites the mentions of dateMention in payload into
+// the date mentions of the notion api.
+func encodeMentions(payload []byte) ([]byte, error) {
+	if !bytes.Contains(payload, []byte(`"type":"mention"`)) {
+		return payload, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// keep the numbers as they are
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	rewriteMentions(v)
+	return json.Marshal(v)
+}
+
+func rewriteMentions(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if start, ok := v["href"].(string); ok && v["type"] == typeMention && v["mention"] == nil {
+			v["mention"] = map[string]interface{}{
+				"type": typeDate,
+				"date": map[string]interface{}{"start": start},
+			}
+			delete(v, "href")
+			delete(v, "text")
+			return
+		}
+		for _, child := range v {
+			rewriteMentions(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			rewriteMentions(child)
+		}
+	}
+}
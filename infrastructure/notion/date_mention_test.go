@@ -0,0 +1,107 @@
+package notion
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDates(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2024, 5, 31, 10, 0, 0, 0, loc)
+
+	cases := []struct {
+		Text    string
+		Matched string
+		Start   string
+	}{
+		{Text: "review at 2024-06-01 15:00 ok", Matched: "2024-06-01 15:00", Start: "2024-06-01T15:00:00+08:00"},
+		{Text: "due 2024/6/1", Matched: "2024/6/1", Start: "2024-06-01"},
+		{Text: "2024年6月3日上午9点半开会", Matched: "2024年6月3日上午9点半", Start: "2024-06-03T09:30:00+08:00"},
+		{Text: "明天下午3点 开会", Matched: "明天下午3点", Start: "2024-06-01T15:00:00+08:00"},
+		{Text: "后天晚上8点20分", Matched: "后天晚上8点20分", Start: "2024-06-02T20:20:00+08:00"},
+		{Text: "今天 交周报", Matched: "今天", Start: "2024-05-31"},
+		// not dates
+		{Text: "2024-02-30 or 2024-06-01 25:00"},
+		{Text: "order 120240601 shipped"},
+	}
+	for _, tc := range cases {
+		matches := defaultDateParser{}.ParseDates(tc.Text, now)
+		if tc.Matched == "" {
+			if len(matches) != 0 {
+				t.Fatalf("text: %s, expected no dates, got %+v", tc.Text, matches)
+			}
+			continue
+		}
+		if len(matches) != 1 {
+			t.Fatalf("text: %s, expected one date, got %+v", tc.Text, matches)
+		}
+		match := matches[0]
+		start := match.Date.Format("2006-01-02")
+		if match.HasTime {
+			start = match.Date.Format(time.RFC3339)
+		}
+		if matched := tc.Text[match.Start:match.End]; matched != tc.Matched || start != tc.Start {
+			t.Fatalf("text: %s, expected %s at %s, got %s at %s", tc.Text, tc.Matched, tc.Start, matched, start)
+		}
+	}
+}
+
+type fakeDateParser struct {
+	date time.Time
+}
+
+func (p fakeDateParser) ParseDates(text string, now time.Time) []DateMatch {
+	i := strings.Index(text, "someday")
+	if i < 0 {
+		return nil
+	}
+	return []DateMatch{{Start: i, End: i + len("someday"), Date: p.date}}
+}
+
+func TestDateMentions(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(testSchema))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	parser := fakeDateParser{date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, DateMentions: true, DateParser: parser})
+	if _, err := client.AddNewPage2Database("secret", "db_xxx", "#计划 call mom someday, ok", PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`"content":" call mom "`,
+		`"mention":{"date":{"start":"2024-06-01"},"type":"date"},"type":"mention"`,
+		`"content":", ok"`,
+		`"name":"计划"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s, got %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "someday") {
+		t.Fatalf("expected the date as a mention only, got %s", body)
+	}
+
+	// off by default
+	client = NewNotionClient(ClientOption{BaseURI: server.URL, DateParser: parser})
+	if _, err := client.AddNewPage2Database("secret", "db_xxx", "call mom someday", PageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body, typeMention) || !strings.Contains(body, "call mom someday") {
+		t.Fatalf("expected no mentions, got %s", body)
+	}
+}
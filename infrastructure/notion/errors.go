@@ -0,0 +1,60 @@
+package notion
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	codeObjectNotFound     = "object_not_found"
+	codeRestrictedResource = "restricted_resource"
+)
+
+// APIError is a failed response of the notion api
+type APIError struct {
+	StatusCode int
+	Status     string
+	// error code and message in the body, e.g. object_not_found
+	Code    string
+	Message string
+	Body    string
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+
+	var data struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &data); err == nil {
+		e.Code, e.Message = data.Code, data.Message
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("code=%d, status=%s, body=%s", e.StatusCode, e.Status, e.Body)
+}
+
+// IsNotShared reports whether err is caused by a page or database
+// that isn't shared with the integration at all.
+func IsNotShared(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.Code == codeObjectNotFound
+}
+
+// IsRestricted reports whether err is caused by a page or database
+// shared with the integration without the permission needed, e.g.
+// it can read but not write.
+func IsRestricted(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) &&
+		(e.Code == codeRestrictedResource || (e.Code == "" && e.StatusCode == http.StatusForbidden))
+}
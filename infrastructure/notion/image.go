@@ -0,0 +1,40 @@
+package notion
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+const blockImage = "image"
+
+// a line of a markdown image of an external url
+var imageLine = regexp.MustCompile(`^!\[[^\]]*\]\((https?://[^\s)]+)\)$`)
+
+// splitImages splits the lines of markdown images out of content as image
+// blocks, returning the rest of content
+func splitImages(content string) ([]core.Block, string) {
+	if !strings.Contains(content, "![") {
+		return nil, content
+	}
+
+	var images []core.Block
+	var rest []string
+	for _, line := range strings.Split(content, "\n") {
+		m := imageLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			rest = append(rest, line)
+			continue
+		}
+		images = append(images, core.Block{
+			Object: core.OBJECT_BLOCK,
+			Type:   blockImage,
+			ImageBlock: &core.ImageBlock{FileObject: core.FileObject{
+				Type:         "external",
+				ExternalFile: &core.ExternalFile{URL: m[1]},
+			}},
+		})
+	}
+	return images, strings.TrimSpace(strings.Join(rest, "\n"))
+}
@@ -0,0 +1,89 @@
+package notion
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitImages(t *testing.T) {
+	cases := []struct {
+		Content string
+		Images  []string
+		Rest    string
+	}{
+		{"no images", nil, "no images"},
+		{"![image](https://img.example.com/a)", []string{"https://img.example.com/a"}, ""},
+		{"caption\n![image](https://img.example.com/a)\n![](http://img.example.com/b)", []string{"https://img.example.com/a", "http://img.example.com/b"}, "caption"},
+		// only whole lines of external images
+		{"see ![image](https://img.example.com/a)", nil, "see ![image](https://img.example.com/a)"},
+		{"![image](img_xxx)", nil, "![image](img_xxx)"},
+	}
+	for _, tc := range cases {
+		images, rest := splitImages(tc.Content)
+		if rest != tc.Rest || len(images) != len(tc.Images) {
+			t.Fatalf("content: %q, expected %v and %q, got %+v and %q", tc.Content, tc.Images, tc.Rest, images, rest)
+		}
+		for i, img := range images {
+			if img.Type != blockImage || img.ImageBlock.ExternalFile.URL != tc.Images[i] {
+				t.Fatalf("content: %q, expected image %s, got %+v", tc.Content, tc.Images[i], img.ImageBlock)
+			}
+		}
+	}
+}
+
+func TestAppendBlockImages(t *testing.T) {
+	var appended string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPatch:
+			data, _ := ioutil.ReadAll(r.Body)
+			appended = string(data)
+			w.Write([]byte(`{"object": "list", "results": []}`))
+		case strings.HasPrefix(r.URL.Path, "/pages/"):
+			w.Write([]byte(`{"object": "page", "id": "page_xxx", "last_edited_time": "` +
+				time.Now().UTC().Format(time.RFC3339) + `"}`))
+		default:
+			w.Write([]byte(`{"object": "list", "results": [{"object": "block", "type": "paragraph"}]}`))
+		}
+	}))
+	defer server.Close()
+	client := NewNotionClient(ClientOption{BaseURI: server.URL})
+
+	cases := []struct {
+		Content string
+		Items   int
+	}{
+		{"caption\n![image](https://img.example.com/a)", 1},
+		// no empty list item
+		{"![image](https://img.example.com/a)", 0},
+	}
+	for _, tc := range cases {
+		if err := client.AppendBlock("secret", "page_xxx", tc.Content); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(appended, `"bulleted_list_item":`) != tc.Items || strings.Contains(appended, "![image]") ||
+			!strings.Contains(appended, `"url":"https://img.example.com/a"`) {
+			t.Fatalf("content: %q, expected an image block after %d items, got %s", tc.Content, tc.Items, appended)
+		}
+	}
+	if err := client.AppendScratch("secret", "page_xxx", "---", "![image](https://img.example.com/a)"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(appended, "![image]") || !strings.Contains(appended, `"url":"https://img.example.com/a"`) {
+		t.Fatalf("expected an image block of the scratch page, got %s", appended)
+	}
+}
+
+func TestImageTitle(t *testing.T) {
+	client := NewNotionClient(ClientOption{TitleMaxLength: 20})
+	if title := client.pageTitle("周末爬山\n![image](https://img.example.com/a)"); title != "周末爬山" {
+		t.Fatalf("expected the title without the image, got %q", title)
+	}
+	if title := client.pageTitle("![image](https://img.example.com/a)"); title != "" {
+		t.Fatalf("expected no title of an image, got %q", title)
+	}
+}
@@ -0,0 +1,53 @@
+package notion
+
+import "github.com/KDF5000/notion-sdk-go/core"
+
+// maxAppendBlocks is the most children notion takes in a request, to create
+// a page or to append to one
+const maxAppendBlocks = 100
+
+// appendBlocks appends blocks to page pageId, in requests of at most
+// maxAppendBlocks
+func (c *NotionClient) appendBlocks(notionKey, pageId string, blocks []core.Block) error {
+	for start := 0; start < len(blocks); start += maxAppendBlocks {
+		end := start + maxAppendBlocks
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		children := make([]*core.Block, 0, end-start)
+		for i := start; i < end; i++ {
+			children = append(children, &blocks[i])
+		}
+		if err := c.api.AppendBlockChildren(notionKey, pageId, children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createLinkPage creates page title under page parentId with the blocks of
+// entries, the ones over what notion takes at once are appended after.
+func (c *NotionClient) createLinkPage(notionKey, parentId, title string, entries []WeeklyEntry) (string, error) {
+	blocks := weeklyBlocks(entries)
+	first := blocks
+	if len(first) > maxAppendBlocks {
+		first = first[:maxAppendBlocks]
+	}
+	id, err := c.createSubpage(notionKey, parentId, title, first)
+	if err != nil {
+		return "", err
+	}
+	return id, c.appendBlocks(notionKey, id, blocks[len(first):])
+}
+
+// CreateIndexPage creates index page title under page parentId with links
+// to the pages of entries
+func (c *NotionClient) CreateIndexPage(notionKey, parentId, title string, entries []WeeklyEntry) (string, error) {
+	return c.createLinkPage(notionKey, parentId, title, entries)
+}
+
+// AppendIndexLinks appends links to the pages of entries to index page
+// pageId
+func (c *NotionClient) AppendIndexLinks(notionKey, pageId string, entries []WeeklyEntry) error {
+	return c.appendBlocks(notionKey, pageId, weeklyBlocks(entries))
+}
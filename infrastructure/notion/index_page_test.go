@@ -0,0 +1,52 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAppendIndexLinks(t *testing.T) {
+	var created string
+	var appended []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var body struct {
+			Children []json.RawMessage `json:"children"`
+		}
+		json.Unmarshal(data, &body)
+		if r.Method == http.MethodPost {
+			created = string(data)
+		} else {
+			appended = append(appended, len(body.Children))
+		}
+		w.Write([]byte(`{"object": "page", "id": "index_xxx"}`))
+	}))
+	defer server.Close()
+
+	entries := make([]WeeklyEntry, 250)
+	for i := range entries {
+		entries[i] = WeeklyEntry{Content: fmt.Sprintf("memo %d", i), PageID: fmt.Sprintf("page-%d", i)}
+	}
+	client := NewNotionClient(ClientOption{BaseURI: server.URL})
+	id, err := client.CreateIndexPage("secret", "parent_xxx", "Memo Index", entries)
+	if err != nil || id != "index_xxx" {
+		t.Fatalf("expected index_xxx, got %s, %v", id, err)
+	}
+	// notion takes 100 children a request
+	if fmt.Sprint(appended) != "[100 50]" || strings.Count(created, `"bulleted_list_item":`) != 100 {
+		t.Fatalf("expected 100 links created and the rest appended in chunks, got %d, %v", strings.Count(created, `"bulleted_list_item":`), appended)
+	}
+	if !strings.Contains(created, `"text":{"content":"memo 0","link":{"url":"https://www.notion.so/page0"}}`) {
+		t.Fatalf("expected a link object, got %s", created)
+	}
+
+	appended = nil
+	if err := client.AppendIndexLinks("secret", "index_xxx", entries[:1]); err != nil || fmt.Sprint(appended) != "[1]" {
+		t.Fatalf("expected a link appended, got %v, %v", appended, err)
+	}
+}
@@ -0,0 +1,157 @@
+package notion
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultLinkPreviewTimeout  = 3 * time.Second
+	DefaultLinkPreviewMaxBytes = 512 << 10
+	// redirects followed to the linked page
+	maxLinkPreviewRedirects = 3
+)
+
+// the links are sent by anyone in the chats, the internal addresses of the
+// server mustn't be read into their pages
+var nonPublicNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// publicIP reports whether ip is an internet address, not a loopback,
+// private, link-local or unspecified one
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func checkPreviewURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme of %s isn't http or https", u.Redacted())
+	}
+	return nil
+}
+
+var (
+	ogTitleRegexp = regexp.MustCompile(`(?is)<meta\s[^>]*property=["']og:title["'][^>]*content=["']([^"']*)["']`)
+	titleRegexp   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// linkPreviewer reads the titles of linked pages on public addresses
+type linkPreviewer struct {
+	client   *http.Client
+	maxBytes int64
+	// whether an address may be connected to, publicIP unless in tests
+	allowIP func(ip net.IP) bool
+}
+
+func newLinkPreviewer(timeout time.Duration, maxBytes int64) *linkPreviewer {
+	if timeout <= 0 {
+		timeout = DefaultLinkPreviewTimeout
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultLinkPreviewMaxBytes
+	}
+
+	p := &linkPreviewer{maxBytes: maxBytes, allowIP: publicIP}
+	// checked on connecting, after the name is resolved, for every redirect
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !p.allowIP(ip) {
+				return fmt.Errorf("address %s isn't public", host)
+			}
+			return nil
+		},
+	}
+	p.client = &http.Client{
+		Timeout: timeout,
+		// no proxy, it would be the one connected to
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxLinkPreviewRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkPreviewURL(req.URL)
+		},
+	}
+	return p
+}
+
+// Title returns the og:title or the title of the html page of link,
+// read from its first maxBytes bytes.
+func (p *linkPreviewer) Title(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if err := checkPreviewURL(u); err != nil {
+		return "", err
+	}
+
+	resp, err := p.client.Get(link)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get %s error, status=%s", link, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "html") {
+		return "", fmt.Errorf("%s isn't a html page, content type %s", link, ct)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, p.maxBytes))
+	if err != nil {
+		return "", err
+	}
+
+	for _, re := range []*regexp.Regexp{ogTitleRegexp, titleRegexp} {
+		if m := re.FindSubmatch(data); m != nil {
+			if title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " "); title != "" {
+				return title, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no title in the first %d bytes of %s", p.maxBytes, link)
+}
@@ -0,0 +1,107 @@
+package notion
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLinkServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/title":
+			w.Write([]byte("<html><head><TITLE>\n  Go &amp; Notion\n</TITLE></head></html>"))
+		case "/og":
+			w.Write([]byte(`<html><head><title>ignored</title><meta property="og:title" content="微信文章"></head></html>`))
+		case "/large":
+			w.Write([]byte("<html>" + strings.Repeat(" ", 2048) + "<title>too far</title></html>"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("<title>png</title>"))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("<title>slow</title>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestLinkPreviewTitle(t *testing.T) {
+	server := newTestLinkServer()
+	defer server.Close()
+
+	p := newLinkPreviewer(100*time.Millisecond, 1024)
+	// the test server is on a loopback address
+	p.allowIP = func(net.IP) bool { return true }
+	for path, expected := range map[string]string{"/title": "Go & Notion", "/og": "微信文章"} {
+		title, err := p.Title(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if title != expected {
+			t.Fatalf("path: %s, expected %s, got %s", path, expected, title)
+		}
+	}
+
+	for _, path := range []string{"/large", "/image", "/slow", "/missing"} {
+		if title, err := p.Title(server.URL + path); err == nil {
+			t.Fatalf("path: %s, expected error, got %s", path, title)
+		}
+	}
+}
+
+func TestBookmarkPreview(t *testing.T) {
+	server := newTestLinkServer()
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{Bookmarks: true, LinkPreviews: true, LinkPreviewTimeout: 100 * time.Millisecond})
+	client.links.allowIP = func(net.IP) bool { return true }
+	if caption := plainText(&client.bookmark(server.URL + "/title").Cpation); caption != "Go & Notion" {
+		t.Fatalf("expected bookmark captioned with the title, got %s", caption)
+	}
+
+	// fallback to a plain link
+	bookmark := client.bookmark(server.URL + "/missing")
+	if bookmark.Url != server.URL+"/missing" || len(bookmark.Cpation) != 0 {
+		t.Fatalf("expected plain bookmark, got %+v", bookmark)
+	}
+}
+
+func TestLinkPreviewPublicOnly(t *testing.T) {
+	server := newTestLinkServer()
+	defer server.Close()
+	// redirects to the test server on a loopback address
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/title", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	p := newLinkPreviewer(100*time.Millisecond, 1024)
+	for _, link := range []string{server.URL + "/title", "http://169.254.169.254/latest/meta-data/", "file:///etc/passwd"} {
+		if title, err := p.Title(link); err == nil {
+			t.Fatalf("link: %s, expected refused, got %s", link, title)
+		}
+	}
+
+	// every hop is checked, only the first one is let through here
+	var dialed []string
+	p.allowIP = func(ip net.IP) bool { dialed = append(dialed, ip.String()); return len(dialed) == 1 }
+	if title, err := p.Title(redirect.URL); err == nil {
+		t.Fatalf("expected the redirect refused, got %s", title)
+	}
+	if len(dialed) != 2 {
+		t.Fatalf("expected both hops checked, got %v", dialed)
+	}
+
+	for ip, public := range map[string]bool{"127.0.0.1": false, "10.1.2.3": false, "172.20.0.1": false,
+		"192.168.1.1": false, "169.254.169.254": false, "::1": false, "fd00::1": false, "0.0.0.0": false,
+		"8.8.8.8": true, "2001:4860:4860::8888": true} {
+		if publicIP(net.ParseIP(ip)) != public {
+			t.Fatalf("ip: %s, expected public %v", ip, public)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package notion
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+const blockTodo = "to_do"
+
+var (
+	// - [ ] item, - [x] done
+	taskItemRegexp = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*)$`)
+	// - item
+	bulletItemRegexp = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+)
+
+// hasMarkdownList reports whether any line of content is a list item
+func hasMarkdownList(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if bulletItemRegexp.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownBlocks converts content line by line, task list items become
+// to_do blocks, the other list items become bulleted list items, and
+// consecutive remaining lines are kept in one paragraph.
+func markdownBlocks(content string, richText func(string) core.RichTextArrary) []core.Block {
+	var blocks []core.Block
+	var paragraph []string
+	flush := func() {
+		if text := strings.TrimSpace(strings.Join(paragraph, "\n")); text != "" {
+			blocks = append(blocks, core.Block{
+				Object:         core.OBJECT_BLOCK,
+				Type:           core.BLOCK_PARAGRAPH,
+				ParagraphBlock: &core.ParagraphBlock{Text: richText(text)},
+			})
+		}
+		paragraph = paragraph[:0]
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if m := taskItemRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			checked := m[1] != " "
+			blocks = append(blocks, core.Block{
+				Object: core.OBJECT_BLOCK,
+				Type:   blockTodo,
+				TodoBlockBlock: &core.TodoBlock{
+					Text:    richText(strings.TrimSpace(m[2])),
+					Checked: &checked,
+				},
+			})
+			continue
+		}
+
+		if m := bulletItemRegexp.FindStringSubmatch(line); m != nil {
+			flush()
+			blocks = append(blocks, core.Block{
+				Object:                core.OBJECT_BLOCK,
+				Type:                  core.BLOCK_BULLETED_LIST_ITEM,
+				BulletedListItemBlock: &core.ListItemBlock{Text: richText(strings.TrimSpace(m[1]))},
+			})
+			continue
+		}
+
+		paragraph = append(paragraph, line)
+	}
+	flush()
+
+	return blocks
+}
@@ -0,0 +1,124 @@
+package notion
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+type testBlock struct {
+	Type    string
+	Text    string
+	Checked bool
+}
+
+func blockText(texts core.RichTextArrary) string {
+	return plainText(&texts)
+}
+
+func toTestBlocks(blocks []core.Block) []testBlock {
+	var res []testBlock
+	for _, b := range blocks {
+		tb := testBlock{Type: b.Type}
+		switch b.Type {
+		case core.BLOCK_PARAGRAPH:
+			tb.Text = blockText(b.ParagraphBlock.Text)
+		case core.BLOCK_BULLETED_LIST_ITEM:
+			tb.Text = blockText(b.BulletedListItemBlock.Text)
+		case blockTodo:
+			tb.Text = blockText(b.TodoBlockBlock.Text)
+			tb.Checked = *b.TodoBlockBlock.Checked
+		}
+		res = append(res, tb)
+	}
+	return res
+}
+
+func TestMarkdownBlocks(t *testing.T) {
+	cases := []struct {
+		Content string
+		Blocks  []testBlock
+	}{
+		{
+			Content: "- [ ] todo\n- [x] done\n* [X] also done",
+			Blocks: []testBlock{
+				{Type: blockTodo, Text: "todo"},
+				{Type: blockTodo, Text: "done", Checked: true},
+				{Type: blockTodo, Text: "also done", Checked: true},
+			},
+		},
+		{
+			Content: "plans #work\nfor today\n- [ ] write doc\n- buy milk\n  - [x] review\nthat's all",
+			Blocks: []testBlock{
+				{Type: core.BLOCK_PARAGRAPH, Text: "plans #work\nfor today"},
+				{Type: blockTodo, Text: "write doc"},
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "buy milk"},
+				{Type: blockTodo, Text: "review", Checked: true},
+				{Type: core.BLOCK_PARAGRAPH, Text: "that's all"},
+			},
+		},
+		{
+			// not a task without text after the box
+			Content: "- [] item\n-no space",
+			Blocks: []testBlock{
+				{Type: core.BLOCK_BULLETED_LIST_ITEM, Text: "[] item"},
+				{Type: core.BLOCK_PARAGRAPH, Text: "-no space"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		blocks := toTestBlocks(markdownBlocks(tc.Content, styledRichText))
+		if len(blocks) != len(tc.Blocks) {
+			t.Fatalf("content: %q, expected %+v, got %+v", tc.Content, tc.Blocks, blocks)
+		}
+		for i := range blocks {
+			if blocks[i] != tc.Blocks[i] {
+				t.Fatalf("content: %q, expected %+v, got %+v", tc.Content, tc.Blocks[i], blocks[i])
+			}
+		}
+	}
+}
+
+func TestAddNewPage2DatabaseTaskList(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(testSchema))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	content := "plans\n- [ ] todo\n- [x] done\n- note"
+	for _, enabled := range []bool{true, false} {
+		client := NewNotionClient(ClientOption{BaseURI: server.URL, MarkdownLists: enabled})
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", content, PageOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		var page core.Page
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		blocks := toTestBlocks(page.Children)
+		if !enabled {
+			if len(blocks) != 1 || blocks[0].Text != content {
+				t.Fatalf("expected one paragraph, got %+v", blocks)
+			}
+			continue
+		}
+		if len(blocks) != 4 || blocks[1].Type != blockTodo || blocks[1].Checked ||
+			!blocks[2].Checked || blocks[3].Type != core.BLOCK_BULLETED_LIST_ITEM {
+			t.Fatalf("unexpected blocks %+v", blocks)
+		}
+	}
+}
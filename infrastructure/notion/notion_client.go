@@ -2,25 +2,199 @@ package notion
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/KDF5000/pkg/log"
+	"github.com/patrickmn/go-cache"
+
 	"github.com/KDF5000/nomo/infrastructure/utils"
 	"github.com/KDF5000/notion-sdk-go/core"
 )
 
-type NotionClient struct{}
+const (
+	DefaultTitleProperty = "Name"
+	DefaultUserAgent     = "nomo"
 
-func (c *NotionClient) AppendBlock(notionKey, pageId, content string) error {
-	client, err := core.NewClient(&core.Option{SecretKey: notionKey})
+	typeRichText  = "rich_text"
+	typeNumber    = "number"
+	typeDate      = "date"
+	typePeople    = "people"
+	blockBookmark = "bookmark"
+)
+
+type ClientOption struct {
+	// notion api base uri, core.BASE_URI if empty
+	BaseURI string
+	// max runes of the page title derived from content,
+	// 0 means leave the title empty
+	TitleMaxLength int
+	// title property of databases, DefaultTitleProperty if empty.
+	// the real one is detected from the schema if it's wrong
+	TitleProperty string
+	// suffix derived titles taken in the database: TitleDedupNumber or
+	// TitleDedupTimestamp, which costs a query of the database, off if empty
+	TitleDedup string
+	// convert markdown list items, including task lists, to notion blocks
+	MarkdownLists bool
+	// convert runs of lines of at most this many runes in gallery pages to
+	// bulleted list items, longer lines are prose kept as paragraphs, 0
+	// disables it
+	AutoListMaxLength int
+	// markup of colored text in gallery pages, ColorMarkupBraces for
+	// `{red:important}` or a regexp with the groups color and text, off if
+	// empty or invalid
+	ColorMarkup string
+	// identifies nomo to notion, DefaultUserAgent if empty
+	UserAgent string
+	// add a bookmark for each link in gallery pages
+	Bookmarks bool
+	// links differing only by the trailing slash or the fragment get one bookmark
+	LooseLinkMatch bool
+	// caption bookmarks with the titles of the linked pages, which costs a
+	// fetch of each page, bounded by the timeout and the max bytes read,
+	// the defaults if 0
+	LinkPreviews        bool
+	LinkPreviewTimeout  time.Duration
+	LinkPreviewMaxBytes int64
+	// create gallery pages at once without properties if the schema of the
+	// database isn't cached, and set them after the schema is read
+	LazySchema bool
+	// runes a tag is split on, e.g. ",;" makes `#a,b` tags a and b, off if empty
+	TagSeparators string
+	// case of tags, utils.TagCaseLower lowercases latin tags only, leaving
+	// cjk and other scripts and acronyms as they are, kept if empty
+	TagCase string
+	// add the sort, chat and number properties to databases missing them, which
+	// changes the schema of the user's database
+	CreateMissingProperties bool
+	// write dates in content, e.g. `2024-06-01 15:00` or `明天下午3点`, as notion
+	// date mentions, found by DateParser, the built-in formats if nil
+	DateMentions bool
+	DateParser   DateParser
+	// bounds of the pages related by tags: created within the window, at
+	// most the limit of them, the defaults if 0
+	RelatedWindow time.Duration
+	RelatedLimit  int
+	// tags written per page, DefaultMaxPageTags if 0, the rest are dropped
+	MaxPageTags int
+	// options of the Tags property a database takes, DefaultMaxTagOptions
+	// if 0, and how close of it TagOptions warns, 10 if 0
+	MaxTagOptions    int
+	TagOptionsMargin int
+}
+
+type NotionClient struct {
+	option ClientOption
+	api    *notionAPI
+	links  *linkPreviewer
+	// nil if there's no color markup
+	colorMarkup *regexp.Regexp
+	// database id => *Database
+	schemaCache *cache.Cache
+	// properties set in the background, page id => true until set
+	backfills   sync.WaitGroup
+	backfilling sync.Map
+}
+
+func NewNotionClient(opt ClientOption) *NotionClient {
+	if opt.TitleProperty == "" {
+		opt.TitleProperty = DefaultTitleProperty
+	}
+
+	colorMarkup, err := compileColorMarkup(opt.ColorMarkup)
 	if err != nil {
-		return err
+		log.Errorf("color markup is off. err=%v", err)
+	}
+
+	return &NotionClient{
+		option:      opt,
+		api:         newNotionAPI(opt.BaseURI, opt.UserAgent),
+		links:       newLinkPreviewer(opt.LinkPreviewTimeout, opt.LinkPreviewMaxBytes),
+		colorMarkup: colorMarkup,
+		schemaCache: cache.New(10*time.Minute, 30*time.Minute),
+	}
+}
+
+func (c *NotionClient) getSchema(notionKey, dbId string) (*Database, error) {
+	if db, ok := c.schemaCache.Get(dbId); ok {
+		return db.(*Database), nil
+	}
+
+	db, err := c.api.RetrieveDatabase(notionKey, dbId)
+	if err != nil {
+		return nil, err
 	}
 
+	c.schemaCache.Set(dbId, db, cache.DefaultExpiration)
+	return db, nil
+}
+
+// titleProperty returns the title property to use for database dbId,
+// empty if the database has none at all.
+func (c *NotionClient) titleProperty(notionKey, dbId string) string {
+	configured := c.option.TitleProperty
+	db, err := c.getSchema(notionKey, dbId)
+	if err != nil {
+		log.Warnf("failed to get schema of database %s, use title property %s. err=%v", dbId, configured, err)
+		return configured
+	}
+
+	name, ok := db.TitleProperty(configured)
+	if !ok {
+		log.Warnf("database %s has no title property, save without title", dbId)
+		return ""
+	}
+
+	if name != configured {
+		log.Warnf("title property %s not found in database %s, use %s instead", configured, dbId, name)
+	}
+	return name
+}
+
+// ensureProperty adds property of propType to database dbId if it's not in
+// the schema and CreateMissingProperties is on. A property of another
+// type is left as it is.
+func (c *NotionClient) ensureProperty(notionKey, dbId, property, propType string) error {
+	if !c.option.CreateMissingProperties {
+		return nil
+	}
+
+	db, err := c.getSchema(notionKey, dbId)
+	if err != nil {
+		// the write fails the same way if notion is unreachable
+		log.Warnf("failed to get schema of database %s, assume %s exists. err=%v", dbId, property, err)
+		return nil
+	}
+	if _, ok := db.Properties[property]; ok {
+		return nil
+	}
+
+	log.Infof("property %s not found in database %s, create it as %s", property, dbId, propType)
+	updated, err := c.api.UpdateDatabaseProperties(notionKey, dbId, map[string]interface{}{
+		property: map[string]interface{}{propType: struct{}{}},
+	})
+	if err != nil {
+		return fmt.Errorf("create property %s of database %s error, %w", property, dbId, err)
+	}
+
+	// a partial schema is read again next time
+	if updated.HasMore {
+		c.schemaCache.Delete(dbId)
+	} else {
+		c.schemaCache.Set(dbId, updated, cache.DefaultExpiration)
+	}
+	return nil
+}
+
+func (c *NotionClient) AppendBlock(notionKey, pageId, content string) error {
 	if pageId == "" {
 		return fmt.Errorf("invalid content")
 	}
 
-	page, err := client.RetrivePage(pageId)
+	page, err := c.api.RetrievePage(notionKey, pageId)
 	if err != nil {
 		return err
 	}
@@ -32,7 +206,10 @@ func (c *NotionClient) AppendBlock(notionKey, pageId, content string) error {
 	}
 
 	// ignore error
-	children, _, _, _ := client.RetriveBlockChildren(pageId, "", 1)
+	var children []core.Block
+	if resp, err := c.api.RetrieveBlockChildren(notionKey, pageId, "", 1); err == nil {
+		children = resp.Results
+	}
 	// log.Infof("children: %+v", children)
 	var blocks []*core.Block
 	if lastEditTime.Local().Day() != time.Now().Day() || len(children) == 0 {
@@ -51,81 +228,552 @@ func (c *NotionClient) AppendBlock(notionKey, pageId, content string) error {
 		blocks = append(blocks, &block)
 	}
 
-	var bulletedItem core.ListItemBlock
-	bulletedItem.Text = append(bulletedItem.Text,
+	// images go after the text, a memo of images only has no list item
+	images, content := splitImages(content)
+	if content != "" || len(images) == 0 {
+		var bulletedItem core.ListItemBlock
+		if c.option.MarkdownLists && hasMarkdownList(content) {
+			// the leading paragraph is the text of the memo, the rest are nested
+			children := markdownBlocks(content, plainRichText)
+			if children[0].Type == core.BLOCK_PARAGRAPH {
+				bulletedItem.Text = children[0].ParagraphBlock.Text
+				children = children[1:]
+			}
+			bulletedItem.Children = children
+		} else {
+			bulletedItem.Text = plainRichText(content)
+		}
+		bulletedItem.Text = c.withDateMentions(bulletedItem.Text, time.Now())
+
+		blocks = append(blocks, &core.Block{
+			Object:                core.OBJECT_BLOCK,
+			Type:                  core.BLOCK_BULLETED_LIST_ITEM,
+			BulletedListItemBlock: &bulletedItem,
+		})
+	}
+	for i := range images {
+		blocks = append(blocks, &images[i])
+	}
+
+	return c.api.AppendBlockChildren(notionKey, pageId, blocks)
+}
+
+func plainRichText(text string) core.RichTextArrary {
+	return core.RichTextArrary{
 		core.RichTextObject{
 			Type: core.TYPE_TEXT,
 			Text: &core.TextObject{
-				Content: content,
+				Content: text,
+			},
+		},
+	}
+}
+
+// styledRichText highlights the tags in text
+func styledRichText(text string) core.RichTextArrary {
+	var texts core.RichTextArrary
+	for _, elem := range utils.ScanContent(text) {
+		color := "default"
+		if elem.IsTag {
+			color = "blue"
+		}
+
+		texts = append(texts, core.RichTextObject{
+			Type: core.TYPE_TEXT,
+			Text: &core.TextObject{
+				Content: elem.Text,
+			},
+			Annotations: &core.AnnotationObject{
+				Bold:  true,
+				Code:  elem.IsTag,
+				Color: color,
 			},
 		})
+	}
+	return texts
+}
 
-	blocks = append(blocks, &core.Block{
-		Object:                core.OBJECT_BLOCK,
-		Type:                  core.BLOCK_BULLETED_LIST_ITEM,
-		BulletedListItemBlock: &bulletedItem,
-	})
+// pageTitle is the title of the page created for content
+func (c *NotionClient) pageTitle(content string) string {
+	if c.option.TitleMaxLength <= 0 {
+		return ""
+	}
 
-	err = client.AppendBlock(pageId, blocks)
+	// the title is plain text, images are blocks of the page
+	_, content = splitImages(content)
+	if c.colorMarkup != nil {
+		content = c.colorMarkup.ReplaceAllString(content, "${text}")
+	}
+	return utils.TruncateTitle(content, c.option.TitleMaxLength)
+}
+
+func plainText(texts *core.RichTextArrary) string {
+	if texts == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, t := range *texts {
+		if t.PlainText != "" {
+			sb.WriteString(t.PlainText)
+		} else if t.Text != nil {
+			sb.WriteString(t.Text.Content)
+		}
+	}
+	return sb.String()
+}
+
+// VerifyPage reads page pageId back and checks it's persisted
+// with the title derived from content.
+func (c *NotionClient) VerifyPage(notionKey, pageId, content string) error {
+	page, err := c.api.RetrievePage(notionKey, pageId)
 	if err != nil {
-		return err
+		return fmt.Errorf("read back page %s error, %v", pageId, err)
+	}
+
+	if page.ID == "" || page.Archived {
+		return fmt.Errorf("page %s not persisted", pageId)
 	}
 
+	// the title may not be set yet
+	if _, ok := c.backfilling.Load(pageId); ok {
+		return nil
+	}
+
+	expected := c.pageTitle(content)
+	for _, prop := range page.Properties {
+		if prop.Type != core.TYPE_TITLE {
+			continue
+		}
+
+		if title := plainText(prop.TitleObject); !c.titleMatches(title, expected) {
+			return fmt.Errorf("page %s title mismatch, expected: %s, got: %s", pageId, expected, title)
+		}
+		return nil
+	}
+
+	if expected != "" {
+		return fmt.Errorf("page %s has no title, expected: %s", pageId, expected)
+	}
 	return nil
 }
 
-func (c *NotionClient) AddNewPage2Database(notionKey, dbId, content string) error {
-	client, err := core.NewClient(&core.Option{SecretKey: notionKey})
-	if err != nil {
-		return err
+func tagsProperty(tags []string) core.PropertyValue {
+	tagObj := core.MultiSelectObject{}
+	for _, tag := range tags {
+		tagObj = append(tagObj, core.SelectOption{Name: tag})
 	}
 
-	var page core.Page
-	page.Parent = core.ParentObject{
-		DatabaseID: dbId,
+	return core.PropertyValue{
+		Type:        core.TYPE_MULTI_SELECT,
+		MultiSelect: &tagObj,
 	}
+}
 
-	page.Properties = make(map[string]core.PropertyValue)
-	page.Properties["Name"] = core.PropertyValue{
-		Type:        core.TYPE_TITLE,
-		TitleObject: &core.RichTextArrary{},
+// textProperty is a property of value, typed after property in the schema
+// of database dbId, rich text unless it's a select or multi select.
+func (c *NotionClient) textProperty(notionKey, dbId, property, value string) core.PropertyValue {
+	propType := typeRichText
+	if db, err := c.getSchema(notionKey, dbId); err == nil {
+		if prop, ok := db.Properties[property]; ok {
+			propType = prop.Type
+		}
+	} else {
+		log.Warnf("failed to get schema of database %s, save %s as text. err=%v", dbId, property, err)
 	}
 
-	var contentBlock core.ParagraphBlock
-	elements := utils.ScanContent(content)
-	var tagObj core.MultiSelectObject
-	for _, elem := range elements {
-		color := "default"
+	switch propType {
+	case core.TYPE_SELECT:
+		return core.PropertyValue{
+			Type:         core.TYPE_SELECT,
+			SingleSelect: &core.SelectOption{Name: value},
+		}
+	case core.TYPE_MULTI_SELECT:
+		return core.PropertyValue{
+			Type:        core.TYPE_MULTI_SELECT,
+			MultiSelect: &core.MultiSelectObject{{Name: value}},
+		}
+	}
+
+	text := plainRichText(value)
+	return core.PropertyValue{
+		Type:     typeRichText,
+		RichText: &text,
+	}
+}
+
+// contentTags are the tags of content, split on the tag separators and cased
+func (c *NotionClient) contentTags(content string) []string {
+	var tags []string
+	for _, elem := range utils.ScanContent(content) {
 		if elem.IsTag {
-			tagObj = append(tagObj, core.SelectOption{Name: elem.Text[1:]})
-			color = "blue"
+			tags = append(tags, elem.Text[1:])
+		}
+	}
+
+	return utils.NormalizeTagCase(utils.SplitTags(tags, c.option.TagSeparators), c.option.TagCase)
+}
+
+// mergeTags are tags followed by the extra ones not in them
+func mergeTags(tags, extra []string) []string {
+	for _, tag := range extra {
+		if !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Mention is a user @mentioned in a memo, NotionUserID is empty if the
+// user isn't mapped to a notion user
+type Mention struct {
+	Name         string
+	NotionUserID string
+}
+
+// PageOptions are the optional properties of a page created in database
+type PageOptions struct {
+	// creation time of the memo, now if zero
+	CreatedAt time.Time
+	SortField *SortField
+	// property to keep the name of the source chat, none if empty
+	ChatProperty string
+	ChatName     string
+	// property to keep the timezone label of the sender, e.g. Asia/Shanghai,
+	// none if empty
+	TimezoneProperty string
+	Timezone         string
+	// tags besides those of content
+	Tags []string
+	// number properties => values
+	Numbers map[string]int64
+	// property for the users @mentioned in the memo, none if empty
+	MentionProperty string
+	Mentions        []Mention
+	// self-relation property linking the page to the recent pages sharing a
+	// tag, none if empty. It costs a query of the database
+	RelatedProperty string
+	// page left out of the related ones, the page itself when backfilled
+	skipPage string
+	// children of the page if not empty, the title and tags still come from content
+	Body string
+	// blocks the body is placed in, see ParsePageTemplate. Pages split into
+	// sections don't use it
+	Template []TemplateBlock
+}
+
+func (opts *PageOptions) createdAt() time.Time {
+	if opts.CreatedAt.IsZero() {
+		return time.Now()
+	}
+	return opts.CreatedAt
+}
+
+func (opts *PageOptions) body(content string) string {
+	if opts.Body != "" {
+		return opts.Body
+	}
+	return content
+}
+
+// contentBlocks are the blocks of a page for content written at now
+func (c *NotionClient) contentBlocks(content string, now time.Time) []core.Block {
+	richText := func(text string) core.RichTextArrary {
+		return c.withDateMentions(c.coloredRichText(text), now)
+	}
+
+	// images go after the text
+	images, content := splitImages(content)
+	listed := false
+	if c.option.AutoListMaxLength > 0 {
+		content, listed = autoList(content, c.option.AutoListMaxLength)
+	}
+	var blocks []core.Block
+	if listed || c.option.MarkdownLists && hasMarkdownList(content) {
+		blocks = markdownBlocks(content, richText)
+	} else if content != "" || len(images) == 0 {
+		blocks = []core.Block{{
+			Object:         core.OBJECT_BLOCK,
+			Type:           core.BLOCK_PARAGRAPH,
+			ParagraphBlock: &core.ParagraphBlock{Text: richText(content)},
+		}}
+	}
+
+	if c.option.Bookmarks {
+		for _, link := range utils.ExtractURLs(content, c.option.LooseLinkMatch) {
+			blocks = append(blocks, core.Block{
+				Object:        core.OBJECT_BLOCK,
+				Type:          blockBookmark,
+				BookmarkBlock: c.bookmark(link),
+			})
+		}
+	}
+	return append(blocks, images...)
+}
+
+// bookmark of link, captioned with the title of the page if previews are
+// enabled, a plain one if the title can't be read.
+func (c *NotionClient) bookmark(link string) *core.BookmarkBlock {
+	bookmark := &core.BookmarkBlock{Url: link}
+	if !c.option.LinkPreviews {
+		return bookmark
+	}
+
+	title, err := c.links.Title(link)
+	if err != nil {
+		log.Warnf("failed to preview link %s. err=%v", link, err)
+		return bookmark
+	}
+
+	bookmark.Cpation = plainRichText(title)
+	return bookmark
+}
+
+// AddNewPage2Database creates a page for content in database dbId
+// and returns the id of the new page.
+func (c *NotionClient) AddNewPage2Database(notionKey, dbId, content string, opts PageOptions) (string, error) {
+	children := c.contentBlocks(opts.body(content), opts.createdAt())
+	if len(opts.Template) > 0 {
+		children = templateBlocks(opts.Template, children)
+	}
+	return c.createDatabasePage(notionKey, dbId, content, opts, children)
+}
+
+// AddSectionPages2Database creates an index page for content in database
+// dbId, and a subpage of it for each of sections, which notion lists as
+// links in the index. It returns the id of the index page, which is
+// created even if a subpage fails.
+func (c *NotionClient) AddSectionPages2Database(notionKey, dbId, content string, sections []Section, opts PageOptions) (string, error) {
+	indexID, err := c.createDatabasePage(notionKey, dbId, content, opts, []core.Block{})
+	if err != nil {
+		return "", err
+	}
+
+	for _, section := range sections {
+		var children []core.Block
+		if section.Content != "" {
+			children = c.contentBlocks(section.Content, opts.createdAt())
+		}
+		if _, err := c.createSubpage(notionKey, indexID, section.Title, children); err != nil {
+			return indexID, fmt.Errorf("create page of section %s error, %w", section.Title, err)
+		}
+	}
+
+	return indexID, nil
+}
+
+// createDatabasePage creates a page of children for content in database
+// dbId. With LazySchema, a database whose schema isn't cached gets the
+// page without properties at once, which are set once the schema is read.
+func (c *NotionClient) createDatabasePage(notionKey, dbId, content string, opts PageOptions, children []core.Block) (string, error) {
+	if _, cached := c.schemaCache.Get(dbId); c.option.LazySchema && !cached {
+		// the title property isn't known without the schema
+		page := &core.Page{
+			Parent:   core.ParentObject{DatabaseID: dbId},
+			Children: children,
+		}
+		created, err := c.api.CreatePage(notionKey, page, nil)
+		if err != nil {
+			return "", err
+		}
+
+		c.backfillProperties(notionKey, dbId, created.ID, content, opts)
+		return created.ID, nil
+	}
+
+	page, rawProperties, err := c.databasePage(notionKey, dbId, content, opts)
+	if err != nil {
+		return "", err
+	}
+	page.Children = children
+
+	created, err := c.api.CreatePage(notionKey, page, rawProperties)
+	if err != nil {
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+// backfillProperties reads the schema of database dbId in the background
+// and sets the properties of page pageId created without them.
+func (c *NotionClient) backfillProperties(notionKey, dbId, pageId, content string, opts PageOptions) {
+	c.backfills.Add(1)
+	c.backfilling.Store(pageId, true)
+	go func() {
+		defer c.backfills.Done()
+		defer c.backfilling.Delete(pageId)
+		if _, err := c.getSchema(notionKey, dbId); err != nil {
+			log.Errorf("failed to get schema of database %s, page %s is left without properties. err=%v", dbId, pageId, err)
+			return
+		}
+
+		opts.skipPage = pageId
+		page, rawProperties, err := c.databasePage(notionKey, dbId, content, opts)
+		if err == nil {
+			err = c.api.UpdatePageProperties(notionKey, pageId, page.Properties, rawProperties)
+		}
+		if err != nil {
+			log.Errorf("failed to backfill properties of page %s. err=%v", pageId, err)
 		}
+	}()
+}
+
+// databasePage is a page for content in database dbId without children,
+// with the properties that core.PropertyValue can't encode.
+func (c *NotionClient) databasePage(notionKey, dbId, content string, opts PageOptions) (*core.Page, map[string]interface{}, error) {
+	var page core.Page
+	page.Parent = core.ParentObject{
+		DatabaseID: dbId,
+	}
 
-		contentBlock.Text = append(contentBlock.Text, core.RichTextObject{
+	titleProp := c.titleProperty(notionKey, dbId)
+	title := core.RichTextArrary{}
+	if text := c.dedupTitle(notionKey, dbId, titleProp, c.pageTitle(content), opts.createdAt()); text != "" {
+		title = append(title, core.RichTextObject{
 			Type: core.TYPE_TEXT,
 			Text: &core.TextObject{
-				Content: elem.Text,
-			},
-			Annotations: &core.AnnotationObject{
-				Bold:  true,
-				Code:  elem.IsTag,
-				Color: color,
+				Content: text,
 			},
 		})
 	}
 
-	var textBlock core.Block
-	textBlock.Object = core.OBJECT_BLOCK
-	textBlock.Type = core.BLOCK_PARAGRAPH
-	textBlock.ParagraphBlock = &contentBlock
-	page.Children = append(page.Children, textBlock)
+	page.Properties = make(map[string]core.PropertyValue)
+	if titleProp != "" {
+		page.Properties[titleProp] = core.PropertyValue{
+			Type:        core.TYPE_TITLE,
+			TitleObject: &title,
+		}
+	}
+
+	if opts.ChatProperty != "" && opts.ChatName != "" {
+		if err := c.ensureProperty(notionKey, dbId, opts.ChatProperty, typeRichText); err != nil {
+			return nil, nil, err
+		}
+		page.Properties[opts.ChatProperty] = c.textProperty(notionKey, dbId, opts.ChatProperty, opts.ChatName)
+	}
 
-	if len(tagObj) > 0 {
-		page.Properties["Tags"] = core.PropertyValue{
-			Type:        core.TYPE_MULTI_SELECT,
-			MultiSelect: &tagObj,
+	if opts.TimezoneProperty != "" && opts.Timezone != "" {
+		if err := c.ensureProperty(notionKey, dbId, opts.TimezoneProperty, typeRichText); err != nil {
+			return nil, nil, err
+		}
+		page.Properties[opts.TimezoneProperty] = c.textProperty(notionKey, dbId, opts.TimezoneProperty, opts.Timezone)
+	}
+
+	tags := c.capTags(mergeTags(c.contentTags(content), opts.Tags))
+	if len(tags) > 0 {
+		page.Properties["Tags"] = tagsProperty(tags)
+	}
+
+	rawProperties := make(map[string]interface{})
+	if opts.SortField != nil && opts.SortField.Property != "" {
+		value, err := opts.SortField.propertyValue(opts.createdAt())
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := c.ensureProperty(notionKey, dbId, opts.SortField.Property, opts.SortField.propertyType()); err != nil {
+			return nil, nil, err
+		}
+		rawProperties[opts.SortField.Property] = value
+	}
+
+	for name, value := range opts.Numbers {
+		if err := c.ensureProperty(notionKey, dbId, name, typeNumber); err != nil {
+			return nil, nil, err
 		}
+		// encoded by hand like the sort field
+		rawProperties[name] = map[string]interface{}{
+			"type":   typeNumber,
+			"number": value,
+		}
+	}
+
+	if opts.MentionProperty != "" && len(opts.Mentions) > 0 {
+		if err := c.ensureProperty(notionKey, dbId, opts.MentionProperty, typeRichText); err != nil {
+			return nil, nil, err
+		}
+		c.setMentions(notionKey, dbId, opts.MentionProperty, opts.Mentions, &page, rawProperties)
+	}
+
+	if opts.RelatedProperty != "" && len(tags) > 0 {
+		c.setRelated(notionKey, dbId, tags, &opts, rawProperties)
+	}
+
+	return &page, rawProperties, nil
+}
+
+// setMentions sets property of page to mentions: the mapped notion users
+// for a people property, which core.PropertyValue can't encode, the names
+// otherwise.
+func (c *NotionClient) setMentions(notionKey, dbId, property string, mentions []Mention, page *core.Page, rawProperties map[string]interface{}) {
+	if db, err := c.getSchema(notionKey, dbId); err == nil && db.Properties[property].Type == typePeople {
+		var people []map[string]interface{}
+		for _, m := range mentions {
+			if m.NotionUserID != "" {
+				people = append(people, map[string]interface{}{"object": "user", "id": m.NotionUserID})
+			}
+		}
+		if len(people) > 0 {
+			rawProperties[property] = map[string]interface{}{
+				"type":   typePeople,
+				"people": people,
+			}
+		}
+		return
+	}
+
+	names := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		names = append(names, m.Name)
+	}
+	page.Properties[property] = c.textProperty(notionKey, dbId, property, strings.Join(names, ", "))
+}
+
+// UpdatePageTags rescans content and overwrites the Tags property of
+// page pageId with its tags and extra, tags no longer in either are removed.
+func (c *NotionClient) UpdatePageTags(notionKey, pageId, content string, extra []string) error {
+	tags := c.capTags(mergeTags(c.contentTags(content), extra))
+	return c.api.UpdatePageProperties(notionKey, pageId, map[string]core.PropertyValue{
+		"Tags": tagsProperty(tags),
+	}, nil)
+}
+
+// CreateSubpage creates an empty page titled title under page parentId
+func (c *NotionClient) CreateSubpage(notionKey, parentId, title string) (string, error) {
+	return c.createSubpage(notionKey, parentId, title, nil)
+}
+
+func (c *NotionClient) createSubpage(notionKey, parentId, title string, children []core.Block) (string, error) {
+	var page core.Page
+	page.Parent = core.ParentObject{
+		PageID: parentId,
+	}
+	page.Properties = map[string]core.PropertyValue{
+		"title": {
+			Type: core.TYPE_TITLE,
+			TitleObject: &core.RichTextArrary{
+				{Type: core.TYPE_TEXT, Text: &core.TextObject{Content: title}},
+			},
+		},
+	}
+	page.Children = children
+	if page.Children == nil {
+		page.Children = []core.Block{}
+	}
+
+	created, err := c.api.CreatePage(notionKey, &page, nil)
+	if err != nil {
+		return "", err
 	}
 
-	return client.CreatePage(&page)
+	return created.ID, nil
 }
@@ -1,9 +1,15 @@
 package notion
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"github.com/KDF5000/nomo/infrastructure/utils"
+	"github.com/KDF5000/notion-sdk-go/core"
 )
 
 const (
@@ -20,9 +26,9 @@ func TestNotionCreatePage(t *testing.T) {
 		"有些人喜欢在中间加#标签 然后",
 	}
 
-	client := &NotionClient{}
+	client := NewNotionClient(ClientOption{})
 	for _, content := range cases {
-		err := client.AddNewPage2Database(SecretKey, DatabaseID, content)
+		_, err := client.AddNewPage2Database(SecretKey, DatabaseID, content, PageOptions{})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -33,3 +39,310 @@ func TestScanContent(t *testing.T) {
 	t.Logf("%+v", utils.ScanContent("有些人喜欢在中间加#标签 然后"))
 	t.Logf("%v", utils.ScanContent("#科技 只是一条科技#美食 哈哈"))
 }
+
+func TestAddNewPage2DatabaseID(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(testSchema))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		if r.URL.Path != "/pages" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, TitleMaxLength: 10})
+	id, err := client.AddNewPage2Database("secret", "db_xxx", "#科技 technology change our life!", PageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "page_xxx" {
+		t.Fatalf("expected page_xxx, got %s", id)
+	}
+
+	// title property detected from schema
+	var page core.Page
+	if err := json.Unmarshal([]byte(body), &page); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := page.Properties["标题"]; !ok {
+		t.Fatalf("expected title property 标题, got %s", body)
+	}
+}
+
+func TestVerifyPage(t *testing.T) {
+	pages := map[string]string{
+		"/pages/page_ok":       `{"object": "page", "id": "page_ok", "properties": {"Name": {"type": "title", "title": [{"type": "text", "plain_text": "technology…"}]}}}`,
+		"/pages/page_mismatch": `{"object": "page", "id": "page_mismatch", "properties": {"Name": {"type": "title", "title": []}}}`,
+		"/pages/page_archived": `{"object": "page", "id": "page_archived", "archived": true}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"object": "error", "code": "object_not_found"}`))
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, TitleMaxLength: 12})
+	content := "technology change our life!"
+	if err := client.VerifyPage("secret", "page_ok", content); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"page_mismatch", "page_archived", "page_missing"} {
+		if err := client.VerifyPage("secret", id, content); err == nil {
+			t.Fatalf("expected %s to fail verification", id)
+		}
+	}
+
+	// no title derived, only existence is checked
+	client = NewNotionClient(ClientOption{BaseURI: server.URL})
+	if err := client.VerifyPage("secret", "page_mismatch", content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTextProperty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testSchema))
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL})
+	cases := []struct {
+		Property string
+		Value    string
+	}{
+		{Property: "Tags", Value: `{"type":"multi_select","multi_select":[{"name":"群"}]}`},
+		// not in the schema
+		{Property: "Channel", Value: `{"type":"rich_text","rich_text":[{"type":"text","text":{"content":"群"}}]}`},
+	}
+	for _, tc := range cases {
+		data, _ := json.Marshal(client.textProperty("secret", "db_xxx", tc.Property, "群"))
+		if string(data) != tc.Value {
+			t.Fatalf("property: %s, expected %s, got %s", tc.Property, tc.Value, data)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		UserAgent string
+		Expected  string
+	}{
+		{UserAgent: "", Expected: DefaultUserAgent},
+		{UserAgent: "nomo/1a2b3c4 (+ops@example.com)", Expected: "nomo/1a2b3c4 (+ops@example.com)"},
+	}
+	for _, tc := range cases {
+		client := NewNotionClient(ClientOption{BaseURI: server.URL, UserAgent: tc.UserAgent})
+		if _, err := client.CreateSubpage("secret", "page_yyy", "sub"); err != nil {
+			t.Fatal(err)
+		}
+		if userAgent != tc.Expected {
+			t.Fatalf("expected user agent %s, got %s", tc.Expected, userAgent)
+		}
+	}
+}
+
+func TestAccessErrors(t *testing.T) {
+	cases := []struct {
+		Code       int
+		Body       string
+		NotShared  bool
+		Restricted bool
+	}{
+		{Code: http.StatusNotFound, Body: `{"object": "error", "code": "object_not_found"}`, NotShared: true},
+		{Code: http.StatusForbidden, Body: `{"object": "error", "code": "restricted_resource"}`, Restricted: true},
+		{Code: http.StatusForbidden, Body: `forbidden`, Restricted: true},
+		{Code: http.StatusUnauthorized, Body: `{"object": "error", "code": "unauthorized"}`},
+		{Code: http.StatusBadGateway, Body: `bad gateway`},
+	}
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.Code)
+			w.Write([]byte(tc.Body))
+		}))
+
+		client := NewNotionClient(ClientOption{BaseURI: server.URL})
+		_, err := client.CreateSubpage("secret", "page_xxx", "sub")
+		server.Close()
+		if err == nil {
+			t.Fatalf("code: %d, expected error", tc.Code)
+		}
+		if IsNotShared(err) != tc.NotShared || IsRestricted(err) != tc.Restricted {
+			t.Fatalf("code: %d, body: %s, unexpected access of %v", tc.Code, tc.Body, err)
+		}
+	}
+}
+
+func TestAddSectionPages2Database(t *testing.T) {
+	var pages []core.Page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(testSchema))
+			return
+		}
+
+		var page core.Page
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &page)
+		pages = append(pages, page)
+		w.Write([]byte(`{"object": "page", "id": "page_` + string(rune('a'+len(pages)-1)) + `"}`))
+	}))
+	defer server.Close()
+
+	content := "reading notes\n# Go\n#科技 channels\n# Rust\nownership"
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, TitleMaxLength: 10})
+	id, err := client.AddSectionPages2Database("secret", "db_xxx", content, SplitSections(content, 1), PageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "page_a" {
+		t.Fatalf("expected index page_a, got %s", id)
+	}
+
+	if len(pages) != 4 {
+		t.Fatalf("expected index and 3 sections, got %+v", pages)
+	}
+	index := pages[0]
+	if index.Parent.DatabaseID != "db_xxx" || len(index.Children) != 0 {
+		t.Fatalf("unexpected index %+v", index)
+	}
+	if _, ok := index.Properties["Tags"]; !ok {
+		t.Fatalf("expected tags of the whole content on the index, got %+v", index.Properties)
+	}
+
+	titles := []string{IntroTitle, "Go", "Rust"}
+	for i, page := range pages[1:] {
+		title := page.Properties["title"].TitleObject
+		if page.Parent.PageID != "page_a" || plainText(title) != titles[i] || len(page.Children) != 1 {
+			t.Fatalf("unexpected section page %+v", page)
+		}
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	var page core.Page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pages" {
+			data, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(data, &page)
+		}
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	content := "https://example.com/a https://example.com/a https://example.com/a/#top https://example.com/b"
+	cases := []struct {
+		Option   ClientOption
+		Expected []string
+	}{
+		{Option: ClientOption{}},
+		{
+			Option:   ClientOption{Bookmarks: true},
+			Expected: []string{"https://example.com/a", "https://example.com/a/#top", "https://example.com/b"},
+		},
+		{
+			Option:   ClientOption{Bookmarks: true, LooseLinkMatch: true},
+			Expected: []string{"https://example.com/a", "https://example.com/b"},
+		},
+	}
+	for _, tc := range cases {
+		tc.Option.BaseURI = server.URL
+		client := NewNotionClient(tc.Option)
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", content, PageOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		var links []string
+		for _, block := range page.Children {
+			if block.Type == blockBookmark {
+				links = append(links, block.BookmarkBlock.Url)
+			}
+		}
+		if !reflect.DeepEqual(links, tc.Expected) {
+			t.Fatalf("option: %+v, expected bookmarks %v, got %v", tc.Option, tc.Expected, links)
+		}
+	}
+}
+
+func TestTagSeparators(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(testSchema))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		Separators string
+		Tags       []string
+	}{
+		// commas may be part of tags
+		{Separators: "", Tags: []string{"科技,美食;旅行"}},
+		{Separators: ",;", Tags: []string{"科技", "美食", "旅行"}},
+	}
+	for _, tc := range cases {
+		client := NewNotionClient(ClientOption{BaseURI: server.URL, TagSeparators: tc.Separators})
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", "#科技,美食;旅行 weekend", PageOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		var page core.Page
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		var tags []string
+		if prop, ok := page.Properties["Tags"]; ok && prop.MultiSelect != nil {
+			for _, opt := range *prop.MultiSelect {
+				tags = append(tags, opt.Name)
+			}
+		}
+		if !reflect.DeepEqual(tags, tc.Tags) {
+			t.Fatalf("separators: %q, expected tags %v, got %v", tc.Separators, tc.Tags, tags)
+		}
+	}
+}
+
+func TestContentTagCase(t *testing.T) {
+	content := "#Go #科技 #AI 周会 #go #Go语言"
+	cases := []struct {
+		TagCase  string
+		Expected []string
+	}{
+		{TagCase: "", Expected: []string{"Go", "科技", "AI", "go", "Go语言"}},
+		// latin lowercased, cjk and acronyms kept
+		{TagCase: utils.TagCaseLower, Expected: []string{"go", "科技", "AI", "go语言"}},
+		{TagCase: utils.TagCaseLowerAll, Expected: []string{"go", "科技", "ai", "go语言"}},
+	}
+	for _, tc := range cases {
+		client := NewNotionClient(ClientOption{TagCase: tc.TagCase})
+		if tags := client.contentTags(content); !reflect.DeepEqual(tags, tc.Expected) {
+			t.Fatalf("tag case: %q, expected %v, got %v", tc.TagCase, tc.Expected, tags)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package notion
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+// TemplateBody is the line of a page template where the memo goes
+const TemplateBody = "{body}"
+
+// notion takes at most 100 children to create a page, the rest are left
+// for the memo
+const maxTemplateBlocks = 50
+
+// # heading to ### heading, which notion has
+var templateHeading = regexp.MustCompile(`^(#{1,3})\s+(.*)$`)
+
+// TemplateBlock is a line of a page template: a heading of level 1 to 3,
+// a paragraph of Text, or the memo itself
+type TemplateBlock struct {
+	Heading int
+	Text    string
+	Body    bool
+}
+
+// ParsePageTemplate parses template, lines of `# heading` to `### heading`,
+// paragraphs of text and exactly one line of TemplateBody. Blank lines are
+// skipped.
+func ParsePageTemplate(template string) ([]TemplateBlock, error) {
+	var blocks []TemplateBlock
+	bodies := 0
+	for _, line := range strings.Split(template, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == TemplateBody:
+			bodies++
+			blocks = append(blocks, TemplateBlock{Body: true})
+		case strings.Contains(line, TemplateBody):
+			return nil, fmt.Errorf("%s should be a line of its own", TemplateBody)
+		case strings.HasPrefix(line, "#"):
+			m := templateHeading.FindStringSubmatch(line)
+			if m == nil || strings.TrimSpace(m[2]) == "" {
+				return nil, fmt.Errorf("invalid heading %q, must be # to ### and a title", line)
+			}
+			blocks = append(blocks, TemplateBlock{Heading: len(m[1]), Text: strings.TrimSpace(m[2])})
+		default:
+			blocks = append(blocks, TemplateBlock{Text: line})
+		}
+	}
+
+	if bodies != 1 {
+		return nil, fmt.Errorf("template should have exactly one line of %s, got %d", TemplateBody, bodies)
+	}
+	if len(blocks) > maxTemplateBlocks {
+		return nil, fmt.Errorf("template has %d blocks, at most %d", len(blocks), maxTemplateBlocks)
+	}
+	return blocks, nil
+}
+
+// templateBlocks are the blocks of template with body in place of its
+// TemplateBody
+func templateBlocks(template []TemplateBlock, body []core.Block) []core.Block {
+	blocks := make([]core.Block, 0, len(template)+len(body))
+	for _, t := range template {
+		if t.Body {
+			blocks = append(blocks, body...)
+			continue
+		}
+
+		block := core.Block{Object: core.OBJECT_BLOCK}
+		heading := &core.HeadingBlobck{Text: plainRichText(t.Text)}
+		switch t.Heading {
+		case 1:
+			block.Type, block.Heading1Block = core.BLOCK_HEADING1, heading
+		case 2:
+			block.Type, block.Heading2Block = core.BLOCK_HEADING2, heading
+		case 3:
+			block.Type, block.Heading3Block = core.BLOCK_HEADING3, heading
+		default:
+			block.Type = core.BLOCK_PARAGRAPH
+			block.ParagraphBlock = &core.ParagraphBlock{Text: plainRichText(t.Text)}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
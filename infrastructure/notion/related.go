@@ -0,0 +1,146 @@
+package notion
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+)
+
+const (
+	typeRelation = "relation"
+
+	defaultRelatedWindow = 7 * 24 * time.Hour
+	defaultRelatedLimit  = 5
+)
+
+type queriedPage struct {
+	ID          string    `json:"id"`
+	CreatedTime time.Time `json:"created_time"`
+	Properties  map[string]struct {
+		Title []struct {
+			PlainText string `json:"plain_text"`
+		} `json:"title"`
+	} `json:"properties"`
+}
+
+// title is the plain text of the title property of the page
+func (p *queriedPage) title(property string) string {
+	var sb strings.Builder
+	for _, t := range p.Properties[property].Title {
+		sb.WriteString(t.PlainText)
+	}
+	return sb.String()
+}
+
+type queryResult struct {
+	Results []queriedPage `json:"results"`
+}
+
+// QueryDatabase returns the first pageSize pages of database dbID matching
+// filter, in the order of sorts.
+func (api *notionAPI) QueryDatabase(secretKey, dbID string, filter interface{}, sorts []interface{}, pageSize int) (*queryResult, error) {
+	payload := map[string]interface{}{"page_size": pageSize}
+	if filter != nil {
+		payload["filter"] = filter
+	}
+	if len(sorts) > 0 {
+		payload["sorts"] = sorts
+	}
+
+	var result queryResult
+	if err := api.do(secretKey, http.MethodPost, fmt.Sprintf("/databases/%s/query", dbID), payload, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// relatedFilter matches the pages with any of tags
+func relatedFilter(tags []string) interface{} {
+	filters := make([]interface{}, 0, len(tags))
+	for _, tag := range tags {
+		filters = append(filters, map[string]interface{}{
+			"property":     "Tags",
+			"multi_select": map[string]interface{}{"contains": tag},
+		})
+	}
+	if len(filters) == 1 {
+		return filters[0]
+	}
+	return map[string]interface{}{"or": filters}
+}
+
+// relatedPages are the ids of the latest pages of database dbId sharing a
+// tag with tags, created within the related window before now, at most
+// the related limit of them. skipPage is left out.
+func (c *NotionClient) relatedPages(notionKey, dbId string, tags []string, now time.Time, skipPage string) ([]string, error) {
+	window, limit := c.option.RelatedWindow, c.option.RelatedLimit
+	if window <= 0 {
+		window = defaultRelatedWindow
+	}
+	if limit <= 0 {
+		limit = defaultRelatedLimit
+	}
+
+	sorts := []interface{}{map[string]interface{}{"timestamp": "created_time", "direction": "descending"}}
+	// one more for skipPage
+	result, err := c.api.QueryDatabase(notionKey, dbId, relatedFilter(tags), sorts, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.Add(-window)
+	var ids []string
+	for _, page := range result.Results {
+		// the latest first, so are the rest older
+		if page.CreatedTime.Before(since) {
+			break
+		}
+		if page.ID == skipPage {
+			continue
+		}
+		if ids = append(ids, page.ID); len(ids) == limit {
+			break
+		}
+	}
+	return ids, nil
+}
+
+// relationProperty is a relation property to the pages of ids, encoded by
+// hand as core.PropertyValue has no relations
+func relationProperty(ids []string) map[string]interface{} {
+	relations := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		relations = append(relations, map[string]string{"id": id})
+	}
+	return map[string]interface{}{
+		"type":     typeRelation,
+		"relation": relations,
+	}
+}
+
+// setRelated links the page to the related pages of tags in
+// opts.RelatedProperty, a relation of the database to itself. The page is
+// written without them if they can't be found.
+func (c *NotionClient) setRelated(notionKey, dbId string, tags []string, opts *PageOptions, rawProperties map[string]interface{}) {
+	db, err := c.getSchema(notionKey, dbId)
+	if err != nil {
+		log.Warnf("failed to get schema of database %s, skip related pages. err=%v", dbId, err)
+		return
+	}
+	if db.Properties[opts.RelatedProperty].Type != typeRelation {
+		log.Warnf("property %s of database %s isn't a relation, skip related pages", opts.RelatedProperty, dbId)
+		return
+	}
+
+	ids, err := c.relatedPages(notionKey, dbId, tags, opts.createdAt(), opts.skipPage)
+	if err != nil {
+		log.Warnf("failed to find pages related to tags %v in database %s. err=%v", tags, dbId, err)
+		return
+	}
+	if len(ids) > 0 {
+		rawProperties[opts.RelatedProperty] = relationProperty(ids)
+	}
+}
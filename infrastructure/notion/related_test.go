@@ -0,0 +1,105 @@
+package notion
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const relatedSchema = `{"object": "database", "id": "db_xxx", "properties": {
+	"Name": {"type": "title"}, "Tags": {"type": "multi_select"}, "Related": {"type": "relation"}}}`
+
+func TestRelatedPages(t *testing.T) {
+	var query map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &query)
+		// the latest first
+		w.Write([]byte(`{"object": "list", "results": [
+			{"id": "page_self", "created_time": "2024-06-10T08:00:00.000Z"},
+			{"id": "page_1", "created_time": "2024-06-09T08:00:00.000Z"},
+			{"id": "page_2", "created_time": "2024-06-05T08:00:00.000Z"},
+			{"id": "page_old", "created_time": "2024-05-01T08:00:00.000Z"}]}`))
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC)
+	client := NewNotionClient(ClientOption{BaseURI: server.URL})
+	ids, err := client.relatedPages("secret", "db_xxx", []string{"go", "科技"}, now, "page_self")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"page_1", "page_2"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+	filter, _ := json.Marshal(query["filter"])
+	if expected := `{"or":[{"multi_select":{"contains":"go"},"property":"Tags"},{"multi_select":{"contains":"科技"},"property":"Tags"}]}`; string(filter) != expected {
+		t.Fatalf("expected filter %s, got %s", expected, filter)
+	}
+
+	// bounded by the limit
+	client = NewNotionClient(ClientOption{BaseURI: server.URL, RelatedLimit: 1})
+	if ids, err = client.relatedPages("secret", "db_xxx", []string{"go"}, now, ""); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"page_self"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+
+	data, _ := json.Marshal(relationProperty([]string{"page_1", "page_2"}))
+	if expected := `{"relation":[{"id":"page_1"},{"id":"page_2"}],"type":"relation"}`; string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+}
+
+func TestRelatedProperty(t *testing.T) {
+	cases := []struct {
+		Results  string
+		Expected string
+	}{
+		{
+			Results:  `[{"id": "page_1", "created_time": "2024-06-09T08:00:00.000Z"}]`,
+			Expected: `"Related":{"relation":[{"id":"page_1"}],"type":"relation"}`,
+		},
+		// nothing recent shares a tag
+		{Results: `[{"id": "page_old", "created_time": "2024-01-01T08:00:00.000Z"}]`},
+		{Results: `[]`},
+	}
+	for _, tc := range cases {
+		var page string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/databases/db_xxx":
+				w.Write([]byte(relatedSchema))
+			case "/databases/db_xxx/query":
+				w.Write([]byte(`{"object": "list", "results": ` + tc.Results + `}`))
+			default:
+				data, _ := ioutil.ReadAll(r.Body)
+				page = string(data)
+				w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+			}
+		}))
+
+		client := NewNotionClient(ClientOption{BaseURI: server.URL})
+		opts := PageOptions{
+			CreatedAt:       time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC),
+			RelatedProperty: "Related",
+		}
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", "#go notes", opts); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+
+		if tc.Expected == "" && strings.Contains(page, `"Related"`) {
+			t.Fatalf("results: %s, expected no relation, got %s", tc.Results, page)
+		}
+		if !strings.Contains(page, tc.Expected) {
+			t.Fatalf("results: %s, expected %s, got %s", tc.Results, tc.Expected, page)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package notion
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+type SelectProperty struct {
+	Options []core.SelectOption `json:"options"`
+}
+
+// DatabaseProperty is one column in the schema of a database
+type DatabaseProperty struct {
+	ID          string          `json:"id,omitempty"`
+	Name        string          `json:"name,omitempty"`
+	Type        string          `json:"type,omitempty"`
+	Select      *SelectProperty `json:"select,omitempty"`
+	MultiSelect *SelectProperty `json:"multi_select,omitempty"`
+}
+
+type Database struct {
+	Object     string                      `json:"object"`
+	ID         string                      `json:"id"`
+	Properties map[string]DatabaseProperty `json:"properties"`
+	// the rest of the properties or options are in the next page if any
+	HasMore    bool   `json:"has_more,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// maxSchemaPages bounds the pages of a schema followed
+const maxSchemaPages = 100
+
+// merge adds the properties of next, and the select options of the
+// properties known already.
+func (db *Database) merge(next *Database) {
+	if db.Properties == nil {
+		db.Properties = make(map[string]DatabaseProperty)
+	}
+
+	for name, prop := range next.Properties {
+		known, ok := db.Properties[name]
+		if !ok {
+			db.Properties[name] = prop
+			continue
+		}
+
+		known.Select = mergeOptions(known.Select, prop.Select)
+		known.MultiSelect = mergeOptions(known.MultiSelect, prop.MultiSelect)
+		db.Properties[name] = known
+	}
+}
+
+func mergeOptions(known, next *SelectProperty) *SelectProperty {
+	if next == nil {
+		return known
+	}
+	if known == nil {
+		return next
+	}
+
+	seen := make(map[string]bool)
+	for _, opt := range known.Options {
+		seen[opt.Name] = true
+	}
+	for _, opt := range next.Options {
+		if !seen[opt.Name] {
+			seen[opt.Name] = true
+			known.Options = append(known.Options, opt)
+		}
+	}
+	return known
+}
+
+// TitleProperty returns preferred if it's the title property of db,
+// otherwise the name of whatever property has the title type.
+func (db *Database) TitleProperty(preferred string) (string, bool) {
+	if prop, ok := db.Properties[preferred]; ok && prop.Type == core.TYPE_TITLE {
+		return preferred, true
+	}
+
+	for name, prop := range db.Properties {
+		if prop.Type == core.TYPE_TITLE {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// RetrieveDatabase returns the schema of database dbID, following the
+// cursors of a paginated one to collect all the properties and options.
+func (api *notionAPI) RetrieveDatabase(secretKey, dbID string) (*Database, error) {
+	var db Database
+	path := fmt.Sprintf("/databases/%s", dbID)
+	if err := api.do(secretKey, http.MethodGet, path, nil, &db); err != nil {
+		return nil, err
+	}
+
+	cursors := make(map[string]bool)
+	for pages := 1; db.HasMore && db.NextCursor != "" && !cursors[db.NextCursor]; pages++ {
+		if pages >= maxSchemaPages {
+			return nil, fmt.Errorf("schema of database %s has more than %d pages", dbID, maxSchemaPages)
+		}
+		cursors[db.NextCursor] = true
+
+		var next Database
+		if err := api.do(secretKey, http.MethodGet, fmt.Sprintf("%s?start_cursor=%s", path, url.QueryEscape(db.NextCursor)), nil, &next); err != nil {
+			return nil, fmt.Errorf("read schema of database %s after %s error, %w", dbID, db.NextCursor, err)
+		}
+
+		db.merge(&next)
+		db.HasMore, db.NextCursor = next.HasMore, next.NextCursor
+	}
+
+	db.HasMore, db.NextCursor = false, ""
+	return &db, nil
+}
+
+// UpdateDatabaseProperties adds or changes properties of database dbID,
+// name => config of the type, e.g. {"Order": {"number": {}}}, and
+// returns the schema after.
+func (api *notionAPI) UpdateDatabaseProperties(secretKey, dbID string, properties map[string]interface{}) (*Database, error) {
+	payload := struct {
+		Properties map[string]interface{} `json:"properties"`
+	}{
+		Properties: properties,
+	}
+
+	var db Database
+	if err := api.do(secretKey, http.MethodPatch, fmt.Sprintf("/databases/%s", dbID), &payload, &db); err != nil {
+		return nil, err
+	}
+	return &db, nil
+}
@@ -0,0 +1,278 @@
+package notion
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSchema = `{
+	"object": "database",
+	"id": "db_xxx",
+	"properties": {
+		"Tags": {"id": "a", "name": "Tags", "type": "multi_select", "multi_select": {"options": []}},
+		"标题": {"id": "title", "name": "标题", "type": "title", "title": {}}
+	}
+}`
+
+func TestDatabaseTitleProperty(t *testing.T) {
+	var db Database
+	if err := json.Unmarshal([]byte(testSchema), &db); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Preferred string
+		Title     string
+	}{
+		{Preferred: "标题", Title: "标题"},
+		// misconfigured, detect from schema
+		{Preferred: "Name", Title: "标题"},
+		// not a title property
+		{Preferred: "Tags", Title: "标题"},
+	}
+	for _, tc := range cases {
+		title, ok := db.TitleProperty(tc.Preferred)
+		if !ok || title != tc.Title {
+			t.Fatalf("preferred: %s, expected: %s, got: %s", tc.Preferred, tc.Title, title)
+		}
+	}
+}
+
+func TestDatabaseNoTitleProperty(t *testing.T) {
+	db := Database{
+		Properties: map[string]DatabaseProperty{
+			"Tags": {Name: "Tags", Type: "multi_select"},
+		},
+	}
+
+	if title, ok := db.TitleProperty("Name"); ok {
+		t.Fatalf("expected no title property, got %s", title)
+	}
+}
+
+func TestRetrieveDatabasePaginated(t *testing.T) {
+	pages := map[string]string{
+		"": `{"object": "database", "id": "db_xxx", "has_more": true, "next_cursor": "c1", "properties": {
+			"Tags": {"name": "Tags", "type": "multi_select", "multi_select": {"options": [{"name": "科技"}, {"name": "美食"}]}},
+			"标题": {"name": "标题", "type": "title"}}}`,
+		"c1": `{"object": "database", "id": "db_xxx", "has_more": true, "next_cursor": "c2", "properties": {
+			"Tags": {"name": "Tags", "type": "multi_select", "multi_select": {"options": [{"name": "美食"}, {"name": "旅行"}]}}}}`,
+		"c2": `{"object": "database", "id": "db_xxx", "has_more": false, "properties": {
+			"Channel": {"name": "Channel", "type": "select", "select": {"options": [{"name": "群"}]}}}}`,
+	}
+	var cursors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("start_cursor")
+		cursors = append(cursors, cursor)
+		w.Write([]byte(pages[cursor]))
+	}))
+	defer server.Close()
+
+	db, err := newNotionAPI(server.URL, "").RetrieveDatabase("secret", "db_xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cursors, []string{"", "c1", "c2"}) {
+		t.Fatalf("unexpected cursors followed %v", cursors)
+	}
+
+	var tags []string
+	for _, opt := range db.Properties["Tags"].MultiSelect.Options {
+		tags = append(tags, opt.Name)
+	}
+	if !reflect.DeepEqual(tags, []string{"科技", "美食", "旅行"}) {
+		t.Fatalf("unexpected tag options %v", tags)
+	}
+	if len(db.Properties) != 3 || db.Properties["Channel"].Type != "select" || db.HasMore {
+		t.Fatalf("unexpected schema %+v", db)
+	}
+}
+
+func TestRetrieveDatabaseCursorLoop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object": "database", "id": "db_xxx", "has_more": true, "next_cursor": "c1", "properties": {}}`))
+	}))
+	defer server.Close()
+
+	// a repeated cursor ends the pages
+	if _, err := newNotionAPI(server.URL, "").RetrieveDatabase("secret", "db_xxx"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateMissingProperties(t *testing.T) {
+	cases := []struct {
+		Opts    PageOptions
+		Created string
+	}{
+		{
+			Opts:    PageOptions{SortField: &SortField{Property: "Order"}},
+			Created: `{"properties":{"Order":{"number":{}}}}`,
+		},
+		{
+			Opts:    PageOptions{SortField: &SortField{Property: "Captured", Strategy: SortStrategyTimestamp}},
+			Created: `{"properties":{"Captured":{"date":{}}}}`,
+		},
+		{
+			Opts:    PageOptions{ChatProperty: "Channel", ChatName: "产品讨论群"},
+			Created: `{"properties":{"Channel":{"rich_text":{}}}}`,
+		},
+		// in the schema already
+		{
+			Opts: PageOptions{ChatProperty: "Tags", ChatName: "产品讨论群"},
+		},
+	}
+
+	for _, tc := range cases {
+		var created, page string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			switch {
+			case r.Method == http.MethodPatch && r.URL.Path == "/databases/db_xxx":
+				created = string(data)
+				w.Write([]byte(testSchema))
+			case r.URL.Path == "/databases/db_xxx":
+				w.Write([]byte(testSchema))
+			case r.URL.Path == "/pages":
+				page = string(data)
+				w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+			}
+		}))
+
+		client := NewNotionClient(ClientOption{BaseURI: server.URL, CreateMissingProperties: true})
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", "memo", tc.Opts); err != nil {
+			t.Fatal(err)
+		}
+		if created != tc.Created {
+			t.Fatalf("options: %+v, expected %s created, got %s", tc.Opts, tc.Created, created)
+		}
+		if page == "" {
+			t.Fatalf("options: %+v, expected the page written", tc.Opts)
+		}
+		server.Close()
+	}
+}
+
+func TestCreateMissingPropertiesOff(t *testing.T) {
+	var patched bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			patched = true
+		}
+		if r.URL.Path == "/pages" {
+			w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+			return
+		}
+		w.Write([]byte(testSchema))
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL})
+	_, err := client.AddNewPage2Database("secret", "db_xxx", "memo", PageOptions{SortField: &SortField{Property: "Order"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched {
+		t.Fatal("expected the schema untouched")
+	}
+}
+
+func TestCreateMissingPropertyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"object": "error", "status": 403, "code": "restricted_resource", "message": "read only"}`))
+			return
+		}
+		w.Write([]byte(testSchema))
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, CreateMissingProperties: true})
+	_, err := client.AddNewPage2Database("secret", "db_xxx", "memo", PageOptions{SortField: &SortField{Property: "Order"}})
+	if !IsRestricted(err) {
+		t.Fatalf("expected restricted error, got %v", err)
+	}
+}
+
+func TestLazySchema(t *testing.T) {
+	var mu sync.Mutex
+	var created, patched []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/databases/db_xxx":
+			w.Write([]byte(testSchema))
+		case r.Method == http.MethodPost && r.URL.Path == "/pages":
+			created = append(created, string(data))
+			w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/pages/page_xxx":
+			patched = append(patched, string(data))
+			w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, TitleMaxLength: 10, LazySchema: true})
+	opts := PageOptions{SortField: &SortField{Property: "Order"}, CreatedAt: time.Unix(1650000000, 0)}
+	if _, err := client.AddNewPage2Database("secret", "db_xxx", "#科技 technology", opts); err != nil {
+		t.Fatal(err)
+	}
+	client.backfills.Wait()
+
+	// the body only on a cold cache, the properties after
+	if len(created) != 1 || !strings.Contains(created[0], "technology") || strings.Contains(created[0], "properties") {
+		t.Fatalf("expected body without properties, got %v", created)
+	}
+	if len(patched) != 1 {
+		t.Fatalf("expected properties backfilled, got %v", patched)
+	}
+	for _, prop := range []string{`"标题"`, `"Tags"`, `"Order":{"number":1650000000000,"type":"number"}`} {
+		if !strings.Contains(patched[0], prop) {
+			t.Fatalf("expected %s backfilled, got %s", prop, patched[0])
+		}
+	}
+
+	// written at once with a warm cache
+	if _, err := client.AddNewPage2Database("secret", "db_xxx", "#科技 technology", opts); err != nil {
+		t.Fatal(err)
+	}
+	client.backfills.Wait()
+	if len(created) != 2 || !strings.Contains(created[1], `"Tags"`) || len(patched) != 1 {
+		t.Fatalf("expected full page without backfill, created: %v, patched: %v", created, patched)
+	}
+}
+
+func TestLazySchemaUnavailable(t *testing.T) {
+	var patched bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/databases/db_xxx":
+			w.WriteHeader(http.StatusBadGateway)
+		case r.Method == http.MethodPatch:
+			patched = true
+		default:
+			w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, LazySchema: true})
+	id, err := client.AddNewPage2Database("secret", "db_xxx", "#科技 technology", PageOptions{})
+	if err != nil || id != "page_xxx" {
+		t.Fatalf("expected the page saved, got %s, err: %v", id, err)
+	}
+	client.backfills.Wait()
+	if patched {
+		t.Fatal("expected no backfill without schema")
+	}
+}
@@ -0,0 +1,42 @@
+package notion
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+// AppendScratch appends content to scratch page pageId after a line of
+// separator
+func (c *NotionClient) AppendScratch(notionKey, pageId, separator, content string) error {
+	if pageId == "" {
+		return fmt.Errorf("invalid content")
+	}
+
+	gray := &core.AnnotationObject{Color: "gray"}
+	blocks := []*core.Block{
+		{
+			Object: core.OBJECT_BLOCK,
+			Type:   core.BLOCK_PARAGRAPH,
+			ParagraphBlock: &core.ParagraphBlock{Text: core.RichTextArrary{{
+				Type:        core.TYPE_TEXT,
+				Text:        &core.TextObject{Content: separator},
+				Annotations: gray,
+			}}},
+		},
+	}
+	// images go after the text
+	images, content := splitImages(content)
+	if content != "" || len(images) == 0 {
+		blocks = append(blocks, &core.Block{
+			Object:         core.OBJECT_BLOCK,
+			Type:           core.BLOCK_PARAGRAPH,
+			ParagraphBlock: &core.ParagraphBlock{Text: c.withDateMentions(plainRichText(content), time.Now())},
+		})
+	}
+	for i := range images {
+		blocks = append(blocks, &images[i])
+	}
+	return c.api.AppendBlockChildren(notionKey, pageId, blocks)
+}
@@ -0,0 +1,47 @@
+package notion
+
+import (
+	"regexp"
+	"strings"
+)
+
+// IntroTitle is the title of the section before the first heading
+const IntroTitle = "Intro"
+
+// # title
+var headingRegexp = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+
+// Section is the content under a markdown heading
+type Section struct {
+	Title   string
+	Content string
+}
+
+// SplitSections splits content on the markdown headings of level 1 to
+// level, e.g. `# title` and `## title` for level 2, the deeper ones are
+// kept in the content. Content before the first heading is the section
+// titled IntroTitle, omitted if blank.
+func SplitSections(content string, level int) []Section {
+	var sections []Section
+	title := IntroTitle
+	var lines []string
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(lines, "\n"))
+		if text != "" || title != IntroTitle {
+			sections = append(sections, Section{Title: title, Content: text})
+		}
+		lines = lines[:0]
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if m := headingRegexp.FindStringSubmatch(line); m != nil && len(m[1]) <= level {
+			flush()
+			title = strings.TrimSpace(m[2])
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	return sections
+}
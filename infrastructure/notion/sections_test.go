@@ -0,0 +1,44 @@
+package notion
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSections(t *testing.T) {
+	content := "reading notes\n\n# Go\n## Channels\nunbuffered\n### Select\nblocks\n## Maps\nnot safe\n# Rust\nownership"
+	cases := []struct {
+		Level    int
+		Expected []Section
+	}{
+		{
+			Level: 1,
+			Expected: []Section{
+				{Title: IntroTitle, Content: "reading notes"},
+				{Title: "Go", Content: "## Channels\nunbuffered\n### Select\nblocks\n## Maps\nnot safe"},
+				{Title: "Rust", Content: "ownership"},
+			},
+		},
+		{
+			Level: 2,
+			Expected: []Section{
+				{Title: IntroTitle, Content: "reading notes"},
+				{Title: "Go", Content: ""},
+				{Title: "Channels", Content: "unbuffered\n### Select\nblocks"},
+				{Title: "Maps", Content: "not safe"},
+				{Title: "Rust", Content: "ownership"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		if got := SplitSections(content, tc.Level); !reflect.DeepEqual(got, tc.Expected) {
+			t.Fatalf("level: %d, expected %+v, got %+v", tc.Level, tc.Expected, got)
+		}
+	}
+
+	// no intro, tags aren't headings
+	expected := []Section{{Title: "Go", Content: "#科技 channels"}}
+	if got := SplitSections("# Go\n#科技 channels", 2); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
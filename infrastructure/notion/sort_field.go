@@ -0,0 +1,58 @@
+package notion
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// a number property of the creation time in milliseconds, it grows with
+	// every memo so it's a monotonic order
+	SortStrategyOrder = "order"
+	// a date property of the creation time in UTC
+	SortStrategyTimestamp = "timestamp"
+)
+
+// SortField is a helper property populated on created pages, so that
+// database views can sort memos consistently.
+type SortField struct {
+	Property string
+	// SortStrategyOrder if empty
+	Strategy string
+}
+
+func ValidSortStrategy(strategy string) bool {
+	return strategy == SortStrategyOrder || strategy == SortStrategyTimestamp
+}
+
+// propertyType is the type of the property, empty if the strategy is invalid
+func (f *SortField) propertyType() string {
+	switch f.Strategy {
+	case "", SortStrategyOrder:
+		return typeNumber
+	case SortStrategyTimestamp:
+		return typeDate
+	}
+	return ""
+}
+
+// propertyValue returns the raw property value of the page created at t,
+// numbers are encoded by hand since notion-sdk-go gets them wrong.
+func (f *SortField) propertyValue(t time.Time) (map[string]interface{}, error) {
+	switch f.Strategy {
+	case "", SortStrategyOrder:
+		return map[string]interface{}{
+			"type":   "number",
+			"number": t.UnixNano() / int64(time.Millisecond),
+		}, nil
+	case SortStrategyTimestamp:
+		return map[string]interface{}{
+			"type": "date",
+			"date": map[string]string{
+				"start": t.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid sort strategy %s", f.Strategy)
+}
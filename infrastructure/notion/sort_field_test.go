@@ -0,0 +1,70 @@
+package notion
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAddNewPage2DatabaseSortField(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(testSchema))
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	createdAt := time.Unix(1650000000, 123*int64(time.Millisecond))
+	cases := []struct {
+		Strategy string
+		Value    string
+	}{
+		{Strategy: "", Value: `{"number":1650000000123,"type":"number"}`},
+		{Strategy: SortStrategyOrder, Value: `{"number":1650000000123,"type":"number"}`},
+		{Strategy: SortStrategyTimestamp, Value: `{"date":{"start":"2022-04-15T05:20:00.123Z"},"type":"date"}`},
+	}
+
+	client := NewNotionClient(ClientOption{BaseURI: server.URL, TitleMaxLength: 10})
+	for _, tc := range cases {
+		_, err := client.AddNewPage2Database("secret", "db_xxx", "#科技 technology", PageOptions{
+			CreatedAt: createdAt,
+			SortField: &SortField{Property: "Order", Strategy: tc.Strategy},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var page struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		if string(page.Properties["Order"]) != tc.Value {
+			t.Fatalf("strategy: %s, expected %s, got %s", tc.Strategy, tc.Value, page.Properties["Order"])
+		}
+		// the other properties are kept
+		if _, ok := page.Properties["标题"]; !ok {
+			t.Fatalf("title property lost, %s", body)
+		}
+		if _, ok := page.Properties["Tags"]; !ok {
+			t.Fatalf("tags property lost, %s", body)
+		}
+	}
+
+	_, err := client.AddNewPage2Database("secret", "db_xxx", "memo", PageOptions{
+		SortField: &SortField{Property: "Order", Strategy: "random"},
+	})
+	if err == nil {
+		t.Fatal("expected error of invalid strategy")
+	}
+}
@@ -0,0 +1,62 @@
+package notion
+
+import (
+	"github.com/KDF5000/pkg/log"
+)
+
+const (
+	// notion takes at most 100 values of a multi-select property per page
+	DefaultMaxPageTags = 100
+	// options of a multi-select property notion allows in a database
+	DefaultMaxTagOptions = 100
+	// warn once the options of Tags are this close of the max
+	defaultTagOptionsMargin = 10
+)
+
+func (c *NotionClient) maxPageTags() int {
+	if c.option.MaxPageTags > 0 {
+		return c.option.MaxPageTags
+	}
+	return DefaultMaxPageTags
+}
+
+// capTags are the first tags notion takes for a page, the rest are dropped
+func (c *NotionClient) capTags(tags []string) []string {
+	if max := c.maxPageTags(); len(tags) > max {
+		log.Warnf("%d tags over the limit %d of a page, drop %v", len(tags), max, tags[max:])
+		return tags[:max]
+	}
+	return tags
+}
+
+// TagOptions is the number of options of the Tags property of database
+// dbId once tags are added to it, and whether it's near the max notion
+// allows. It's false if the schema can't be read.
+func (c *NotionClient) TagOptions(notionKey, dbId string, tags []string) (int, bool) {
+	db, err := c.getSchema(notionKey, dbId)
+	if err != nil {
+		log.Warnf("failed to get schema of database %s, skip counting tag options. err=%v", dbId, err)
+		return 0, false
+	}
+
+	known := make(map[string]bool)
+	if prop := db.Properties["Tags"].MultiSelect; prop != nil {
+		for _, opt := range prop.Options {
+			known[opt.Name] = true
+		}
+	}
+	// the new tags become options of the database
+	for _, tag := range tags {
+		known[tag] = true
+	}
+
+	max := c.option.MaxTagOptions
+	if max <= 0 {
+		max = DefaultMaxTagOptions
+	}
+	margin := c.option.TagOptionsMargin
+	if margin <= 0 {
+		margin = defaultTagOptionsMargin
+	}
+	return len(known), len(known) >= max-margin
+}
@@ -0,0 +1,92 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tagSchema is a database whose Tags have n options, tag0 to tag<n-1>
+func tagSchema(n int) string {
+	options := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		options = append(options, fmt.Sprintf(`{"name": "tag%d"}`, i))
+	}
+	return fmt.Sprintf(`{"object": "database", "id": "db_xxx", "properties": {"Name": {"type": "title"},
+		"Tags": {"type": "multi_select", "multi_select": {"options": [%s]}}}}`, strings.Join(options, ","))
+}
+
+func TestCapPageTags(t *testing.T) {
+	var page struct {
+		Properties struct {
+			Tags struct {
+				MultiSelect []struct {
+					Name string `json:"name"`
+				} `json:"multi_select"`
+			}
+		} `json:"properties"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/databases/db_xxx" {
+			w.Write([]byte(tagSchema(0)))
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &page)
+		w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+	}))
+	defer server.Close()
+
+	var content []string
+	for i := 0; i < 120; i++ {
+		content = append(content, fmt.Sprintf("#t%d", i))
+	}
+	cases := []struct {
+		MaxPageTags int
+		Expected    int
+	}{
+		{MaxPageTags: 0, Expected: DefaultMaxPageTags},
+		{MaxPageTags: 3, Expected: 3},
+		{MaxPageTags: 200, Expected: 120},
+	}
+	for _, tc := range cases {
+		client := NewNotionClient(ClientOption{BaseURI: server.URL, MaxPageTags: tc.MaxPageTags})
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", strings.Join(content, " "), PageOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		tags := page.Properties.Tags.MultiSelect
+		if len(tags) != tc.Expected || tags[0].Name != "t0" {
+			t.Fatalf("max: %d, expected the first %d tags, got %+v", tc.MaxPageTags, tc.Expected, tags)
+		}
+	}
+}
+
+func TestTagOptions(t *testing.T) {
+	cases := []struct {
+		Options int
+		Tags    []string
+		Count   int
+		Near    bool
+	}{
+		{Options: 10, Tags: []string{"tag1", "new"}, Count: 11},
+		{Options: 89, Tags: []string{"tag1"}, Count: 89},
+		// the new tags count
+		{Options: 89, Tags: []string{"new"}, Count: 90, Near: true},
+		{Options: 100, Count: 100, Near: true},
+	}
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tagSchema(tc.Options)))
+		}))
+		client := NewNotionClient(ClientOption{BaseURI: server.URL})
+		count, near := client.TagOptions("secret", "db_xxx", tc.Tags)
+		server.Close()
+		if count != tc.Count || near != tc.Near {
+			t.Fatalf("options: %d, tags: %v, expected %d/%v, got %d/%v", tc.Options, tc.Tags, tc.Count, tc.Near, count, near)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package notion
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// encodeLinks rewrites the links of the text objects in payload, which
+// core.TextObject encodes as strings, into the link objects of the notion
+// api.
+func encodeLinks(payload []byte) ([]byte, error) {
+	if !bytes.Contains(payload, []byte(`"link":"`)) {
+		return payload, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	// keep the numbers as they are
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	rewriteLinks(v)
+	return json.Marshal(v)
+}
+
+func rewriteLinks(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if link, ok := v["link"].(string); ok {
+			if _, isText := v["content"]; isText {
+				v["link"] = map[string]interface{}{"url": link}
+			}
+		}
+		for _, child := range v {
+			rewriteLinks(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			rewriteLinks(child)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package notion
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+)
+
+const (
+	// append " (2)", " (3)"... to a title taken in the database
+	TitleDedupNumber = "number"
+	// append the time of the memo to a title taken in the database
+	TitleDedupTimestamp = "timestamp"
+
+	// titles of a database read to find a free one, notion's max page size
+	titleDedupPageSize = 100
+)
+
+// dedupTitle is title, suffixed after TitleDedup if a page of database
+// dbId has it already in its title property titleProp. The title is kept
+// if the database can't be queried.
+func (c *NotionClient) dedupTitle(notionKey, dbId, titleProp, title string, now time.Time) string {
+	mode := c.option.TitleDedup
+	if (mode != TitleDedupNumber && mode != TitleDedupTimestamp) || title == "" || titleProp == "" {
+		return title
+	}
+
+	filter := map[string]interface{}{
+		"property": titleProp,
+		"title":    map[string]interface{}{"starts_with": title},
+	}
+	result, err := c.api.QueryDatabase(notionKey, dbId, filter, nil, titleDedupPageSize)
+	if err != nil {
+		log.Warnf("failed to query titles of database %s, keep title %s. err=%v", dbId, title, err)
+		return title
+	}
+
+	taken := make(map[string]bool)
+	for _, page := range result.Results {
+		taken[page.title(titleProp)] = true
+	}
+	if !taken[title] {
+		return title
+	}
+
+	if mode == TitleDedupTimestamp {
+		suffixed := fmt.Sprintf("%s %s", title, now.Format("2006-01-02 15:04"))
+		if taken[suffixed] {
+			suffixed = fmt.Sprintf("%s %s", title, now.Format("2006-01-02 15:04:05"))
+		}
+		return suffixed
+	}
+	for n := 2; ; n++ {
+		if suffixed := fmt.Sprintf("%s (%d)", title, n); !taken[suffixed] {
+			return suffixed
+		}
+	}
+}
+
+// titleMatches reports whether title is expected, or expected suffixed by
+// dedupTitle
+func (c *NotionClient) titleMatches(title, expected string) bool {
+	if title == expected {
+		return true
+	}
+	return c.option.TitleDedup != "" && expected != "" && strings.HasPrefix(title, expected+" ")
+}
@@ -0,0 +1,77 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupTitle(t *testing.T) {
+	cases := []struct {
+		Mode     string
+		Titles   []string
+		Expected string
+	}{
+		{Mode: TitleDedupNumber, Titles: nil, Expected: "周报"},
+		// only starts with it
+		{Mode: TitleDedupNumber, Titles: []string{"周报 草稿"}, Expected: "周报"},
+		{Mode: TitleDedupNumber, Titles: []string{"周报"}, Expected: "周报 (2)"},
+		{Mode: TitleDedupNumber, Titles: []string{"周报", "周报 (2)", "周报 (4)"}, Expected: "周报 (3)"},
+		{Mode: TitleDedupTimestamp, Titles: []string{"周报"}, Expected: "周报 2024-06-10 09:30"},
+		{Mode: TitleDedupTimestamp, Titles: []string{"周报", "周报 2024-06-10 09:30"}, Expected: "周报 2024-06-10 09:30:15"},
+		// never queried
+		{Mode: "", Titles: []string{"周报"}, Expected: "周报"},
+	}
+	for _, tc := range cases {
+		var query, page string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			switch r.URL.Path {
+			case "/databases/db_xxx":
+				w.Write([]byte(testSchema))
+			case "/databases/db_xxx/query":
+				query = string(data)
+				results := make([]string, 0, len(tc.Titles))
+				for _, title := range tc.Titles {
+					results = append(results, fmt.Sprintf(`{"id": "page_%d", "properties": {"标题": {"type": "title", "title": [{"plain_text": %q}]}}}`, len(results), title))
+				}
+				w.Write([]byte(`{"object": "list", "results": [` + strings.Join(results, ",") + `]}`))
+			default:
+				page = string(data)
+				w.Write([]byte(`{"object": "page", "id": "page_xxx"}`))
+			}
+		}))
+
+		client := NewNotionClient(ClientOption{BaseURI: server.URL, TitleMaxLength: 10, TitleDedup: tc.Mode})
+		opts := PageOptions{CreatedAt: time.Date(2024, 6, 10, 9, 30, 15, 0, time.UTC)}
+		if _, err := client.AddNewPage2Database("secret", "db_xxx", "周报", opts); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+
+		title, _ := json.Marshal(tc.Expected)
+		if !strings.Contains(page, `"content":`+string(title)) {
+			t.Fatalf("mode: %q, titles: %v, expected title %s, got %s", tc.Mode, tc.Titles, tc.Expected, page)
+		}
+		if tc.Mode != "" && !strings.Contains(query, `"title":{"starts_with":"周报"}`) {
+			t.Fatalf("mode: %q, unexpected query %s", tc.Mode, query)
+		}
+		if tc.Mode == "" && query != "" {
+			t.Fatalf("expected no query, got %s", query)
+		}
+	}
+
+	// suffixed titles pass the verification
+	client := NewNotionClient(ClientOption{TitleDedup: TitleDedupNumber})
+	if !client.titleMatches("周报 (2)", "周报") || client.titleMatches("周报草稿", "周报") {
+		t.Fatal("expected only the suffixed title to match")
+	}
+	if client = NewNotionClient(ClientOption{}); client.titleMatches("周报 (2)", "周报") {
+		t.Fatal("expected the suffixed title not to match without dedup")
+	}
+}
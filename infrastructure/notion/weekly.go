@@ -0,0 +1,54 @@
+package notion
+
+import (
+	"strings"
+
+	"github.com/KDF5000/notion-sdk-go/core"
+)
+
+// WeeklyEntry is a memo of a weekly review or index page, a link to the
+// page of the memo if it has one, or a copy of it
+type WeeklyEntry struct {
+	Content string
+	PageID  string
+}
+
+// pageURL is the url of notion page pageID
+func pageURL(pageID string) string {
+	return "https://www.notion.so/" + strings.ReplaceAll(pageID, "-", "")
+}
+
+func weeklyBlocks(entries []WeeklyEntry) []core.Block {
+	blocks := make([]core.Block, 0, len(entries))
+	for _, entry := range entries {
+		text := plainRichText(entry.Content)
+		if entry.PageID != "" {
+			// the first line stands for the memo, the rest is on its page
+			title := strings.TrimSpace(strings.SplitN(strings.TrimSpace(entry.Content), "\n", 2)[0])
+			if title == "" {
+				title = entry.PageID
+			}
+			text = core.RichTextArrary{{
+				Type: core.TYPE_TEXT,
+				Text: &core.TextObject{Content: title, Link: pageURL(entry.PageID)},
+			}}
+		}
+		blocks = append(blocks, core.Block{
+			Object:                core.OBJECT_BLOCK,
+			Type:                  core.BLOCK_BULLETED_LIST_ITEM,
+			BulletedListItemBlock: &core.ListItemBlock{Text: text},
+		})
+	}
+	return blocks
+}
+
+// CreateWeeklyPage creates weekly review page title under page parentId
+// with entries
+func (c *NotionClient) CreateWeeklyPage(notionKey, parentId, title string, entries []WeeklyEntry) (string, error) {
+	return c.createLinkPage(notionKey, parentId, title, entries)
+}
+
+// AppendWeeklyEntries appends entries to weekly review page pageId
+func (c *NotionClient) AppendWeeklyEntries(notionKey, pageId string, entries []WeeklyEntry) error {
+	return c.appendBlocks(notionKey, pageId, weeklyBlocks(entries))
+}
@@ -0,0 +1,23 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"gorm.io/gorm"
+)
+
+type analyticsRepo struct {
+	db *gorm.DB
+}
+
+func NewAnalyticsRepo(db *gorm.DB) *analyticsRepo {
+	return &analyticsRepo{db: db}
+}
+
+var _ repository.AnalyticsRepository = &analyticsRepo{}
+
+func (repo *analyticsRepo) Create(ctx context.Context, a *entity.MemoAnalytics) error {
+	return repo.db.Create(a).Error
+}
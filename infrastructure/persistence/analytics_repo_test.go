@@ -0,0 +1,26 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+)
+
+func TestAnalyticsRepo(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewAnalyticsRepo(db)
+
+	a := entity.MemoAnalytics{ContentHash: "hash", Length: 5, Tags: `["tag"]`}
+	if err := repo.Create(context.TODO(), &a); err != nil {
+		t.Fatal(err)
+	}
+
+	var got entity.MemoAnalytics
+	if err := db.First(&got, a.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.ContentHash != a.ContentHash || got.Length != a.Length || got.Tags != a.Tags || got.CreatedAt.IsZero() {
+		t.Fatalf("unexpected analytics %+v", got)
+	}
+}
@@ -2,12 +2,19 @@ package persistence
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/KDF5000/nomo/domain/entity"
 	"github.com/KDF5000/nomo/domain/repository"
 	"gorm.io/gorm"
 )
 
+// attempts of UpdateSettings against concurrent writes of the settings
+const maxSettingsUpdates = 10
+
 type bindInfoRepo struct {
 	db *gorm.DB
 }
@@ -27,13 +34,63 @@ func (repo *bindInfoRepo) UpdateOrInsert(ctx context.Context, b *entity.BindInfo
 
 	b.ID = bind.ID
 	b.CreatedAt = bind.CreatedAt
-	if err := repo.db.Save(b).Error; err != nil {
+	// keep the settings when binding another page, they're left out of
+	// the write so as not to undo an UpdateSettings in the meantime
+	db := repo.db
+	if b.Settings == "" && b.ID != 0 {
+		db = db.Omit("settings")
+	}
+	if err := db.Save(b).Error; err != nil {
 		return err
 	}
+	if b.Settings == "" {
+		b.Settings = bind.Settings
+	}
 
 	return nil
 }
 
+func (repo *bindInfoRepo) UpdateSettings(ctx context.Context, id string, update func(s *entity.BindSettings) error) (*entity.BindSettings, error) {
+	for i := 0; i < maxSettingsUpdates; i++ {
+		bind, err := repo.GetBindInfoByUnionUserID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		settings, err := bind.GetSettings()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := update(&settings); err != nil {
+			if errors.Is(err, repository.ErrSettingsUnchanged) {
+				return &settings, nil
+			}
+			return nil, err
+		}
+		old := bind.Settings
+		if err := bind.SetSettings(&settings); err != nil {
+			return nil, err
+		}
+
+		// only if nobody changed them since read. Bindings older than the
+		// column have none, which is read as empty
+		db := repo.db.Model(&entity.BindInfo{}).Where("id = ?", bind.ID)
+		if old == "" {
+			db = db.Where("settings = '' OR settings IS NULL")
+		} else {
+			db = db.Where("settings = ?", old)
+		}
+		res := db.Updates(map[string]interface{}{"settings": bind.Settings, "updated_at": time.Now()})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 {
+			return &settings, nil
+		}
+	}
+	return nil, fmt.Errorf("settings of %s kept changing, gave up after %d attempts", id, maxSettingsUpdates)
+}
+
 func (repo *bindInfoRepo) GetBindInfoByUnionUserID(ctx context.Context, id string) (*entity.BindInfo, error) {
 	var bind entity.BindInfo
 	err := repo.db.Where("union_user_id = ?", id).First(&bind).Error
@@ -43,3 +100,22 @@ func (repo *bindInfoRepo) GetBindInfoByUnionUserID(ctx context.Context, id strin
 
 	return &bind, nil
 }
+
+func (repo *bindInfoRepo) ListBindInfosByNotionPage(ctx context.Context, pageID string) ([]entity.BindInfo, error) {
+	var binds []entity.BindInfo
+	// narrowed down by the page info json, then matched exactly
+	err := repo.db.Where("bind_platform = ? AND page_info LIKE ?", uint8(entity.BindPlatformTypeNotion), "%"+pageID+"%").
+		Order("id").Find(&binds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []entity.BindInfo
+	for _, bind := range binds {
+		var pageInfo entity.NotionPageInfo
+		if err := json.Unmarshal([]byte(bind.PageInfo), &pageInfo); err == nil && pageInfo.NotionPageID == pageID {
+			matched = append(matched, bind)
+		}
+	}
+	return matched, nil
+}
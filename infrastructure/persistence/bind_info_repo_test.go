@@ -2,10 +2,14 @@ package persistence
 
 import (
 	"context"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -58,3 +62,119 @@ func TestBindInfoRepo(t *testing.T) {
 
 	t.Logf("Update: %+v", *newBindInfo)
 }
+
+func TestListBindInfosByNotionPage(t *testing.T) {
+	repo := NewBindInfoRepo(newTestDB(t))
+
+	for id, info := range map[string]string{
+		"lark_xxx": `{"notion_secret_key": "secret", "notion_page_id": "db_xxx"}`,
+		"wx_xxx":   `{"notion_secret_key": "secret", "notion_page_id": "db_xxx"}`,
+		// only a prefix of it
+		"wx_yyy": `{"notion_secret_key": "secret", "notion_page_id": "db_xxx_2"}`,
+	} {
+		bind := entity.BindInfo{UnionUserID: id, BindPlatform: uint8(entity.BindPlatformTypeNotion), PageInfo: info}
+		if err := repo.UpdateOrInsert(context.TODO(), &bind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := entity.BindInfo{UnionUserID: "lark_yyy", BindPlatform: uint8(entity.BindPlatformTypeLarkDoc),
+		PageInfo: `{"doc_token": "db_xxx"}`}
+	if err := repo.UpdateOrInsert(context.TODO(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	binds, err := repo.ListBindInfosByNotionPage(context.TODO(), "db_xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, b := range binds {
+		ids = append(ids, b.UnionUserID)
+	}
+	sort.Strings(ids)
+	if expected := []string{"lark_xxx", "wx_xxx"}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected %v, got %v", expected, ids)
+	}
+}
+
+func TestBindInfoUpdateSettings(t *testing.T) {
+	repo := NewBindInfoRepo(newTestDB(t))
+	bind := entity.BindInfo{UnionUserID: "lark_xxx", BindPlatform: uint8(entity.BindPlatformTypeNotion), PageInfo: pageInfo}
+	if err := repo.UpdateOrInsert(context.TODO(), &bind); err != nil {
+		t.Fatal(err)
+	}
+
+	// no count is lost by concurrent updates
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.UpdateSettings(context.TODO(), "lark_xxx", func(s *entity.BindSettings) error {
+				if s.PagesToday == nil {
+					s.PagesToday = &entity.DayCount{Day: "2022-04-15"}
+				}
+				s.PagesToday.Count++
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// nor by binding another page
+	rebind := entity.BindInfo{UnionUserID: "lark_xxx", BindPlatform: uint8(entity.BindPlatformTypeNotion), PageInfo: pageInfo}
+	if err := repo.UpdateOrInsert(context.TODO(), &rebind); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := repo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, _ := latest.GetSettings()
+	if settings.PagesToday == nil || settings.PagesToday.Count != 20 {
+		t.Fatalf("expected 20 pages counted, got %+v", settings.PagesToday)
+	}
+
+	if _, err := repo.UpdateSettings(context.TODO(), "lark_xxx", func(s *entity.BindSettings) error {
+		s.Ack = entity.AckReaction
+		return repository.ErrSettingsUnchanged
+	}); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ = repo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if settings, _ := latest.GetSettings(); settings.Ack != "" {
+		t.Fatalf("expected the settings unchanged, got %+v", settings)
+	}
+}
+
+func TestBindInfoUpdateNullSettings(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewBindInfoRepo(db)
+	bind := entity.BindInfo{UnionUserID: "lark_xxx", BindPlatform: uint8(entity.BindPlatformTypeNotion), PageInfo: pageInfo}
+	if err := repo.UpdateOrInsert(context.TODO(), &bind); err != nil {
+		t.Fatal(err)
+	}
+	// bound before the column was added
+	if err := db.Exec("UPDATE bind_infos SET settings = NULL WHERE id = ?", bind.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	// and bound again since
+	rebind := entity.BindInfo{UnionUserID: "lark_xxx", BindPlatform: uint8(entity.BindPlatformTypeNotion), PageInfo: pageInfo}
+	if err := repo.UpdateOrInsert(context.TODO(), &rebind); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.UpdateSettings(context.TODO(), "lark_xxx", func(s *entity.BindSettings) error {
+		s.Ack = entity.AckReaction
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := repo.GetBindInfoByUnionUserID(context.TODO(), "lark_xxx")
+	if settings, _ := latest.GetSettings(); settings.Ack != entity.AckReaction {
+		t.Fatalf("expected the settings updated, got %+v", settings)
+	}
+}
@@ -13,6 +13,9 @@ import (
 type Repositories struct {
 	BindInfoRepo        repository.BindInfoRepository
 	LarkBotRegistarRepo repository.LarkBotRegistarRepository
+	MemoRepo            repository.MemoRepository
+	FlagRepo            repository.FlagRepository
+	AnalyticsRepo       repository.AnalyticsRepository
 
 	db *gorm.DB
 }
@@ -32,10 +35,23 @@ func NewRepositories(dbUser, dbPassword, dbPort,
 	return &Repositories{
 		BindInfoRepo:        NewBindInfoRepo(db),
 		LarkBotRegistarRepo: NewLarkBotRegistarRepo(db),
+		MemoRepo:            NewMemoRepo(db),
+		FlagRepo:            NewFlagRepo(db),
+		AnalyticsRepo:       NewAnalyticsRepo(db),
 		db:                  db,
 	}, nil
 }
 
 func (s *Repositories) AutoMigrate() error {
-	return s.db.AutoMigrate(&entity.BindInfo{}, &entity.LarkBotRegistar{})
+	return s.db.AutoMigrate(&entity.BindInfo{}, &entity.LarkBotRegistar{}, &entity.Memo{}, &entity.Flag{}, &entity.MemoAnalytics{})
+}
+
+// Close closes the connections to the database
+func (s *Repositories) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
 }
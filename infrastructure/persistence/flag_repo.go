@@ -0,0 +1,40 @@
+package persistence
+
+import (
+	"context"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"gorm.io/gorm"
+)
+
+type flagRepo struct {
+	db *gorm.DB
+}
+
+func NewFlagRepo(db *gorm.DB) *flagRepo {
+	return &flagRepo{db: db}
+}
+
+var _ repository.FlagRepository = &flagRepo{}
+
+func (repo *flagRepo) GetFlag(ctx context.Context, name string) (*entity.Flag, error) {
+	var flag entity.Flag
+	if err := repo.db.Where("name = ?", name).First(&flag).Error; err != nil {
+		return nil, err
+	}
+
+	return &flag, nil
+}
+
+func (repo *flagRepo) SetFlag(ctx context.Context, name, value string) error {
+	var flag entity.Flag
+	err := repo.db.Where("name = ?", name).First(&flag).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	flag.Name = name
+	flag.Value = value
+	return repo.db.Save(&flag).Error
+}
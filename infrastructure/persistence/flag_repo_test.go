@@ -0,0 +1,31 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"gorm.io/gorm"
+)
+
+func TestFlagRepo(t *testing.T) {
+	repo := NewFlagRepo(newTestDB(t))
+
+	if _, err := repo.GetFlag(context.TODO(), entity.FlagNotionWritesEnabled); err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	for _, v := range []string{"false", "true"} {
+		if err := repo.SetFlag(context.TODO(), entity.FlagNotionWritesEnabled, v); err != nil {
+			t.Fatal(err)
+		}
+
+		flag, err := repo.GetFlag(context.TODO(), entity.FlagNotionWritesEnabled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flag.Value != v || flag.ID != 1 {
+			t.Fatalf("unexpected flag %+v", flag)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"gorm.io/gorm"
+)
+
+type memoRepo struct {
+	db *gorm.DB
+}
+
+func NewMemoRepo(db *gorm.DB) *memoRepo {
+	return &memoRepo{db: db}
+}
+
+var _ repository.MemoRepository = &memoRepo{}
+
+// scope limits the queries to accountID, it fails when there's no account
+func (repo *memoRepo) scope(accountID string) (*gorm.DB, error) {
+	if accountID == "" {
+		return nil, repository.ErrAccountRequired
+	}
+
+	return repo.db.Where("union_user_id = ?", accountID), nil
+}
+
+func (repo *memoRepo) Create(ctx context.Context, m *entity.Memo) error {
+	if m.UnionUserID == "" {
+		return repository.ErrAccountRequired
+	}
+
+	return repo.db.Create(m).Error
+}
+
+func (repo *memoRepo) Update(ctx context.Context, accountID string, m *entity.Memo) error {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return err
+	}
+
+	// never move a memo to another account
+	if m.UnionUserID != accountID {
+		return gorm.ErrRecordNotFound
+	}
+
+	res := db.Model(m).Select("*").Omit("created_at", "reviewed").Updates(m)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (repo *memoRepo) GetMemoByID(ctx context.Context, accountID string, id uint) (*entity.Memo, error) {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var memo entity.Memo
+	if err := db.First(&memo, id).Error; err != nil {
+		return nil, err
+	}
+
+	return &memo, nil
+}
+
+func (repo *memoRepo) ListMemos(ctx context.Context, accountID string) ([]entity.Memo, error) {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var memos []entity.Memo
+	if err := db.Order("id").Find(&memos).Error; err != nil {
+		return nil, err
+	}
+
+	return memos, nil
+}
+
+// ListMemosByStatus returns the oldest limit memos of accountID in status
+func (repo *memoRepo) ListMemosByStatus(ctx context.Context, accountID string, status entity.MemoStatusType, limit int) ([]entity.Memo, error) {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var memos []entity.Memo
+	err = db.Where("status = ?", uint8(status)).Order("id").Limit(limit).Find(&memos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return memos, nil
+}
+
+func (repo *memoRepo) ListMemosToReview(ctx context.Context, accountID string, since time.Time, limit int) ([]entity.Memo, error) {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var memos []entity.Memo
+	err = db.Where("status = ? AND reviewed = ? AND created_at >= ?", uint8(entity.MemoStatusSaved), false, since).
+		Order("id").Limit(limit).Find(&memos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return memos, nil
+}
+
+func (repo *memoRepo) MarkMemosReviewed(ctx context.Context, accountID string, ids []uint) error {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return db.Model(&entity.Memo{}).Where("id IN ?", ids).Update("reviewed", true).Error
+}
+
+func (repo *memoRepo) ClaimMemo(ctx context.Context, accountID string, id uint) (bool, error) {
+	db, err := repo.scope(accountID)
+	if err != nil {
+		return false, err
+	}
+
+	// only one of the concurrent updates matches the pending row
+	res := db.Model(&entity.Memo{}).Where("id = ? AND status = ?", id, uint8(entity.MemoStatusPending)).
+		Update("status", uint8(entity.MemoStatusProcessing))
+	if res.Error != nil || res.RowsAffected != 1 {
+		return false, res.Error
+	}
+
+	// checked after the claim, of two workers claiming memos of the account
+	// the one of the later memo sees the other and gives it up
+	var older int64
+	err = repo.db.Model(&entity.Memo{}).Where("union_user_id = ? AND id < ? AND status IN ?", accountID, id,
+		[]int{int(entity.MemoStatusPending), int(entity.MemoStatusProcessing)}).Count(&older).Error
+	if err == nil && older == 0 {
+		return true, nil
+	}
+	if res := repo.db.Model(&entity.Memo{}).Where("id = ? AND status = ?", id, uint8(entity.MemoStatusProcessing)).
+		Update("status", uint8(entity.MemoStatusPending)); res.Error != nil && err == nil {
+		err = res.Error
+	}
+	return false, err
+}
+
+func (repo *memoRepo) ReleaseMemos(ctx context.Context, before time.Time) (int, error) {
+	res := repo.db.Model(&entity.Memo{}).Where("status = ? AND updated_at < ?", uint8(entity.MemoStatusProcessing), before).
+		Update("status", uint8(entity.MemoStatusPending))
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	return int(res.RowsAffected), nil
+}
+
+func (repo *memoRepo) ListAccountsByStatus(ctx context.Context, status entity.MemoStatusType) ([]string, error) {
+	var accounts []string
+	err := repo.db.Model(&entity.Memo{}).Where("status = ?", uint8(status)).
+		Distinct().Order("union_user_id").Pluck("union_user_id", &accounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (repo *memoRepo) CountMemosByError(ctx context.Context, statuses ...entity.MemoStatusType) ([]entity.MemoErrorCount, error) {
+	// not []uint8, which is bound as bytes
+	values := make([]int, 0, len(statuses))
+	for _, status := range statuses {
+		values = append(values, int(status))
+	}
+
+	var counts []entity.MemoErrorCount
+	err := repo.db.Model(&entity.Memo{}).Select("status, last_error, count(*) as count").
+		Where("status IN ?", values).Group("status, last_error").Order("status, last_error").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,330 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KDF5000/nomo/domain/entity"
+	"github.com/KDF5000/nomo/domain/repository"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every new connection opens another empty memory database
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	repos := &Repositories{db: db}
+	if err := repos.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestMemoRepoMetadata(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	meta := entity.MemoMetadata{
+		Platform:   "lark",
+		AppID:      "cli_xxx",
+		EventID:    "event_xxx",
+		MessageID:  "om_xxx",
+		ChatID:     "oc_xxx",
+		CreateTime: "1650000000000",
+	}
+	data, _ := json.Marshal(&meta)
+	memo := entity.Memo{
+		UnionUserID:  "lark_xxx",
+		BindPlatform: uint8(entity.BindPlatformTypeNotion),
+		Content:      "#科技 technology change our life!",
+		Status:       uint8(entity.MemoStatusSaved),
+		Metadata:     string(data),
+	}
+	if err := repo.Create(context.TODO(), &memo); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetMemoByID(context.TODO(), "lark_xxx", memo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotMeta entity.MemoMetadata
+	if err := json.Unmarshal([]byte(got.Metadata), &gotMeta); err != nil {
+		t.Fatal(err)
+	}
+	if gotMeta != meta {
+		t.Fatalf("expected: %+v, got: %+v", meta, gotMeta)
+	}
+	if got.Content != memo.Content {
+		t.Fatalf("expected: %s, got: %s", memo.Content, got.Content)
+	}
+}
+
+func TestMemoRepoRawContent(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	memo := entity.Memo{
+		UnionUserID: "lark_xxx",
+		Content:     " #科技 technology change our life!",
+		RawContent:  "@_user_1 #科技 technology change our life!",
+	}
+	if err := repo.Create(context.TODO(), &memo); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetMemoByID(context.TODO(), "lark_xxx", memo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Content != memo.Content || got.RawContent != memo.RawContent {
+		t.Fatalf("expected: %q/%q, got: %q/%q", memo.Content, memo.RawContent, got.Content, got.RawContent)
+	}
+}
+
+func TestMemoRepoList(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	for _, id := range []string{"lark_xxx", "lark_yyy", "lark_xxx"} {
+		if err := repo.Create(context.TODO(), &entity.Memo{UnionUserID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	memos, err := repo.ListMemos(context.TODO(), "lark_xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memos) != 2 || memos[0].ID != 1 || memos[1].ID != 3 {
+		t.Fatalf("unexpected memos %+v", memos)
+	}
+}
+
+func TestMemoRepoListByStatus(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	memos := []entity.Memo{
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusSaved)},
+		{UnionUserID: "lark_yyy", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_zzz", Status: uint8(entity.MemoStatusSaved)},
+	}
+	for i := range memos {
+		if err := repo.Create(context.TODO(), &memos[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accounts, err := repo.ListAccountsByStatus(context.TODO(), entity.MemoStatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0] != "lark_xxx" || accounts[1] != "lark_yyy" {
+		t.Fatalf("unexpected accounts %+v", accounts)
+	}
+
+	got, err := repo.ListMemosByStatus(context.TODO(), "lark_xxx", entity.MemoStatusPending, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != 1 || got[1].ID != 4 {
+		t.Fatalf("unexpected memos %+v", got)
+	}
+}
+
+func TestMemoRepoReview(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	since := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	memos := []entity.Memo{
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusSaved)},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusSaved)},
+		{UnionUserID: "lark_yyy", Status: uint8(entity.MemoStatusSaved)},
+		// before since
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusSaved)},
+	}
+	for i := range memos {
+		memos[i].CreatedAt = since.Add(time.Hour)
+	}
+	memos[4].CreatedAt = since.Add(-time.Hour)
+	for i := range memos {
+		if err := repo.Create(context.TODO(), &memos[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.MarkMemosReviewed(context.TODO(), "lark_xxx", []uint{1, 4}); err != nil {
+		t.Fatal(err)
+	}
+	// not unmarked by other writes
+	memos[0].LastError = "patched"
+	if err := repo.Update(context.TODO(), "lark_xxx", &memos[0]); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.ListMemosToReview(context.TODO(), "lark_xxx", since, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != 3 {
+		t.Fatalf("unexpected memos %+v", got)
+	}
+	// memo 4 is of another account
+	if other, _ := repo.GetMemoByID(context.TODO(), "lark_yyy", 4); other.Reviewed {
+		t.Fatalf("unexpected memo of another account marked %+v", other)
+	}
+}
+
+func TestMemoRepoClaim(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	memos := []entity.Memo{
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusSaved)},
+	}
+	for i := range memos {
+		if err := repo.Create(context.TODO(), &memos[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the first claim wins
+	for i, expected := range []bool{true, false} {
+		if claimed, err := repo.ClaimMemo(context.TODO(), "lark_xxx", 1); err != nil || claimed != expected {
+			t.Fatalf("claim %d, expected %v, got %v, err=%v", i, expected, claimed, err)
+		}
+	}
+	if claimed, _ := repo.ClaimMemo(context.TODO(), "lark_xxx", 2); claimed {
+		t.Fatal("unexpected saved memo claimed")
+	}
+	if claimed, _ := repo.ClaimMemo(context.TODO(), "lark_yyy", 1); claimed {
+		t.Fatal("unexpected memo claimed by another account")
+	}
+	if got, _ := repo.GetMemoByID(context.TODO(), "lark_xxx", 1); got.Status != uint8(entity.MemoStatusProcessing) {
+		t.Fatalf("expected the memo processing, got %+v", got)
+	}
+	// later memos wait for the processing one
+	later := entity.Memo{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)}
+	if err := repo.Create(context.TODO(), &later); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := repo.ClaimMemo(context.TODO(), "lark_xxx", later.ID); err != nil || claimed {
+		t.Fatalf("unexpected later memo claimed, err=%v", err)
+	}
+	if got, _ := repo.GetMemoByID(context.TODO(), "lark_xxx", later.ID); got.Status != uint8(entity.MemoStatusPending) {
+		t.Fatalf("expected the later memo pending, got %+v", got)
+	}
+
+	// processing for a while only
+	if n, err := repo.ReleaseMemos(context.TODO(), time.Now().Add(-time.Minute)); err != nil || n != 0 {
+		t.Fatalf("expected no memo released, got %d, err=%v", n, err)
+	}
+	if n, err := repo.ReleaseMemos(context.TODO(), time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected the memo released, got %d, err=%v", n, err)
+	}
+	if got, _ := repo.GetMemoByID(context.TODO(), "lark_xxx", 1); got.Status != uint8(entity.MemoStatusPending) {
+		t.Fatalf("expected the memo pending again, got %+v", got)
+	}
+}
+
+func TestMemoRepoAccountScope(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	memo := entity.Memo{UnionUserID: "lark_xxx", Content: "secret memo"}
+	if err := repo.Create(context.TODO(), &memo); err != nil {
+		t.Fatal(err)
+	}
+
+	// scoping is mandatory
+	if err := repo.Create(context.TODO(), &entity.Memo{Content: "no account"}); err != repository.ErrAccountRequired {
+		t.Fatalf("create without account, got %v", err)
+	}
+	if _, err := repo.GetMemoByID(context.TODO(), "", memo.ID); err != repository.ErrAccountRequired {
+		t.Fatalf("get without account, got %v", err)
+	}
+	if _, err := repo.ListMemos(context.TODO(), ""); err != repository.ErrAccountRequired {
+		t.Fatalf("list without account, got %v", err)
+	}
+	if _, err := repo.ListMemosByStatus(context.TODO(), "", entity.MemoStatusSaved, 10); err != repository.ErrAccountRequired {
+		t.Fatalf("list by status without account, got %v", err)
+	}
+	if err := repo.Update(context.TODO(), "", &memo); err != repository.ErrAccountRequired {
+		t.Fatalf("update without account, got %v", err)
+	}
+
+	// another account can't touch the memo
+	if _, err := repo.GetMemoByID(context.TODO(), "lark_yyy", memo.ID); err != gorm.ErrRecordNotFound {
+		t.Fatalf("get by another account, got %v", err)
+	}
+	if memos, err := repo.ListMemos(context.TODO(), "lark_yyy"); err != nil || len(memos) != 0 {
+		t.Fatalf("list by another account, got %+v, %v", memos, err)
+	}
+
+	stolen := memo
+	stolen.Content = "overwritten"
+	if err := repo.Update(context.TODO(), "lark_yyy", &stolen); err != gorm.ErrRecordNotFound {
+		t.Fatalf("update by another account, got %v", err)
+	}
+	stolen.UnionUserID = "lark_yyy"
+	if err := repo.Update(context.TODO(), "lark_yyy", &stolen); err != gorm.ErrRecordNotFound {
+		t.Fatalf("update to another account, got %v", err)
+	}
+
+	got, err := repo.GetMemoByID(context.TODO(), "lark_xxx", memo.ID)
+	if err != nil || got.Content != "secret memo" || got.UnionUserID != "lark_xxx" {
+		t.Fatalf("memo should be untouched, got %+v, %v", got, err)
+	}
+
+	// the owner can update it
+	memo.Content = "updated"
+	if err := repo.Update(context.TODO(), "lark_xxx", &memo); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.GetMemoByID(context.TODO(), "lark_xxx", memo.ID); got.Content != "updated" || got.CreatedAt.IsZero() {
+		t.Fatalf("unexpected memo %+v", got)
+	}
+}
+
+func TestMemoRepoCountByError(t *testing.T) {
+	repo := NewMemoRepo(newTestDB(t))
+
+	memos := []entity.Memo{
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending)},
+		{UnionUserID: "lark_yyy", Status: uint8(entity.MemoStatusPending), LastError: "timeout"},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusPending), LastError: "timeout"},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusFailed), LastError: "timeout"},
+		{UnionUserID: "lark_zzz", Status: uint8(entity.MemoStatusFailed), LastError: "not found"},
+		{UnionUserID: "lark_xxx", Status: uint8(entity.MemoStatusSaved)},
+	}
+	for i := range memos {
+		if err := repo.Create(context.TODO(), &memos[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := repo.CountMemosByError(context.TODO(), entity.MemoStatusPending, entity.MemoStatusFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []entity.MemoErrorCount{
+		{Status: uint8(entity.MemoStatusFailed), LastError: "not found", Count: 1},
+		{Status: uint8(entity.MemoStatusFailed), LastError: "timeout", Count: 1},
+		{Status: uint8(entity.MemoStatusPending), LastError: "", Count: 1},
+		{Status: uint8(entity.MemoStatusPending), LastError: "timeout", Count: 2},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, counts)
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// lark image keys are letters, digits, '_' and '-', anything else is
+	// replaced to keep the file in the directory
+	imageNameRegexp = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+	imageExtensions = map[string]string{
+		"image/png":  ".png",
+		"image/jpeg": ".jpg",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+		"image/bmp":  ".bmp",
+	}
+)
+
+// DirImageStore keeps images as files of a directory served at baseURL
+type DirImageStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewDirImageStore creates dir if it doesn't exist, baseURL is where notion
+// reads the files of dir from, so it must be public.
+func NewDirImageStore(dir, baseURL string) (*DirImageStore, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("no url for the images of %s", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirImageStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put writes data to the file of name and returns its url, the same name
+// overwrites the file.
+func (s *DirImageStore) Put(name, contentType string, data []byte) (string, error) {
+	name = imageNameRegexp.ReplaceAllString(name, "_")
+	if name == "" {
+		return "", fmt.Errorf("empty image name")
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	file := name + imageExtensions[strings.TrimSpace(strings.ToLower(contentType))]
+
+	// written aside first, a half written file is never served
+	tmp, err := ioutil.TempFile(s.dir, "."+file+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, file)); err != nil {
+		return "", err
+	}
+
+	return s.baseURL + "/" + file, nil
+}
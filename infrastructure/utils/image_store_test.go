@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirImageStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewDirImageStore(dir, ""); err == nil {
+		t.Fatal("expected error without the url")
+	}
+	store, err := NewDirImageStore(filepath.Join(dir, "lark"), "https://nomo.example.com/images/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name        string
+		ContentType string
+		URL         string
+		File        string
+	}{
+		{Name: "img_v2_abc-1", ContentType: "image/png", URL: "https://nomo.example.com/images/img_v2_abc-1.png", File: "img_v2_abc-1.png"},
+		{Name: "img_jpeg", ContentType: "image/jpeg; charset=binary", URL: "https://nomo.example.com/images/img_jpeg.jpg", File: "img_jpeg.jpg"},
+		{Name: "img_unknown", ContentType: "application/octet-stream", URL: "https://nomo.example.com/images/img_unknown", File: "img_unknown"},
+		// never out of the directory
+		{Name: "../../etc/passwd", ContentType: "image/png", URL: "https://nomo.example.com/images/______etc_passwd.png", File: "______etc_passwd.png"},
+	}
+	for _, tc := range cases {
+		url, err := store.Put(tc.Name, tc.ContentType, []byte(tc.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != tc.URL {
+			t.Fatalf("name: %s, expected url %s, got %s", tc.Name, tc.URL, url)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "lark", tc.File))
+		if err != nil || string(data) != tc.Name {
+			t.Fatalf("name: %s, expected file %s written, got %q, err=%v", tc.Name, tc.File, data, err)
+		}
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(dir, "lark"))
+	if len(files) != len(cases) {
+		t.Fatalf("expected only the images left in the directory, got %d files", len(files))
+	}
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLarkOpenAPI = "https://open.feishu.cn/open-apis"
+
+	// ✅
+	ReactionDone = "DONE"
+)
+
+// LarkOpenAPI calls the lark open apis which are missing in larkbot
+type LarkOpenAPI struct {
+	baseURI string
+	client  *http.Client
+	// of message resources, which take longer than the api calls
+	resourceClient *http.Client
+	clock          Clock
+	// app id => tenant access token
+	tokensMu sync.Mutex
+	tokens   map[string]tenantToken
+	// of the token endpoint, shared by the apps
+	tokenBreaker *circuitBreaker
+}
+
+func NewLarkOpenAPI(baseURI string) *LarkOpenAPI {
+	if baseURI == "" {
+		baseURI = DefaultLarkOpenAPI
+	}
+
+	return &LarkOpenAPI{
+		baseURI: baseURI,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		// images of the max size on a slow network
+		resourceClient: &http.Client{Timeout: time.Minute},
+		clock:          RealClock,
+		tokens:         make(map[string]tenantToken),
+		tokenBreaker:   newCircuitBreaker(tokenBreakerFailures, tokenBreakerCooldown),
+	}
+}
+
+type larkResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"msg"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type tenantAccessTokenResponse struct {
+	Code              int    `json:"code"`
+	Message           string `json:"msg"`
+	TenantAccessToken string `json:"tenant_access_token"`
+	Expire            int64  `json:"expire"`
+}
+
+func (api *LarkOpenAPI) post(path string, headers map[string]string, in, out interface{}) error {
+	return api.request(http.MethodPost, path, headers, in, out)
+}
+
+func (api *LarkOpenAPI) request(method, path string, headers map[string]string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(payload)
+	}
+
+	req, err := http.NewRequest(method, api.baseURI+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode lark response error, status=%s, err=%v", resp.Status, err)
+	}
+
+	return nil
+}
+
+// Call sends a request authorized by the tenant access token of app
+// and decodes data of the response into out if it's not nil.
+func (api *LarkOpenAPI) Call(appID, secretKey, method, path string, in, out interface{}) error {
+	token, err := api.TenantAccessToken(appID, secretKey)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	var resp larkResponse
+	if err := api.request(method, path, headers, in, &resp); err != nil {
+		return err
+	}
+
+	if resp.Code != 0 {
+		return fmt.Errorf("lark api %s error, code=%d, msg=%s", path, resp.Code, resp.Message)
+	}
+
+	if out == nil || len(resp.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+func (api *LarkOpenAPI) AddReaction(appID, secretKey, messageID, emojiType string) error {
+	req := map[string]interface{}{
+		"reaction_type": map[string]string{"emoji_type": emojiType},
+	}
+
+	return api.Call(appID, secretKey, http.MethodPost,
+		fmt.Sprintf("/im/v1/messages/%s/reactions", messageID), req, nil)
+}
+
+// ReplyMessage replies text msg to message messageID, or sends it to chat
+// chatID if messageID is empty
+func (api *LarkOpenAPI) ReplyMessage(appID, secretKey, chatID, messageID, msg string) error {
+	content, _ := json.Marshal(map[string]string{"text": msg})
+	req := map[string]string{
+		"msg_type": "text",
+		"content":  string(content),
+	}
+	if messageID != "" {
+		return api.Call(appID, secretKey, http.MethodPost, fmt.Sprintf("/im/v1/messages/%s/reply", messageID), req, nil)
+	}
+
+	req["receive_id"] = chatID
+	return api.Call(appID, secretKey, http.MethodPost, "/im/v1/messages?receive_id_type=chat_id", req, nil)
+}
+
+type ChatInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (api *LarkOpenAPI) GetChatInfo(appID, secretKey, chatID string) (*ChatInfo, error) {
+	var info ChatInfo
+	if err := api.Call(appID, secretKey, http.MethodGet, fmt.Sprintf("/im/v1/chats/%s", chatID), nil, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// ResourceTooLargeError is returned for a message resource over Max bytes,
+// Size is -1 if lark didn't tell the size of it
+type ResourceTooLargeError struct {
+	Size int64
+	Max  int64
+}
+
+func (e *ResourceTooLargeError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("resource over the max size %d", e.Max)
+	}
+	return fmt.Sprintf("resource of size %d over the max size %d", e.Size, e.Max)
+}
+
+// MessageResource downloads resource fileKey of type resourceType, e.g.
+// image, of message messageID, with its content type. At most maxSize bytes
+// are read, it fails with ResourceTooLargeError beyond.
+func (api *LarkOpenAPI) MessageResource(appID, secretKey, messageID, fileKey, resourceType string, maxSize int64) ([]byte, string, error) {
+	token, err := api.TenantAccessToken(appID, secretKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	path := fmt.Sprintf("/im/v1/messages/%s/resources/%s?type=%s", messageID, fileKey, resourceType)
+	req, err := http.NewRequest(http.MethodGet, api.baseURI+path, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := api.resourceClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var lr larkResponse
+		if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+			return nil, "", fmt.Errorf("lark api %s error, status=%s", path, resp.Status)
+		}
+		return nil, "", fmt.Errorf("lark api %s error, code=%d, msg=%s", path, lr.Code, lr.Message)
+	}
+
+	// don't read what's over anyway
+	if resp.ContentLength > maxSize {
+		return nil, "", &ResourceTooLargeError{Size: resp.ContentLength, Max: maxSize}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, "", &ResourceTooLargeError{Size: -1, Max: maxSize}
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
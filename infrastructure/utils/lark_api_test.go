@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLarkAddReaction(t *testing.T) {
+	var tokenCalls int
+	var reaction string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/v3/tenant_access_token/internal":
+			tokenCalls++
+			w.Write([]byte(`{"code": 0, "tenant_access_token": "t-xxx", "expire": 7200}`))
+		case "/im/v1/messages/om_xxx/reactions":
+			if r.Header.Get("Authorization") != "Bearer t-xxx" {
+				w.Write([]byte(`{"code": 99991663, "msg": "invalid token"}`))
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			reaction = string(data)
+			w.Write([]byte(`{"code": 0, "data": {}}`))
+		default:
+			w.Write([]byte(`{"code": 230002, "msg": "no permission"}`))
+		}
+	}))
+	defer server.Close()
+
+	api := NewLarkOpenAPI(server.URL)
+	for i := 0; i < 2; i++ {
+		if err := api.AddReaction("cli_xxx", "secret", "om_xxx", ReactionDone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if reaction != `{"reaction_type":{"emoji_type":"DONE"}}` {
+		t.Fatalf("unexpected reaction %s", reaction)
+	}
+	if tokenCalls != 1 {
+		t.Fatalf("expected token to be cached, got %d calls", tokenCalls)
+	}
+
+	if err := api.AddReaction("cli_xxx", "secret", "om_yyy", ReactionDone); err == nil {
+		t.Fatal("expected no permission error")
+	}
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// fakeLarkServer answers the token endpoint unless it's down, and records
+// the replies sent with the token
+type fakeLarkServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	down       bool
+	tokenCalls int
+	replies    []string
+}
+
+func newFakeLarkServer() *fakeLarkServer {
+	s := &fakeLarkServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case r.URL.Path == "/auth/v3/tenant_access_token/internal":
+			s.tokenCalls++
+			if s.down {
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte("bad gateway"))
+				return
+			}
+			if data, _ := ioutil.ReadAll(r.Body); strings.Contains(string(data), `"app_id":"cli_bad"`) {
+				w.Write([]byte(`{"code": 10014, "msg": "app secret invalid"}`))
+				return
+			}
+			w.Write([]byte(`{"code": 0, "tenant_access_token": "t-xxx", "expire": 7200}`))
+		case strings.HasSuffix(r.URL.Path, "/reply") && r.Header.Get("Authorization") == "Bearer t-xxx":
+			data, _ := ioutil.ReadAll(r.Body)
+			s.replies = append(s.replies, r.URL.Path+" "+string(data))
+			w.Write([]byte(`{"code": 0, "data": {}}`))
+		default:
+			w.Write([]byte(`{"code": 99991663, "msg": "invalid token"}`))
+		}
+	}))
+	return s
+}
+
+func (s *fakeLarkServer) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func TestCachedTokenDuringOutage(t *testing.T) {
+	server := newFakeLarkServer()
+	defer server.Close()
+	clock := &testClock{now: time.Unix(1650000000, 0)}
+	api := NewLarkOpenAPI(server.URL)
+	api.clock = clock
+	messenger := NewLarkMessenger(api)
+
+	if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", "om_1", "saved"); err != nil {
+		t.Fatal(err)
+	}
+
+	// due for refresh but still valid while the endpoint is down
+	server.setDown(true)
+	clock.now = clock.now.Add(7200*time.Second - time.Minute)
+	for i := 0; i < 5; i++ {
+		if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", "om_2", "saved"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(server.replies) != 6 {
+		t.Fatalf("expected the replies sent with the cached token, got %v", server.replies)
+	}
+	// the breaker stops calling the endpoint after a few failures
+	if server.tokenCalls != 1+tokenBreakerFailures {
+		t.Fatalf("expected %d token calls, got %d", 1+tokenBreakerFailures, server.tokenCalls)
+	}
+}
+
+func TestQueueRepliesWithoutToken(t *testing.T) {
+	server := newFakeLarkServer()
+	defer server.Close()
+	server.setDown(true)
+	clock := &testClock{now: time.Unix(1650000000, 0)}
+	api := NewLarkOpenAPI(server.URL)
+	api.clock = clock
+	messenger := NewLarkMessenger(api).(*larkMessenger)
+
+	for _, id := range []string{"om_1", "om_2"} {
+		if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", id, "saved "+id); !errors.Is(err, ErrReplyQueued) {
+			t.Fatalf("expected the reply queued, got %v", err)
+		}
+	}
+	if left := messenger.FlushReplies(); left != 2 || len(server.replies) != 0 {
+		t.Fatalf("expected 2 replies queued, got %d left, %v sent", left, server.replies)
+	}
+
+	// sent in order once the endpoint is back and the breaker lets it try
+	server.setDown(false)
+	clock.now = clock.now.Add(tokenBreakerCooldown)
+	if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", "om_3", "saved om_3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.replies) != 3 || !strings.HasPrefix(server.replies[0], "/im/v1/messages/om_1/reply") ||
+		!strings.HasPrefix(server.replies[2], "/im/v1/messages/om_3/reply") {
+		t.Fatalf("expected the queued replies sent first, got %v", server.replies)
+	}
+	if !strings.Contains(server.replies[0], `"content":"{\"text\":\"saved om_1\"}"`) {
+		t.Fatalf("unexpected reply %s", server.replies[0])
+	}
+}
+
+func TestRefusedAppDoesNotQueue(t *testing.T) {
+	server := newFakeLarkServer()
+	defer server.Close()
+	clock := &testClock{now: time.Unix(1650000000, 0)}
+	api := NewLarkOpenAPI(server.URL)
+	api.clock = clock
+	messenger := NewLarkMessenger(api).(*larkMessenger)
+
+	err := messenger.Reply("cli_bad", "wrong", "oc_xxx", "om_1", "saved")
+	if err == nil || errors.Is(err, ErrReplyQueued) || errors.Is(err, ErrLarkTokenUnavailable) {
+		t.Fatalf("expected a plain error for the refused app, got %v", err)
+	}
+	if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", "om_2", "saved"); err != nil {
+		t.Fatal(err)
+	}
+	if left := messenger.FlushReplies(); left != 0 || len(server.replies) != 1 {
+		t.Fatalf("expected nothing queued, got %d left, %v sent", left, server.replies)
+	}
+}
+
+func TestRepliesQueuedPerApp(t *testing.T) {
+	server := newFakeLarkServer()
+	defer server.Close()
+	clock := &testClock{now: time.Unix(1650000000, 0)}
+	api := NewLarkOpenAPI(server.URL)
+	api.clock = clock
+	messenger := NewLarkMessenger(api).(*larkMessenger)
+
+	// cli_xxx has a cached token, cli_yyy gets none during the outage
+	if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", "om_1", "saved"); err != nil {
+		t.Fatal(err)
+	}
+	server.setDown(true)
+	if err := messenger.Reply("cli_yyy", "secret", "oc_yyy", "om_2", "saved"); !errors.Is(err, ErrReplyQueued) {
+		t.Fatalf("expected the reply queued, got %v", err)
+	}
+	if err := messenger.Reply("cli_xxx", "secret", "oc_xxx", "om_3", "saved"); err != nil {
+		t.Fatalf("expected the other app not blocked by the queue, got %v", err)
+	}
+	if len(server.replies) != 2 || messenger.FlushReplies() != 1 {
+		t.Fatalf("expected only the reply of cli_yyy queued, got %v sent", server.replies)
+	}
+}
@@ -1,16 +1,182 @@
 package utils
 
 import (
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/KDF5000/pkg/larkbot"
+	"github.com/KDF5000/pkg/log"
+)
+
+const (
+	// replies kept while there's no token, the oldest are dropped beyond
+	maxQueuedReplies = 100
+	// queued replies older than this are dropped rather than sent late
+	queuedReplyTTL = time.Hour
 )
 
+// ErrReplyQueued is returned when a reply is queued to be sent once a
+// tenant access token is available again
+var ErrReplyQueued = errors.New("lark reply queued")
+
 type LarkNotify func(msg string)
 
-func ReplyLarkMessage(appid, secretKey, chatID, messageId, msg string) {
+func ReplyLarkMessage(appid, secretKey, chatID, messageId, msg string) error {
 	bot := larkbot.NewLarkBot(larkbot.BotOption{
 		AppID:     appid,
 		AppSecret: secretKey,
 	})
 
-	bot.SendTextMessage(larkbot.IDTypeChatID, chatID, messageId, msg)
+	return bot.SendTextMessage(larkbot.IDTypeChatID, chatID, messageId, msg)
+}
+
+// LarkMessenger sends the bot's responses to a lark message
+type LarkMessenger interface {
+	Reply(appID, secretKey, chatID, messageID, msg string) error
+	AddReaction(appID, secretKey, messageID, emojiType string) error
+	ChatName(appID, secretKey, chatID string) (string, error)
+	// Image downloads image imageKey of message messageID with its content
+	// type, failing with ResourceTooLargeError over maxSize bytes
+	Image(appID, secretKey, messageID, imageKey string, maxSize int64) ([]byte, string, error)
+}
+
+type queuedReply struct {
+	appID, secretKey, chatID, messageID, msg string
+	queuedAt                                 time.Time
+}
+
+// replyQueue holds the replies of one app, sending serializes its flushes
+// so they keep the order without blocking the other apps
+type replyQueue struct {
+	sending sync.Mutex
+	replies []queuedReply
+}
+
+type larkMessenger struct {
+	api *LarkOpenAPI
+
+	mu     sync.Mutex
+	queues map[string]*replyQueue
+}
+
+func NewLarkMessenger(api *LarkOpenAPI) LarkMessenger {
+	return &larkMessenger{api: api, queues: make(map[string]*replyQueue)}
+}
+
+// Reply sends msg, after the replies of the app queued before it. It's
+// queued with ErrReplyQueued if there's no valid token to send it with.
+func (m *larkMessenger) Reply(appID, secretKey, chatID, messageID, msg string) error {
+	reply := queuedReply{appID: appID, secretKey: secretKey, chatID: chatID, messageID: messageID, msg: msg}
+	if m.flushApp(appID) > 0 {
+		// keep the order
+		m.enqueue(reply)
+		return ErrReplyQueued
+	}
+
+	err := m.api.ReplyMessage(appID, secretKey, chatID, messageID, msg)
+	if errors.Is(err, ErrLarkTokenUnavailable) {
+		m.enqueue(reply)
+		return ErrReplyQueued
+	}
+	return err
+}
+
+func (m *larkMessenger) queue(appID string) *replyQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[appID]
+	if !ok {
+		q = &replyQueue{}
+		m.queues[appID] = q
+	}
+	return q
+}
+
+func (m *larkMessenger) enqueue(reply queuedReply) {
+	reply.queuedAt = m.api.clock.Now()
+	q := m.queue(reply.appID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(q.replies) >= maxQueuedReplies {
+		log.Warnf("too many queued lark replies of %s, drop the reply to %s", reply.appID, q.replies[0].messageID)
+		q.replies = q.replies[1:]
+	}
+	q.replies = append(q.replies, reply)
+}
+
+// FlushReplies sends the queued replies of every app in order until a
+// token is unavailable again, and returns the number of them left.
+func (m *larkMessenger) FlushReplies() int {
+	m.mu.Lock()
+	appIDs := make([]string, 0, len(m.queues))
+	for appID := range m.queues {
+		appIDs = append(appIDs, appID)
+	}
+	m.mu.Unlock()
+
+	var left int
+	for _, appID := range appIDs {
+		left += m.flushApp(appID)
+	}
+	return left
+}
+
+// flushApp sends the queued replies of appID in order until its token is
+// unavailable again, and returns the number of them left. m.mu isn't held
+// while sending.
+func (m *larkMessenger) flushApp(appID string) int {
+	q := m.queue(appID)
+	q.sending.Lock()
+	defer q.sending.Unlock()
+
+	now := m.api.clock.Now()
+	for {
+		m.mu.Lock()
+		if len(q.replies) == 0 {
+			m.mu.Unlock()
+			return 0
+		}
+		reply := q.replies[0]
+		m.mu.Unlock()
+
+		if now.Sub(reply.queuedAt) > queuedReplyTTL {
+			log.Warnf("drop the lark reply to %s queued at %s", reply.messageID, reply.queuedAt.Format(time.RFC3339))
+		} else {
+			err := m.api.ReplyMessage(reply.appID, reply.secretKey, reply.chatID, reply.messageID, reply.msg)
+			if errors.Is(err, ErrLarkTokenUnavailable) {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				return len(q.replies)
+			}
+			if err != nil {
+				log.Errorf("failed to send queued lark reply to %s. err=%v", reply.messageID, err)
+			}
+		}
+
+		// unless enqueue dropped it meanwhile for a full queue
+		m.mu.Lock()
+		if len(q.replies) > 0 && q.replies[0] == reply {
+			q.replies = q.replies[1:]
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *larkMessenger) AddReaction(appID, secretKey, messageID, emojiType string) error {
+	return m.api.AddReaction(appID, secretKey, messageID, emojiType)
+}
+
+func (m *larkMessenger) ChatName(appID, secretKey, chatID string) (string, error) {
+	info, err := m.api.GetChatInfo(appID, secretKey, chatID)
+	if err != nil {
+		return "", err
+	}
+
+	return info.Name, nil
+}
+
+func (m *larkMessenger) Image(appID, secretKey, messageID, imageKey string, maxSize int64) ([]byte, string, error) {
+	return m.api.MessageResource(appID, secretKey, messageID, imageKey, "image", maxSize)
 }
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KDF5000/pkg/log"
+)
+
+const (
+	// consecutive failures of the token endpoint that open the breaker,
+	// and how long it stays open before one call is let through again
+	tokenBreakerFailures = 3
+	tokenBreakerCooldown = 30 * time.Second
+	// a token is refreshed this long before it expires, and kept in use
+	// until then if the token endpoint is down
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// ErrLarkTokenUnavailable is returned when no tenant access token can be
+// fetched and there's no valid one cached
+var ErrLarkTokenUnavailable = errors.New("lark tenant access token unavailable")
+
+type tenantToken struct {
+	value     string
+	refreshAt time.Time
+	expiresAt time.Time
+}
+
+// circuitBreaker fails the calls fast for a cooldown once the calls failed
+// a number of times in a row, then lets one call through to try again
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	threshold int
+	cooldown  time.Duration
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may be made at now
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+func (b *circuitBreaker) record(err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// TenantAccessToken returns the cached token of app, a new one once it's
+// about to expire. While the token endpoint is down the cached token is
+// used until it expires, then ErrLarkTokenUnavailable is returned. An app
+// the endpoint refuses gets a plain error, it won't work by waiting.
+func (api *LarkOpenAPI) TenantAccessToken(appID, secretKey string) (string, error) {
+	now := api.clock.Now()
+	api.tokensMu.Lock()
+	token, cached := api.tokens[appID]
+	api.tokensMu.Unlock()
+	if cached && now.Before(token.refreshAt) {
+		return token.value, nil
+	}
+	valid := cached && now.Before(token.expiresAt)
+
+	if !api.tokenBreaker.allow(now) {
+		if valid {
+			return token.value, nil
+		}
+		return "", ErrLarkTokenUnavailable
+	}
+
+	fetched, reached, err := api.fetchTenantAccessToken(appID, secretKey, now)
+	// an app refused, e.g. by a wrong secret, isn't an outage for the others
+	if reached {
+		api.tokenBreaker.record(nil, now)
+	} else {
+		api.tokenBreaker.record(err, now)
+	}
+	if err != nil {
+		if valid {
+			log.Warnf("failed to refresh tenant access token of %s, use the cached one until %s. err=%v",
+				appID, token.expiresAt.Format(time.RFC3339), err)
+			return token.value, nil
+		}
+		if reached {
+			return "", err
+		}
+		return "", fmt.Errorf("%w, %v", ErrLarkTokenUnavailable, err)
+	}
+
+	api.tokensMu.Lock()
+	api.tokens[appID] = fetched
+	api.tokensMu.Unlock()
+	return fetched.value, nil
+}
+
+// fetchTenantAccessToken gets a new token of app from the token endpoint,
+// reached is false if the endpoint didn't answer.
+func (api *LarkOpenAPI) fetchTenantAccessToken(appID, secretKey string, now time.Time) (token tenantToken, reached bool, err error) {
+	req := map[string]string{
+		"app_id":     appID,
+		"app_secret": secretKey,
+	}
+	var resp tenantAccessTokenResponse
+	if err := api.post("/auth/v3/tenant_access_token/internal", nil, req, &resp); err != nil {
+		return tenantToken{}, false, err
+	}
+
+	if resp.Code != 0 {
+		return tenantToken{}, true, fmt.Errorf("get tenant access token error, code=%d, msg=%s", resp.Code, resp.Message)
+	}
+
+	expiresAt := now.Add(time.Duration(resp.Expire) * time.Second)
+	return tenantToken{
+		value:     resp.TenantAccessToken,
+		refreshAt: expiresAt.Add(-tokenRefreshMargin),
+		expiresAt: expiresAt,
+	}, true, nil
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KDF5000/pkg/log"
+)
+
+// Component is a subsystem started and stopped by Lifecycle, Start
+// must not block and both are optional.
+type Component struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// Lifecycle starts components in the order registered and stops them in
+// the reverse order, so a component should be registered after the ones
+// it depends on, e.g. the database first and the http server last.
+type Lifecycle struct {
+	components []Component
+	// number of components started
+	started int
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+func (l *Lifecycle) Register(c Component) {
+	l.components = append(l.components, c)
+}
+
+// Start starts the components in order, the ones started are stopped
+// if any fails.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	for _, c := range l.components[l.started:] {
+		if c.Start != nil {
+			if err := c.Start(ctx); err != nil {
+				l.Stop(ctx)
+				return fmt.Errorf("start %s error, %w", c.Name, err)
+			}
+		}
+		l.started++
+	}
+	return nil
+}
+
+// Stop stops the components started in the reverse order within the
+// budget of ctx. Each is stopped even if the budget runs out, so the
+// last ones, e.g. the database, are closed anyway.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	var errs []string
+	for ; l.started > 0; l.started-- {
+		c := l.components[l.started-1]
+		if c.Stop == nil {
+			continue
+		}
+
+		log.Infof("stopping %s...", c.Name)
+		if err := c.Stop(ctx); err != nil {
+			log.Errorf("failed to stop %s. err=%v", c.Name, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", c.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("stop error, %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// WorkerComponent runs run in background until it's stopped, and waits
+// for run to return on stop.
+func WorkerComponent(name string, run func(ctx context.Context)) Component {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+	return Component{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			var runCtx context.Context
+			runCtx, cancel = context.WithCancel(context.Background())
+			go func() {
+				defer close(done)
+				run(runCtx)
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
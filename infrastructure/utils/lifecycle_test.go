@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLifecycleOrder(t *testing.T) {
+	var events []string
+	component := func(name string, stopErr error) Component {
+		return Component{
+			Name: name,
+			Start: func(ctx context.Context) error {
+				events = append(events, "start "+name)
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				events = append(events, "stop "+name)
+				return stopErr
+			},
+		}
+	}
+
+	l := NewLifecycle()
+	l.Register(component("db", nil))
+	l.Register(component("worker", errors.New("drain timeout")))
+	l.Register(Component{Name: "no hooks"})
+	l.Register(component("http", nil))
+	if err := l.Start(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed stop doesn't keep the db open
+	if err := l.Stop(context.TODO()); err == nil {
+		t.Fatal("expected the stop error of worker")
+	}
+	expected := []string{"start db", "start worker", "start http", "stop http", "stop worker", "stop db"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+
+	// stopped already
+	events = nil
+	if err := l.Stop(context.TODO()); err != nil || len(events) != 0 {
+		t.Fatalf("expected nothing stopped twice, got %v, err: %v", events, err)
+	}
+}
+
+func TestLifecycleStartError(t *testing.T) {
+	var events []string
+	l := NewLifecycle()
+	l.Register(Component{
+		Name: "db",
+		Stop: func(ctx context.Context) error {
+			events = append(events, "stop db")
+			return nil
+		},
+	})
+	l.Register(Component{
+		Name:  "http",
+		Start: func(ctx context.Context) error { return errors.New("address in use") },
+		Stop: func(ctx context.Context) error {
+			events = append(events, "stop http")
+			return nil
+		},
+	})
+
+	if err := l.Start(context.TODO()); err == nil {
+		t.Fatal("expected start error")
+	}
+	if !reflect.DeepEqual(events, []string{"stop db"}) {
+		t.Fatalf("expected only the started db stopped, got %v", events)
+	}
+}
+
+func TestWorkerComponent(t *testing.T) {
+	var events []string
+	l := NewLifecycle()
+	l.Register(Component{
+		Name: "db",
+		Stop: func(ctx context.Context) error {
+			events = append(events, "close db")
+			return nil
+		},
+	})
+	l.Register(WorkerComponent("stuck", func(ctx context.Context) {
+		select {}
+	}))
+	l.Register(WorkerComponent("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		// drain what's left
+		time.Sleep(10 * time.Millisecond)
+		events = append(events, "worker drained")
+	}))
+	if err := l.Start(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Stop(ctx); err == nil {
+		t.Fatal("expected timeout of the stuck worker")
+	}
+	// waits for the worker to drain, and for the stuck one until the budget runs out
+	if !reflect.DeepEqual(events, []string{"worker drained", "close db"}) {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
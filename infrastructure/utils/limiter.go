@@ -0,0 +1,48 @@
+package utils
+
+import "time"
+
+// Limiter bounds how many handlers run concurrently. A caller waits at
+// most wait for a free slot so the platform gets its response in time.
+type Limiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// NewLimiter returns a limiter with size slots, size <= 0 means unlimited
+func NewLimiter(size int, wait time.Duration) *Limiter {
+	l := &Limiter{wait: wait}
+	if size > 0 {
+		l.slots = make(chan struct{}, size)
+	}
+	return l
+}
+
+// Acquire reports whether a slot is taken, the slot must be released by Release
+func (l *Limiter) Acquire() bool {
+	if l == nil || l.slots == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (l *Limiter) Release() {
+	if l == nil || l.slots == nil {
+		return
+	}
+	<-l.slots
+}
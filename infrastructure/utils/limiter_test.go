@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiterConcurrency(t *testing.T) {
+	const size = 3
+	l := NewLimiter(size, time.Second)
+
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !l.Acquire() {
+				t.Error("failed to acquire limiter")
+				return
+			}
+			defer l.Release()
+
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+
+	if max > size {
+		t.Fatalf("expected at most %d concurrent handlers, got %d", size, max)
+	}
+}
+
+func TestLimiterWaitTimeout(t *testing.T) {
+	l := NewLimiter(1, 10*time.Millisecond)
+	if !l.Acquire() {
+		t.Fatal("failed to acquire limiter")
+	}
+
+	begin := time.Now()
+	if l.Acquire() {
+		t.Fatal("expected acquire to time out")
+	}
+	if time.Since(begin) < 10*time.Millisecond {
+		t.Fatal("expected acquire to wait")
+	}
+
+	l.Release()
+	if !l.Acquire() {
+		t.Fatal("failed to acquire released limiter")
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if !l.Acquire() {
+			t.Fatal("unlimited limiter should always acquire")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import "strings"
+
+// trailing punctuation of a sentence ending with a link
+const linkTrailing = ".,;:!?)'\"，。；：！？）"
+
+// normalizeLink is the key of link for loose matches, without the
+// fragment and the trailing slash.
+func normalizeLink(link string) string {
+	if i := strings.Index(link, "#"); i >= 0 {
+		link = link[:i]
+	}
+	return strings.TrimSuffix(link, "/")
+}
+
+// ExtractURLs returns the links in content by their first occurrence,
+// duplicated ones are dropped. With loose, links differing only by the
+// trailing slash or the fragment are duplicated too.
+func ExtractURLs(content string, loose bool) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, link := range linkRegexp.FindAllString(content, -1) {
+		link = strings.TrimRight(link, linkTrailing)
+		key := link
+		if loose {
+			key = normalizeLink(link)
+		}
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		links = append(links, link)
+	}
+	return links
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	content := "看 https://example.com/a, 还有 https://example.com/b 和 https://example.com/a。" +
+		"\nhttps://example.com/a/ https://example.com/b#intro https://example.com/c?q=1"
+	cases := []struct {
+		Loose    bool
+		Expected []string
+	}{
+		{
+			Loose: false,
+			Expected: []string{"https://example.com/a", "https://example.com/b",
+				"https://example.com/a/", "https://example.com/b#intro", "https://example.com/c?q=1"},
+		},
+		{
+			Loose:    true,
+			Expected: []string{"https://example.com/a", "https://example.com/b", "https://example.com/c?q=1"},
+		},
+	}
+	for _, tc := range cases {
+		if links := ExtractURLs(content, tc.Loose); !reflect.DeepEqual(links, tc.Expected) {
+			t.Fatalf("loose: %v, expected %v, got %v", tc.Loose, tc.Expected, links)
+		}
+	}
+
+	if links := ExtractURLs("没有链接", true); len(links) != 0 {
+		t.Fatalf("expected no links, got %v", links)
+	}
+}
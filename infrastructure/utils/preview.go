@@ -0,0 +1,12 @@
+package utils
+
+// Preview keeps the first n runes of content for logs and notifications,
+// followed by TitleEllipsis if anything is cut. n <= 0 keeps all of it.
+func Preview(content string, n int) string {
+	runes := []rune(content)
+	if n <= 0 || len(runes) <= n {
+		return content
+	}
+
+	return string(runes[:n]) + TitleEllipsis
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestPreview(t *testing.T) {
+	cases := []struct {
+		Content string
+		N       int
+		Preview string
+	}{
+		{Content: "short", N: 10, Preview: "short"},
+		{Content: "exactly10!", N: 10, Preview: "exactly10!"},
+		{Content: "technology change our life", N: 10, Preview: "technology…"},
+		{Content: "今天天气很好，适合出去走走", N: 4, Preview: "今天天气…"},
+		{Content: "technology change our life", N: 0, Preview: "technology change our life"},
+	}
+
+	for _, tc := range cases {
+		if preview := Preview(tc.Content, tc.N); preview != tc.Preview {
+			t.Fatalf("content: %s, expected: %s, got: %s", tc.Content, tc.Preview, preview)
+		}
+	}
+}
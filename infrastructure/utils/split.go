@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitMessage cuts text into chunks of at most maxLen runes in order. Each
+// cut prefers the last line break in the second half of the window, then
+// the last space, and falls back to a plain rune cut. maxLen <= 0 means no
+// limit.
+func SplitMessage(text string, maxLen int) []string {
+	runes := []rune(text)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(runes) > maxLen {
+		cut := -1
+		for i := maxLen; i >= maxLen/2 && i > 0; i-- {
+			if runes[i] == '\n' {
+				cut = i
+				break
+			}
+		}
+		if cut < 0 {
+			for i := maxLen; i >= maxLen/2 && i > 0; i-- {
+				if unicode.IsSpace(runes[i]) {
+					cut = i
+					break
+				}
+			}
+		}
+
+		// the separator itself is dropped
+		next := cut + 1
+		if cut < 0 {
+			cut, next = maxLen, maxLen
+		}
+
+		if chunk := strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = runes[next:]
+	}
+
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
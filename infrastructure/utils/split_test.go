@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	cases := []struct {
+		Text   string
+		MaxLen int
+		Chunks []string
+	}{
+		{Text: "short", MaxLen: 10, Chunks: []string{"short"}},
+		{Text: "no limit at all", MaxLen: 0, Chunks: []string{"no limit at all"}},
+		{Text: "line one\nline two\nline three", MaxLen: 18, Chunks: []string{"line one\nline two", "line three"}},
+		{Text: "technology change our life", MaxLen: 12, Chunks: []string{"technology", "change our", "life"}},
+		{Text: "这是一条没有标点也没有空格的很长的memo", MaxLen: 8, Chunks: []string{"这是一条没有标点", "也没有空格的很长", "的memo"}},
+	}
+
+	for _, tc := range cases {
+		chunks := SplitMessage(tc.Text, tc.MaxLen)
+		if strings.Join(chunks, "|") != strings.Join(tc.Chunks, "|") {
+			t.Fatalf("text: %q, expected: %q, got: %q", tc.Text, tc.Chunks, chunks)
+		}
+		for _, c := range chunks {
+			if tc.MaxLen > 0 && len([]rune(c)) > tc.MaxLen {
+				t.Fatalf("chunk %q exceeds %d runes", c, tc.MaxLen)
+			}
+		}
+	}
+}
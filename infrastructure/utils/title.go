@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+const TitleEllipsis = "…"
+
+func isTitleBoundary(r rune) bool {
+	if unicode.IsSpace(r) {
+		return true
+	}
+
+	switch r {
+	case ',', '.', '!', '?', ';', ':',
+		'，', '。', '！', '？', '；', '：', '、':
+		return true
+	}
+
+	return false
+}
+
+// TruncateTitle cuts the first line of content to at most maxLen runes and
+// appends an ellipsis if anything was cut. It prefers the last word or
+// sentence boundary in the second half of the window, and falls back to a
+// plain rune cut for text without spaces or punctuation, e.g. CJK.
+// maxLen <= 0 means no limit.
+func TruncateTitle(content string, maxLen int) string {
+	title := strings.TrimSpace(content)
+	if idx := strings.IndexByte(title, '\n'); idx >= 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	runes := []rune(title)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return title
+	}
+
+	cut := maxLen
+	for i := maxLen; i >= maxLen/2 && i > 0; i-- {
+		if isTitleBoundary(runes[i]) {
+			cut = i
+			break
+		}
+	}
+
+	return strings.TrimRightFunc(string(runes[:cut]), isTitleBoundary) + TitleEllipsis
+}
@@ -0,0 +1,59 @@
+package utils
+
+import "testing"
+
+func TestTruncateTitle(t *testing.T) {
+	cases := []struct {
+		Content string
+		MaxLen  int
+		Title   string
+	}{
+		{
+			Content: "short title",
+			MaxLen:  20,
+			Title:   "short title",
+		},
+		{
+			Content: "technology change our life",
+			MaxLen:  0,
+			Title:   "technology change our life",
+		},
+		{
+			Content: "technology change our life",
+			MaxLen:  20,
+			Title:   "technology change…",
+		},
+		{
+			Content: "first sentence. second sentence",
+			MaxLen:  20,
+			Title:   "first sentence…",
+		},
+		{
+			Content: "first line\nsecond line",
+			MaxLen:  20,
+			Title:   "first line",
+		},
+		{
+			Content: "这是一条没有标点也没有空格的很长的memo",
+			MaxLen:  8,
+			Title:   "这是一条没有标点…",
+		},
+		{
+			Content: "今天天气很好，适合出去走走",
+			MaxLen:  8,
+			Title:   "今天天气很好…",
+		},
+		{
+			Content: "supercalifragilisticexpialidocious",
+			MaxLen:  10,
+			Title:   "supercalif…",
+		},
+	}
+
+	for _, tc := range cases {
+		title := TruncateTitle(tc.Content, tc.MaxLen)
+		if title != tc.Title {
+			t.Fatalf("content: %s, expected: %s, got: %s", tc.Content, tc.Title, title)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import "strings"
+
+const codeFence = "```"
+
+// typographyReplacer straightens quotes and turns en/em dashes into hyphens.
+// The double em dash of chinese comes first to be kept as it is.
+var typographyReplacer = strings.NewReplacer(
+	"——", "——",
+	"‘", "'", "’", "'", "‚", "'", "‛", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`,
+	"—", "--", "–", "-",
+)
+
+// NormalizeTypography replaces the smart quotes and dashes of content with
+// their ascii forms, code is left alone: lines between ``` fences and the
+// spans between backticks.
+func NormalizeTypography(content string) string {
+	lines := strings.Split(content, "\n")
+	fenced := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+
+		parts := strings.Split(line, "`")
+		for j := range parts {
+			// even parts are outside code spans, so is the rest after an unpaired backtick
+			if j%2 == 0 || (j == len(parts)-1 && len(parts)%2 == 0) {
+				parts[j] = typographyReplacer.Replace(parts[j])
+			}
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
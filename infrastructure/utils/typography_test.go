@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestNormalizeTypography(t *testing.T) {
+	cases := []struct {
+		Content    string
+		Normalized string
+	}{
+		{Content: "“Hello,” she said — it’s 9–5.", Normalized: `"Hello," she said -- it's 9-5.`},
+		{Content: "他说——“好”", Normalized: `他说——"好"`},
+		// code spans are kept
+		{Content: "run `echo “hi” — ok` now — “done”", Normalized: "run `echo “hi” — ok` now -- \"done\""},
+		{Content: "it’s `unpaired – dash", Normalized: "it's `unpaired - dash"},
+		// so are fenced blocks
+		{
+			Content:    "“before”\n```\nfmt.Println(“x”) // — \n```\n“after”",
+			Normalized: "\"before\"\n```\nfmt.Println(“x”) // — \n```\n\"after\"",
+		},
+		{Content: "plain text", Normalized: "plain text"},
+	}
+
+	for _, tc := range cases {
+		if normalized := NormalizeTypography(tc.Content); normalized != tc.Normalized {
+			t.Fatalf("content: %q, expected: %q, got: %q", tc.Content, tc.Normalized, normalized)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultWXUnwrapPatterns are the redirect urls wechat wraps shared links in
+var DefaultWXUnwrapPatterns = []string{
+	// web wechat
+	"wx.qq.com/cgi-bin/mmwebwx-bin/webwxcheckurl?requrl",
+	"weixin110.qq.com/cgi-bin/mmspamsupport-bin/newredirectconfirmcgi?url",
+}
+
+var linkRegexp = regexp.MustCompile(`https?://[^\s]+`)
+
+// unwrapPattern matches urls of host and path, which keep the real url in param
+type unwrapPattern struct {
+	host  string
+	path  string
+	param string
+}
+
+// LinkUnwrapper replaces the wrapper urls in content with the real ones
+type LinkUnwrapper struct {
+	patterns []unwrapPattern
+}
+
+// NewLinkUnwrapper returns an unwrapper of patterns like `host/path?param`,
+// e.g. wx.qq.com/cgi-bin/mmwebwx-bin/webwxcheckurl?requrl
+func NewLinkUnwrapper(patterns []string) (*LinkUnwrapper, error) {
+	u := &LinkUnwrapper{}
+	for _, p := range patterns {
+		i, j := strings.Index(p, "/"), strings.LastIndex(p, "?")
+		if i <= 0 || j < i || j == len(p)-1 {
+			return nil, fmt.Errorf("invalid unwrap pattern %s, should be like host/path?param", p)
+		}
+
+		u.patterns = append(u.patterns, unwrapPattern{
+			host:  strings.ToLower(p[:i]),
+			path:  p[i:j],
+			param: p[j+1:],
+		})
+	}
+	return u, nil
+}
+
+// unwrap returns the real url link wraps, or link itself
+func (u *LinkUnwrapper) unwrap(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	for _, p := range u.patterns {
+		if strings.ToLower(parsed.Host) != p.host || parsed.Path != p.path {
+			continue
+		}
+
+		real := parsed.Query().Get(p.param)
+		if linkRegexp.FindString(real) == real && real != "" {
+			return real
+		}
+	}
+	return link
+}
+
+// Unwrap replaces the urls in content matching the patterns with the real
+// urls in them, the others are left untouched.
+func (u *LinkUnwrapper) Unwrap(content string) string {
+	if u == nil || len(u.patterns) == 0 {
+		return content
+	}
+
+	return linkRegexp.ReplaceAllStringFunc(content, func(link string) string {
+		// wrapped more than once
+		for i := 0; i < 3; i++ {
+			real := u.unwrap(link)
+			if real == link {
+				break
+			}
+			link = real
+		}
+		return link
+	})
+}
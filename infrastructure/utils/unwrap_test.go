@@ -0,0 +1,50 @@
+package utils
+
+import "testing"
+
+func TestLinkUnwrapper(t *testing.T) {
+	u, err := NewLinkUnwrapper(DefaultWXUnwrapPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Content  string
+		Expected string
+	}{
+		{
+			Content:  "好文 https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxcheckurl?requrl=https%3A%2F%2Fexample.com%2Fa%3Fb%3D1&skey=xxx&deviceid=e1 #阅读",
+			Expected: "好文 https://example.com/a?b=1 #阅读",
+		},
+		{
+			Content:  "https://weixin110.qq.com/cgi-bin/mmspamsupport-bin/newredirectconfirmcgi?main_type=2&url=http%3A%2F%2Fexample.com",
+			Expected: "http://example.com",
+		},
+		// wrapped twice
+		{
+			Content:  "https://weixin110.qq.com/cgi-bin/mmspamsupport-bin/newredirectconfirmcgi?url=https%3A%2F%2Fwx.qq.com%2Fcgi-bin%2Fmmwebwx-bin%2Fwebwxcheckurl%3Frequrl%3Dhttps%253A%252F%252Fexample.com",
+			Expected: "https://example.com",
+		},
+		// normal urls
+		{
+			Content:  "https://mp.weixin.qq.com/s/abc and https://example.com/?requrl=https%3A%2F%2Fother.com",
+			Expected: "https://mp.weixin.qq.com/s/abc and https://example.com/?requrl=https%3A%2F%2Fother.com",
+		},
+		// the param isn't a url
+		{
+			Content:  "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxcheckurl?requrl=javascript%3Aalert(1)",
+			Expected: "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxcheckurl?requrl=javascript%3Aalert(1)",
+		},
+	}
+	for _, tc := range cases {
+		if got := u.Unwrap(tc.Content); got != tc.Expected {
+			t.Fatalf("content: %s, expected: %s, got: %s", tc.Content, tc.Expected, got)
+		}
+	}
+
+	for _, p := range []string{"wx.qq.com", "wx.qq.com/path", "/path?url", "wx.qq.com/path?"} {
+		if _, err := NewLinkUnwrapper([]string{p}); err == nil {
+			t.Fatalf("expected invalid pattern %s", p)
+		}
+	}
+}
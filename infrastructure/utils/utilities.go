@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -90,3 +91,92 @@ func RetriveTags(content string) []string {
 
 	return tags
 }
+
+// NormalizeTag makes name a tag as ScanContent finds it: spaces become _,
+// and # and the commas notion rejects in select options are dropped.
+func NormalizeTag(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '#', ',', '，':
+			return -1
+		}
+		return r
+	}, name)
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// SplitTags splits each of tags on any rune of separators, e.g. `a,b` into
+// a and b with separators ",;", dropping the empty and repeated ones.
+// tags are kept as they are if separators is empty.
+func SplitTags(tags []string, separators string) []string {
+	if separators == "" {
+		return tags
+	}
+
+	var split []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		for _, part := range strings.FieldsFunc(tag, func(r rune) bool {
+			return strings.ContainsRune(separators, r)
+		}) {
+			if part = strings.TrimSpace(part); part != "" && !seen[part] {
+				seen[part] = true
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
+
+const (
+	// lowercase the latin letters of tags, except all-caps acronyms like AI,
+	// tags of other scripts are kept as they are
+	TagCaseLower = "lower"
+	// lowercase the letters of tags in any script
+	TagCaseLowerAll = "lower_all"
+)
+
+// NormalizeTagCase applies the case rule mode to tags, dropping the ones
+// repeated after it, e.g. Go and go. tags are kept as they are if mode is
+// empty or unknown.
+func NormalizeTagCase(tags []string, mode string) []string {
+	if mode != TagCaseLower && mode != TagCaseLowerAll {
+		return tags
+	}
+
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if mode == TagCaseLowerAll {
+			tag = strings.ToLower(tag)
+		} else if !isAcronym(tag) {
+			tag = strings.Map(func(r rune) rune {
+				if unicode.Is(unicode.Latin, r) {
+					return unicode.ToLower(r)
+				}
+				return r
+			}, tag)
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// isAcronym reports whether tag has two or more letters, all of them upper case latin
+func isAcronym(tag string) bool {
+	letters := 0
+	for _, r := range tag {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if !unicode.Is(unicode.Latin, r) || !unicode.IsUpper(r) {
+			return false
+		}
+		letters++
+	}
+	return letters >= 2
+}
@@ -184,3 +184,52 @@ func TestScanContent(t *testing.T) {
 		t.Logf("content: %s, tags: %+v", tc.Content, tc.Elements)
 	}
 }
+
+func TestNormalizeTag(t *testing.T) {
+	cases := map[string]string{
+		"产品讨论群":              "产品讨论群",
+		"  Team  Nomo\tDev ": "Team_Nomo_Dev",
+		"#nomo, 周报":          "nomo_周报",
+		"，#":                 "",
+	}
+	for name, expected := range cases {
+		if tag := NormalizeTag(name); tag != expected {
+			t.Fatalf("name: %q, expected %q, got %q", name, expected, tag)
+		}
+	}
+}
+
+func TestSplitTags(t *testing.T) {
+	tags := []string{"a,b;c", "科技，美食", "a", ",d,,"}
+	cases := []struct {
+		Separators string
+		Expected   []string
+	}{
+		{Separators: "", Expected: tags},
+		{Separators: ",;", Expected: []string{"a", "b", "c", "科技，美食", "d"}},
+		{Separators: ",;，；", Expected: []string{"a", "b", "c", "科技", "美食", "d"}},
+	}
+	for _, tc := range cases {
+		if split := SplitTags(tags, tc.Separators); !EXPECT_EQ(split, tc.Expected) {
+			t.Fatalf("separators: %q, expected %v, got %v", tc.Separators, tc.Expected, split)
+		}
+	}
+}
+
+func TestNormalizeTagCase(t *testing.T) {
+	tags := []string{"Go", "科技", "go", "AI", "Go语言", "Ελληνικά", "GPT-4", "Café"}
+	cases := []struct {
+		Mode     string
+		Expected []string
+	}{
+		{Mode: "", Expected: tags},
+		// cjk and greek are kept, so are acronyms
+		{Mode: TagCaseLower, Expected: []string{"go", "科技", "AI", "go语言", "Ελληνικά", "GPT-4", "café"}},
+		{Mode: TagCaseLowerAll, Expected: []string{"go", "科技", "ai", "go语言", "ελληνικά", "gpt-4", "café"}},
+	}
+	for _, tc := range cases {
+		if normalized := NormalizeTagCase(tags, tc.Mode); !EXPECT_EQ(normalized, tc.Expected) {
+			t.Fatalf("mode: %q, expected %v, got %v", tc.Mode, tc.Expected, normalized)
+		}
+	}
+}
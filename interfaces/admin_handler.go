@@ -0,0 +1,112 @@
+package interfaces
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/KDF5000/nomo/application"
+	"github.com/KDF5000/nomo/interfaces/common"
+)
+
+type adminHandler struct {
+	adminApp application.IAdminApp
+}
+
+func NewAdminHandler(app application.IAdminApp) *adminHandler {
+	return &adminHandler{adminApp: app}
+}
+
+func (h *adminHandler) ReprocessTags(c *gin.Context) {
+	unionUserID := c.Query("union_user_id")
+	if unionUserID == "" {
+		c.JSON(http.StatusBadRequest, "union_user_id is required")
+		return
+	}
+
+	res, err := h.adminApp.ReprocessTags(c.Request.Context(), unionUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, common.APIResonse{
+		Code:    0,
+		Message: "succ",
+		Data:    res,
+	})
+}
+
+type notionWritesStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (h *adminHandler) GetNotionWrites(c *gin.Context) {
+	c.JSON(http.StatusOK, common.APIResonse{
+		Code:    0,
+		Message: "succ",
+		Data:    notionWritesStatus{Enabled: h.adminApp.NotionWritesEnabled(c.Request.Context())},
+	})
+}
+
+// SetNotionWrites turns notion writes on or off, e.g. ?enabled=false
+func (h *adminHandler) SetNotionWrites(c *gin.Context) {
+	enabled, err := strconv.ParseBool(c.Query("enabled"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "enabled should be true or false")
+		return
+	}
+
+	if err := h.adminApp.SetNotionWrites(c.Request.Context(), enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, common.APIResonse{
+		Code:    0,
+		Message: "succ",
+		Data:    notionWritesStatus{Enabled: enabled},
+	})
+}
+
+type captureStatus struct {
+	UnionUserID string `json:"union_user_id"`
+	Capture     string `json:"capture"`
+}
+
+// SetCapture pauses or resumes capture of a binding, e.g. ?union_user_id=lark_xxx&capture=off
+func (h *adminHandler) SetCapture(c *gin.Context) {
+	unionUserID := c.Query("union_user_id")
+	if unionUserID == "" {
+		c.JSON(http.StatusBadRequest, "union_user_id is required")
+		return
+	}
+
+	capture := c.Query("capture")
+	if err := h.adminApp.SetCapture(c.Request.Context(), unionUserID, capture); err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, common.APIResonse{
+		Code:    0,
+		Message: "succ",
+		Data:    captureStatus{UnionUserID: unionUserID, Capture: capture},
+	})
+}
+
+// GetMemoQueue summarizes the pending and failed memos of all accounts
+func (h *adminHandler) GetMemoQueue(c *gin.Context) {
+	summary, err := h.adminApp.MemoQueue(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, common.APIResonse{
+		Code:    0,
+		Message: "succ",
+		Data:    summary,
+	})
+}
@@ -0,0 +1,60 @@
+package interfaces
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/KDF5000/nomo/application"
+)
+
+type fakeAdminApp struct {
+	application.IAdminApp
+	queue *application.MemoQueueSummary
+	err   error
+}
+
+func (app *fakeAdminApp) MemoQueue(ctx context.Context) (*application.MemoQueueSummary, error) {
+	return app.queue, app.err
+}
+
+func TestGetMemoQueue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queue := &application.MemoQueueSummary{
+		Pending:  1,
+		Retrying: 2,
+		Dead:     1,
+		Errors:   map[string]int{"notion_5xx": 2, "timeout": 1},
+	}
+	app := &fakeAdminApp{queue: queue}
+	router := gin.New()
+	router.GET("/admin/memo/queue", NewAdminHandler(app).GetMemoQueue)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/memo/queue", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Data application.MemoQueueSummary `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.Data, *queue) {
+		t.Fatalf("expected %+v, got %s", *queue, w.Body.String())
+	}
+
+	app.err = errors.New("database is down")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/memo/queue", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+}
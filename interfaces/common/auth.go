@@ -0,0 +1,54 @@
+package common
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth only lets requests with header `Authorization: Bearer <token>` through
+func AdminAuth(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		got := []byte(c.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AccountAuth lets requests with header `Authorization: Bearer <key>` through
+// if key is token, which may target any account, or one of keys, key =>
+// the only account it may target by query param accountParam. A key used
+// for another account is forbidden. An empty token is never matched.
+func AccountAuth(token string, keys map[string]string, accountParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got := []byte(c.GetHeader("Authorization"))
+		if token != "" && subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) == 1 {
+			c.Next()
+			return
+		}
+
+		// compare with every key to not leak which one is close
+		account, found := "", false
+		for key, scope := range keys {
+			if subtle.ConstantTimeCompare(got, []byte("Bearer "+key)) == 1 {
+				account, found = scope, true
+			}
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if c.Query(accountParam) != account {
+			c.AbortWithStatusJSON(http.StatusForbidden, "key not allowed for the account")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccountAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	keys := map[string]string{"key_a": "lark_a", "key_b": "lark_b"}
+	router.POST("/import", AccountAuth("token", keys, "union_user_id"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, "succ")
+	})
+
+	cases := []struct {
+		Auth    string
+		Account string
+		Code    int
+	}{
+		{Auth: "Bearer key_a", Account: "lark_a", Code: http.StatusOK},
+		{Auth: "Bearer key_b", Account: "lark_b", Code: http.StatusOK},
+		// another tenant's account
+		{Auth: "Bearer key_a", Account: "lark_b", Code: http.StatusForbidden},
+		{Auth: "Bearer key_a", Account: "", Code: http.StatusForbidden},
+		// the token isn't scoped
+		{Auth: "Bearer token", Account: "lark_b", Code: http.StatusOK},
+		{Auth: "Bearer key_c", Account: "lark_a", Code: http.StatusUnauthorized},
+		{Auth: "key_a", Account: "lark_a", Code: http.StatusUnauthorized},
+		{Auth: "", Account: "lark_a", Code: http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/import?union_user_id="+tc.Account, nil)
+		if tc.Auth != "" {
+			req.Header.Set("Authorization", tc.Auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.Code {
+			t.Fatalf("auth: %s, account: %s, expected %d, got %d", tc.Auth, tc.Account, tc.Code, w.Code)
+		}
+	}
+}
+
+func TestAccountAuthNoToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/import", AccountAuth("", map[string]string{"key_a": "lark_a"}, "union_user_id"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, "succ")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/import?union_user_id=lark_a", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an empty token rejected, got %d", w.Code)
+	}
+}
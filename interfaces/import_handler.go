@@ -0,0 +1,83 @@
+package interfaces
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/KDF5000/nomo/application"
+	"github.com/KDF5000/nomo/interfaces/common"
+)
+
+// max size of a memo line in ndjson
+const maxImportLine = 1 << 20
+
+type importHandler struct {
+	importApp application.IImportApp
+}
+
+func NewImportHandler(app application.IImportApp) *importHandler {
+	return &importHandler{importApp: app}
+}
+
+// parseImportItems reads a json array of memos, or one memo per line
+// with content type application/x-ndjson.
+func parseImportItems(c *gin.Context) ([]application.ImportItem, error) {
+	var items []application.ImportItem
+	if !strings.HasPrefix(c.ContentType(), "application/x-ndjson") {
+		if err := json.NewDecoder(c.Request.Body).Decode(&items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var item application.ImportItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		items = append(items, item)
+		if len(items) > application.MaxImportItems {
+			return nil, fmt.Errorf("too many memos, at most %d at a time", application.MaxImportItems)
+		}
+	}
+
+	return items, scanner.Err()
+}
+
+func (h *importHandler) Import(c *gin.Context) {
+	unionUserID := c.Query("union_user_id")
+	if unionUserID == "" {
+		c.JSON(http.StatusBadRequest, "union_user_id is required")
+		return
+	}
+
+	items, err := parseImportItems(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("invalid memos, %v", err))
+		return
+	}
+
+	res, err := h.importApp.ImportMemos(c.Request.Context(), unionUserID, items)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, common.APIResonse{
+		Code:    0,
+		Message: "succ",
+		Data:    res,
+	})
+}
@@ -5,22 +5,32 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/KDF5000/nomo/application"
 	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/utils"
 	"github.com/KDF5000/nomo/interfaces/common"
 	"github.com/KDF5000/pkg/log"
 )
 
 type larkMessageHandler struct {
 	messageHandleApp application.ILarkMessageHandleApp
+	// bounds the events processed concurrently
+	limiter *utils.Limiter
+	// process events before acking them, for an app that only queues memos
+	inline bool
+	// the events processed in the background
+	running sync.WaitGroup
 }
 
-func NewLarkMessageHandler(app application.ILarkMessageHandleApp) *larkMessageHandler {
-	return &larkMessageHandler{messageHandleApp: app}
+// NewLarkMessageHandler processes events in the background after acking
+// them, or before if inline, so that queued memos are stored when acked.
+func NewLarkMessageHandler(app application.ILarkMessageHandleApp, limiter *utils.Limiter, inline bool) *larkMessageHandler {
+	return &larkMessageHandler{messageHandleApp: app, limiter: limiter, inline: inline}
 }
 
 func (h *larkMessageHandler) UrlVerification(c *gin.Context) {
@@ -52,13 +62,16 @@ func (h *larkMessageHandler) HandleMessage(c *gin.Context) {
 	}
 
 	// log.Infof("data ==> %+v", string(data))
-	var event lark_message.LarkMessageEvent
-	if err := json.Unmarshal(data, &event); err != nil {
+	events, skipped, err := lark_message.ParseEvents(data)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, err)
 		return
 	}
+	if skipped > 0 {
+		log.Errorf("skip %d invalid events of a batch of lark events", skipped)
+	}
 
-	if event.Schema == "" {
+	if len(events) == 0 {
 		var verifyEvent lark_message.UrlVerificationEvent
 		if err := json.Unmarshal(data, &verifyEvent); err != nil {
 			c.JSON(http.StatusBadRequest, err)
@@ -75,17 +88,77 @@ func (h *larkMessageHandler) HandleMessage(c *gin.Context) {
 		return
 	}
 
-	// log.Infof("%+v", event)
-	go func() {
-		ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
-		defer cancel()
-		if err := h.messageHandleApp.ProcessMessage(ctx, &event); err != nil {
-			log.Error("failed to process lark message", log.String("err", err.Error()))
-		}
-	}()
+	// the events of a batch are handled in order, or started in the
+	// background, before the batch is acked
+	h.handleEvents(events)
 
 	c.JSON(http.StatusOK, common.APIResonse{
 		Code:    0,
 		Message: "succ",
 	})
 }
+
+// handleEvents processes events one by one in a single limiter slot, so
+// the memos of a user keep their order and a batch waits for one slot only.
+func (h *larkMessageHandler) handleEvents(events []lark_message.LarkMessageEvent) {
+	// ack the events even if they're dropped, otherwise lark retries and makes it worse
+	if !h.limiter.Acquire() {
+		for i := range events {
+			log.Errorf("too many lark events in process, drop event %s", events[i].Header.EventID)
+		}
+		return
+	}
+
+	process := func() {
+		defer h.limiter.Release()
+		for i := range events {
+			h.processEvent(&events[i])
+		}
+	}
+	// images are downloaded with retries, which may outlast lark's wait
+	// for the ack, so batches of them go to the background even inline
+	if h.inline && !hasImages(events) {
+		process()
+		return
+	}
+	h.running.Add(1)
+	go func() {
+		defer h.running.Done()
+		process()
+	}()
+}
+
+func hasImages(events []lark_message.LarkMessageEvent) bool {
+	for i := range events {
+		if events[i].Event.Message.MessageType == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait waits for the events processed in the background until ctx is done,
+// to be called once the server stops taking events.
+func (h *larkMessageHandler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *larkMessageHandler) processEvent(event *lark_message.LarkMessageEvent) {
+	// log.Infof("%+v", event)
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	if err := h.messageHandleApp.ProcessMessage(ctx, event); err != nil {
+		log.Error("failed to process lark message", log.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,179 @@
+package interfaces
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/KDF5000/nomo/application"
+	"github.com/KDF5000/nomo/infrastructure/message/lark_message"
+	"github.com/KDF5000/nomo/infrastructure/utils"
+)
+
+type fakeLarkApp struct {
+	application.ILarkMessageHandleApp
+	mu        sync.Mutex
+	events    []string
+	challenge string
+	// event id => time taken to process it
+	delays map[string]time.Duration
+}
+
+func (app *fakeLarkApp) ProcessMessage(ctx context.Context, event *lark_message.LarkMessageEvent) error {
+	time.Sleep(app.delays[event.Header.EventID])
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.events = append(app.events, event.Header.EventID)
+	return nil
+}
+
+func (app *fakeLarkApp) processed() []string {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	return append([]string(nil), app.events...)
+}
+
+func (app *fakeLarkApp) VerifyURL(ctx context.Context, event *lark_message.UrlVerificationEvent) (*lark_message.UrlVerificationResult, error) {
+	app.challenge = event.Challenge
+	return &lark_message.UrlVerificationResult{Challenge: event.Challenge}, nil
+}
+
+func testLarkEvent(id string) string {
+	return fmt.Sprintf(`{"schema": "2.0", "header": {"event_id": "%s", "event_type": "im.message.receive_v1"},
+		"event": {"message": {"message_id": "om_%s", "message_type": "text", "content": "{\"text\":\"memo\"}"}}}`, id, id)
+}
+
+func TestHandleLarkEventBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		Body     string
+		Code     int
+		Expected []string
+	}{
+		{Body: testLarkEvent("e1"), Code: http.StatusOK, Expected: []string{"e1"}},
+		{
+			Body:     "[" + strings.Join([]string{testLarkEvent("e1"), testLarkEvent("e2"), testLarkEvent("e3")}, ",") + "]",
+			Code:     http.StatusOK,
+			Expected: []string{"e1", "e2", "e3"},
+		},
+		// the invalid events of a batch don't drop the others
+		{
+			Body: `{"schema": "2.0", "events": [` + testLarkEvent("e1") + `, "garbage", {"header": {}}, ` +
+				strings.Replace(testLarkEvent("e2"), `"schema": "2.0", `, "", 1) + `]}`,
+			Code:     http.StatusOK,
+			Expected: []string{"e1", "e2"},
+		},
+		{Body: `["garbage"]`, Code: http.StatusBadRequest},
+		{Body: `not json`, Code: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		app := &fakeLarkApp{}
+		router := gin.New()
+		router.POST("/lark", NewLarkMessageHandler(app, utils.NewLimiter(10, time.Second), true).HandleMessage)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/lark", strings.NewReader(tc.Body)))
+		if w.Code != tc.Code {
+			t.Fatalf("body: %s, expected %d, got %d", tc.Body, tc.Code, w.Code)
+		}
+		if !reflect.DeepEqual(app.events, tc.Expected) {
+			t.Fatalf("body: %s, expected events %v, got %v", tc.Body, tc.Expected, app.events)
+		}
+	}
+}
+
+func TestHandleLarkEventBatchOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// the earlier events take longer
+	app := &fakeLarkApp{delays: map[string]time.Duration{"e1": 30 * time.Millisecond, "e2": 10 * time.Millisecond}}
+	router := gin.New()
+	// one slot, which the batch waits for only once
+	handler := NewLarkMessageHandler(app, utils.NewLimiter(1, time.Millisecond), false)
+	router.POST("/lark", handler.HandleMessage)
+
+	body := "[" + strings.Join([]string{testLarkEvent("e1"), testLarkEvent("e2"), testLarkEvent("e3")}, ",") + "]"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/lark", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the batch acked, got %d", w.Code)
+	}
+
+	if err := handler.Wait(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := app.processed(); !reflect.DeepEqual(got, []string{"e1", "e2", "e3"}) {
+		t.Fatalf("expected the events processed in order, got %v", got)
+	}
+}
+
+func TestHandleLarkImageEventsAfterAck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := &fakeLarkApp{delays: map[string]time.Duration{"e2": 50 * time.Millisecond}}
+	handler := NewLarkMessageHandler(app, utils.NewLimiter(10, time.Second), true)
+	router := gin.New()
+	router.POST("/lark", handler.HandleMessage)
+
+	image := strings.Replace(testLarkEvent("e2"), `"message_type": "text"`, `"message_type": "image"`, 1)
+	body := "[" + testLarkEvent("e1") + "," + image + "]"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/lark", strings.NewReader(body)))
+	// acked before the image is downloaded
+	if got := app.processed(); w.Code != http.StatusOK || len(got) == 2 {
+		t.Fatalf("expected the batch acked before processed, got %d, %v", w.Code, got)
+	}
+
+	if err := handler.Wait(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := app.processed(); !reflect.DeepEqual(got, []string{"e1", "e2"}) {
+		t.Fatalf("expected the events processed in order, got %v", got)
+	}
+}
+
+func TestLarkMessageHandlerWait(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := &fakeLarkApp{delays: map[string]time.Duration{"e1": 50 * time.Millisecond}}
+	handler := NewLarkMessageHandler(app, utils.NewLimiter(10, time.Second), false)
+	router := gin.New()
+	router.POST("/lark", handler.HandleMessage)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/lark", strings.NewReader(testLarkEvent("e1"))))
+	// acked before processed
+	if got := app.processed(); len(got) != 0 {
+		t.Fatalf("unexpected events processed %v", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond)
+	defer cancel()
+	if err := handler.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the wait timed out, got %v", err)
+	}
+	if err := handler.Wait(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if got := app.processed(); !reflect.DeepEqual(got, []string{"e1"}) {
+		t.Fatalf("expected the event processed once waited, got %v", got)
+	}
+}
+
+func TestHandleLarkURLVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := &fakeLarkApp{}
+	router := gin.New()
+	router.POST("/lark", NewLarkMessageHandler(app, utils.NewLimiter(10, time.Second), true).HandleMessage)
+
+	w := httptest.NewRecorder()
+	body := `{"challenge": "ajls384kdjx98XX", "token": "xxxxxx", "type": "url_verification"}`
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/lark", strings.NewReader(body)))
+	if w.Code != http.StatusOK || app.challenge != "ajls384kdjx98XX" || len(app.events) != 0 {
+		t.Fatalf("expected the url verified, got %d, %q, %v", w.Code, app.challenge, app.events)
+	}
+}
@@ -12,15 +12,18 @@ import (
 
 	"github.com/KDF5000/nomo/application"
 	"github.com/KDF5000/nomo/infrastructure/message/wx_message"
+	"github.com/KDF5000/nomo/infrastructure/utils"
 	"github.com/KDF5000/pkg/log"
 )
 
 type wxMessageHandler struct {
 	messageHandleApp *application.WXMessageHandleApp
+	// bounds the messages processed concurrently
+	limiter *utils.Limiter
 }
 
-func NewWXMessageHandler(app *application.WXMessageHandleApp) *wxMessageHandler {
-	return &wxMessageHandler{messageHandleApp: app}
+func NewWXMessageHandler(app *application.WXMessageHandleApp, limiter *utils.Limiter) *wxMessageHandler {
+	return &wxMessageHandler{messageHandleApp: app, limiter: limiter}
 }
 
 func (h *wxMessageHandler) UrlVerification(c *gin.Context) {
@@ -60,9 +63,22 @@ func (h *wxMessageHandler) HandleMessage(c *gin.Context) {
 	}
 	// log.Infof("receive wx message, %+v", message)
 
-	reply, err := h.messageHandleApp.ProcessMessage(c.Request.Context(), &message)
-	if err != nil {
-		reply = "系统发生错误，请稍后重试~"
+	var reply string
+	if h.limiter.Acquire() {
+		reply, err = h.messageHandleApp.ProcessMessage(c.Request.Context(), &message)
+		h.limiter.Release()
+		if err != nil {
+			reply = "系统发生错误，请稍后重试~"
+		}
+	} else {
+		log.Errorf("too many wechat messages in process, drop message from %s", message.FromUserName)
+		reply = "系统繁忙，请稍后重试~"
+	}
+
+	// wechat sends nothing to the user for a plain success
+	if reply == "" {
+		c.String(http.StatusOK, "success")
+		return
 	}
 
 	r := wx_message.WxMessageReply{